@@ -0,0 +1,37 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package cloud
+
+import (
+	"github.com/inconshreveable/log15"
+)
+
+// logger is what the cloud providers and servers log with.
+var logger = log15.New("pkg", "cloud")
+
+func init() {
+	logger.SetHandler(log15.StderrHandler)
+}
+
+// SetLogHandler sets where and how messages about cloud resources are logged,
+// which is to STDERR in logfmt format unless you say otherwise. Servers only
+// log debug messages if created by a Provider with debug mode on.
+func SetLogHandler(h log15.Handler) {
+	logger.SetHandler(h)
+}
@@ -28,7 +28,6 @@ import (
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -79,7 +78,7 @@ type Server struct {
 
 func (s *Server) debug(msg string, a ...interface{}) {
 	if s.debugMode {
-		log.Printf(msg, a...)
+		logger.Debug(strings.TrimSpace(fmt.Sprintf(msg, a...)), "server", s.ID)
 	}
 }
 
@@ -186,14 +185,14 @@ func (s *Server) SSHClient() (*ssh.Client, error) {
 	defer s.mutex.Unlock()
 	if s.sshclient == nil {
 		if s.provider.PrivateKey() == "" {
-			log.Printf("resource file %s did not contain the ssh key\n", s.provider.savePath)
+			logger.Error("resource file did not contain the ssh key", "file", s.provider.savePath)
 			return nil, errors.New("missing ssh key")
 		}
 
 		// parse private key and make config
 		signer, err := ssh.ParsePrivateKey([]byte(s.provider.PrivateKey()))
 		if err != nil {
-			log.Printf("failure to parse the private key: %s\n", err)
+			logger.Error("failed to parse the private key", "server", s.ID, "err", err)
 			return nil, err
 		}
 		sshConfig := &ssh.ClientConfig{
@@ -39,9 +39,16 @@ var cmdDisk int
 var cmdOvr int
 var cmdPri int
 var cmdRet int
+var cmdRetryPolicy string
+var cmdEscalation string
+var cmdTimeLimit float64
+var cmdKillSeq string
+var cmdCheckpoint string
 var cmdFile string
 var cmdCwdMatters bool
 var cmdChangeHome bool
+var cmdCache bool
+var cmdWebhook string
 var cmdRepGroup string
 var cmdDepGroups string
 var cmdCmdDeps string
@@ -70,8 +77,10 @@ alternatively have only a JSON object in column 1 that also specifies the
 command as one of the name:value pairs. The possible options are:
 
 cmd cwd cwd_matters change_home on_failure on_success on_exit mounts req_grp
-memory time override cpus disk priority retries rep_grp dep_grps deps cmd_deps
-cloud_os cloud_username cloud_ram cloud_script env
+memory time override cpus disk priority retries retry_policy escalation
+time_limit kill_sequence checkpoint rep_grp dep_grps deps cmd_deps cloud_os
+cloud_username cloud_ram cloud_script env input_files output_files cache array
+webhook
 
 If any of these will be the same for all your commands, you can instead specify
 them as flags (which are treated as defaults in the case that they are
@@ -154,11 +163,12 @@ specify a unit, eg "100M" for 100 megabytes, or "1G" for 1 gigabyte. "time"
 values should do the same, eg. "30m" for 30 minutes, or "1h" for 1 hour.
 
 The manager learns how much memory and time commands in the same req_grp
-actually used in the past, and will use its own values unless you set an
-override. For this learning to work well, you should have reason to believe that
-all the commands you add with the same req_grp will have similar memory and time
-requirements, and you should pick the name in a consistent way such that you'll
-use it again in the future.
+actually used in the past (and also how many cpu cores they kept busy and, when
+not cwd_matters, how much disk space they used), and will use its own values
+unless you set an override. For this learning to work well, you should have
+reason to believe that all the commands you add with the same req_grp will have
+similar memory and time requirements, and you should pick the name in a
+consistent way such that you'll use it again in the future.
 
 For example, if you want to run an executable called "exop", and you know that
 the memory and time requirements of exop vary with the size of its input file,
@@ -171,21 +181,23 @@ sizes in a certain range, and then provide a req_grp that describes this, eg.
 only learning about how good your estimates are! The name of your executable
 should almost always be part of the req_grp name.)
 
-"override" defines if your memory and time should be used instead of the
-manager's estimate. Possible values are:
-0 = do not override wr's learned values for memory and time (if any)
+"override" defines if your memory, time, cpus and disk should be used instead
+of the manager's estimate. Possible values are:
+0 = do not override wr's learned values for these (if any)
 1 = override if yours are higher
 2 = always override
 
-"cpus" tells wr manager exactly how many CPU cores your command needs.
+"cpus" tells wr manager how many CPU cores your command needs.
 
 "disk" tells wr manager how much free disk space (in GB) your command needs. If
 you know that where your command will store its outputs to will not run out of
 disk space, set this to 0 to avoid unnecessary disk space checks (or possible
-volume creation, in the case of cloud schedulers).
-[disk space reservation and checking is not currently implemented, except for
-the openstack scheduler which will create temporary volumes of the specified
-size if necessary]
+volume creation, in the case of cloud schedulers). When not cwd_matters, the
+disk space used by your command's unique working directory and $TMPDIR is
+checked while it runs, and if it uses more than requested it will be killed and
+retried with a larger disk requirement. (Disk space reservation is otherwise
+not currently implemented, except for the openstack scheduler which will create
+temporary volumes of the specified size if necessary.)
 
 "priority" defines how urgent a particular command is; those with higher
 priorities will start running before those with lower priorities. The range of
@@ -199,6 +211,83 @@ more memory/time reserved). Once this number of retries is reached, the command
 will be 'buried' until you take manual action to fix the problem and press the
 retry button in the web interface.
 
+"retry_policy" refines how failed commands are retried. It is a JSON object
+with any of the name:value pairs "delay" (how long to wait before the first
+retry, eg. "1m"; default "30s"), "multiplier" (what the delay is multiplied by
+after each subsequent failure, for exponential backoff), "max_delay" (the
+longest to ever wait, eg. "1h"), "retry_exit_codes" (an array of the only exit
+codes of your command worth retrying), "bury_exit_codes" (an array of exit codes
+that should never be retried, eg. [2] for usage errors) and "infra_retries" (how
+many times to retry when the command failed due to problems with the machine it
+was running on: losing contact with it, being unable to mount, or wr being
+signalled to stop; if set, these failures then don't count against "retries",
+otherwise they use up "retries" like any other failure). For example:
+{"delay":"1m","multiplier":2,"max_delay":"1h","retry_exit_codes":[137],
+"infra_retries":10}
+
+"escalation" changes how memory and time are increased when your command is
+retried after using too much of them. By default memory is increased to double
+(or 1.3 times, above 8GB) the peak usage, or by at least 1GB, and time is
+increased by 1 hour, without limit. It is a JSON object with any of the
+name:value pairs "ram_multiplier" (what peak memory usage is multiplied by),
+"ram_step" (the minimum increase, eg. "500M"), "max_ram" (never increase beyond
+this, eg. "64G"), "time_multiplier" (what the current time is multiplied by),
+"time_step" (the minimum increase, eg. "30m"), "max_time" (eg. "48h"),
+"use_req_grp_max" (true to increase to at least the most memory or time used by
+any previous command with the same req_grp) and "max_escalations" (the most
+times to increase). If a command fails for using too much memory or time and it
+can't be increased any further, it is buried instead of being retried. 'wr
+status' shows the history of increases. For example: {"ram_multiplier":1.5,
+"max_ram":"32G","max_escalations":3}. Commands without their own escalation
+use the one set for their req_grp with 'wr reqgroup escalation', if any.
+
+"time_limit" is a hard limit on how long your command can run for, as a
+multiple of its time (whether you specified time or wr learned it). Eg. 2 means
+that once your command has run for twice its expected time it is sent a TERM
+signal, and then killed if it's still running 30 seconds later. It then fails
+as having used too much time, and is retried with more time like any other
+command. This stops hung commands from holding on to resources indefinitely.
+The default of 0 uses the manager's default (see the managertimelimit option in
+~/.wr_config.yml); a negative value means never kill your command. Without a
+limit, commands that run over time are allowed to continue.
+
+"kill_sequence" describes how to stop your command gracefully when it reaches
+its time_limit, when you kill it (eg. using the web interface), or when the
+runner running it is signalled to stop (eg. by your job scheduler). It is a
+comma separated list of steps, each a signal name followed by a colon and how
+long to wait for your command to exit before moving on to the next step. Eg.
+"INT:60s,TERM:30s" would send an INT signal, then a TERM signal if your command
+was still running a minute later, and finally kill it 30 seconds after that.
+This gives your command the chance to checkpoint or flush its output. Signals
+are sent to every process your command started (that didn't deliberately detach
+themselves), so each part of a pipeline receives them. Without a kill_sequence,
+commands are killed immediately, except at the time_limit where they get a TERM
+signal first. Commands that use too much memory or disk are always killed
+immediately. Anything your command leaves running in the background is killed
+when it exits.
+
+"checkpoint" lets long running commands that are stopped early (by reaching
+their time_limit, being killed, or the runner being signalled) resume from
+where they left off when they are next run. It is a JSON object with the
+name:value pairs "dir" (the directory your command writes its checkpoints to,
+relative to the actual working directory; required), "cmd" (a command that
+will cause your command to write a checkpoint, run when your command has to be
+stopped) or "signal" (a signal, eg. "USR1", sent to your command for the same
+purpose), "wait" (how long to allow for the checkpoint to be written before
+carrying out the kill_sequence; default "30s"), "interval" (if set, also
+checkpoint this often while your command runs, eg. "1h", so that progress isn't
+lost if the machine running it dies; this requires "cmd", and a checkpoint is
+only saved if "cmd" exits successfully within "wait") and "store" (where to
+keep checkpoints between attempts: a shared directory, a directory within one
+of your mounts, or an s3:// path; by default they are kept in the manager's
+result cache, or left in place if cwd_matters). Your command is run with
+$WR_CHECKPOINT_DIR set to the absolute path of "dir", and when a checkpoint
+from a previous attempt has been restored there, with $WR_RESUME set to 1.
+Checkpoints are deleted once your command succeeds; those in the result cache
+count towards its size limit, so may be evicted before then. For example:
+{"dir":"ckpt","cmd":"kill -USR1 $(cat my.pid) && sleep 10","wait":"2m",
+"interval":"4h"}
+
 "rep_grp" is an arbitrary group you can give your commands so you can query
 their status later. This is only used for reporting and presentation purposes
 when viewing status.
@@ -233,7 +322,48 @@ base variables as they were at the moment in time you run 'wr add', so to set a
 certain environment variable for all commands, you could instead just set it
 prior to calling 'wr add'. In the remote case the command will use base
 variables as they were on the machine where the command is executed when that
-machine was started.`,
+machine was started.
+
+"input_files" and "output_files" are arrays of paths to the files your command
+reads and writes (relative paths are relative to cwd, so are only really useful
+when cwd_matters). If output_files are specified, then at the moment you run
+'wr add', if all output files exist and are newer than all input files, the
+command is considered to be up to date: it won't be run and will instead be
+recorded as complete. Otherwise the command will be run, even if it had been
+previously added and completed (regardless of --rerun). This lets you safely
+re-add all the commands of a workflow and only have those whose outputs are
+missing or out of date run again.
+
+"cache" only has an effect if output_files are specified and the manager has
+been configured with a result cache (see the managercachedir option in
+~/.wr_config.yml). If enabled, after your command runs successfully its output
+files are copied in to the cache, keyed on the command line and the contents of
+its input_files. Any future command with the same key will have its output
+files copied out of the cache instead of actually being run. Only use this for
+commands that always produce the same output given the same input and don't
+have other side effects. 'wr status' tells you if there was a cache hit.
+
+"webhook" is a URL that will be POSTed a JSON description of your command when
+it gets buried or completes, and of its reporting group when all the commands
+in that group have completed. If the manager was configured with a
+managerhookkey, the POSTs have an X-Wr-Signature header containing
+"sha256=" followed by the hex encoded HMAC-SHA256 of the body. Past deliveries
+can be seen at /rest/v1/webhooks/.
+
+"array" turns a single line of your file in to many near-identical commands,
+eg. for a parameter sweep. Specify either an inclusive range of integers like
+{"start":1,"end":1000}, or a list of values like {"values":["a","b","c"]}. Your
+command (and any input_files and output_files) must then contain {{index}}
+and/or {{value}}, which will be replaced with each integer of the range, or
+each value of the list and its position in the list (counting from 0),
+respectively. Eg. {"cmd":"sim --seed {{index}} > {{index}}.out","array":
+{"start":1,"end":100000}} results in 100000 commands. These are only queued as
+earlier ones start running, so you can add enormous arrays cheaply (unless
+dep_grps is set, since then other commands may depend on all of them existing).
+'wr status' summarises the state of all the commands of each array, and each
+one can otherwise be treated like a normal command; removing or killing one
+doesn't affect the others. To stop the rest of an array being queued, POST to
+/rest/v1/jobs/[array id]/cancel.`,
 	Run: func(combraCmd *cobra.Command, args []string) {
 		// check the command line options
 		if cmdFile == "" {
@@ -245,11 +375,14 @@ machine was started.`,
 			ReqGrp:      reqGroup,
 			CwdMatters:  cmdCwdMatters,
 			ChangeHome:  cmdChangeHome,
+			Cache:       cmdCache,
+			Webhook:     cmdWebhook,
 			CPUs:        cmdCPUs,
 			Disk:        cmdDisk,
 			Override:    cmdOvr,
 			Priority:    cmdPri,
 			Retries:     cmdRet,
+			TimeLimit:   cmdTimeLimit,
 			Env:         cmdEnv,
 			CloudOS:     cmdOsPrefix,
 			CloudUser:   cmdOsUsername,
@@ -261,6 +394,10 @@ machine was started.`,
 			jd.RepGrp = "manually_added"
 		}
 		var err error
+		jd.KillSequence, err = jobqueue.ParseKillSequence(cmdKillSeq)
+		if err != nil {
+			die("--kill_sequence was not specified correctly: %s", err)
+		}
 		if cmdMem == "" {
 			jd.Memory = 0
 		} else {
@@ -302,6 +439,39 @@ machine was started.`,
 			}
 			jd.OnFailure = bjs.Behaviours(jobqueue.OnFailure)
 		}
+		if cmdEscalation != "" {
+			var epj jobqueue.EscalationPolicyViaJSON
+			err = json.Unmarshal([]byte(cmdEscalation), &epj)
+			if err != nil {
+				die("bad --escalation: %s", err)
+			}
+			jd.EscalationPolicy, err = epj.EscalationPolicy()
+			if err != nil {
+				die("bad --escalation: %s", err)
+			}
+		}
+		if cmdCheckpoint != "" {
+			var cpj jobqueue.CheckpointViaJSON
+			err = json.Unmarshal([]byte(cmdCheckpoint), &cpj)
+			if err != nil {
+				die("bad --checkpoint: %s", err)
+			}
+			jd.Checkpoint, err = cpj.Checkpoint()
+			if err != nil {
+				die("bad --checkpoint: %s", err)
+			}
+		}
+		if cmdRetryPolicy != "" {
+			var rpj jobqueue.RetryPolicyViaJSON
+			err = json.Unmarshal([]byte(cmdRetryPolicy), &rpj)
+			if err != nil {
+				die("bad --retry_policy: %s", err)
+			}
+			jd.RetryPolicy, err = rpj.RetryPolicy()
+			if err != nil {
+				die("bad --retry_policy: %s", err)
+			}
+		}
 		if cmdOnSuccess != "" {
 			var bjs jobqueue.BehavioursViaJSON
 			err = json.Unmarshal([]byte(cmdOnSuccess), &bjs)
@@ -335,31 +505,8 @@ machine was started.`,
 			defer reader.(*os.File).Close()
 		}
 
-		// we'll default to pwd if the manager is on the same host as us, /tmp
-		// otherwise
 		timeout := time.Duration(timeoutint) * time.Second
-		jq, err := jobqueue.Connect(addr, "cmds", timeout)
-		if err != nil {
-			die("%s", err)
-		}
-		sstats, err := jq.ServerStats()
-		if err != nil {
-			die("even though I was able to connect to the manager, it failed to tell me its location")
-		}
-		var pwd string
-		var remoteWarning bool
-		var envVars []string
-		if jobqueue.CurrentIP("")+":"+config.ManagerPort == sstats.ServerInfo.Addr {
-			pwd, err = os.Getwd()
-			if err != nil {
-				die("%s", err)
-			}
-			envVars = os.Environ()
-		} else {
-			pwd = "/tmp"
-			remoteWarning = true
-		}
-		jq.Disconnect()
+		pwd, remoteWarning, envVars := addLocality(timeout)
 
 		// for network efficiency, read in all commands and create a big slice
 		// of Jobs and Add() them in one go afterwards
@@ -418,7 +565,7 @@ machine was started.`,
 		}
 
 		// connect to the server
-		jq, err = jobqueue.Connect(addr, "cmds", timeout)
+		jq, err := jobqueue.Connect(addr, "cmds", timeout)
 		if err != nil {
 			die("%s", err)
 		}
@@ -435,6 +582,7 @@ machine was started.`,
 		} else {
 			info("Added %d new commands (%d were duplicates) to the queue", inserts, dups)
 		}
+		reportUpToDate(jobs)
 	},
 }
 
@@ -448,6 +596,8 @@ func init() {
 	addCmd.Flags().StringVarP(&cmdCwd, "cwd", "c", "", "base for the command's working dir")
 	addCmd.Flags().BoolVar(&cmdCwdMatters, "cwd_matters", false, "--cwd should be used as the actual working directory")
 	addCmd.Flags().BoolVar(&cmdChangeHome, "change_home", false, "when not --cwd_matters, set $HOME to the actual working directory")
+	addCmd.Flags().BoolVar(&cmdCache, "cache", false, "restore output_files from the manager's result cache instead of running identical commands")
+	addCmd.Flags().StringVar(&cmdWebhook, "webhook", "", "URL to POST to when commands are buried or complete")
 	addCmd.Flags().StringVarP(&reqGroup, "req_grp", "g", "", "group name for commands with similar reqs")
 	addCmd.Flags().StringVarP(&cmdMem, "memory", "m", "1G", "peak mem est. [specify units such as M for Megabytes or G for Gigabytes]")
 	addCmd.Flags().StringVarP(&cmdTime, "time", "t", "1h", "max time est. [specify units such as m for minutes or h for hours]")
@@ -456,6 +606,11 @@ func init() {
 	addCmd.Flags().IntVarP(&cmdOvr, "override", "o", 0, "[0|1|2] should your mem/time estimates override? (default 0)")
 	addCmd.Flags().IntVarP(&cmdPri, "priority", "p", 0, "[0-255] command priority (default 0)")
 	addCmd.Flags().IntVarP(&cmdRet, "retries", "r", 3, "[0-255] number of automatic retries for failed commands")
+	addCmd.Flags().StringVar(&cmdRetryPolicy, "retry_policy", "", "backoff and exit code based retry policy for failed commands, in JSON format")
+	addCmd.Flags().StringVar(&cmdEscalation, "escalation", "", "how to increase memory and time of commands that use too much, in JSON format")
+	addCmd.Flags().Float64Var(&cmdTimeLimit, "time_limit", 0, "kill commands that run for this multiple of their expected time [0 means use the manager's default; -1 means never]")
+	addCmd.Flags().StringVar(&cmdKillSeq, "kill_sequence", "", "how to stop commands gracefully, eg. INT:60s,TERM:30s")
+	addCmd.Flags().StringVar(&cmdCheckpoint, "checkpoint", "", "how commands can checkpoint and resume, in JSON format")
 	addCmd.Flags().StringVar(&cmdCmdDeps, "cmd_deps", "", "dependencies of your commands, in the form \"command1,cwd1,command2,cwd2...\"")
 	addCmd.Flags().StringVarP(&cmdGroupDeps, "deps", "d", "", "dependencies of your commands, in the form \"dep_grp1,dep_grp2...\"")
 	addCmd.Flags().StringVar(&cmdOnFailure, "on_failure", "", "behaviours to carry out when cmds fails, in JSON format")
@@ -473,6 +628,47 @@ func init() {
 	addCmd.Flags().IntVar(&timeoutint, "timeout", 30, "how long (seconds) to wait to get a reply from 'wr manager'")
 }
 
+// addLocality connects to the manager to find out if it is running on the same
+// host as us. If so, returns our current directory as the default cwd for
+// added commands, along with our environment variables. Otherwise the default
+// cwd is /tmp and remoteWarning is true.
+func addLocality(timeout time.Duration) (pwd string, remoteWarning bool, envVars []string) {
+	jq, err := jobqueue.Connect(addr, "cmds", timeout)
+	if err != nil {
+		die("%s", err)
+	}
+	defer jq.Disconnect()
+	sstats, err := jq.ServerStats()
+	if err != nil {
+		die("even though I was able to connect to the manager, it failed to tell me its location")
+	}
+	if jobqueue.CurrentIP("")+":"+config.ManagerPort == sstats.ServerInfo.Addr {
+		pwd, err = os.Getwd()
+		if err != nil {
+			die("%s", err)
+		}
+		envVars = os.Environ()
+	} else {
+		pwd = "/tmp"
+		remoteWarning = true
+	}
+	return
+}
+
+// reportUpToDate tells the user how many of the jobs they just added were not
+// going to be run because their outputs were up to date.
+func reportUpToDate(jobs []*jobqueue.Job) {
+	upToDate := 0
+	for _, job := range jobs {
+		if job.Freshness == jobqueue.FreshnessUpToDate {
+			upToDate++
+		}
+	}
+	if upToDate > 0 {
+		info("%d of the duplicates were commands with up-to-date output files, recorded as complete without running", upToDate)
+	}
+}
+
 // convert cmd,cwd columns in to Dependency.
 func colsToDeps(cols []string) (deps jobqueue.Dependencies) {
 	for i := 0; i < len(cols); i += 2 {
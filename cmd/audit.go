@@ -0,0 +1,140 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/VertebrateResequencing/wr/jobqueue"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+// options for this cmd
+var auditFrom string
+var auditTo string
+var auditUser string
+var auditLimit int
+var auditKeys bool
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "See who did what",
+	Long: `See the audit trail of who did what to which commands.
+
+The manager records who added, retried (kicked), removed (deleted), killed or
+modified commands, and who drained, shut down or backed up the manager, along
+with when they did it and the host they did it from.
+
+The user and host of actions taken with wr's command line tools are what those
+tools claimed, so are shown along with the network address the request really
+came from, in square brackets. Actions taken via the web interface or REST API
+are always recorded as being done by the user who started the manager,
+whoever actually took them; only their address tells them apart.
+
+Entries are shown oldest first. By default the most recent 100 are shown; use
+--limit 0 to see all of them, subject to --from, --to and --user.
+
+--from and --to take either a time like 2018-06-01T15:04:05Z (RFC 3339) or a
+duration like 24h, meaning that long ago.
+
+Entries are kept for managerauditdays days, as set in your config file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := &jobqueue.AuditFilter{User: auditUser, Limit: auditLimit}
+		var err error
+		if filter.From, err = pastTime(auditFrom); err != nil {
+			die("bad --from: %s", err)
+		}
+		if filter.To, err = pastTime(auditTo); err != nil {
+			die("bad --to: %s", err)
+		}
+
+		jq, err := jobqueue.Connect(addr, "cmds", time.Duration(timeoutint)*time.Second)
+		if err != nil {
+			die("%s", err)
+		}
+		defer jq.Disconnect()
+
+		entries, err := jq.GetAudit(filter)
+		if err != nil {
+			die("failed to get the audit trail: %s", err)
+		}
+		if len(entries) == 0 {
+			info("no audit entries matched")
+			return
+		}
+		for _, entry := range entries {
+			printAuditEntry(entry)
+		}
+	},
+}
+
+// pastTime parses a time option value, which can be blank, an RFC 3339 time or
+// a duration before now.
+func pastTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// printAuditEntry displays an AuditEntry.
+func printAuditEntry(entry *jobqueue.AuditEntry) {
+	what := entry.Action
+	if entry.Queue != "" {
+		what += fmt.Sprintf(" in queue %s", entry.Queue)
+	}
+	var details []string
+	if entry.Detail != "" {
+		details = append(details, entry.Detail)
+	}
+	if len(entry.Keys) > 0 && !auditKeys {
+		details = append(details, fmt.Sprintf("%d job keys", len(entry.Keys)))
+	}
+	detail := ""
+	if len(details) > 0 {
+		detail = " (" + strings.Join(details, "; ") + ")"
+	}
+	who := entry.User + "@" + entry.Host
+	if entry.Peer != "" {
+		who += " [" + entry.Peer + "]"
+	}
+	fmt.Printf("%s %s %s%s\n", entry.Time.Format(time.RFC3339), who, what, detail)
+	if auditKeys {
+		for _, key := range entry.Keys {
+			fmt.Printf("  %s\n", key)
+		}
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(auditCmd)
+
+	// flags specific to this sub-command
+	auditCmd.Flags().StringVarP(&auditFrom, "from", "f", "", "only show entries made at or after this time")
+	auditCmd.Flags().StringVarP(&auditTo, "to", "t", "", "only show entries made at or before this time")
+	auditCmd.Flags().StringVarP(&auditUser, "user", "u", "", "only show entries made by this user")
+	auditCmd.Flags().IntVarP(&auditLimit, "limit", "l", 100, "only show this many of the most recent matching entries")
+	auditCmd.Flags().BoolVarP(&auditKeys, "keys", "k", false, "list the keys of the affected commands")
+	auditCmd.Flags().IntVar(&timeoutint, "timeout", 30, "how long (seconds) to wait to get a reply from 'wr manager'")
+}
@@ -20,14 +20,15 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/VertebrateResequencing/wr/cloud"
 	"github.com/VertebrateResequencing/wr/internal"
 	"github.com/VertebrateResequencing/wr/jobqueue"
 	jqs "github.com/VertebrateResequencing/wr/jobqueue/scheduler"
+	"github.com/inconshreveable/log15"
 	"github.com/kardianos/osext"
 	"github.com/sevlyar/go-daemon"
 	"github.com/spf13/cobra"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -277,7 +278,11 @@ down will be lost.`,
 var managerStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Get status of the workflow manager",
-	Long:  `Find out if the workflow manager is currently running or not.`,
+	Long: `Find out if the workflow manager is currently running or not.
+
+If it is running and quotas have been configured (see the manageruserquota and
+managerrepquota config options), also shows how much of their quota each user
+and identifier is currently using.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// see if pid file suggests it is supposed to be running
 		pid, err := daemon.ReadPidFile(config.ManagerPidFile)
@@ -345,6 +350,19 @@ func reportLiveStatus(jq *jobqueue.Client) {
 	}
 	mode := sstats.ServerInfo.Mode
 	fmt.Println(mode)
+
+	// show how much of their quotas users and identifiers are using
+	for _, qu := range sstats.Quotas {
+		fmt.Printf("%s %s: jobs %s; cores %s; memory %s\n", qu.Kind, qu.Name, quotaPart(qu.Usage.Jobs, qu.Quota.Jobs, ""), quotaPart(qu.Usage.Cores, qu.Quota.Cores, ""), quotaPart(qu.Usage.RAM, qu.Quota.RAM, "MB"))
+	}
+}
+
+// quotaPart formats one part of a quota usage report as used/limit.
+func quotaPart(used, limit int, unit string) string {
+	if limit <= 0 {
+		return fmt.Sprintf("%d%s/unlimited", used, unit)
+	}
+	return fmt.Sprintf("%d/%d%s", used, limit, unit)
 }
 
 func init() {
@@ -384,14 +402,50 @@ func logStarted(s *jobqueue.ServerInfo) {
 
 func startJQ(sayStarted bool, postCreation []byte) {
 	runtime.GOMAXPROCS(runtime.NumCPU())
+	mlog := log15.New("pkg", "manager")
 
 	// we will spawn runners, which means we need to know the path to ourselves
 	// in case we're not in the user's $PATH
 	exe, err := osext.Executable()
 	if err != nil {
-		log.Printf("wr manager failed to start : %s\n", err)
+		mlog.Crit("wr manager failed to start", "err", err)
+		os.Exit(1)
+	}
+
+	shareWeights, err := jobqueue.ParseShareWeights(config.ManagerShares)
+	if err != nil {
+		mlog.Crit("wr manager failed to start", "option", "managershares", "err", err)
+		os.Exit(1)
+	}
+	userQuotas, err := jobqueue.ParseQuotas(config.ManagerUserQuota)
+	if err != nil {
+		mlog.Crit("wr manager failed to start", "option", "manageruserquota", "err", err)
+		os.Exit(1)
+	}
+	repGroupQuotas, err := jobqueue.ParseQuotas(config.ManagerRepQuota)
+	if err != nil {
+		mlog.Crit("wr manager failed to start", "option", "managerrepquota", "err", err)
+		os.Exit(1)
+	}
+	webhooks, err := jobqueue.ParseWebhooks(config.ManagerWebhooks)
+	if err != nil {
+		mlog.Crit("wr manager failed to start", "option", "managerwebhooks", "err", err)
 		os.Exit(1)
 	}
+	var email *jobqueue.EmailConfig
+	if config.ManagerSMTP != "" {
+		email = &jobqueue.EmailConfig{
+			SMTP:       config.ManagerSMTP,
+			Username:   config.ManagerSMTPUser,
+			Password:   config.ManagerSMTPPass,
+			From:       config.ManagerMailFrom,
+			UserDomain: config.ManagerUserMail,
+			Interval:   time.Duration(config.ManagerMailMins) * time.Minute,
+		}
+		if config.ManagerMailTo != "" {
+			email.Admins = strings.Split(config.ManagerMailTo, ",")
+		}
+	}
 
 	var schedulerConfig interface{}
 	serverCIDR := ""
@@ -437,35 +491,69 @@ func startJQ(sayStarted bool, postCreation []byte) {
 		DBFileBackup:    config.ManagerDbBkFile,
 		Deployment:      config.Deployment,
 		CIDR:            serverCIDR,
+		CacheDir:        config.ManagerCacheDir,
+		CacheMaxMB:      config.ManagerCacheSize,
+		TimeLimit:       config.ManagerTimeLimit,
+		FairShare:       config.ManagerFairShare,
+		ShareWeights:    shareWeights,
+		PriorityAging:   time.Duration(config.ManagerAging) * time.Second,
+		UserQuotas:      userQuotas,
+		RepGroupQuotas:  repGroupQuotas,
+		Webhooks:        webhooks,
+		WebhookSecret:   config.ManagerHookKey,
+		Email:           email,
+		AuditRetention:  time.Duration(config.ManagerAuditDays) * 24 * time.Hour,
+		Recommendations: &jobqueue.RecommendationConfig{
+			Percentile: float64(config.ManagerRecPct),
+			MBRound:    config.ManagerRecMB,
+			SecRound:   config.ManagerRecSec,
+			WindowRuns: config.ManagerRecRuns,
+			WindowDays: config.ManagerRecDays,
+		},
 	})
 
 	if sayStarted && err == nil {
 		logStarted(server.ServerInfo)
 	}
 
-	// start logging to configured file
+	// start logging JSON to configured file, at the configured level
+	lvl, errlvl := log15.LvlFromString(config.ManagerLogLevel)
+	if errlvl != nil {
+		warn("managerloglevel %s is invalid, will log at the info level", config.ManagerLogLevel)
+		lvl = log15.LvlInfo
+	}
+	if cloudDebug {
+		lvl = log15.LvlDebug
+	}
+	var lh log15.Handler
 	logfile, errlog := os.OpenFile(config.ManagerLogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if errlog != nil {
 		warn("could not log to %s, will log to STDOUT: %v", config.ManagerLogFile, errlog)
+		lh = log15.StreamHandler(os.Stdout, log15.JsonFormat())
 	} else {
 		defer logfile.Close()
-		log.SetOutput(logfile)
+		lh = log15.StreamHandler(logfile, log15.JsonFormat())
 	}
+	lh = log15.LvlFilterHandler(lvl, lh)
+	mlog.SetHandler(lh)
+	jobqueue.SetLogHandler(lh)
+	jqs.SetLogHandler(lh)
+	cloud.SetLogHandler(lh)
 
 	// log to file failure to Serve
 	if err != nil {
 		if msg != "" {
-			log.Printf("wr manager : %s\n", msg)
+			mlog.Warn(msg)
 		}
-		log.Printf("wr manager failed to start : %s\n", err)
+		mlog.Crit("wr manager failed to start", "err", err)
 		os.Exit(1)
 	}
 
 	// log to file that we started
 	addr := sAddr(server.ServerInfo)
-	log.Printf("wr manager started on %s\n", addr)
+	mlog.Info("wr manager started", "addr", addr)
 	if msg != "" {
-		log.Printf("wr manager : %s\n", msg)
+		mlog.Warn(msg)
 	}
 
 	// block forever while the jobqueue does its work
@@ -474,13 +562,13 @@ func startJQ(sayStarted bool, postCreation []byte) {
 		jqerr, ok := err.(jobqueue.Error)
 		switch {
 		case ok && jqerr.Err == jobqueue.ErrClosedTerm:
-			log.Printf("wr manager on %s gracefully stopped (received SIGTERM)\n", addr)
+			mlog.Info("wr manager gracefully stopped", "addr", addr, "reason", "received SIGTERM")
 		case ok && jqerr.Err == jobqueue.ErrClosedInt:
-			log.Printf("wr manager on %s gracefully stopped (received SIGINT)\n", addr)
+			mlog.Info("wr manager gracefully stopped", "addr", addr, "reason", "received SIGINT")
 		case ok && jqerr.Err == jobqueue.ErrClosedStop:
-			log.Printf("wr manager on %s gracefully stopped (following a drain)\n", addr)
+			mlog.Info("wr manager gracefully stopped", "addr", addr, "reason", "drained")
 		default:
-			log.Printf("wr manager on %s exited unexpectedly: %s\n", addr, err)
+			mlog.Crit("wr manager exited unexpectedly", "addr", addr, "err", err)
 		}
 	}
 }
@@ -0,0 +1,251 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/VertebrateResequencing/wr/jobqueue"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+// options for this cmd
+var reqGroupName string
+var reqGroupPercentile float64
+var reqGroupMBRound int
+var reqGroupSecRound int
+var reqGroupWindowRuns int
+var reqGroupWindowDays int
+var reqGroupDefaults bool
+var reqGroupEscalation string
+
+// reqGroupCmd represents the reqgroup command
+var reqGroupCmd = &cobra.Command{
+	Use:   "reqgroup",
+	Short: "Inspect and manage learned resource usage",
+	Long: `Inspect and manage the resource usage wr has learned.
+
+When commands complete, wr remembers how much memory, time, cores and disk they
+used against their req_grp (see 'wr add -h'), and recommends those resources
+for future commands in the same req_grp.
+
+By default the 95th percentile of all past runs is recommended, but the manager
+can be configured to use a different percentile and to only consider recent
+runs (see the managerrec* options in your config file). The reqgroup
+sub-commands let you see what has been learned, override that configuration for
+particular req_grps, set how their resources escalate after failures, and
+forget what was learned (eg. after your software
+changes and uses very different resources).`,
+}
+
+// show sub-command displays learned values
+var reqGroupShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show learned resource usage",
+	Long: `Show the resources that will be recommended for commands in each req_grp.
+
+Without -g, all req_grps that wr has learned about are shown.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		jq := reqGroupConnect()
+		defer jq.Disconnect()
+
+		stats, err := jq.GetReqGroupStats(reqGroupName)
+		if err != nil {
+			die("failed to get req_grp stats: %s", err)
+		}
+		if len(stats) == 0 {
+			info("wr has not learned about any req_grps yet")
+			return
+		}
+		for _, stat := range stats {
+			printReqGroupStats(stat)
+		}
+	},
+}
+
+// reset sub-command forgets learned values
+var reqGroupResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Forget learned resource usage",
+	Long: `Forget the resource usage wr has learned for a req_grp.
+
+Until new commands in the req_grp complete, only the resources specified when
+commands are added will be used. Any custom configuration of the req_grp is
+kept.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if reqGroupName == "" {
+			die("--req_grp is required")
+		}
+		jq := reqGroupConnect()
+		defer jq.Disconnect()
+
+		err := jq.ResetReqGroup(reqGroupName)
+		if err != nil {
+			die("failed to reset req_grp %s: %s", reqGroupName, err)
+		}
+		info("forgot the learned resource usage of req_grp %s", reqGroupName)
+	},
+}
+
+// config sub-command overrides recommendation settings
+var reqGroupConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configure recommendations for a req_grp",
+	Long: `Configure how resources are recommended for a req_grp.
+
+Any options you don't supply (or set to 0) will use the manager's defaults. Use
+--defaults to remove all custom configuration for the req_grp.
+
+Changing --window_runs or --window_days will cause runs that fall outside of
+the new window to be forgotten the next time the manager prunes its stats.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if reqGroupName == "" {
+			die("--req_grp is required")
+		}
+		if reqGroupPercentile < 0 || reqGroupPercentile > 100 {
+			die("--percentile must be between 0 and 100")
+		}
+
+		var conf *jobqueue.RecommendationConfig
+		if !reqGroupDefaults {
+			conf = &jobqueue.RecommendationConfig{
+				Percentile: reqGroupPercentile,
+				MBRound:    reqGroupMBRound,
+				SecRound:   reqGroupSecRound,
+				WindowRuns: reqGroupWindowRuns,
+				WindowDays: reqGroupWindowDays,
+			}
+		}
+
+		jq := reqGroupConnect()
+		defer jq.Disconnect()
+
+		stat, err := jq.SetReqGroupConfig(reqGroupName, conf)
+		if err != nil {
+			die("failed to configure req_grp %s: %s", reqGroupName, err)
+		}
+		if stat != nil {
+			printReqGroupStats(stat)
+		}
+	},
+}
+
+// escalation sub-command sets a req_grp's escalation policy
+var reqGroupEscalationCmd = &cobra.Command{
+	Use:   "escalation",
+	Short: "Set the escalation policy of a req_grp",
+	Long: `Set how memory and time are increased for commands in a req_grp.
+
+When a command fails for using too much memory or time, its requirements are
+increased according to its escalation (see 'wr add -h'). Commands that were
+added without their own escalation will instead use the one you set here,
+including commands already added. The --escalation value is a JSON object in
+the same form as for 'wr add', eg. {"ram_multiplier":1.5,"max_ram":"32G"}.
+
+Use --defaults to remove the req_grp's escalation, reverting to the default
+behaviour.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if reqGroupName == "" {
+			die("--req_grp is required")
+		}
+
+		var policy *jobqueue.EscalationPolicy
+		if !reqGroupDefaults {
+			if reqGroupEscalation == "" {
+				die("--escalation or --defaults is required")
+			}
+			var epj jobqueue.EscalationPolicyViaJSON
+			err := json.Unmarshal([]byte(reqGroupEscalation), &epj)
+			if err != nil {
+				die("bad --escalation: %s", err)
+			}
+			policy, err = epj.EscalationPolicy()
+			if err != nil {
+				die("bad --escalation: %s", err)
+			}
+		}
+
+		jq := reqGroupConnect()
+		defer jq.Disconnect()
+
+		err := jq.SetReqGroupEscalationPolicy(reqGroupName, policy)
+		if err != nil {
+			die("failed to set the escalation of req_grp %s: %s", reqGroupName, err)
+		}
+		if policy == nil {
+			info("req_grp %s now uses the default escalation", reqGroupName)
+		} else {
+			info("set the escalation of req_grp %s", reqGroupName)
+		}
+	},
+}
+
+// reqGroupConnect connects to the manager or dies.
+func reqGroupConnect() *jobqueue.Client {
+	jq, err := jobqueue.Connect(addr, "cmds", time.Duration(timeoutint)*time.Second)
+	if err != nil {
+		die("%s", err)
+	}
+	return jq
+}
+
+// printReqGroupStats displays a ReqGroupStats.
+func printReqGroupStats(stat *jobqueue.ReqGroupStats) {
+	custom := ""
+	if stat.Custom {
+		custom = " (custom)"
+	}
+	fmt.Printf("\n# %s\nConfig: %s%s\nRuns considered: %d\n", stat.ReqGroup, stat.Config, custom, stat.Runs)
+	if stat.EscalationPolicy != nil {
+		fmt.Printf("Escalation: %+v\n", *stat.EscalationPolicy)
+	}
+	if stat.Runs > 0 {
+		fmt.Printf("Recommended: memory %dMB; time %s; cores %d; disk %dGB\n", stat.RAM, stat.Time, stat.Cores, stat.Disk)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(reqGroupCmd)
+	reqGroupCmd.AddCommand(reqGroupShowCmd)
+	reqGroupCmd.AddCommand(reqGroupResetCmd)
+	reqGroupCmd.AddCommand(reqGroupConfigCmd)
+	reqGroupCmd.AddCommand(reqGroupEscalationCmd)
+
+	// flags specific to these sub-commands
+	reqGroupShowCmd.Flags().StringVarP(&reqGroupName, "req_grp", "g", "", "req_grp to show (default all)")
+	reqGroupShowCmd.Flags().IntVar(&timeoutint, "timeout", 30, "how long (seconds) to wait to get a reply from 'wr manager'")
+
+	reqGroupResetCmd.Flags().StringVarP(&reqGroupName, "req_grp", "g", "", "req_grp to forget")
+	reqGroupResetCmd.Flags().IntVar(&timeoutint, "timeout", 30, "how long (seconds) to wait to get a reply from 'wr manager'")
+
+	reqGroupConfigCmd.Flags().StringVarP(&reqGroupName, "req_grp", "g", "", "req_grp to configure")
+	reqGroupConfigCmd.Flags().Float64VarP(&reqGroupPercentile, "percentile", "p", 0, "percentile of past usage to recommend")
+	reqGroupConfigCmd.Flags().IntVar(&reqGroupMBRound, "mb_round", 0, "round recommended memory up to a multiple of this many MB")
+	reqGroupConfigCmd.Flags().IntVar(&reqGroupSecRound, "sec_round", 0, "round recommended time up to a multiple of this many seconds")
+	reqGroupConfigCmd.Flags().IntVar(&reqGroupWindowRuns, "window_runs", 0, "only consider this many of the most recent runs")
+	reqGroupConfigCmd.Flags().IntVar(&reqGroupWindowDays, "window_days", 0, "only consider runs that ended within this many days")
+	reqGroupConfigCmd.Flags().BoolVar(&reqGroupDefaults, "defaults", false, "remove custom configuration, reverting to the manager's defaults")
+	reqGroupConfigCmd.Flags().IntVar(&timeoutint, "timeout", 30, "how long (seconds) to wait to get a reply from 'wr manager'")
+
+	reqGroupEscalationCmd.Flags().StringVarP(&reqGroupName, "req_grp", "g", "", "req_grp to set the escalation of")
+	reqGroupEscalationCmd.Flags().StringVar(&reqGroupEscalation, "escalation", "", "how to increase memory and time of commands that use too much, in JSON format")
+	reqGroupEscalationCmd.Flags().BoolVar(&reqGroupDefaults, "defaults", false, "remove the escalation, reverting to the default behaviour")
+	reqGroupEscalationCmd.Flags().IntVar(&timeoutint, "timeout", 30, "how long (seconds) to wait to get a reply from 'wr manager'")
+}
@@ -56,12 +56,8 @@ $ wr manager start
 Then you either directly add commands you want to run to the queue:
 $ wr add
 
-Or you define a workflow that works out the commands for you:
-Create a workflow with:                           $ wr create
-Define a datasource with:                         $ wr datasource
-Set up an instance of workflow + datasource with: $ wr setup
-[create, datasource and setup commands are not yet implemented; just use add for
-now]
+Or you define a workflow in a YAML file that works out the commands for you:
+$ wr workflow run -f workflow.yml
 
 At this point your commands should be running, and you can monitor their
 progress with:
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"github.com/VertebrateResequencing/wr/internal"
 	"github.com/VertebrateResequencing/wr/jobqueue"
+	"github.com/inconshreveable/log15"
 	"github.com/kardianos/osext"
 	"github.com/spf13/cobra"
 	"os"
@@ -41,7 +42,7 @@ var maxtime int
 var runnerCmd = &cobra.Command{
 	Use:   "runner",
 	Short: "Run queued commands",
-	Long: `A runner runs commands that were queued by the add or setup commands.
+	Long: `A runner runs commands that were queued by the add or workflow commands.
 
 You won't normally run this yourself directly - "wr manager" spawns these as
 needed.
@@ -73,6 +74,14 @@ complete.`,
 		}
 		defer jq.Disconnect()
 
+		// problems and our reason for exiting are also sent to the manager, so
+		// that its log explains what all its runners did
+		serverLog := func(lvl log15.Lvl, msg string, ctx ...interface{}) {
+			if lerr := jq.ServerLog(lvl, msg, ctx...); lerr != nil {
+				warn("failed to send a log message to the manager: %s", lerr)
+			}
+		}
+
 		// in case any job we execute has a Cmd that calls `wr add`, we alter
 		// the environment to make that call work
 		if rserver != "" {
@@ -113,7 +122,8 @@ complete.`,
 			}
 
 			if err != nil {
-				die("%s", err) //*** we want this in a central log so we can know if/why our runners are failing
+				serverLog(log15.LvlError, "runner failed to reserve a command", "queue", queuename, "scheduler_group", schedgrp, "err", err)
+				die("%s", err)
 			}
 			if job == nil {
 				break
@@ -130,6 +140,7 @@ complete.`,
 			err = jq.Execute(job, config.RunnerExecShell)
 			if err != nil {
 				warn("%s", err)
+				serverLog(log15.LvlWarn, "command failed", "cmd", job.Cmd, "rep_grp", job.RepGroup, "err", err)
 				if jqerr, ok := err.(jobqueue.Error); ok && jqerr.Err == jobqueue.FailReasonSignal {
 					exitReason = "we received a signal to stop"
 					break
@@ -142,6 +153,7 @@ complete.`,
 		}
 
 		info("wr runner exiting, having run %d commands, because %s", numrun, exitReason)
+		serverLog(log15.LvlInfo, "runner exiting", "queue", queuename, "scheduler_group", schedgrp, "commands_run", numrun, "reason", exitReason)
 	},
 }
 
@@ -40,13 +40,21 @@ var showStd bool
 var showEnv bool
 var quietMode bool
 var statusLimit int
+var searchSince string
+var searchUntil string
+var searchExitcode int
+var searchFailReason string
+var searchHost string
+var searchReqGrp string
+var searchUser string
+var searchGrep string
 
 // statusCmd represents the status command
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Get status of commands",
 	Long: `You can find the status of commands you've previously added using
-"wr add" or "wr setup" by running this command.
+"wr add" or "wr workflow run" by running this command.
 
 Specify one of the flags -f, -l  or -i to choose which commands you want the
 status of. If none are supplied, it gives you an overview of all your currently
@@ -66,7 +74,19 @@ grouped together and only a random 1 of them is displayed (and you are told how
 many were skipped). --limit changes how many commands in each of these groups
 are displayed. A limit of 0 turns off grouping and shows all your desired
 commands individually, but you could hit a timeout if retrieving the details of
-very many (tens of thousands+) commands.`,
+very many (tens of thousands+) commands.
+
+Array commands (see the "array" option of 'wr add') are summarised first, with
+counts of their elements in each state, including those that have not yet been
+queued.
+
+Instead of -f, -l or -i, you can search the history of all commands that have
+run (whether they then completed or not) using any combination of --since,
+--until, --exitcode, --fail_reason, --host, --req_grp, --user and --grep. The
+matching commands are displayed in the order they last finished running, grouped
+according to --limit as above. --since and --until take an RFC 3339 time like
+2018-06-01T12:00:00Z, or a duration before now like 24h. --grep takes a regular
+expression that the command lines must match.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		set := 0
 		if cmdFileStatus != "" {
@@ -81,6 +101,10 @@ very many (tens of thousands+) commands.`,
 		if set > 1 {
 			die("-f, -i and -l are mutually exclusive; only specify one of them")
 		}
+		search := statusSearch(cmd)
+		if search != nil && set > 0 {
+			die("the search options can't be used with -f, -i or -l")
+		}
 		var cmdState jobqueue.JobState
 		if showBuried {
 			cmdState = jobqueue.JobStateBuried
@@ -101,6 +125,9 @@ very many (tens of thousands+) commands.`,
 		var jobs []*jobqueue.Job
 		showextra := true
 		switch {
+		case search != nil:
+			// get jobs that have run and match the search
+			jobs, err = jq.SearchJobs(search, statusLimit, showStd, showEnv)
 		case set == 0:
 			// get incomplete jobs
 			jobs, err = jq.GetIncomplete(statusLimit, cmdState, showStd, showEnv)
@@ -165,13 +192,15 @@ very many (tens of thousands+) commands.`,
 		}
 
 		if quietMode {
-			var d, re, b, ru, l, c int
+			var d, re, qu, b, ru, l, c int
 			for _, job := range jobs {
 				switch job.State {
 				case jobqueue.JobStateDelayed:
 					d += 1 + job.Similar
 				case jobqueue.JobStateReady:
 					re += 1 + job.Similar
+				case jobqueue.JobStateQuota:
+					qu += 1 + job.Similar
 				case jobqueue.JobStateBuried:
 					b += 1 + job.Similar
 				case jobqueue.JobStateReserved, jobqueue.JobStateRunning:
@@ -182,8 +211,12 @@ very many (tens of thousands+) commands.`,
 					c += 1 + job.Similar
 				}
 			}
-			fmt.Printf("complete: %d\nrunning: %d\nready: %d\nlost contact: %d\ndelayed: %d\nburied: %d\n", c, ru, re, l, d, b)
+			fmt.Printf("complete: %d\nrunning: %d\nready: %d\nwaiting on quota: %d\nlost contact: %d\ndelayed: %d\nburied: %d\n", c, ru, re, qu, l, d, b)
 		} else {
+			// summarise any array commands first, since their elements may
+			// be spread over many of the groups below
+			printArrayStatuses(jq, cmdIDStatus, jobs, showextra && cmdLine == "")
+
 			// print out status information for each job
 			for _, job := range jobs {
 				cwd := job.Cwd
@@ -209,6 +242,8 @@ very many (tens of thousands+) commands.`,
 					fmt.Printf("Status: delayed following a temporary problem, will become ready soon (attempted at %s)\n", job.StartTime.Format(shortTimeFormat))
 				case jobqueue.JobStateReady:
 					fmt.Println("Status: ready to be picked up by a `wr runner`")
+				case jobqueue.JobStateQuota:
+					fmt.Println("Status: waiting on quota - ready, but its user or identifier already has as many commands running as allowed (see `wr manager status`)")
 				case jobqueue.JobStateBuried:
 					fmt.Printf("Status: buried - you need to fix the problem and then `wr kick` (attempted at %s)\n", job.StartTime.Format(shortTimeFormat))
 				case jobqueue.JobStateReserved, jobqueue.JobStateRunning:
@@ -216,24 +251,48 @@ very many (tens of thousands+) commands.`,
 				case jobqueue.JobStateLost:
 					fmt.Printf("Status: lost contact (started %s; lost %s)\n", job.StartTime.Format(shortTimeFormat), job.EndTime.Format(shortTimeFormat))
 				case jobqueue.JobStateComplete:
-					fmt.Printf("Status: complete (started %s; ended %s)\n", job.StartTime.Format(shortTimeFormat), job.EndTime.Format(shortTimeFormat))
+					if job.Freshness == jobqueue.FreshnessUpToDate {
+						fmt.Printf("Status: complete without running, since its outputs were up to date (added %s)\n", job.EndTime.Format(shortTimeFormat))
+					} else {
+						fmt.Printf("Status: complete (started %s; ended %s)\n", job.StartTime.Format(shortTimeFormat), job.EndTime.Format(shortTimeFormat))
+					}
+				}
+
+				if job.Freshness == jobqueue.FreshnessRerun {
+					fmt.Println("Re-run: it had completed before, but its outputs were out of date")
+				}
+
+				if job.ArrayID != "" {
+					fmt.Printf("Array element: index %d of a %d element array (array %s)\n", job.ArrayIndex, job.ArraySize, job.ArrayID)
+				}
+
+				if job.CacheStatus != "" {
+					if job.CacheStatus == jobqueue.CacheHit {
+						fmt.Printf("Cache: hit; outputs were restored from the result cache instead of running (key %s)\n", job.CacheKey)
+					} else {
+						fmt.Printf("Cache: %s (key %s)\n", job.CacheStatus, job.CacheKey)
+					}
 				}
 
 				if job.FailReason != "" {
 					fmt.Printf("Previous problem: %s\n", job.FailReason)
 				}
 
+				for _, e := range job.Escalations {
+					fmt.Printf("Requirements increased: %s at %s\n", e, e.Time.Format(shortTimeFormat))
+				}
+
 				var hostID string
 				if job.HostID != "" {
 					hostID = ", ID: " + job.HostID
 				}
 
-				if job.Exited {
+				if job.Exited && job.Freshness != jobqueue.FreshnessUpToDate {
 					prefix := "Stats"
 					if job.State != jobqueue.JobStateComplete {
 						prefix = "Stats of previous attempt"
 					}
-					fmt.Printf("%s: { Exit code: %d; Peak memory: %dMB; Wall time: %s; CPU time: %s }\nHost: %s (IP: %s%s); Pid: %d\n", prefix, job.Exitcode, job.PeakRAM, job.WallTime(), job.CPUtime, job.Host, job.HostIP, hostID, job.Pid)
+					fmt.Printf("%s: { Exit code: %d; Peak memory: %dMB; Peak disk: %dMB; Wall time: %s; CPU time: %s }\nHost: %s (IP: %s%s); Pid: %d\n", prefix, job.Exitcode, job.PeakRAM, job.PeakDisk, job.WallTime(), job.CPUtime, job.Host, job.HostIP, hostID, job.Pid)
 					if showextra && showStd && job.Exitcode != 0 {
 						stdout, err := job.StdOut()
 						if err != nil {
@@ -298,6 +357,70 @@ very many (tens of thousands+) commands.`,
 	},
 }
 
+// printArrayStatuses prints a summary of the states of the elements of array
+// commands. If all is false, only arrays that the given jobs are elements of
+// are summarised.
+func printArrayStatuses(jq *jobqueue.Client, repgroup string, jobs []*jobqueue.Job, all bool) {
+	ids := make(map[string]bool)
+	for _, job := range jobs {
+		if job.ArrayID != "" {
+			ids[job.ArrayID] = true
+		}
+	}
+	if !all && len(ids) == 0 {
+		return
+	}
+
+	statuses, err := jq.GetArrayStatus(repgroup)
+	if err != nil {
+		warn("failed to get the status of array commands: %s", err)
+		return
+	}
+
+	states := []jobqueue.JobState{jobqueue.JobStateComplete, jobqueue.JobStateRunning, jobqueue.JobStateLost, jobqueue.JobStateReady, jobqueue.JobStateQuota, jobqueue.JobStateDelayed, jobqueue.JobStateDependent, jobqueue.JobStateBuried}
+	for _, status := range statuses {
+		if !all && !ids[status.ID] {
+			continue
+		}
+		var counts []string
+		for _, state := range states {
+			if count := status.States[state]; count > 0 {
+				counts = append(counts, fmt.Sprintf("%s: %d", state, count))
+			}
+		}
+		if status.Pending > 0 {
+			counts = append(counts, fmt.Sprintf("not yet queued: %d", status.Pending))
+		}
+		fmt.Printf("\n# Array %s\nId: %s; Elements: %d\nStatus: { %s }\n", status.ID, status.RepGroup, status.Size, strings.Join(counts, "; "))
+	}
+}
+
+// statusSearch returns a JobSearch based on the search options the user
+// supplied, or nil if they didn't supply any.
+func statusSearch(cmd *cobra.Command) *jobqueue.JobSearch {
+	search := &jobqueue.JobSearch{
+		FailReason: searchFailReason,
+		Host:       searchHost,
+		ReqGroup:   searchReqGrp,
+		User:       searchUser,
+		Cmd:        searchGrep,
+	}
+	var err error
+	if search.Since, err = pastTime(searchSince); err != nil {
+		die("bad --since: %s", err)
+	}
+	if search.Until, err = pastTime(searchUntil); err != nil {
+		die("bad --until: %s", err)
+	}
+	if cmd.Flags().Changed("exitcode") {
+		search.Exitcode = &searchExitcode
+	}
+	if search.Since.IsZero() && search.Until.IsZero() && search.Exitcode == nil && search.FailReason == "" && search.Host == "" && search.ReqGroup == "" && search.User == "" && search.Cmd == "" {
+		return nil
+	}
+	return search
+}
+
 func init() {
 	RootCmd.AddCommand(statusCmd)
 
@@ -312,6 +435,14 @@ func init() {
 	statusCmd.Flags().BoolVarP(&showEnv, "env", "e", false, "except in -f mode, also show the environment variables the command(s) ran with")
 	statusCmd.Flags().BoolVarP(&quietMode, "quiet", "q", false, "minimal verbosity: just display status counts")
 	statusCmd.Flags().IntVar(&statusLimit, "limit", 1, "number of commands that share the same properties to display; 0 displays all")
+	statusCmd.Flags().StringVar(&searchSince, "since", "", "search for commands that finished running at or after this time")
+	statusCmd.Flags().StringVar(&searchUntil, "until", "", "search for commands that finished running at or before this time")
+	statusCmd.Flags().IntVar(&searchExitcode, "exitcode", 0, "search for commands that exited with this code")
+	statusCmd.Flags().StringVar(&searchFailReason, "fail_reason", "", "search for commands that failed for this reason")
+	statusCmd.Flags().StringVar(&searchHost, "host", "", "search for commands that ran on this host")
+	statusCmd.Flags().StringVar(&searchReqGrp, "req_grp", "", "search for commands in this requirements group")
+	statusCmd.Flags().StringVar(&searchUser, "user", "", "search for commands added by this user")
+	statusCmd.Flags().StringVar(&searchGrep, "grep", "", "search for commands whose command line matches this regular expression")
 
 	statusCmd.Flags().IntVar(&timeoutint, "timeout", 30, "how long (seconds) to wait to get a reply from 'wr manager'")
 }
@@ -0,0 +1,184 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/VertebrateResequencing/wr/jobqueue"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+// options for this cmd
+var workflowFile string
+var workflowCwd string
+var workflowDryRun bool
+var workflowReRun bool
+var workflowTimeout int
+
+// workflowCmd represents the workflow command
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "Run workflows defined in YAML",
+	Long: `Run the commands of a declarative workflow definition.
+
+Instead of generating lines for 'wr add' yourself, you can describe your
+workflow in a YAML file as a set of named steps, and have wr work out and add
+all the commands for you. Use the 'run' sub-command to do this.`,
+}
+
+// run sub-command expands a workflow and adds its commands to the queue
+var workflowRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Add the commands of a workflow to the queue",
+	Long: `Validate and expand a workflow definition, adding its commands to the
+queue.
+
+The workflow file is YAML with a "name", optional "defaults" and a list of
+"steps". For example:
+
+name: wgs
+defaults:
+  memory: 2G
+  time: 1h
+steps:
+  - name: align
+    cmd: bwa mem ref.fa {{.Input}} > {{.Stem}}.sam
+    glob: /data/*.fq
+    req_grp: bwa
+  - name: merge
+    cmd: samtools merge all.bam *.sam
+    after: [align]
+
+"defaults" and each step can specify any of the options that 'wr add' accepts in
+its JSON objects (cwd, cwd_matters, change_home, on_failure, on_success,
+on_exit, mounts, req_grp, memory, time, override, cpus, disk, priority, retries,
+retry_policy, escalation, time_limit, kill_sequence, checkpoint, rep_grp,
+dep_grps, deps, cmd_deps, cloud_os, cloud_username, cloud_ram, cloud_script,
+env, input_files, output_files, cache and webhook), with the same meanings as
+described in 'wr add -h'. Values set in a step take precedence over those in
+"defaults". Steps (but not "defaults") can also specify an "array", in which
+case {{index}} and {{value}} are left in the step's cmd for each element of the
+array to fill in.
+
+Each step must have a unique "name" and a "cmd". The cmd is a Go text/template
+that is expanded once for every input of the step; inputs are listed in
+"inputs" and/or found by matching the file path pattern in "glob". Within the
+cmd you can use {{.Input}} for the input path, {{.Index}} for its position
+(counting from 0), {{.Base}} for its basename, {{.Stem}} for its basename
+without extension and {{.Dir}} for its directory. The same can be used in the
+step's input_files and output_files. A step with no inputs results in a single
+command.
+
+"after" is a list of the names of other steps that must completely finish before
+any command of this step will start. This works by giving the commands of each
+step the dep_grp "[workflow name].[step name]", and making the commands of later
+steps depend on that. These dependencies are 'live' (see 'wr add -h'). The
+rep_grp of each step's commands also defaults to "[workflow name].[step name]",
+so you can easily check on the progress of each step using 'wr status -i'.
+
+With --dry-run, nothing is added to the queue; instead the commands that would
+have been added are printed, each followed (tab separated) by a JSON object of
+their options (so the output could be piped to 'wr add' if desired).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if workflowFile == "" {
+			die("--file is required")
+		}
+
+		wf, err := jobqueue.ParseWorkflow(workflowFile)
+		if err != nil {
+			die("%s", err)
+		}
+
+		// these match the defaults of 'wr add'
+		jd := &jobqueue.JobDefaults{
+			Cwd:     workflowCwd,
+			Memory:  1024,
+			Time:    1 * time.Hour,
+			Retries: 3,
+			OnExit:  jobqueue.BehavioursViaJSON{{Cleanup: true}}.Behaviours(jobqueue.OnExit),
+		}
+
+		timeout := time.Duration(workflowTimeout) * time.Second
+		var envVars []string
+		if workflowDryRun {
+			if jd.Cwd == "" {
+				jd.Cwd, err = os.Getwd()
+				if err != nil {
+					die("%s", err)
+				}
+			}
+		} else {
+			pwd, remoteWarning, localEnv := addLocality(timeout)
+			envVars = localEnv
+			if jd.Cwd == "" {
+				if remoteWarning {
+					warn("command working directories defaulting to /tmp since the manager is running remotely")
+				}
+				jd.Cwd = pwd
+			}
+		}
+
+		jobs, err := wf.Jobs(jd)
+		if err != nil {
+			die("%s", err)
+		}
+
+		if workflowDryRun {
+			wjs, errj := wf.JobsViaJSON(jd)
+			if errj != nil {
+				die("%s", errj)
+			}
+			for _, wj := range wjs {
+				opts, errj := wj.OptionsJSON()
+				if errj != nil {
+					die("%s", errj)
+				}
+				fmt.Printf("%s\t%s\n", wj.Cmd, opts)
+			}
+			return
+		}
+
+		jq, err := jobqueue.Connect(addr, "cmds", timeout)
+		if err != nil {
+			die("%s", err)
+		}
+		defer jq.Disconnect()
+
+		inserts, dups, err := jq.Add(jobs, envVars, !workflowReRun)
+		if err != nil {
+			die("%s", err)
+		}
+		info("Added %d new commands (%d were duplicates) to the queue for workflow '%s'", inserts, dups, wf.Name)
+		reportUpToDate(jobs)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(workflowCmd)
+	workflowCmd.AddCommand(workflowRunCmd)
+
+	// flags specific to these sub-commands
+	workflowRunCmd.Flags().StringVarP(&workflowFile, "file", "f", "", "YAML file containing your workflow definition")
+	workflowRunCmd.Flags().StringVarP(&workflowCwd, "cwd", "c", "", "base for the commands' working dirs, if not set in the workflow")
+	workflowRunCmd.Flags().BoolVar(&workflowDryRun, "dry-run", false, "print the expanded commands instead of adding them to the queue")
+	workflowRunCmd.Flags().BoolVar(&workflowReRun, "rerun", false, "re-run any commands that had been previously added and have since completed")
+	workflowRunCmd.Flags().IntVar(&workflowTimeout, "timeout", 30, "how long (seconds) to wait to get a reply from 'wr manager'")
+}
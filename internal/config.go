@@ -44,30 +44,54 @@ const (
 
 // Config holds the configuration options for jobqueue server and client
 type Config struct {
-	ManagerPort      string `default:""`
-	ManagerWeb       string `default:""`
-	ManagerHost      string `default:"localhost"`
-	ManagerDir       string `default:"~/.wr"`
-	ManagerPidFile   string `default:"pid"`
-	ManagerLogFile   string `default:"log"`
-	ManagerDbFile    string `default:"db"`
-	ManagerDbBkFile  string `default:"db_bk"`
-	ManagerUmask     int    `default:"007"`
-	ManagerScheduler string `default:"local"`
-	RunnerExecShell  string `default:"bash"`
-	Deployment       string `default:"production"`
-	CloudFlavor      string `default:""`
-	CloudKeepAlive   int    `default:"120"`
-	CloudServers     int    `default:"-1"`
-	CloudCIDR        string `default:"192.168.0.0/18"`
-	CloudGateway     string `default:"192.168.0.1"`
-	CloudDNS         string `default:"8.8.4.4,8.8.8.8"`
-	CloudOS          string `default:"Ubuntu Xenial"`
-	CloudUser        string `default:"ubuntu"`
-	CloudRAM         int    `default:"2048"`
-	CloudDisk        int    `default:"1"`
-	CloudScript      string `default:""`
-	CloudConfigFiles string `default:"~/.s3cfg,~/.aws/credentials,~/.aws/config"`
+	ManagerPort      string  `default:""`
+	ManagerWeb       string  `default:""`
+	ManagerHost      string  `default:"localhost"`
+	ManagerDir       string  `default:"~/.wr"`
+	ManagerPidFile   string  `default:"pid"`
+	ManagerLogFile   string  `default:"log"`
+	ManagerLogLevel  string  `default:"info"`
+	ManagerDbFile    string  `default:"db"`
+	ManagerDbBkFile  string  `default:"db_bk"`
+	ManagerUmask     int     `default:"007"`
+	ManagerCacheDir  string  `default:""`
+	ManagerCacheSize int     `default:"0"`
+	ManagerRecPct    int     `default:"95"`
+	ManagerRecMB     int     `default:"100"`
+	ManagerRecSec    int     `default:"1800"`
+	ManagerRecRuns   int     `default:"0"`
+	ManagerRecDays   int     `default:"0"`
+	ManagerTimeLimit float64 `default:"0"`
+	ManagerFairShare string  `default:""`
+	ManagerShares    string  `default:""`
+	ManagerAging     int     `default:"0"`
+	ManagerUserQuota string  `default:""`
+	ManagerRepQuota  string  `default:""`
+	ManagerWebhooks  string  `default:""`
+	ManagerHookKey   string  `default:""`
+	ManagerSMTP      string  `default:""`
+	ManagerSMTPUser  string  `default:""`
+	ManagerSMTPPass  string  `default:""`
+	ManagerMailFrom  string  `default:""`
+	ManagerMailTo    string  `default:""`
+	ManagerUserMail  string  `default:""`
+	ManagerMailMins  int     `default:"60"`
+	ManagerAuditDays int     `default:"90"`
+	ManagerScheduler string  `default:"local"`
+	RunnerExecShell  string  `default:"bash"`
+	Deployment       string  `default:"production"`
+	CloudFlavor      string  `default:""`
+	CloudKeepAlive   int     `default:"120"`
+	CloudServers     int     `default:"-1"`
+	CloudCIDR        string  `default:"192.168.0.0/18"`
+	CloudGateway     string  `default:"192.168.0.1"`
+	CloudDNS         string  `default:"8.8.4.4,8.8.8.8"`
+	CloudOS          string  `default:"Ubuntu Xenial"`
+	CloudUser        string  `default:"ubuntu"`
+	CloudRAM         int     `default:"2048"`
+	CloudDisk        int     `default:"1"`
+	CloudScript      string  `default:""`
+	CloudConfigFiles string  `default:"~/.s3cfg,~/.aws/credentials,~/.aws/config"`
 }
 
 /*
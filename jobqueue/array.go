@@ -0,0 +1,448 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for array Jobs: single Jobs that act as a
+// template for many near-identical Jobs (the "elements" of the array), which
+// the server creates lazily as earlier elements start running.
+
+import (
+	"fmt"
+	"github.com/VertebrateResequencing/wr/queue"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ArrayIndexPlaceholder and ArrayValuePlaceholder are the strings in an array
+// Job's Cmd, Inputs and Outputs that get replaced with the index and value of
+// each element of the array.
+const (
+	ArrayIndexPlaceholder = "{{index}}"
+	ArrayValuePlaceholder = "{{value}}"
+)
+
+// ServerArrayBatchSize is the maximum number of elements of each array Job
+// that the server will have waiting to start in the queue at once; further
+// elements are only created as these start running. (Array Jobs with DepGroups
+// are the exception: all their elements are created at once, since otherwise
+// Jobs that depend on those DepGroups could start after only some of the
+// elements had completed.) It is only exported for testing purposes.
+var ServerArrayBatchSize = 1000
+
+// JobArray describes the elements of an array Job. Either supply an inclusive
+// range of integers with Start and End, or a list of Values. For a range, each
+// element's index and value are the same integer. For Values, the index is the
+// position of the value in the list, counting from 0.
+type JobArray struct {
+	Start  int      `json:"start"`
+	End    int      `json:"end"`
+	Values []string `json:"values"`
+}
+
+// Size returns the number of elements in the array.
+func (a *JobArray) Size() int {
+	if len(a.Values) > 0 {
+		return len(a.Values)
+	}
+	if a.End < a.Start {
+		return 0
+	}
+	return a.End - a.Start + 1
+}
+
+// String returns a short description of the array, like "1-100" or
+// "10 values".
+func (a *JobArray) String() string {
+	if len(a.Values) > 0 {
+		return fmt.Sprintf("%d values", len(a.Values))
+	}
+	return fmt.Sprintf("%d-%d", a.Start, a.End)
+}
+
+// element returns the index and value of the ith (counting from 0) element of
+// the array.
+func (a *JobArray) element(i int) (index int, value string) {
+	if len(a.Values) > 0 {
+		return i, a.Values[i]
+	}
+	index = a.Start + i
+	return index, strconv.Itoa(index)
+}
+
+// validate checks that the array has elements and that the given cmd would be
+// different for each of them.
+func (a *JobArray) validate(cmd string) error {
+	if a.Size() == 0 {
+		return fmt.Errorf("array for cmd [%s] has no elements", cmd)
+	}
+	if !strings.Contains(cmd, ArrayIndexPlaceholder) && !strings.Contains(cmd, ArrayValuePlaceholder) {
+		return fmt.Errorf("array cmd [%s] contains neither %s nor %s", cmd, ArrayIndexPlaceholder, ArrayValuePlaceholder)
+	}
+	return nil
+}
+
+// ArrayStatus summarises the states of the elements of an array Job.
+type ArrayStatus struct {
+	// ID is the ArrayID of the elements.
+	ID       string
+	RepGroup string
+	Size     int
+	// Pending is the number of elements that have not yet been created by
+	// the server, and so aren't counted in States.
+	Pending int
+	// States counts the elements in each JobState; reserved elements are
+	// counted as running.
+	States map[JobState]int
+}
+
+// jarrays is how we send the ArrayStatus of every array Job with incomplete
+// elements to the status webpage.
+type jarrays struct {
+	Arrays []*ArrayStatus
+}
+
+// jobArrayState is what we store in the database for array Jobs that have not
+// yet been fully expanded in to their elements.
+type jobArrayState struct {
+	Template       *Job
+	Expanded       int
+	IgnoreComplete bool
+}
+
+// serverArray is the server's in-memory record of an array Job that has not
+// yet been fully expanded.
+type serverArray struct {
+	*jobArrayState
+	unstarted int  // number of created elements that haven't yet been reserved
+	cancelled bool // true once cancelArray() has been called
+	sync.Mutex
+}
+
+// arrayElement creates the ith (counting from 0) element of this array Job.
+// Everything apart from Cmd, Inputs and Outputs (which have the placeholders
+// replaced) is shared with or copied from the array Job.
+func (j *Job) arrayElement(i int) *Job {
+	index, value := j.Array.element(i)
+	r := strings.NewReplacer(ArrayIndexPlaceholder, strconv.Itoa(index), ArrayValuePlaceholder, value)
+	replaceAll := func(paths []string) (replaced []string) {
+		for _, path := range paths {
+			replaced = append(replaced, r.Replace(path))
+		}
+		return
+	}
+
+	req := *j.Requirements
+	return &Job{
+		RepGroup:         j.RepGroup,
+		ReqGroup:         j.ReqGroup,
+		DepGroups:        j.DepGroups,
+		Cmd:              r.Replace(j.Cmd),
+		Cwd:              j.Cwd,
+		CwdMatters:       j.CwdMatters,
+		ChangeHome:       j.ChangeHome,
+		Requirements:     &req,
+		Override:         j.Override,
+		Priority:         j.Priority,
+		Retries:          j.Retries,
+		RetryPolicy:      j.RetryPolicy,
+		EscalationPolicy: j.EscalationPolicy,
+		TimeLimit:        j.TimeLimit,
+		KillSequence:     j.KillSequence,
+		Checkpoint:       j.Checkpoint,
+		Dependencies:     j.Dependencies,
+		Behaviours:       j.Behaviours,
+		MountConfigs:     j.MountConfigs,
+		Inputs:           replaceAll(j.Inputs),
+		Outputs:          replaceAll(j.Outputs),
+		Cache:            j.Cache,
+		Webhook:          j.Webhook,
+		EnvOverride:      j.EnvOverride,
+		ArrayID:          j.key(),
+		ArrayIndex:       index,
+		ArraySize:        j.Array.Size(),
+		User:             j.User,
+	}
+}
+
+// createArrays removes any array Jobs from the given jobs, storing and
+// returning them so that you can expandArray() them. Arrays that are still
+// being expanded from a previous add are counted as dups, while pending is the
+// total number of elements of the new arrays.
+func (s *Server) createArrays(inputJobs []*Job, ignoreComplete bool) (jobs []*Job, arrays []*serverArray, pending int, dups int, err error) {
+	for _, job := range inputJobs {
+		if job.Array == nil {
+			jobs = append(jobs, job)
+			continue
+		}
+
+		err = job.Array.validate(job.Cmd)
+		if err != nil {
+			return
+		}
+
+		id := job.key()
+		size := job.Array.Size()
+		s.amutex.Lock()
+		if _, exists := s.arrays[id]; exists {
+			s.amutex.Unlock()
+			dups += size
+			continue
+		}
+		arr := &serverArray{jobArrayState: &jobArrayState{Template: job, IgnoreComplete: ignoreComplete}}
+		s.arrays[id] = arr
+		s.amutex.Unlock()
+
+		err = s.db.storeArray(id, arr.jobArrayState)
+		if err != nil {
+			s.amutex.Lock()
+			delete(s.arrays, id)
+			s.amutex.Unlock()
+			return
+		}
+		arrays = append(arrays, arr)
+		pending += size
+	}
+	return
+}
+
+// expandArray creates and queues more elements of the given array Job, until
+// ServerArrayBatchSize of them are waiting to start or all of them have been
+// created (arrays with DepGroups are always fully created). Once the latter
+// happens we forget about the array Job. Returns the number of elements that
+// were queued.
+func (s *Server) expandArray(q *queue.Queue, arr *serverArray) (added int) {
+	arr.Lock()
+	if arr.cancelled {
+		arr.Unlock()
+		return
+	}
+	id := arr.Template.key()
+	size := arr.Template.Array.Size()
+
+	// other jobs could depend on our DepGroups, and would start running if
+	// only some of our elements had been created, so in that case we must
+	// create them all now
+	batchSize := ServerArrayBatchSize
+	if len(arr.Template.DepGroups) > 0 {
+		batchSize = size
+	}
+
+	for arr.unstarted < batchSize && arr.Expanded < size {
+		n := batchSize - arr.unstarted
+		if arr.Expanded+n > size {
+			n = size - arr.Expanded
+		}
+
+		var elements []*Job
+		for i := arr.Expanded; i < arr.Expanded+n; i++ {
+			elements = append(elements, arr.Template.arrayElement(i))
+		}
+		thisAdded, _, _, _, err := s.createJobs(q, elements, arr.Template.EnvKey, arr.Template.User, arr.IgnoreComplete)
+		if err != nil {
+			arr.Unlock()
+			logger.Error("failed to create elements of array", "array", id, "err", err)
+			return
+		}
+
+		arr.Expanded += n
+		arr.unstarted += thisAdded
+		added += thisAdded
+	}
+
+	if arr.Expanded < size {
+		err := s.db.storeArray(id, arr.jobArrayState)
+		arr.Unlock()
+		if err != nil {
+			logger.Error("failed to store progress of array", "array", id, "err", err)
+		}
+		return
+	}
+	arr.Unlock()
+
+	// (we must not hold arr's lock while getting amutex)
+	s.amutex.Lock()
+	delete(s.arrays, id)
+	s.amutex.Unlock()
+	s.db.remove(bucketArrays, id)
+	return
+}
+
+// cancelArray stops any more elements being created for the given array Job,
+// returning the number of elements that will now never be created. This is
+// only done when explicitly requested, since deleting or killing one element
+// shouldn't affect the others.
+func (s *Server) cancelArray(id string) (dropped int) {
+	if id == "" {
+		return
+	}
+	s.amutex.Lock()
+	arr, exists := s.arrays[id]
+	delete(s.arrays, id)
+	s.amutex.Unlock()
+	if !exists {
+		return
+	}
+
+	arr.Lock()
+	arr.cancelled = true
+	dropped = arr.Template.Array.Size() - arr.Expanded
+	arr.Unlock()
+	s.db.remove(bucketArrays, id)
+	return
+}
+
+// arrayElementDequeued should be called when an element of an array Job is
+// reserved or removed from the queue for the first time. If that leaves few
+// enough elements waiting to start, more elements will be created in the
+// background.
+func (s *Server) arrayElementDequeued(q *queue.Queue, job *Job) {
+	job.Lock()
+	if job.ArrayID == "" || job.arrayDequeued {
+		job.Unlock()
+		return
+	}
+	job.arrayDequeued = true
+	id := job.ArrayID
+	job.Unlock()
+
+	s.amutex.RLock()
+	arr, exists := s.arrays[id]
+	s.amutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	go func() {
+		defer s.logPanic("jobqueue array expansion", false)
+		arr.Lock()
+		arr.unstarted--
+		expand := arr.unstarted <= ServerArrayBatchSize/2
+		arr.Unlock()
+		if expand {
+			s.expandArray(q, arr)
+		}
+	}()
+}
+
+// recoverArrays is used when the server starts to continue expanding any array
+// Jobs that had not been fully expanded, given the jobs that were recovered
+// from the live bucket.
+func (s *Server) recoverArrays(priorJobs []*Job) error {
+	states, err := s.db.retrieveArrays()
+	if err != nil {
+		return err
+	}
+
+	unstarted := make(map[string]int)
+	for _, job := range priorJobs {
+		if job.ArrayID != "" {
+			unstarted[job.ArrayID]++
+		}
+	}
+
+	for _, state := range states {
+		id := state.Template.key()
+		arr := &serverArray{jobArrayState: state, unstarted: unstarted[id]}
+		s.amutex.Lock()
+		s.arrays[id] = arr
+		s.amutex.Unlock()
+		s.expandArray(s.getOrCreateQueue(state.Template.Queue), arr)
+	}
+	return nil
+}
+
+// getArrayStatuses summarises the states of the elements of the array Jobs
+// with the given RepGroup (including complete elements), or of all array Jobs
+// with incomplete elements if repgroup is blank.
+func (s *Server) getArrayStatuses(q *queue.Queue, repgroup string) (statuses []*ArrayStatus, srerr string, qerr string) {
+	var jobs []*Job
+	if repgroup != "" {
+		jobs, srerr, qerr = s.getJobsByRepGroup(q, repgroup, 0, "", false, false)
+		if srerr != "" {
+			return
+		}
+	} else {
+		jobs = s.getArrayElementsCurrent(q)
+	}
+	statuses = s.summariseArrays(jobs, repgroup)
+	return
+}
+
+// getArrayElementsCurrent is like getJobsCurrent(), but only gets the elements
+// of array Jobs, which is much quicker when most jobs aren't array elements.
+func (s *Server) getArrayElementsCurrent(q *queue.Queue) (jobs []*Job) {
+	for _, item := range q.AllItems() {
+		sjob := item.Data.(*Job)
+		sjob.RLock()
+		isElement := sjob.ArrayID != ""
+		sjob.RUnlock()
+		if isElement {
+			jobs = append(jobs, s.itemToJob(item, false, false))
+		}
+	}
+	return
+}
+
+// summariseArrays counts the states of the array elements amongst the given
+// jobs, along with the uncreated elements of the array Jobs with the given
+// RepGroup (or of all array Jobs if repgroup is blank).
+func (s *Server) summariseArrays(jobs []*Job, repgroup string) (statuses []*ArrayStatus) {
+	byID := make(map[string]*ArrayStatus)
+	getStatus := func(id, rg string, size int) *ArrayStatus {
+		status, exists := byID[id]
+		if !exists {
+			status = &ArrayStatus{ID: id, RepGroup: rg, Size: size, States: make(map[JobState]int)}
+			byID[id] = status
+			statuses = append(statuses, status)
+		}
+		return status
+	}
+
+	for _, job := range jobs {
+		if job.ArrayID == "" {
+			continue
+		}
+		state := job.State
+		if state == JobStateReserved {
+			state = JobStateRunning
+		}
+		getStatus(job.ArrayID, job.RepGroup, job.ArraySize).States[state]++
+	}
+
+	s.amutex.RLock()
+	for id, arr := range s.arrays {
+		arr.Lock()
+		if repgroup == "" || arr.Template.RepGroup == repgroup {
+			status := getStatus(id, arr.Template.RepGroup, arr.Template.Array.Size())
+			status.Pending = status.Size - arr.Expanded
+		}
+		arr.Unlock()
+	}
+	s.amutex.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].RepGroup == statuses[j].RepGroup {
+			return statuses[i].ID < statuses[j].ID
+		}
+		return statuses[i].RepGroup < statuses[j].RepGroup
+	})
+	return
+}
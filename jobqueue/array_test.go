@@ -0,0 +1,81 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	jqs "github.com/VertebrateResequencing/wr/jobqueue/scheduler"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestJobArray(t *testing.T) {
+	Convey("JobArrays have the expected sizes and elements", t, func() {
+		a := &JobArray{Start: 3, End: 5}
+		So(a.Size(), ShouldEqual, 3)
+		So(a.String(), ShouldEqual, "3-5")
+		index, value := a.element(1)
+		So(index, ShouldEqual, 4)
+		So(value, ShouldEqual, "4")
+
+		a = &JobArray{Start: 5, End: 3}
+		So(a.Size(), ShouldEqual, 0)
+		So(a.validate("echo {{index}}"), ShouldNotBeNil)
+
+		a = &JobArray{Start: 3, End: 5, Values: []string{"x", "y"}}
+		So(a.Size(), ShouldEqual, 2)
+		So(a.String(), ShouldEqual, "2 values")
+		index, value = a.element(1)
+		So(index, ShouldEqual, 1)
+		So(value, ShouldEqual, "y")
+
+		So(a.validate("echo {{value}}"), ShouldBeNil)
+		So(a.validate("echo {{index}}"), ShouldBeNil)
+		So(a.validate("echo"), ShouldNotBeNil)
+	})
+
+	Convey("Array Jobs create the expected elements", t, func() {
+		job := &Job{
+			Cmd:          "process {{value}} > {{index}}.out",
+			Cwd:          "/tmp",
+			RepGroup:     "rg",
+			Requirements: &jqs.Requirements{RAM: 10, Time: 1 * time.Minute, Cores: 1},
+			Priority:     3,
+			Inputs:       []string{"{{value}}"},
+			Outputs:      []string{"{{index}}.out"},
+			Array:        &JobArray{Values: []string{"a.in", "b.in"}},
+		}
+
+		element := job.arrayElement(1)
+		So(element.Cmd, ShouldEqual, "process b.in > 1.out")
+		So(element.Inputs, ShouldResemble, []string{"b.in"})
+		So(element.Outputs, ShouldResemble, []string{"1.out"})
+		So(element.Cwd, ShouldEqual, "/tmp")
+		So(element.RepGroup, ShouldEqual, "rg")
+		So(element.Priority, ShouldEqual, 3)
+		So(element.Array, ShouldBeNil)
+		So(element.ArrayID, ShouldEqual, job.key())
+		So(element.ArrayIndex, ShouldEqual, 1)
+		So(element.ArraySize, ShouldEqual, 2)
+		So(element.key(), ShouldNotEqual, job.arrayElement(0).key())
+
+		element.Requirements.RAM = 20
+		So(job.Requirements.RAM, ShouldEqual, 10)
+	})
+}
@@ -0,0 +1,297 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for the audit trail of who did what to which
+// jobs.
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/go-mangos/mangos"
+	"github.com/ugorji/go/codec"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const restAuditEndpoint = "/rest/v1/audit/"
+
+// Audit* are the actions recorded in the audit trail.
+const (
+	AuditAdd      = "add"
+	AuditKick     = "kick"
+	AuditDelete   = "delete"
+	AuditKill     = "kill"
+	AuditCancel   = "cancel"
+	AuditModify   = "modify"
+	AuditDrain    = "drain"
+	AuditShutdown = "shutdown"
+	AuditBackup   = "backup"
+)
+
+// ServerAuditPruneInterval is how often the server deletes audit entries that
+// are older than ServerConfig.AuditRetention.
+var ServerAuditPruneInterval = 1 * time.Hour
+
+// AuditEntry records a request a user made of the server that changed jobs or
+// the server itself.
+type AuditEntry struct {
+	Time   time.Time
+	User   string
+	Host   string   // the host the client said the request came from
+	Peer   string   // the network address the request actually came from
+	Action string   // one of the Audit* constants
+	Queue  string   // blank for actions on the server itself
+	Keys   []string // the keys of the jobs (or ArrayIDs) that were affected
+	Detail string   // eg. how many jobs were requested vs affected
+}
+
+// AuditFilter limits which AuditEntrys are retrieved.
+type AuditFilter struct {
+	// From and To limit to entries made within this time range; zero values
+	// don't limit.
+	From time.Time
+	To   time.Time
+
+	// User limits to entries made by this user.
+	User string
+
+	// Limit, if greater than 0, limits to this many of the most recent
+	// matching entries.
+	Limit int
+}
+
+// auditKey returns the db key of an entry made at the given time, with the
+// given sequence number to keep keys unique. Keys sort in time order.
+func auditKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// auditKeyTime returns the time encoded in a key made by auditKey().
+func auditKeyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
+
+// storeAudit appends the given entry to the audit trail.
+func (db *db) storeAudit(entry *AuditEntry) (err error) {
+	var encoded []byte
+	enc := codec.NewEncoderBytes(&encoded, db.ch)
+	err = enc.Encode(entry)
+	if err != nil {
+		return
+	}
+	err = db.bolt.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketAudit)
+		seq, serr := b.NextSequence()
+		if serr != nil {
+			return serr
+		}
+		return b.Put(auditKey(entry.Time, seq), encoded)
+	})
+	if err != nil {
+		return
+	}
+	db.backgroundBackup()
+	return
+}
+
+// retrieveAudit returns the entries in the audit trail that pass the filter,
+// oldest first.
+func (db *db) retrieveAudit(filter *AuditFilter) (entries []*AuditEntry, err error) {
+	to := filter.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	err = db.bolt.View(func(tx *bolt.Tx) error {
+		// work backwards from To so that we can stop once we have Limit of
+		// the most recent
+		c := tx.Bucket(bucketAudit).Cursor()
+		k, v := c.Seek(auditKey(to.Add(1), 0))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil; k, v = c.Prev() {
+			if auditKeyTime(k).Before(filter.From) {
+				break
+			}
+			entry := &AuditEntry{}
+			dec := codec.NewDecoderBytes(v, db.ch)
+			if derr := dec.Decode(entry); derr != nil {
+				return derr
+			}
+			if filter.User != "" && entry.User != filter.User {
+				continue
+			}
+			entries = append(entries, entry)
+			if filter.Limit > 0 && len(entries) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return
+}
+
+// pruneAudit deletes the entries in the audit trail that were made before the
+// given time. Returns the number of entries deleted.
+func (db *db) pruneAudit(before time.Time) (pruned int, err error) {
+	err = db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketAudit)
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && auditKeyTime(k).Before(before); k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		for _, key := range keys {
+			if derr := b.Delete(key); derr != nil {
+				return derr
+			}
+		}
+		pruned = len(keys)
+		return nil
+	})
+	return
+}
+
+// audit records in the audit trail that the given user on the given host (as
+// claimed by the client), connecting from the given peer address, carried out
+// the given action (one of the Audit* constants), affecting the jobs with the
+// given keys in the given queue. Actions on a queue that didn't affect any jobs
+// aren't recorded. Failure to record is logged rather than preventing the
+// action.
+func (s *Server) audit(user, host, peer, action, queue string, keys []string, detail string) {
+	if queue != "" && len(keys) == 0 {
+		return
+	}
+	entry := &AuditEntry{
+		Time:   time.Now(),
+		User:   user,
+		Host:   host,
+		Peer:   peer,
+		Action: action,
+		Queue:  queue,
+		Keys:   keys,
+		Detail: detail,
+	}
+	if err := s.db.storeAudit(entry); err != nil {
+		logger.Error("failed to record an audit entry", "user", user, "action", action, "err", err)
+	}
+}
+
+// auditJobs is like audit(), but takes the affected Jobs instead of their
+// keys.
+func (s *Server) auditJobs(user, host, peer, action, queue string, jobs []*Job, detail string) {
+	keys := make([]string, len(jobs))
+	for i, job := range jobs {
+		keys[i] = job.key()
+	}
+	s.audit(user, host, peer, action, queue, keys, detail)
+}
+
+// auditDetail describes how many of the requested jobs were affected.
+func auditDetail(affected, requested int) string {
+	return fmt.Sprintf("%d of %d requested", affected, requested)
+}
+
+// requestHost returns the host part of the remote address of a web request.
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// mangosPeer returns the remote address of the connection a client request
+// message was received on, or blank if it isn't known.
+func mangosPeer(m *mangos.Message) string {
+	if m.Port == nil {
+		return ""
+	}
+	addr, err := m.Port.GetProp(mangos.PropRemoteAddr)
+	if err != nil {
+		return ""
+	}
+	if netAddr, ok := addr.(net.Addr); ok {
+		return netAddr.String()
+	}
+	return ""
+}
+
+// restAudit lets you GET the audit trail. Possible query parameters are from
+// and to (RFC 3339 times), user and limit (a number), as per AuditFilter.
+func restAudit(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		r.ParseForm()
+
+		filter := &AuditFilter{User: r.Form.Get("user")}
+		for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if r.Form.Get(name) == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, r.Form.Get(name))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s must be an RFC 3339 time", name), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+		if r.Form.Get("limit") != "" {
+			limit, err := strconv.Atoi(r.Form.Get("limit"))
+			if err != nil || limit < 0 {
+				http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = limit
+		}
+
+		entries, err := s.db.retrieveAudit(filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []*AuditEntry{}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(entries)
+	}
+}
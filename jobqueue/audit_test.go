@@ -0,0 +1,92 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	"github.com/boltdb/bolt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	Convey("Audit keys sort in time order", t, func() {
+		now := time.Now()
+		key := auditKey(now, 3)
+		So(auditKeyTime(key).Equal(now), ShouldBeTrue)
+		So(string(auditKey(now, 4)), ShouldBeGreaterThan, string(key))
+		So(string(auditKey(now.Add(time.Nanosecond), 0)), ShouldBeGreaterThan, string(key))
+	})
+
+	Convey("The audit trail can be stored, filtered and pruned", t, func() {
+		dir, err := ioutil.TempDir("", "wr_audit_test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		boltdb, err := bolt.Open(filepath.Join(dir, "db"), dbFilePermission, nil)
+		So(err, ShouldBeNil)
+		defer boltdb.Close()
+		err = boltdb.Update(func(tx *bolt.Tx) error {
+			_, berr := tx.CreateBucketIfNotExists(bucketAudit)
+			return berr
+		})
+		So(err, ShouldBeNil)
+		db := &db{bolt: boltdb, ch: new(codec.BincHandle)}
+
+		start := time.Now().Add(-10 * time.Hour).Truncate(time.Second)
+		for i := 0; i < 10; i++ {
+			user := "alice"
+			if i%2 == 1 {
+				user = "bob"
+			}
+			err = db.storeAudit(&AuditEntry{Time: start.Add(time.Duration(i) * time.Hour), User: user, Action: AuditKill, Queue: "cmds", Keys: []string{string('a' + rune(i))}})
+			So(err, ShouldBeNil)
+		}
+
+		entries, err := db.retrieveAudit(&AuditFilter{})
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 10)
+		So(entries[0].Keys, ShouldResemble, []string{"a"})
+		So(entries[9].Keys, ShouldResemble, []string{"j"})
+		So(entries[0].Time.Equal(start), ShouldBeTrue)
+
+		entries, err = db.retrieveAudit(&AuditFilter{User: "bob", Limit: 2})
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 2)
+		So(entries[0].Keys, ShouldResemble, []string{"h"})
+		So(entries[1].Keys, ShouldResemble, []string{"j"})
+
+		entries, err = db.retrieveAudit(&AuditFilter{From: start.Add(2 * time.Hour), To: start.Add(4 * time.Hour)})
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 3)
+		So(entries[0].Keys, ShouldResemble, []string{"c"})
+		So(entries[2].Keys, ShouldResemble, []string{"e"})
+
+		pruned, err := db.pruneAudit(start.Add(5 * time.Hour))
+		So(err, ShouldBeNil)
+		So(pruned, ShouldEqual, 5)
+		entries, err = db.retrieveAudit(&AuditFilter{})
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 5)
+		So(entries[0].Keys, ShouldResemble, []string{"f"})
+	})
+}
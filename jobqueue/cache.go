@@ -0,0 +1,282 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for caching the output files of deterministic
+// jobs, so that future identical jobs can have their outputs restored instead
+// of being run again.
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/VertebrateResequencing/muxfys"
+	"github.com/VertebrateResequencing/wr/internal"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheCompleteMarker is the name of the file we create in a cache entry once
+// all of its outputs have been stored. Its modification time is updated every
+// time the entry is used, so that we can evict least recently used entries.
+const cacheCompleteMarker = ".complete"
+
+// CacheEvictInterval is how often the server checks if its (local) result
+// cache has grown larger than ServerConfig.CacheMaxMB.
+var CacheEvictInterval = 10 * time.Minute
+
+// Cache* constants are the possible values of Job.CacheStatus.
+const (
+	// CacheHit means the Job's Outputs were restored from the cache instead
+	// of Cmd being run.
+	CacheHit = "hit"
+
+	// CacheMiss means Cmd was run and its Outputs were then stored in the
+	// cache.
+	CacheMiss = "miss"
+
+	// CacheStoreFailed means Cmd was run, but its Outputs could not be stored
+	// in the cache.
+	CacheStoreFailed = "miss (failed to store outputs)"
+)
+
+// resultCache is a cache location opened for use by a single Job execution.
+type resultCache struct {
+	dir   string
+	fs    *muxfys.MuxFys
+	mount string
+}
+
+// openResultCache prepares the given cache location for use. The location can
+// be a local (ideally shared) directory, or an S3 path like
+// s3://[profile@]bucket/path, in which case it is mounted using muxfys. You
+// must close() the returned resultCache when done.
+func openResultCache(location string) (rc *resultCache, err error) {
+	if !internal.InS3(location) {
+		err = os.MkdirAll(location, os.ModePerm)
+		if err != nil {
+			return
+		}
+		return &resultCache{dir: location}, err
+	}
+
+	path := strings.TrimPrefix(location, internal.S3Prefix)
+	var profile string
+	if parts := strings.SplitN(path, "@", 2); len(parts) == 2 {
+		profile = parts[0]
+		path = parts[1]
+	}
+
+	accessorConfig, err := muxfys.S3ConfigFromEnvironment(profile, path)
+	if err != nil {
+		return
+	}
+	accessor, err := muxfys.NewS3Accessor(accessorConfig)
+	if err != nil {
+		return
+	}
+
+	mount, err := ioutil.TempDir("", "wr_result_cache_")
+	if err != nil {
+		return
+	}
+	fs, err := muxfys.New(&muxfys.Config{
+		Mount:     filepath.Join(mount, "mnt"),
+		CacheBase: mount,
+		Retries:   10,
+	})
+	if err != nil {
+		os.RemoveAll(mount)
+		return
+	}
+	err = fs.Mount(&muxfys.RemoteConfig{Accessor: accessor, Write: true})
+	if err != nil {
+		os.RemoveAll(mount)
+		return
+	}
+
+	return &resultCache{dir: filepath.Join(mount, "mnt"), fs: fs, mount: mount}, err
+}
+
+// close unmounts the cache if it was in S3, uploading any stored outputs. It
+// is safe to call this more than once.
+func (rc *resultCache) close() (err error) {
+	if rc.fs != nil {
+		err = rc.fs.Unmount(false)
+		os.RemoveAll(rc.mount)
+		rc.fs = nil
+	}
+	return
+}
+
+// entryDir returns the directory that the outputs of jobs with the given cache
+// key are stored in.
+func (rc *resultCache) entryDir(key string) string {
+	return filepath.Join(rc.dir, key[0:2], key)
+}
+
+// restore copies the cached outputs of the given Job (which must have its
+// CacheKey set) to their expected locations, returning true if this was
+// possible.
+func (rc *resultCache) restore(job *Job) (hit bool, err error) {
+	dir := rc.entryDir(job.CacheKey)
+	marker := filepath.Join(dir, cacheCompleteMarker)
+	if _, serr := os.Stat(marker); serr != nil {
+		return
+	}
+
+	for i, output := range job.Outputs {
+		dest := job.absPath(output)
+		err = os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+		if err != nil {
+			return
+		}
+		err = copyFile(filepath.Join(dir, strconv.Itoa(i)), dest)
+		if err != nil {
+			return
+		}
+	}
+
+	// note that we used this entry; it doesn't matter if this fails
+	now := time.Now()
+	os.Chtimes(marker, now, now)
+
+	return true, err
+}
+
+// store copies the outputs of the given Job (which must have its CacheKey set)
+// in to the cache.
+func (rc *resultCache) store(job *Job) (err error) {
+	dir := rc.entryDir(job.CacheKey)
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return
+	}
+
+	for i, output := range job.Outputs {
+		err = copyFile(job.absPath(output), filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			return
+		}
+	}
+
+	marker, err := os.Create(filepath.Join(dir, cacheCompleteMarker))
+	if err != nil {
+		return
+	}
+	return marker.Close()
+}
+
+// cacheKey calculates the key that a Job's outputs would be cached under,
+// based on its Cmd, the checksums of the contents of its Inputs and the paths
+// of its Outputs.
+func cacheKey(job *Job) (key string, err error) {
+	h := md5.New()
+	io.WriteString(h, job.Cmd)
+	for _, input := range job.Inputs {
+		sum, serr := fileChecksum(job.absPath(input))
+		if serr != nil {
+			err = fmt.Errorf("could not checksum input file %s: %s", input, serr)
+			return
+		}
+		io.WriteString(h, "\x00"+sum)
+	}
+	for _, output := range job.Outputs {
+		io.WriteString(h, "\x01"+output)
+	}
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+// fileChecksum returns the md5 checksum of the contents of the given file.
+func fileChecksum(path string) (sum string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	h := md5.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return
+	}
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+// cacheEntry is used by evictResultCache() to describe a stored cache entry.
+type cacheEntry struct {
+	dir      string
+	size     int64
+	lastUsed time.Time
+}
+
+// evictResultCache deletes the least recently used entries from a local result
+// cache directory until the total size of what remains is no more than maxMB.
+// Checkpoints stored in the cache count towards its size and are evicted in the
+// same way. Entries that are still being stored are never deleted. Returns the
+// number of entries deleted.
+func evictResultCache(dir string, maxMB int) (removed int, err error) {
+	entryDirs, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if err != nil {
+		return
+	}
+	cpDirs, err := filepath.Glob(filepath.Join(dir, checkpointStoreSubDir, "*", "*"))
+	if err != nil {
+		return
+	}
+	entryDirs = append(entryDirs, cpDirs...)
+
+	var entries []*cacheEntry
+	var total int64
+	for _, entryDir := range entryDirs {
+		info, serr := os.Stat(filepath.Join(entryDir, cacheCompleteMarker))
+		if serr != nil {
+			continue
+		}
+		entry := &cacheEntry{dir: entryDir, size: dirSize(entryDir), lastUsed: info.ModTime()}
+		total += entry.size
+		entries = append(entries, entry)
+	}
+
+	max := int64(maxMB) * 1024 * 1024
+	if total <= max {
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+	for _, entry := range entries {
+		if total <= max {
+			break
+		}
+		err = os.RemoveAll(entry.dir)
+		if err != nil {
+			return
+		}
+		total -= entry.size
+		removed++
+	}
+	return
+}
@@ -0,0 +1,132 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResultCache(t *testing.T) {
+	Convey("Given some job inputs and a result cache directory", t, func() {
+		dir, err := ioutil.TempDir("", "wr_jobqueue_test_cache_dir_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		cacheDir := filepath.Join(dir, "cache")
+		workDir := filepath.Join(dir, "work")
+		err = os.MkdirAll(workDir, os.ModePerm)
+		So(err, ShouldBeNil)
+
+		err = ioutil.WriteFile(filepath.Join(workDir, "in.txt"), []byte("input"), 0600)
+		So(err, ShouldBeNil)
+
+		job := &Job{Cmd: "cp in.txt out.txt", Cwd: workDir, Inputs: []string{"in.txt"}, Outputs: []string{"out.txt", "sub/out2.txt"}}
+
+		Convey("Cache keys depend on the cmd and input contents", func() {
+			key, err := cacheKey(job)
+			So(err, ShouldBeNil)
+			So(len(key), ShouldEqual, 32)
+
+			key2, err := cacheKey(job)
+			So(err, ShouldBeNil)
+			So(key2, ShouldEqual, key)
+
+			job2 := &Job{Cmd: "cp in.txt out.txt ", Cwd: workDir, Inputs: job.Inputs, Outputs: job.Outputs}
+			key2, err = cacheKey(job2)
+			So(err, ShouldBeNil)
+			So(key2, ShouldNotEqual, key)
+
+			err = ioutil.WriteFile(filepath.Join(workDir, "in.txt"), []byte("changed"), 0600)
+			So(err, ShouldBeNil)
+			key2, err = cacheKey(job)
+			So(err, ShouldBeNil)
+			So(key2, ShouldNotEqual, key)
+
+			job.Inputs = []string{"missing.txt"}
+			_, err = cacheKey(job)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Outputs can be stored and restored", func() {
+			job.CacheKey, err = cacheKey(job)
+			So(err, ShouldBeNil)
+			rc, err := openResultCache(cacheDir)
+			So(err, ShouldBeNil)
+			defer rc.close()
+
+			hit, err := rc.restore(job)
+			So(err, ShouldBeNil)
+			So(hit, ShouldBeFalse)
+
+			err = os.MkdirAll(filepath.Join(workDir, "sub"), os.ModePerm)
+			So(err, ShouldBeNil)
+			err = ioutil.WriteFile(filepath.Join(workDir, "out.txt"), []byte("output"), 0600)
+			So(err, ShouldBeNil)
+			err = ioutil.WriteFile(filepath.Join(workDir, "sub", "out2.txt"), []byte("output2"), 0600)
+			So(err, ShouldBeNil)
+			err = rc.store(job)
+			So(err, ShouldBeNil)
+
+			err = os.RemoveAll(filepath.Join(workDir, "sub"))
+			So(err, ShouldBeNil)
+			err = os.Remove(filepath.Join(workDir, "out.txt"))
+			So(err, ShouldBeNil)
+
+			hit, err = rc.restore(job)
+			So(err, ShouldBeNil)
+			So(hit, ShouldBeTrue)
+			content, err := ioutil.ReadFile(filepath.Join(workDir, "out.txt"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "output")
+			content, err = ioutil.ReadFile(filepath.Join(workDir, "sub", "out2.txt"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "output2")
+
+			Convey("Least recently used entries can be evicted", func() {
+				oldJob := &Job{Cmd: "old", Cwd: workDir, Outputs: []string{"out.txt"}}
+				oldJob.CacheKey, err = cacheKey(oldJob)
+				So(err, ShouldBeNil)
+				err = ioutil.WriteFile(filepath.Join(workDir, "out.txt"), make([]byte, 1024*1024), 0600)
+				So(err, ShouldBeNil)
+				err = rc.store(oldJob)
+				So(err, ShouldBeNil)
+				past := time.Now().Add(-1 * time.Hour)
+				err = os.Chtimes(filepath.Join(rc.entryDir(oldJob.CacheKey), cacheCompleteMarker), past, past)
+				So(err, ShouldBeNil)
+
+				removed, err := evictResultCache(cacheDir, 2)
+				So(err, ShouldBeNil)
+				So(removed, ShouldEqual, 0)
+
+				removed, err = evictResultCache(cacheDir, 1)
+				So(err, ShouldBeNil)
+				So(removed, ShouldEqual, 1)
+				_, err = os.Stat(rc.entryDir(oldJob.CacheKey))
+				So(err, ShouldNotBeNil)
+				hit, err = rc.restore(job)
+				So(err, ShouldBeNil)
+				So(hit, ShouldBeTrue)
+			})
+		})
+	})
+}
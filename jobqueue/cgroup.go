@@ -0,0 +1,350 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for running Cmds in their own cgroup (v2) on
+// linux, so that their memory and cpu usage can be limited and measured
+// precisely by the kernel.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/VertebrateResequencing/wr/jobqueue/scheduler"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errCgroupJoin is returned by jobCgroup.start() if we couldn't join the
+// cgroup.
+var errCgroupJoin = errors.New("could not join the cgroup")
+
+// cgroupRoot is where the cgroup v2 unified hierarchy is mounted.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupCPUPeriod is the period (in microseconds) we use for cpu.max.
+const cgroupCPUPeriod = 100000
+
+var (
+	cgroupMutex       sync.Mutex
+	cgroupUsers       int
+	cgroupParent      string
+	cgroupLeaf        string
+	cgroupControllers map[string]bool
+)
+
+// acquireCgroup returns the cgroup directory that we can create Cmd cgroups
+// in, and which controllers are enabled for them. If no other Cmd is using it,
+// we first move ourselves in to a leaf cgroup of the cgroup we were started
+// in, and enable the memory and cpu controllers for its children; this only
+// works if that cgroup was delegated to us (eg. by systemd or the job
+// scheduler). Returns an empty dir if cgroups can't be used; otherwise you
+// must call releaseCgroup() once your Cmd has exited.
+func acquireCgroup() (dir string, controllers map[string]bool) {
+	if !ClientUseCgroups {
+		return
+	}
+	cgroupMutex.Lock()
+	defer cgroupMutex.Unlock()
+	if cgroupParent == "" && !setupCgroup() {
+		return
+	}
+	cgroupUsers++
+	return cgroupParent, cgroupControllers
+}
+
+// setupCgroup does the work for acquireCgroup(), returning true if we're now
+// in our leaf cgroup. You must hold cgroupMutex.
+func setupCgroup() bool {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return false
+	}
+	path := cgroupV2Path(f)
+	f.Close()
+	if path == "" {
+		return false
+	}
+	parent := filepath.Join(cgroupRoot, path)
+
+	available := make(map[string]bool)
+	content, err := ioutil.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return false
+	}
+	for _, c := range strings.Fields(string(content)) {
+		available[c] = true
+	}
+	if !available["memory"] {
+		return false
+	}
+
+	// runners that died without cleaning up leave behind empty leaf cgroups;
+	// the kernel refuses to delete those that are still in use
+	if stale, gerr := filepath.Glob(filepath.Join(parent, AppName+"_runner_*")); gerr == nil {
+		for _, dir := range stale {
+			os.Remove(dir)
+		}
+	}
+
+	// cgroups with enabled controllers can't contain processes, so we have to
+	// get out of the way first
+	leaf := filepath.Join(parent, fmt.Sprintf("%s_runner_%d", AppName, os.Getpid()))
+	err = os.Mkdir(leaf, 0755)
+	if err != nil {
+		return false
+	}
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	err = ioutil.WriteFile(filepath.Join(leaf, "cgroup.procs"), pid, 0644)
+	if err != nil {
+		os.Remove(leaf)
+		return false
+	}
+
+	enabled := map[string]bool{"memory": true}
+	if available["cpu"] {
+		enabled["cpu"] = true
+	}
+	err = ioutil.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), cgroupControl(enabled, "+"), 0644)
+	if err != nil {
+		// there are other processes in our cgroup that we can't move
+		ioutil.WriteFile(filepath.Join(parent, "cgroup.procs"), pid, 0644)
+		os.Remove(leaf)
+		return false
+	}
+
+	cgroupParent = parent
+	cgroupLeaf = leaf
+	cgroupControllers = enabled
+	return true
+}
+
+// releaseCgroup undoes acquireCgroup() once no Cmd is using it any more,
+// disabling the controllers we enabled, moving ourselves back in to the cgroup
+// we were started in and deleting our leaf cgroup.
+func releaseCgroup() {
+	cgroupMutex.Lock()
+	defer cgroupMutex.Unlock()
+	if cgroupUsers > 0 {
+		cgroupUsers--
+	}
+	if cgroupUsers > 0 || cgroupParent == "" {
+		return
+	}
+
+	control := filepath.Join(cgroupParent, "cgroup.subtree_control")
+	err := ioutil.WriteFile(control, cgroupControl(cgroupControllers, "-"), 0644)
+	if err != nil {
+		// stay where we are, ready for the next Cmd
+		return
+	}
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	err = ioutil.WriteFile(filepath.Join(cgroupParent, "cgroup.procs"), pid, 0644)
+	if err != nil {
+		ioutil.WriteFile(control, cgroupControl(cgroupControllers, "+"), 0644)
+		return
+	}
+	os.Remove(cgroupLeaf)
+	cgroupParent = ""
+	cgroupLeaf = ""
+	cgroupControllers = nil
+}
+
+// cgroupControl returns what to write to cgroup.subtree_control to enable
+// (sign "+") or disable (sign "-") the given controllers.
+func cgroupControl(controllers map[string]bool, sign string) []byte {
+	var names []string
+	for name := range controllers {
+		names = append(names, sign+name)
+	}
+	sort.Strings(names)
+	return []byte(strings.Join(names, " "))
+}
+
+// cgroupV2Path parses the contents of a /proc/[pid]/cgroup file, returning the
+// path of the process's cgroup in the unified (v2) hierarchy. Returns an empty
+// string if there isn't one.
+func cgroupV2Path(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::")
+		}
+	}
+	return ""
+}
+
+// jobCgroup represents the cgroup a Cmd is running in.
+type jobCgroup struct {
+	dir string
+}
+
+// newJobCgroup creates a cgroup with the given name in the parent cgroup
+// directory, limiting its memory to req.RAM and, if the cpu controller is
+// enabled, its cpu to req.Cores.
+func newJobCgroup(parent, name string, req *scheduler.Requirements, cpu bool) (*jobCgroup, error) {
+	cg := &jobCgroup{dir: filepath.Join(parent, name)}
+	err := os.Mkdir(cg.dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RAM > 0 {
+		err = cg.write("memory.max", strconv.Itoa(req.RAM*1024*1024))
+		if err != nil {
+			cg.remove()
+			return nil, err
+		}
+
+		// we want to be killed when we use too much memory, not slowly swap
+		// (this file won't exist if swap accounting is disabled)
+		cg.write("memory.swap.max", "0")
+	}
+
+	if cpu && req.Cores > 0 {
+		err = cg.write("cpu.max", fmt.Sprintf("%d %d", req.Cores*cgroupCPUPeriod, cgroupCPUPeriod))
+		if err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	return cg, err
+}
+
+// write writes a value to one of our cgroup's interface files.
+func (cg *jobCgroup) write(file, value string) error {
+	return ioutil.WriteFile(filepath.Join(cg.dir, file), []byte(value), 0644)
+}
+
+// start starts the given Cmd inside our cgroup, so that nothing it starts can
+// escape it. We do this by briefly joining the cgroup ourselves while the Cmd
+// is forked, before going back to our leaf cgroup. If we couldn't join the
+// cgroup, errCgroupJoin is returned without the Cmd being started.
+func (cg *jobCgroup) start(cmd *exec.Cmd) error {
+	cgroupMutex.Lock()
+	defer cgroupMutex.Unlock()
+	pid := strconv.Itoa(os.Getpid())
+	if cg.write("cgroup.procs", pid) != nil {
+		return errCgroupJoin
+	}
+	err := cmd.Start()
+
+	var lerr error
+	for i := 0; i < 10; i++ {
+		lerr = ioutil.WriteFile(filepath.Join(cgroupLeaf, "cgroup.procs"), []byte(pid), 0644)
+		if lerr == nil {
+			break
+		}
+		<-time.After(100 * time.Millisecond)
+	}
+	if lerr != nil && err == nil {
+		// we can't limit the Cmd without limiting ourselves
+		signalGroup(cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+		err = fmt.Errorf("could not leave the cgroup of the command: %s", lerr)
+	}
+	return err
+}
+
+// contains tells you if the process with the given pid is in our cgroup.
+func (cg *jobCgroup) contains(pid int) bool {
+	content, err := ioutil.ReadFile(filepath.Join(cg.dir, "cgroup.procs"))
+	if err != nil {
+		return false
+	}
+	for _, field := range strings.Fields(string(content)) {
+		if field == strconv.Itoa(pid) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyedValue returns the value of the given key in one of our cgroup's flat
+// keyed interface files, like memory.events or cpu.stat.
+func (cg *jobCgroup) keyedValue(file, key string) (value uint64, err error) {
+	f, err := os.Open(filepath.Join(cg.dir, file))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err = scanner.Err(); err == nil {
+		err = fmt.Errorf("%s not found in %s", key, file)
+	}
+	return
+}
+
+// anonMemory returns the anonymous memory (in MB) currently used by the
+// processes in our cgroup. Unlike memory.current and memory.peak, this excludes
+// the page cache, which the kernel can reclaim, so it is comparable to the
+// memory we measure for processes ourselves.
+func (cg *jobCgroup) anonMemory() (int, error) {
+	n, err := cg.keyedValue("memory.stat", "anon")
+	if err != nil {
+		return 0, err
+	}
+	return int(n / 1024 / 1024), nil
+}
+
+// cpuTime returns the total (user + system) cpu time used by the processes in
+// our cgroup.
+func (cg *jobCgroup) cpuTime() (time.Duration, error) {
+	usec, err := cg.keyedValue("cpu.stat", "usage_usec")
+	return time.Duration(usec) * time.Microsecond, err
+}
+
+// oomKilled tells you if any process in our cgroup was killed by the kernel
+// for using more memory than memory.max allows.
+func (cg *jobCgroup) oomKilled() bool {
+	kills, err := cg.keyedValue("memory.events", "oom_kill")
+	return err == nil && kills > 0
+}
+
+// remove kills any processes that are still in our cgroup, then deletes it.
+// (If we ourselves are somehow still in it, nothing is killed.)
+func (cg *jobCgroup) remove() {
+	if !cg.contains(os.Getpid()) {
+		cg.write("cgroup.kill", "1")
+	}
+	for i := 0; i < 10; i++ {
+		err := os.Remove(cg.dir)
+		if err == nil || os.IsNotExist(err) {
+			return
+		}
+		<-time.After(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	"github.com/VertebrateResequencing/wr/jobqueue/scheduler"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCgroups(t *testing.T) {
+	Convey("The unified cgroup path can be found", t, func() {
+		So(cgroupV2Path(strings.NewReader("0::/user.slice/wr.scope\n")), ShouldEqual, "/user.slice/wr.scope")
+		So(cgroupV2Path(strings.NewReader("12:memory:/foo\n1:name=systemd:/foo\n0::/bar\n")), ShouldEqual, "/bar")
+		So(cgroupV2Path(strings.NewReader("12:memory:/foo\n")), ShouldEqual, "")
+	})
+
+	Convey("Job cgroups are limited and measured", t, func() {
+		parent, err := ioutil.TempDir("", "wr_jobqueue_test_cgroup_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(parent)
+
+		cg, err := newJobCgroup(parent, "job", &scheduler.Requirements{RAM: 100, Cores: 2}, true)
+		So(err, ShouldBeNil)
+		So(cg.dir, ShouldEqual, filepath.Join(parent, "job"))
+
+		content, err := ioutil.ReadFile(filepath.Join(cg.dir, "memory.max"))
+		So(err, ShouldBeNil)
+		So(string(content), ShouldEqual, "104857600")
+		content, err = ioutil.ReadFile(filepath.Join(cg.dir, "cpu.max"))
+		So(err, ShouldBeNil)
+		So(string(content), ShouldEqual, "200000 100000")
+
+		_, err = cg.anonMemory()
+		So(err, ShouldNotBeNil)
+		So(cg.oomKilled(), ShouldBeFalse)
+
+		So(cg.write("memory.stat", "anon 209715200\nfile 524288000\nkernel 1048576\n"), ShouldBeNil)
+		mb, err := cg.anonMemory()
+		So(err, ShouldBeNil)
+		So(mb, ShouldEqual, 200)
+
+		So(cg.write("cpu.stat", "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n"), ShouldBeNil)
+		cpu, err := cg.cpuTime()
+		So(err, ShouldBeNil)
+		So(cpu, ShouldEqual, 2500*time.Millisecond)
+
+		So(cg.write("memory.events", "low 0\nhigh 0\nmax 3\noom 1\noom_kill 0\n"), ShouldBeNil)
+		So(cg.oomKilled(), ShouldBeFalse)
+		So(cg.write("memory.events", "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n"), ShouldBeNil)
+		So(cg.oomKilled(), ShouldBeTrue)
+
+		Convey("Cmds are started inside them, and we don't kill ourselves", func() {
+			leaf := filepath.Join(parent, "leaf")
+			So(os.Mkdir(leaf, 0755), ShouldBeNil)
+			origLeaf := cgroupLeaf
+			cgroupLeaf = leaf
+			defer func() {
+				cgroupLeaf = origLeaf
+			}()
+
+			cmd := exec.Command("true")
+			So(cg.start(cmd), ShouldBeNil)
+			So(cmd.Wait(), ShouldBeNil)
+			So(cg.contains(os.Getpid()), ShouldBeTrue)
+			content, err = ioutil.ReadFile(filepath.Join(leaf, "cgroup.procs"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, strconv.Itoa(os.Getpid()))
+
+			cg.remove()
+			_, err = os.Stat(filepath.Join(cg.dir, "cgroup.kill"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			bad := &jobCgroup{dir: filepath.Join(parent, "missing")}
+			So(bad.start(exec.Command("true")), ShouldEqual, errCgroupJoin)
+		})
+
+		Convey("Our leaf cgroup is removed once no Cmd is using it", func() {
+			leaf := filepath.Join(parent, "wr_runner_leaf")
+			So(os.Mkdir(leaf, 0755), ShouldBeNil)
+			cgroupParent, cgroupLeaf, cgroupControllers, cgroupUsers = parent, leaf, map[string]bool{"memory": true, "cpu": true}, 2
+
+			releaseCgroup()
+			So(cgroupParent, ShouldEqual, parent)
+			_, err = os.Stat(leaf)
+			So(err, ShouldBeNil)
+
+			releaseCgroup()
+			So(cgroupParent, ShouldEqual, "")
+			So(cgroupUsers, ShouldEqual, 0)
+			_, err = os.Stat(leaf)
+			So(os.IsNotExist(err), ShouldBeTrue)
+			content, err = ioutil.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "-cpu -memory")
+			content, err = ioutil.ReadFile(filepath.Join(parent, "cgroup.procs"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, strconv.Itoa(os.Getpid()))
+		})
+
+		Convey("Cpu is only limited if the controller is enabled", func() {
+			cg, err = newJobCgroup(parent, "job2", &scheduler.Requirements{RAM: 100, Cores: 2}, false)
+			So(err, ShouldBeNil)
+			_, err = os.Stat(filepath.Join(cg.dir, "cpu.max"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,318 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for letting long running Cmds save their
+// progress when they are stopped early, so that their next attempt can resume
+// instead of starting from scratch.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// These are the environment variables that Cmds with a Checkpoint are run
+// with. CheckpointDirEnv is always set to the absolute path of the
+// Checkpoint's Dir, while CheckpointResumeEnv is only set (to "1") when a
+// checkpoint from a previous attempt was restored in to that directory.
+const (
+	CheckpointDirEnv    = "WR_CHECKPOINT_DIR"
+	CheckpointResumeEnv = "WR_RESUME"
+)
+
+// checkpointStoreSubDir is the sub-directory of the server's result cache that
+// checkpoints are stored in if a Checkpoint has no Store.
+const checkpointStoreSubDir = "checkpoints"
+
+// Checkpoint describes how a Job's Cmd can save its progress, so that if it is
+// stopped early (because it ran out of time, the runner was signalled, or it
+// was killed) its next attempt can resume from where it left off.
+type Checkpoint struct {
+	// Cmd, if set, is run (in the same working directory and environment as
+	// the Job's Cmd) when the Job's Cmd has to be stopped, and should cause a
+	// checkpoint to be written to Dir.
+	Cmd string
+
+	// Signal, if Cmd isn't set, is sent to all the processes of the Job's Cmd
+	// when it has to be stopped, to ask it to write a checkpoint to Dir.
+	Signal syscall.Signal
+
+	// Wait is how long Cmd or Signal is given to write a checkpoint before the
+	// Job's Cmd is stopped. Defaults to ClientKillGracePeriod.
+	Wait time.Duration
+
+	// Interval, if set, causes a checkpoint to be triggered and saved
+	// periodically while the Job's Cmd runs, so that progress isn't lost even
+	// if the runner dies without warning. It requires Cmd, since a checkpoint
+	// is only saved once Cmd has exited successfully.
+	Interval time.Duration
+
+	// Dir is the directory the Job's Cmd writes its checkpoints to. Relative
+	// paths are relative to the Cmd's actual working directory.
+	Dir string
+
+	// Store is where checkpoints are copied to once the Job's Cmd exits
+	// unsuccessfully, and restored from when it next runs. It can be a local
+	// (ideally shared) directory, a directory within the mount point of one of
+	// the Job's MountConfigs (in which case the checkpoint is uploaded when
+	// the Job is unmounted), or an S3 path like s3://[profile@]bucket/path.
+	// If not set, the server's result cache location is used (where they
+	// count towards its size limit, so may be evicted), unless CwdMatters is
+	// true, in which case checkpoints are simply left in place.
+	Store string
+}
+
+// wait returns Wait, or its default.
+func (cp *Checkpoint) wait() time.Duration {
+	if cp.Wait > 0 {
+		return cp.Wait
+	}
+	return ClientKillGracePeriod
+}
+
+// path returns the absolute path of Dir, given the actual working directory of
+// the Job's Cmd.
+func (cp *Checkpoint) path(cwd string) string {
+	if filepath.IsAbs(cp.Dir) {
+		return cp.Dir
+	}
+	return filepath.Join(cwd, cp.Dir)
+}
+
+// location returns where the given Job's checkpoints should be stored, or an
+// empty string if they don't need to be (or can't be) copied anywhere.
+func (cp *Checkpoint) location(job *Job) string {
+	switch {
+	case cp.Store != "":
+		return cp.Store
+	case job.CwdMatters:
+		return ""
+	case job.cacheDir != "":
+		// (not filepath.Join(), which would break s3:// locations)
+		return job.cacheDir + "/" + checkpointStoreSubDir
+	}
+	return ""
+}
+
+// trigger asks the running Cmd of a Job to write a checkpoint, by running our
+// Cmd using the given shell, working directory and environment, or by sending
+// our Signal to the process group led by pid. It returns once the checkpoint
+// has been written, our Wait has elapsed or exited has been closed. completed
+// is true if our Cmd exited successfully within Wait, or if we sent our Signal
+// and the Job's Cmd then exited.
+func (cp *Checkpoint) trigger(shell, cwd string, env []string, pid int, exited <-chan bool) (completed bool) {
+	switch {
+	case cp.Cmd != "":
+		ccmd := exec.Command(shell, "-c", cp.Cmd)
+		ccmd.Dir = cwd
+		ccmd.Env = env
+		ccmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		if ccmd.Start() != nil {
+			return
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- ccmd.Wait()
+		}()
+		select {
+		case err := <-done:
+			return err == nil
+		case <-time.After(cp.wait()):
+			signalGroup(ccmd.Process.Pid, syscall.SIGKILL)
+			<-done
+		}
+	case cp.Signal != 0:
+		signalGroup(pid, cp.Signal)
+		select {
+		case <-exited:
+			return true
+		case <-time.After(cp.wait()):
+		}
+	}
+	return
+}
+
+// save copies a Job's checkpoint directory (given its Cmd's actual working
+// directory) to our store, replacing any previously saved checkpoint. It does
+// nothing if the directory is empty or doesn't exist, and returns an error if
+// there is nowhere to store it. The copy is made in a temporary directory that
+// then replaces the previous checkpoint, so that if we fail part way through,
+// the previous checkpoint is still intact.
+func (cp *Checkpoint) save(job *Job, cwd string) error {
+	src := cp.path(cwd)
+	if files, err := ioutil.ReadDir(src); err != nil || len(files) == 0 {
+		return nil
+	}
+	location := cp.location(job)
+	if location == "" {
+		if job.CwdMatters {
+			return nil
+		}
+		return fmt.Errorf("checkpoint could not be saved, since it has no store and the manager has no cache dir")
+	}
+
+	store, err := openResultCache(location)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	dir := store.entryDir(job.key())
+	err = os.MkdirAll(filepath.Dir(dir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), filepath.Base(dir)+".saving")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	err = copyDir(src, tmp)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %s", err)
+	}
+	f, err := os.Create(filepath.Join(tmp, cacheCompleteMarker))
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	// (directories can't be renamed over non-empty ones, so we move the
+	// previous checkpoint out of the way first)
+	old := tmp + ".old"
+	err = os.Rename(dir, old)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Rename(tmp, dir)
+	if err != nil {
+		os.Rename(old, dir)
+		return fmt.Errorf("failed to save checkpoint: %s", err)
+	}
+	os.RemoveAll(old)
+	return store.close()
+}
+
+// restore copies the most recently saved checkpoint of a Job from our store in
+// to its checkpoint directory (given its Cmd's actual working directory),
+// returning true if there was one to restore. When checkpoints are left in
+// place, returns true if the checkpoint directory isn't empty.
+func (cp *Checkpoint) restore(job *Job, cwd string) (restored bool, err error) {
+	dest := cp.path(cwd)
+	location := cp.location(job)
+	if location == "" {
+		files, rerr := ioutil.ReadDir(dest)
+		return rerr == nil && len(files) > 0, nil
+	}
+
+	store, err := openResultCache(location)
+	if err != nil {
+		return
+	}
+	defer store.close()
+
+	dir := store.entryDir(job.key())
+	if _, serr := os.Stat(filepath.Join(dir, cacheCompleteMarker)); serr != nil {
+		return
+	}
+	err = copyDir(dir, dest)
+	if err != nil {
+		return
+	}
+	os.Remove(filepath.Join(dest, cacheCompleteMarker))
+	return true, nil
+}
+
+// discard deletes any saved checkpoint of a Job, for use once its Cmd has
+// completed successfully.
+func (cp *Checkpoint) discard(job *Job) error {
+	location := cp.location(job)
+	if location == "" {
+		return nil
+	}
+
+	store, err := openResultCache(location)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	err = os.RemoveAll(store.entryDir(job.key()))
+	if err != nil {
+		return err
+	}
+	return store.close()
+}
+
+// CheckpointViaJSON describes a Checkpoint in a form suitable for JSON and
+// YAML job definitions.
+type CheckpointViaJSON struct {
+	Cmd string `json:"cmd"`
+	// Signal is a signal name like USR1, or number.
+	Signal string `json:"signal"`
+	// Wait and Interval are durations with a unit suffix, eg. 30s.
+	Wait     string `json:"wait"`
+	Interval string `json:"interval"`
+	Dir      string `json:"dir"`
+	Store    string `json:"store"`
+}
+
+// Checkpoint converts to a Checkpoint, returning an error if any of the values
+// are invalid.
+func (c *CheckpointViaJSON) Checkpoint() (cp *Checkpoint, err error) {
+	if c.Dir == "" {
+		err = fmt.Errorf("checkpoint dir must be specified")
+		return
+	}
+	cp = &Checkpoint{Cmd: c.Cmd, Dir: c.Dir, Store: c.Store}
+	if c.Signal != "" {
+		cp.Signal, err = parseSignal(c.Signal)
+		if err != nil {
+			err = fmt.Errorf("checkpoint signal value (%s) was not specified correctly: %s", c.Signal, err)
+			return
+		}
+	}
+	if c.Wait != "" {
+		cp.Wait, err = time.ParseDuration(c.Wait)
+		if err != nil {
+			err = fmt.Errorf("checkpoint wait value (%s) was not specified correctly: %s", c.Wait, err)
+			return
+		}
+	}
+	if c.Interval != "" {
+		if c.Cmd == "" {
+			err = fmt.Errorf("checkpoint interval requires a cmd, so that we know when each checkpoint has been written")
+			return
+		}
+		cp.Interval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			err = fmt.Errorf("checkpoint interval value (%s) was not specified correctly: %s", c.Interval, err)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,153 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	Convey("Checkpoints can be specified in JSON", t, func() {
+		cpj := &CheckpointViaJSON{Dir: "ckpt", Signal: "usr1", Wait: "2m"}
+		cp, err := cpj.Checkpoint()
+		So(err, ShouldBeNil)
+		So(cp.Signal, ShouldEqual, syscall.SIGUSR1)
+		So(cp.Wait, ShouldEqual, 2*time.Minute)
+
+		cpj.Interval = "4h"
+		_, err = cpj.Checkpoint()
+		So(err, ShouldNotBeNil)
+		cpj.Cmd = "kill -USR1 1234"
+		cp, err = cpj.Checkpoint()
+		So(err, ShouldBeNil)
+		So(cp.Interval, ShouldEqual, 4*time.Hour)
+
+		_, err = (&CheckpointViaJSON{Signal: "USR1"}).Checkpoint()
+		So(err, ShouldNotBeNil)
+		_, err = (&CheckpointViaJSON{Dir: "ckpt", Signal: "FOO"}).Checkpoint()
+		So(err, ShouldNotBeNil)
+		_, err = (&CheckpointViaJSON{Dir: "ckpt", Wait: "soon"}).Checkpoint()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Checkpoints can be triggered, saved, restored and discarded", t, func() {
+		tmpdir, err := ioutil.TempDir("", "wr_jobqueue_test_checkpoint_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmpdir)
+		cwd1 := filepath.Join(tmpdir, "cwd1")
+		cwd2 := filepath.Join(tmpdir, "cwd2")
+		store := filepath.Join(tmpdir, "store")
+
+		job := &Job{Cmd: "my_long_cmd", Cwd: tmpdir}
+		cp := &Checkpoint{Cmd: "mkdir -p ckpt/sub && echo 5 > ckpt/sub/progress", Dir: "ckpt", Store: store}
+		So(cp.path(cwd1), ShouldEqual, filepath.Join(cwd1, "ckpt"))
+		So(os.MkdirAll(cwd1, os.ModePerm), ShouldBeNil)
+
+		restored, err := cp.restore(job, cwd1)
+		So(err, ShouldBeNil)
+		So(restored, ShouldBeFalse)
+
+		So(cp.save(job, cwd1), ShouldBeNil)
+		entries, err := filepath.Glob(filepath.Join(store, "*", "*"))
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 0)
+
+		So(cp.trigger("bash", cwd1, os.Environ(), 0, nil), ShouldBeTrue)
+		So(cp.save(job, cwd1), ShouldBeNil)
+
+		// saving again replaces the previous checkpoint, leaving nothing
+		// else behind
+		So(ioutil.WriteFile(filepath.Join(cwd1, "ckpt", "sub", "progress"), []byte("6\n"), 0644), ShouldBeNil)
+		So(cp.save(job, cwd1), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(cwd1, "ckpt", "sub", "progress"), []byte("5\n"), 0644), ShouldBeNil)
+		So(cp.save(job, cwd1), ShouldBeNil)
+		entries, err = filepath.Glob(filepath.Join(store, "*", "*"))
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 1)
+
+		restored, err = cp.restore(job, cwd2)
+		So(err, ShouldBeNil)
+		So(restored, ShouldBeTrue)
+		content, err := ioutil.ReadFile(filepath.Join(cwd2, "ckpt", "sub", "progress"))
+		So(err, ShouldBeNil)
+		So(string(content), ShouldEqual, "5\n")
+		_, err = os.Stat(filepath.Join(cwd2, "ckpt", cacheCompleteMarker))
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		So(cp.discard(job), ShouldBeNil)
+		restored, err = cp.restore(job, filepath.Join(tmpdir, "cwd3"))
+		So(err, ShouldBeNil)
+		So(restored, ShouldBeFalse)
+
+		Convey("Triggers report if they didn't complete", func() {
+			cp.Cmd = "false"
+			So(cp.trigger("bash", cwd1, os.Environ(), 0, nil), ShouldBeFalse)
+			cp.Cmd = "sleep 5"
+			cp.Wait = 10 * time.Millisecond
+			So(cp.trigger("bash", cwd1, os.Environ(), 0, nil), ShouldBeFalse)
+		})
+
+		Convey("Without a store, checkpoints of cwd_matters jobs are left in place", func() {
+			job.CwdMatters = true
+			cp.Store = ""
+			So(cp.location(job), ShouldEqual, "")
+			restored, err = cp.restore(job, cwd1)
+			So(err, ShouldBeNil)
+			So(restored, ShouldBeTrue)
+		})
+
+		Convey("Without a store, checkpoints are kept in the result cache", func() {
+			cp.Store = ""
+			So(cp.location(job), ShouldEqual, "")
+			job.cacheDir = "s3://bucket/cache"
+			So(cp.location(job), ShouldEqual, "s3://bucket/cache/checkpoints")
+		})
+
+		Convey("Without a store or result cache, saving checkpoints fails", func() {
+			cp.Store = ""
+			So(cp.trigger("bash", cwd1, os.Environ(), 0, nil), ShouldBeTrue)
+			err = cp.save(job, cwd1)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no store")
+		})
+
+		Convey("Checkpoints kept in a local result cache are evicted from it", func() {
+			cp.Store = ""
+			job.cacheDir = filepath.Join(tmpdir, "cache")
+			So(cp.trigger("bash", cwd1, os.Environ(), 0, nil), ShouldBeTrue)
+			So(cp.save(job, cwd1), ShouldBeNil)
+
+			removed, err := evictResultCache(job.cacheDir, 1)
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 0)
+			removed, err = evictResultCache(job.cacheDir, 0)
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 1)
+			restored, err = cp.restore(job, cwd2)
+			So(err, ShouldBeNil)
+			So(restored, ShouldBeFalse)
+		})
+	})
+}
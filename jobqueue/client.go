@@ -27,12 +27,14 @@ import (
 	"github.com/go-mangos/mangos"
 	"github.com/go-mangos/mangos/protocol/req"
 	"github.com/go-mangos/mangos/transport/tcp"
+	"github.com/inconshreveable/log15"
 	"github.com/satori/go.uuid"
 	"github.com/ugorji/go/codec"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
@@ -50,6 +52,7 @@ const (
 	FailReasonCExit    = "command invalid exit code"
 	FailReasonExit     = "command exited non-zero"
 	FailReasonRAM      = "command used too much RAM"
+	FailReasonDisk     = "command used too much disk space"
 	FailReasonTime     = "command used too much time"
 	FailReasonAbnormal = "command failed to complete normally"
 	FailReasonLost     = "lost contact with runner"
@@ -66,10 +69,14 @@ const (
 var (
 	ClientTouchInterval               = 15 * time.Second
 	ClientReleaseDelay                = 30 * time.Second
+	ClientDiskCheckInterval           = 5 * time.Second
+	ClientUseCgroups                  = true
+	ClientKillGracePeriod             = 30 * time.Second
 	RAMIncreaseMin            float64 = 1000
 	RAMIncreaseMultLow                = 2.0
 	RAMIncreaseMultHigh               = 1.3
 	RAMIncreaseMultBreakpoint float64 = 8192
+	DiskIncreaseMult                  = 2.0
 )
 
 // clientRequest is the struct that clients send to the server over the network
@@ -92,6 +99,12 @@ type clientRequest struct {
 	Limit          int
 	State          JobState
 	FirstReserve   bool
+	RecConfig      *RecommendationConfig
+	Log            *clientLog
+	Host           string
+	Audit          *AuditFilter
+	Search         *JobSearch
+	peer           string // set by the server to where the request came from
 }
 
 // Client represents the client side of the socket that the jobqueue server is
@@ -104,6 +117,7 @@ type Client struct {
 	hostID      string
 	gotHostID   bool
 	user        string
+	host        string
 	hasReserved bool
 	teMutex     sync.Mutex // to protect Touch() from other methods during Execute()
 	sync.Mutex
@@ -156,6 +170,7 @@ func Connect(addr string, queue string, timeout time.Duration) (c *Client, err e
 	// Connect() once; on the other hand, we avoid any possible problem with
 	// running on machines with low time resolution
 	c = &Client{sock: sock, queue: queue, ch: new(codec.BincHandle), user: user, clientid: uuid.NewV4()}
+	c.host, _ = os.Hostname()
 
 	// Dial succeeds even when there's no server up, so we test the connection
 	// works with a Ping()
@@ -186,6 +201,36 @@ func (c *Client) Ping(timeout time.Duration) (err error) {
 	return
 }
 
+// ServerLog has the server log the given message and key/value context at the
+// given level, along with details of this client and the host and process it
+// is running in. Runners use this so that the reasons they have problems or
+// exit end up in the server's log, instead of being lost on whatever host they
+// ran on.
+func (c *Client) ServerLog(lvl log15.Lvl, msg string, ctx ...interface{}) (err error) {
+	_, err = c.request(&clientRequest{Method: "log", Log: &clientLog{
+		Lvl: lvl,
+		Msg: msg,
+		Ctx: logContext(ctx),
+		PID: os.Getpid(),
+	}})
+	return
+}
+
+// GetAudit gets the entries in the server's audit trail of who added, kicked,
+// deleted, killed or modified which jobs, and who drained, shut down or backed
+// up the server, oldest first. filter can be nil to get everything.
+func (c *Client) GetAudit(filter *AuditFilter) (entries []*AuditEntry, err error) {
+	if filter == nil {
+		filter = &AuditFilter{}
+	}
+	resp, err := c.request(&clientRequest{Method: "getaudit", Audit: filter})
+	if err != nil {
+		return
+	}
+	entries = resp.Audit
+	return
+}
+
 // DrainServer tells the server to stop spawning new runners, stop letting
 // existing runners reserve new jobs, and exit once existing runners stop
 // running. You get back a count of existing runners and and an estimated time
@@ -256,7 +301,18 @@ func (c *Client) BackupDB(path string) (err error) {
 // The envVars argument is a slice of ("key=value") strings with the environment
 // variables you want to be set when the job's Cmd actually runs. Typically you
 // would pass in os.Environ().
+//
+// Jobs that specify Outputs first have CheckFreshness() called on them. Those
+// that are then FreshnessUpToDate will be stored as complete without being run
+// (and counted as existed), while those that are FreshnessStale will be run
+// even if they had previously completed and ignoreComplete is true.
+//
+// Jobs that have an Array count as added (or existed) once for each of their
+// elements.
 func (c *Client) Add(jobs []*Job, envVars []string, ignoreComplete bool) (added int, existed int, err error) {
+	for _, job := range jobs {
+		job.CheckFreshness()
+	}
 	resp, err := c.request(&clientRequest{Method: "add", Jobs: jobs, Env: c.CompressEnv(envVars), IgnoreComplete: ignoreComplete})
 	if err != nil {
 		return
@@ -290,6 +346,9 @@ func (c *Client) Reserve(timeout time.Duration) (j *Job, err error) {
 		return
 	}
 	j = resp.Job
+	if j != nil {
+		j.cacheDir = resp.CacheDir
+	}
 	return
 }
 
@@ -315,6 +374,9 @@ func (c *Client) ReserveScheduled(timeout time.Duration, schedulerGroup string)
 		return
 	}
 	j = resp.Job
+	if j != nil {
+		j.cacheDir = resp.CacheDir
+	}
 	return
 }
 
@@ -340,14 +402,29 @@ func (c *Client) ReserveScheduled(timeout time.Duration, schedulerGroup string)
 // mounted prior to running the Cmd, and unmounted afterwards.
 //
 // Internally, Execute() calls Mount(), Started() and Ended() and keeps track of
-// peak RAM used. It regularly calls Touch() on the Job so that the server knows
-// we are still alive and handling the Job successfully. It also intercepts
-// SIGTERM, SIGINT, SIGQUIT, SIGUSR1 and SIGUSR2, sending SIGKILL to the running
-// Cmd and returning Error.Err(FailReasonSignal); you should check for this and
-// exit your process. Finally it calls Unmount() and TriggerBehaviours().
+// peak RAM used. On linux, if the process calling Execute() was started in a
+// cgroup (v2) that was delegated to it, the Cmd is started inside its own child
+// cgroup limited to the Job's RAM and cores, and the kernel's accounting is used
+// to help determine its peak RAM and cpu time (and if it used too much RAM). It
+// regularly calls Touch() on the Job so that the server knows we are still
+// alive and handling the Job successfully. It also intercepts SIGTERM, SIGINT,
+// SIGQUIT, SIGUSR1 and SIGUSR2, stopping the running Cmd and returning
+// Error.Err(FailReasonSignal); you should check for this and exit your process.
+// Finally it calls Unmount() and TriggerBehaviours().
+//
+// The Cmd is run in its own process group, and is stopped by carrying out the
+// Job's KillSequence against the whole group, or by sending the group SIGKILL
+// if there isn't one. (Cmds using too much RAM or disk are always killed
+// immediately.) Once the Cmd exits, anything it left running in its process
+// group is killed.
+//
+// If the Job has a Checkpoint, any checkpoint saved by a previous attempt is
+// restored before the Cmd runs, and the Cmd is asked to checkpoint before
+// being stopped; unless the Cmd succeeds, its checkpoint is then saved for the
+// next attempt.
 //
 // If Kill() is called while executing the Cmd, the next internal Touch() call
-// will result in the Cmd being killed and the job being Bury()ied.
+// will result in the Cmd being stopped and the job being Bury()ied.
 //
 // If no error is returned, the Cmd will have run OK, exited with status 0, and
 // been Archive()d from the queue while being placed in the permanent store.
@@ -376,6 +453,10 @@ func (c *Client) Execute(job *Job, shell string) error {
 	}
 	cmd := exec.Command(shell, "-c", jc)
 
+	// the command gets its own process group, so that we can signal it and
+	// everything it starts (eg. all the parts of a pipeline) together
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
 	// we'll filter STDERR/OUT of the cmd to keep only the first and last line
 	// of any contiguous block of \r terminated lines (to mostly eliminate
 	// progress bars), and  we'll store only up to 4kb of their head and tail
@@ -423,6 +504,10 @@ func (c *Client) Execute(job *Job, shell string) error {
 			err = job.Mount()
 		}
 		if err != nil {
+			if job.RetryPolicy != nil && job.willRetry(FailReasonMount) {
+				c.Release(job, FailReasonMount)
+				return fmt.Errorf("failed to mount remote file system(s): %s, which may be a temporary issue, so it will be tried again", err)
+			}
 			buryErr := fmt.Errorf("failed to mount remote file system(s): %s", err)
 			c.Bury(job, FailReasonMount, buryErr)
 			return buryErr
@@ -448,8 +533,52 @@ func (c *Client) Execute(job *Job, shell string) error {
 			env = envOverride(env, []string{"HOME=" + actualCwd})
 		}
 	}
+
+	// if the command can checkpoint, we restore its checkpoint from any
+	// previous attempt and tell it to resume. Checkpoint problems aren't fatal,
+	// but are reported in the command's stderr
+	cp := job.Checkpoint
+	var cpProblems []string
+	if cp != nil {
+		cpDir := cp.path(cmd.Dir)
+		err = os.MkdirAll(cpDir, os.ModePerm)
+		if err != nil {
+			c.Bury(job, FailReasonCwd)
+			job.Unmount(true)
+			return fmt.Errorf("could not create checkpoint directory: %s", err)
+		}
+		env = envOverride(env, []string{CheckpointDirEnv + "=" + cpDir})
+		restored, rerr := cp.restore(job, cmd.Dir)
+		switch {
+		case rerr != nil:
+			// we can still run the command from scratch
+			cpProblems = append(cpProblems, fmt.Sprintf("failed to restore checkpoint: %s", rerr))
+		case restored:
+			env = envOverride(env, []string{CheckpointResumeEnv + "=1"})
+		}
+	}
 	cmd.Env = env
 
+	// if the outputs of an identical previous run of the command are in the
+	// result cache, restore them instead of running it. Problems with the
+	// cache are not fatal; we just run the command normally
+	var rcache *resultCache
+	if job.Cache && job.cacheDir != "" && len(job.Outputs) > 0 {
+		key, cerr := cacheKey(job)
+		if cerr == nil {
+			rcache, cerr = openResultCache(job.cacheDir)
+		}
+		if cerr == nil {
+			defer rcache.close()
+			job.CacheKey = key
+			hit, rerr := rcache.restore(job)
+			if hit && rerr == nil {
+				job.CacheStatus = CacheHit
+				cmd.Args = []string{shell, "-c", "true"}
+			}
+		}
+	}
+
 	// intercept certain signals (under LSF and SGE, SIGUSR2 may mean out-of-
 	// time, but there's no reliable way of knowing out-of-memory, so we will
 	// just treat them all the same)
@@ -457,22 +586,49 @@ func (c *Client) Execute(job *Job, shell string) error {
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
 	defer signal.Stop(sigs)
 
-	// start running the command
+	// on linux, if we've been delegated a cgroup, we run the command in its
+	// own child cgroup so that the kernel can limit and measure its memory
+	// and cpu usage
+	var cg *jobCgroup
+	if cgParent, controllers := acquireCgroup(); cgParent != "" {
+		defer releaseCgroup()
+		cg, _ = newJobCgroup(cgParent, fmt.Sprintf("%s_job_%s_%d", AppName, job.key(), os.Getpid()), job.Requirements, controllers["cpu"])
+	}
+
+	// start running the command (inside its cgroup from the outset, so that
+	// nothing it forks can escape)
 	endT := time.Now().Add(job.Requirements.Time)
-	err = cmd.Start()
+	if cg != nil {
+		err = cg.start(cmd)
+		if err == errCgroupJoin {
+			cg.remove()
+			cg = nil
+			err = cmd.Start()
+		}
+	} else {
+		err = cmd.Start()
+	}
 	if err != nil {
 		// some obscure internal error about setting things up
+		if cg != nil {
+			cg.remove()
+		}
 		c.Release(job, FailReasonStart)
 		job.Unmount(true)
 		return fmt.Errorf("could not start command [%s]: %s", jc, err)
 	}
+	if cg != nil {
+		// (this also kills anything the cmd left running in the background)
+		defer cg.remove()
+	}
 
 	// update the server that we've started the job
 	err = c.Started(job, cmd.Process.Pid)
 	if err != nil {
 		// if we can't access the server, may as well bail out now - kill the
 		// command (and don't bother trying to Release(); it will auto-Release)
-		cmd.Process.Kill()
+		signalGroup(cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
 		job.TriggerBehaviours(false)
 		job.Unmount(true)
 		return fmt.Errorf("command [%s] started running, but I killed it due to a jobqueue server error: %s", job.Cmd, err)
@@ -485,6 +641,62 @@ func (c *Client) Execute(job *Job, shell string) error {
 	memTicker := time.NewTicker(1 * time.Second)  // we need to check on memory usage frequently
 	ranoutMem := false
 	ranoutTime := false
+
+	// we can only check on disk usage when the cmd runs in its own unique
+	// directory, in which case we measure that and its TMPDIR together
+	peakdisk := 0
+	ranoutDisk := false
+	var diskTicker *time.Ticker
+	var diskCheck <-chan time.Time
+	// (walking a big directory can be slow, so we measure it in the
+	// background, one walk at a time, so as not to hold up touching)
+	diskSizes := make(chan int, 1)
+	diskWalking := false
+	if !job.CwdMatters {
+		diskTicker = time.NewTicker(ClientDiskCheckInterval)
+		diskCheck = diskTicker.C
+	}
+	// if the command has a hard time limit, we'll stop it if it runs for too
+	// long
+	var timeLimit <-chan time.Time
+	timedOut := false
+	if job.TimeLimit > 0 {
+		limitTimer := time.NewTimer(time.Duration(float64(job.Requirements.Time) * job.TimeLimit))
+		defer limitTimer.Stop()
+		timeLimit = limitTimer.C
+	}
+	// when we're asked to stop the command we'll give it the chance to
+	// checkpoint, then carry out the job's kill sequence, or by default just
+	// kill it immediately. Over-resource commands are always killed
+	// immediately, since they could be screwing up the machine we're running
+	// on. While a kill sequence is being carried out we carry on touching the
+	// job, so that it isn't considered lost
+	pid := cmd.Process.Pid
+	exited := make(chan bool)
+	stopping := false
+	stop := func(ks KillSequence, checkpoint bool) {
+		if stopping && ks != nil {
+			return
+		}
+		stopping = true
+		go func() {
+			if checkpoint && cp != nil {
+				cp.trigger(shell, cmd.Dir, env, pid, exited)
+			}
+			ks.run(pid, exited)
+		}()
+	}
+
+	// commands that checkpoint periodically have their checkpoints saved
+	// as they go
+	var cpMutex sync.Mutex
+	cpBusy := make(chan bool, 1)
+	var cpCheck <-chan time.Time
+	if cp != nil && cp.Interval > 0 {
+		cpTicker := time.NewTicker(cp.Interval)
+		defer cpTicker.Stop()
+		cpCheck = cpTicker.C
+	}
 	signalled := false
 	killCalled := false
 	var stateMutex sync.Mutex
@@ -493,11 +705,16 @@ func (c *Client) Execute(job *Job, shell string) error {
 		for {
 			select {
 			case <-sigs:
-				cmd.Process.Kill()
+				// (if we're signalled again while stopping gracefully, we
+				// kill immediately)
+				if stopping {
+					stop(nil, false)
+				} else {
+					stop(job.KillSequence, true)
+				}
 				stateMutex.Lock()
 				signalled = true
 				stateMutex.Unlock()
-				return
 			case <-ticker.C:
 				stateMutex.Lock()
 				if !ranoutTime && time.Now().After(endT) {
@@ -514,15 +731,21 @@ func (c *Client) Execute(job *Job, shell string) error {
 					// will keep trying to touch until it works
 					continue
 				}
-				if kc {
-					cmd.Process.Kill()
+				if kc && !killCalled {
+					stop(job.KillSequence, true)
 					stateMutex.Lock()
 					killCalled = true
 					stateMutex.Unlock()
-					return
 				}
 			case <-memTicker.C:
 				mem, err := currentMemory(job.Pid)
+				if cg != nil {
+					// (the cgroup also counts processes that escaped the
+					// cmd's process tree)
+					if cgmem, cgerr := cg.anonMemory(); cgerr == nil && (err != nil || cgmem > mem) {
+						mem, err = cgmem, nil
+					}
+				}
 				stateMutex.Lock()
 				if err == nil && mem > peakmem {
 					peakmem = mem
@@ -530,13 +753,71 @@ func (c *Client) Execute(job *Job, shell string) error {
 					if peakmem > job.Requirements.RAM {
 						// we don't allow things to use too much memory, or we
 						// could screw up the machine we're running on
-						cmd.Process.Kill()
+						stop(nil, false)
 						ranoutMem = true
 						stateMutex.Unlock()
 						return
 					}
 				}
 				stateMutex.Unlock()
+			case <-timeLimit:
+				// ask the command to stop gracefully, and make it stop if it
+				// hasn't after a grace period
+				ks := job.KillSequence
+				if ks == nil {
+					ks = KillSequence{{Signal: syscall.SIGTERM, Wait: ClientKillGracePeriod}}
+				}
+				stop(ks, true)
+				stateMutex.Lock()
+				ranoutTime = true
+				timedOut = true
+				stateMutex.Unlock()
+			case <-diskCheck:
+				if diskWalking {
+					continue
+				}
+				diskWalking = true
+				go func() {
+					diskSizes <- int(dirSize(filepath.Dir(actualCwd)) / 1024 / 1024)
+				}()
+			case disk := <-diskSizes:
+				diskWalking = false
+				stateMutex.Lock()
+				if disk > peakdisk {
+					peakdisk = disk
+
+					if job.Requirements.Disk > 0 && peakdisk > job.Requirements.Disk*1024 {
+						// we don't allow things to use too much disk space,
+						// or we could fill up scratch space shared with
+						// other jobs
+						stop(nil, false)
+						ranoutDisk = true
+						stateMutex.Unlock()
+						return
+					}
+				}
+				stateMutex.Unlock()
+			case <-cpCheck:
+				if stopping {
+					continue
+				}
+				select {
+				case cpBusy <- true:
+					go func() {
+						cpMutex.Lock()
+						if cp.trigger(shell, cmd.Dir, env, pid, exited) {
+							if serr := cp.save(job, cmd.Dir); serr != nil {
+								cpProblems = append(cpProblems, serr.Error())
+							}
+						} else {
+							cpProblems = append(cpProblems, "periodic checkpoint cmd did not complete successfully, so the checkpoint was not saved")
+						}
+						cpMutex.Unlock()
+						<-cpBusy
+					}()
+				default:
+					// the previous checkpoint is still being saved
+				}
 			case <-stopChecking:
 				return
 			}
@@ -547,8 +828,18 @@ func (c *Client) Execute(job *Job, shell string) error {
 	<-stderrWait
 	<-stdoutWait
 	err = cmd.Wait()
+	close(exited)
+
+	// the command may have left things running in the background, or if it
+	// was killed, its shell may have died before the rest of its pipeline;
+	// make sure none of its process group are left behind (they'll be reaped
+	// by init)
+	signalGroup(pid, syscall.SIGKILL)
 	ticker.Stop()
 	memTicker.Stop()
+	if diskTicker != nil {
+		diskTicker.Stop()
+	}
 	stopChecking <- true
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
@@ -567,6 +858,18 @@ func (c *Client) Execute(job *Job, shell string) error {
 		}
 	}
 
+	// the kernel knows best how much cpu time the command used, and if it
+	// was killed for using too much memory
+	cputime := cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	if cg != nil {
+		if cgcpu, cgerr := cg.cpuTime(); cgerr == nil && cgcpu > cputime {
+			cputime = cgcpu
+		}
+		if cg.oomKilled() {
+			ranoutMem = true
+		}
+	}
+
 	// include our own memory usage in the peakmem of the command, since the
 	// peak memory is used to schedule us in the job scheduler, which may
 	// kill us for using more memory than expected: we need to allow for our
@@ -584,11 +887,22 @@ func (c *Client) Execute(job *Job, shell string) error {
 	dorelease := false
 	doarchive := false
 	failreason := ""
-	var mayBeTemp string
-	if job.UntilBuried > 1 {
-		mayBeTemp = ", which may be a temporary issue, so it will be tried again"
+	mayBeTemp := func(reason string) string {
+		if job.willRetry(reason) {
+			return ", which may be a temporary issue, so it will be tried again"
+		}
+		return ""
 	}
-	if err != nil {
+	if timedOut {
+		// we stopped it for exceeding its hard time limit, so it failed
+		// regardless of how it exited
+		if exitError, ok := err.(*exec.ExitError); ok {
+			exitcode = exitError.Sys().(syscall.WaitStatus).ExitStatus()
+		}
+		dorelease = true
+		failreason = FailReasonTime
+		myerr = Error{c.queue, "Execute", job.key(), FailReasonTime}
+	} else if err != nil {
 		// there was a problem running the command
 		if exitError, ok := err.(*exec.ExitError); ok {
 			exitcode = exitError.Sys().(syscall.WaitStatus).ExitStatus()
@@ -610,6 +924,9 @@ func (c *Client) Execute(job *Job, shell string) error {
 				if ranoutMem {
 					failreason = FailReasonRAM
 					myerr = Error{c.queue, "Execute", job.key(), FailReasonRAM}
+				} else if ranoutDisk {
+					failreason = FailReasonDisk
+					myerr = Error{c.queue, "Execute", job.key(), FailReasonDisk}
 				} else if signalled {
 					if ranoutTime {
 						failreason = FailReasonTime
@@ -622,9 +939,13 @@ func (c *Client) Execute(job *Job, shell string) error {
 					dobury = true
 					failreason = FailReasonKilled
 					myerr = Error{c.queue, "Execute", job.key(), FailReasonKilled}
+				} else if job.RetryPolicy != nil && job.RetryPolicy.buryExitCode(exitcode) {
+					dobury = true
+					failreason = FailReasonExit
+					myerr = fmt.Errorf("command [%s] exited with code %d, which its retry policy says is permanent, so it has been buried", job.Cmd, exitcode)
 				} else {
 					failreason = FailReasonExit
-					myerr = fmt.Errorf("command [%s] exited with code %d%s", job.Cmd, exitcode, mayBeTemp)
+					myerr = fmt.Errorf("command [%s] exited with code %d%s", job.Cmd, exitcode, mayBeTemp(failreason))
 				}
 			}
 		} else {
@@ -632,7 +953,7 @@ func (c *Client) Execute(job *Job, shell string) error {
 			exitcode = 255
 			dorelease = true
 			failreason = FailReasonAbnormal
-			myerr = fmt.Errorf("command [%s] failed to complete normally (%v)%s", job.Cmd, err, mayBeTemp)
+			myerr = fmt.Errorf("command [%s] failed to complete normally (%v)%s", job.Cmd, err, mayBeTemp(failreason))
 		}
 	} else {
 		// the command worked fine
@@ -643,6 +964,50 @@ func (c *Client) Execute(job *Job, shell string) error {
 
 	finalStdErr := bytes.TrimSpace(stderr.Bytes())
 
+	// note how much disk space the cmd used before any behaviours get a
+	// chance to clean up; we can only do this when it ran in its own unique
+	// directory
+	if !job.CwdMatters {
+		disk := int(dirSize(filepath.Dir(actualCwd)) / 1024 / 1024)
+		if disk > peakdisk {
+			peakdisk = disk
+		}
+		job.PeakDisk = peakdisk
+	}
+
+	// store our outputs in the result cache before any behaviours get a chance
+	// to clean them up
+	if rcache != nil && job.CacheStatus != CacheHit {
+		job.CacheStatus = ""
+		if doarchive {
+			job.CacheStatus = CacheMiss
+			if rcache.store(job) != nil || rcache.close() != nil {
+				job.CacheStatus = CacheStoreFailed
+			}
+		}
+	}
+
+	// save the command's checkpoint so that its next attempt can resume, or
+	// get rid of it if it's no longer needed, before any behaviours get a
+	// chance to clean it up or it gets unmounted
+	if cp != nil {
+		cpMutex.Lock()
+		var cperr error
+		if doarchive {
+			cperr = cp.discard(job)
+		} else {
+			cperr = cp.save(job, cmd.Dir)
+		}
+		if cperr != nil {
+			cpProblems = append(cpProblems, cperr.Error())
+		}
+		if len(cpProblems) > 0 {
+			finalStdErr = append(finalStdErr, "\n\nCheckpoint problems:\n"...)
+			finalStdErr = append(finalStdErr, strings.Join(cpProblems, "\n")...)
+		}
+		cpMutex.Unlock()
+	}
+
 	// behaviours/ unmounting may take some time we need to make sure to keep
 	// touching
 	ticker2 := time.NewTicker(ClientTouchInterval)
@@ -721,7 +1086,7 @@ func (c *Client) Execute(job *Job, shell string) error {
 	worked := false
 	for retryNum := 0; retryNum < maxRetries; retryNum++ {
 		if !endedWorked {
-			err = c.Ended(job, actualCwd, exitcode, peakmem, cmd.ProcessState.SystemTime(), bytes.TrimSpace(stdout.Bytes()), finalStdErr)
+			err = c.Ended(job, actualCwd, exitcode, peakmem, cputime, bytes.TrimSpace(stdout.Bytes()), finalStdErr)
 
 			if err != nil {
 				<-time.After(time.Duration(retryNum*100) * time.Millisecond)
@@ -836,23 +1201,25 @@ func (c *Client) Archive(job *Job) (err error) {
 // You can only Release() the same job as many times as its Retries value if it
 // has been run and failed; a subsequent call to Release() will instead result
 // in a Bury(). (If the job's Cmd was not run, you can Release() an unlimited
-// number of times.)
+// number of times.) If the job has a RetryPolicy, releases with a failreason
+// for which FailReasonIsInfrastructure() is true are instead limited by its
+// InfraRetries (if greater than 0), and the job will wait in the delay queue
+// for the policy's backoff delay. If the job failed due to using too much RAM
+// or time, the server increases its Requirements according to its
+// EscalationPolicy, and buries it if they can't be increased any further.
 func (c *Client) Release(job *Job, failreason string) (err error) {
 	c.teMutex.Lock()
 	defer c.teMutex.Unlock()
 	job.FailReason = failreason
-	_, err = c.request(&clientRequest{Method: "jrelease", Job: job})
-	if err == nil {
-		// update our process with what the server would have done
-		if job.Exited && job.Exitcode != 0 {
-			job.UntilBuried--
-			job.updateRecsAfterFailure()
-		}
-		if job.UntilBuried <= 0 {
-			job.State = JobStateBuried
-		} else {
-			job.State = JobStateDelayed
-		}
+	sr, err := c.request(&clientRequest{Method: "jrelease", Job: job})
+	if err == nil && sr.Job != nil {
+		// update our process with what the server did
+		job.Requirements = sr.Job.Requirements
+		job.Override = sr.Job.Override
+		job.Escalations = sr.Job.Escalations
+		job.UntilBuried = sr.Job.UntilBuried
+		job.InfraUntilBuried = sr.Job.InfraUntilBuried
+		job.State = sr.Job.State
 	}
 	return
 }
@@ -890,8 +1257,10 @@ func (c *Client) Kick(jes []*JobEssence) (kicked int, err error) {
 
 // Delete removes previously Bury()'d jobs from the queue completely. For use
 // when jobs were created incorrectly/ by accident, or they can never be fixed.
-// It returns a count of jobs that it actually removed. Errors will only be
-// related to not being able to contact the server.
+// Deleting an element of an array Job only affects that element; see
+// CancelArray() to stop the rest of the array being created. It returns a count
+// of jobs that it actually removed. Errors will only be related to not being
+// able to contact the server.
 func (c *Client) Delete(jes []*JobEssence) (deleted int, err error) {
 	keys := c.jesToKeys(jes)
 	resp, err := c.request(&clientRequest{Method: "jdel", Keys: keys})
@@ -907,7 +1276,8 @@ func (c *Client) Delete(jes []*JobEssence) (deleted int, err error) {
 // respond to this signal by terminating their execution and burying the job. As
 // such you should note that there could be a delay between calling Kill() and
 // execution ceasing; wait until the jobs actually get buried before retrying
-// the jobs if desired.
+// the jobs if desired. Killing an element of an array Job only affects that
+// element; see CancelArray() to stop the rest of the array being created.
 //
 // Kill returns a count of jobs that were eligible to be killed (those still in
 // running state). Errors will only be related to not being able to contact the
@@ -922,6 +1292,20 @@ func (c *Client) Kill(jes []*JobEssence) (killable int, err error) {
 	return
 }
 
+// CancelArray stops any elements of the array Jobs with the given ArrayIDs that
+// haven't been created yet from ever being created. Elements that have already
+// been created are unaffected, so you may also want to Kill() or Delete() them.
+// It returns a count of the elements that will now never be created. Errors
+// will only be related to not being able to contact the server.
+func (c *Client) CancelArray(arrayIDs []string) (dropped int, err error) {
+	resp, err := c.request(&clientRequest{Method: "jcancel", Keys: arrayIDs})
+	if err != nil {
+		return
+	}
+	dropped = resp.Existed
+	return
+}
+
 // GetByEssence gets a Job given a JobEssence to describe it. With the boolean
 // args set to true, this is the only way to get a Job that StdOut() and
 // StdErr() will work on, and one of 2 ways that Env() will work (the other
@@ -976,6 +1360,75 @@ func (c *Client) GetByRepGroup(repgroup string, limit int, state JobState, getSt
 	return
 }
 
+// SearchJobs gets the Jobs that have run at least once and that match the
+// search, whether they are now complete or not (eg. buried), in the order they
+// last finished running. 'limit', 'getStd' and 'getEnv' work as for
+// GetByRepGroup().
+func (c *Client) SearchJobs(search *JobSearch, limit int, getStd bool, getEnv bool) (jobs []*Job, err error) {
+	resp, err := c.request(&clientRequest{Method: "search", Search: search, Limit: limit, GetStd: getStd, GetEnv: getEnv})
+	if err != nil {
+		return
+	}
+	jobs = resp.Jobs
+	return
+}
+
+// GetArrayStatus summarises the states of the elements of every array Job with
+// the given RepGroup (including elements that have completed), or of every
+// array Job that has incomplete elements if repgroup is blank.
+func (c *Client) GetArrayStatus(repgroup string) (statuses []*ArrayStatus, err error) {
+	resp, err := c.request(&clientRequest{Method: "getarr", Job: &Job{RepGroup: repgroup}})
+	if err != nil {
+		return
+	}
+	statuses = resp.Arrays
+	return
+}
+
+// GetReqGroupStats tells you what the server has learned about the resource
+// usage of Jobs with the given ReqGroup, and so what Requirements it will
+// recommend for new Jobs in that ReqGroup. Supply an empty string to get the
+// stats for all ReqGroups.
+func (c *Client) GetReqGroupStats(reqGroup string) (stats []*ReqGroupStats, err error) {
+	resp, err := c.request(&clientRequest{Method: "rgstats", Job: &Job{ReqGroup: reqGroup}})
+	if err != nil {
+		return
+	}
+	stats = resp.ReqGroups
+	return
+}
+
+// ResetReqGroup makes the server forget everything it has learned about the
+// resource usage of Jobs with the given ReqGroup, so that it will stop
+// recommending Requirements for that ReqGroup until new Jobs complete.
+func (c *Client) ResetReqGroup(reqGroup string) (err error) {
+	_, err = c.request(&clientRequest{Method: "rgreset", Job: &Job{ReqGroup: reqGroup}})
+	return
+}
+
+// SetReqGroupConfig changes how the server turns the learned resource usage of
+// Jobs with the given ReqGroup in to recommended Requirements, overriding the
+// server's defaults. Zero values in the config keep the defaults; supply nil
+// to go back to using only the defaults. Returns the resulting stats.
+func (c *Client) SetReqGroupConfig(reqGroup string, config *RecommendationConfig) (stats *ReqGroupStats, err error) {
+	resp, err := c.request(&clientRequest{Method: "rgconf", Job: &Job{ReqGroup: reqGroup}, RecConfig: config})
+	if err != nil {
+		return
+	}
+	if len(resp.ReqGroups) == 1 {
+		stats = resp.ReqGroups[0]
+	}
+	return
+}
+
+// SetReqGroupEscalationPolicy sets the EscalationPolicy used by Jobs with the
+// given ReqGroup that don't have their own, including Jobs already in the
+// queue. Supply nil to go back to the default behaviour.
+func (c *Client) SetReqGroupEscalationPolicy(reqGroup string, policy *EscalationPolicy) (err error) {
+	_, err = c.request(&clientRequest{Method: "rgescalate", Job: &Job{ReqGroup: reqGroup, EscalationPolicy: policy}})
+	return
+}
+
 // GetIncomplete gets all Jobs that are currently in the jobqueue, ie. excluding
 // those that are complete and have been Archive()d. The args are as in
 // GetByRepGroup().
@@ -1000,6 +1453,7 @@ func (c *Client) request(cr *clientRequest) (sr *serverResponse, err error) {
 	enc := codec.NewEncoderBytes(&encoded, c.ch)
 	cr.Queue = c.queue
 	cr.User = c.user
+	cr.Host = c.host
 	cr.ClientID = c.clientid
 	err = enc.Encode(cr)
 	if err != nil {
@@ -43,9 +43,8 @@ import (
 )
 
 const (
-	dbDelimiter          = "_::_"
-	jobStatWindowPercent = float32(5)
-	dbFilePermission     = 0600
+	dbDelimiter      = "_::_"
+	dbFilePermission = 0600
 )
 
 var (
@@ -59,15 +58,26 @@ var (
 	bucketStdE         = []byte("stde")
 	bucketJobMBs       = []byte("jobMBs")
 	bucketJobSecs      = []byte("jobSecs")
+	bucketJobCores     = []byte("jobCores")
+	bucketJobDisk      = []byte("jobDisk")
+	bucketArrays       = []byte("arrays")
+	bucketRecConfigs   = []byte("recConfigs")
+	bucketEscPolicies  = []byte("escalationPolicies")
+	bucketAudit        = []byte("audit")
+	bucketETK          = []byte("endTimeToKey")
 	wipeDevDBOnInit    = true
 	forceBackups       = false
 )
 
-// Rec* variables are only exported for testing purposes (*** though they should
-// probably be user configurable somewhere...).
+// Rec* variables are the default rounding amounts used when recommending
+// resources. RecMBRound and RecSecRound can be overridden per deployment or
+// per ReqGroup with a RecommendationConfig; all are exported for testing
+// purposes.
 var (
-	RecMBRound  = 100  // when we recommend amount of memory to reserve for a job, we round up to the nearest RecMBRound MBs
-	RecSecRound = 1800 // when we recommend time to reserve for a job, we round up to the nearest RecSecRound seconds
+	RecMBRound   = 100  // when we recommend amount of memory to reserve for a job, we round up to the nearest RecMBRound MBs
+	RecSecRound  = 1800 // when we recommend time to reserve for a job, we round up to the nearest RecSecRound seconds
+	RecCoreRound = 100  // we record cores used as a percentage of 1 core, and round up to the nearest RecCoreRound percent when recommending
+	RecDiskRound = 1024 // we record disk used in MB, and round up to the nearest RecDiskRound MBs when recommending
 )
 
 // sobsd ('slice of byte slice doublets') implements sort interface so we can
@@ -106,7 +116,11 @@ type db struct {
 	backupFinal          bool
 	backupNotification   chan bool
 	slowBackups          bool // just for testing purposes
+	backupCB             func(time.Duration)
 	closed               bool
+	recDefaults          *RecommendationConfig
+	recConfigs           map[string]*RecommendationConfig
+	escPolicies          map[string]*EscalationPolicy
 	sync.RWMutex
 }
 
@@ -219,6 +233,7 @@ func initDB(dbFile string, dbBkFile string, deployment string) (dbstruct *db, ms
 	}
 
 	// ensure our buckets are in place
+	ch := new(codec.BincHandle)
 	err = boltdb.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists(bucketJobsLive)
 		if err != nil {
@@ -260,6 +275,42 @@ func initDB(dbFile string, dbBkFile string, deployment string) (dbstruct *db, ms
 		if err != nil {
 			return fmt.Errorf("create bucket %s: %s", bucketJobSecs, err)
 		}
+		_, err = tx.CreateBucketIfNotExists(bucketJobCores)
+		if err != nil {
+			return fmt.Errorf("create bucket %s: %s", bucketJobCores, err)
+		}
+		_, err = tx.CreateBucketIfNotExists(bucketJobDisk)
+		if err != nil {
+			return fmt.Errorf("create bucket %s: %s", bucketJobDisk, err)
+		}
+		_, err = tx.CreateBucketIfNotExists(bucketArrays)
+		if err != nil {
+			return fmt.Errorf("create bucket %s: %s", bucketArrays, err)
+		}
+		_, err = tx.CreateBucketIfNotExists(bucketRecConfigs)
+		if err != nil {
+			return fmt.Errorf("create bucket %s: %s", bucketRecConfigs, err)
+		}
+		_, err = tx.CreateBucketIfNotExists(bucketEscPolicies)
+		if err != nil {
+			return fmt.Errorf("create bucket %s: %s", bucketEscPolicies, err)
+		}
+		_, err = tx.CreateBucketIfNotExists(bucketAudit)
+		if err != nil {
+			return fmt.Errorf("create bucket %s: %s", bucketAudit, err)
+		}
+		indexed := tx.Bucket(bucketETK) != nil
+		_, err = tx.CreateBucketIfNotExists(bucketETK)
+		if err != nil {
+			return fmt.Errorf("create bucket %s: %s", bucketETK, err)
+		}
+		if !indexed {
+			// databases from before we had this index need it built
+			err = indexCompleteJobs(tx, ch)
+			if err != nil {
+				return fmt.Errorf("index bucket %s: %s", bucketJobsComplete, err)
+			}
+		}
 		return nil
 	})
 	if err != nil {
@@ -275,10 +326,12 @@ func initDB(dbFile string, dbBkFile string, deployment string) (dbstruct *db, ms
 	dbstruct = &db{
 		bolt:               boltdb,
 		envcache:           envcache,
-		ch:                 new(codec.BincHandle),
+		ch:                 ch,
 		backupsEnabled:     backupsEnabled,
 		backupPath:         bkPath,
 		backupNotification: make(chan bool),
+		recConfigs:         make(map[string]*RecommendationConfig),
+		escPolicies:        make(map[string]*EscalationPolicy),
 	}
 	if fs != nil {
 		dbstruct.backupMount = fs
@@ -296,6 +349,12 @@ func initDB(dbFile string, dbBkFile string, deployment string) (dbstruct *db, ms
 // along with those that have been added and the returned alreadyAdded value
 // will increase.
 //
+// Jobs with a Freshness of FreshnessUpToDate are never queued: if not already
+// added they are stored directly in the complete bucket (and count towards
+// alreadyAdded). Jobs with a Freshness of FreshnessStale are stored even if
+// ignoreAdded and they had previously completed, in which case their Freshness
+// becomes FreshnessRerun.
+//
 // While storing it also checks if any previously stored jobs depend on a dep
 // group that an input job is a member of. If not, jobsToQueue return value will
 // be identical to the input job slice (minus any jobs ignored due to being
@@ -310,16 +369,41 @@ func (db *db) storeNewJobs(jobs []*Job, ignoreAdded bool) (jobsToQueue []*Job, j
 	// turn the jobs in to sobsd and sort by their keys, likewise for the
 	// lookups
 	var encodedJobs sobsd
+	var encodedCompleteJobs sobsd
 	var rgLookups sobsd
 	var dgLookups sobsd
 	var rdgLookups sobsd
+	var etLookups sobsd
 	depGroups := make(map[string]bool)
 	newJobKeys := make(map[string]bool)
 	var keptJobs []*Job
 	for _, job := range jobs {
 		keyStr := job.key()
 
-		if ignoreAdded {
+		switch {
+		case job.Freshness == FreshnessStale:
+			// stale jobs must run even if they completed before
+			var live bool
+			live, err = db.checkIfLive(keyStr)
+			if err != nil {
+				return
+			}
+			if live {
+				if ignoreAdded {
+					alreadyAdded++
+					continue
+				}
+				break
+			}
+			var complete bool
+			complete, err = db.checkIfComplete(keyStr)
+			if err != nil {
+				return
+			}
+			if complete {
+				job.Freshness = FreshnessRerun
+			}
+		case ignoreAdded || job.Freshness == FreshnessUpToDate:
 			var added bool
 			added, err = db.checkIfAdded(keyStr)
 			if err != nil {
@@ -329,10 +413,20 @@ func (db *db) storeNewJobs(jobs []*Job, ignoreAdded bool) (jobsToQueue []*Job, j
 				alreadyAdded++
 				continue
 			}
-			keptJobs = append(keptJobs, job)
 		}
 
-		newJobKeys[keyStr] = true
+		upToDate := job.Freshness == FreshnessUpToDate
+		if upToDate {
+			now := time.Now()
+			job.Lock()
+			job.State = JobStateComplete
+			job.Exited = true
+			job.Exitcode = 0
+			job.StartTime = now
+			job.EndTime = now
+			job.Unlock()
+		}
+
 		key := []byte(keyStr)
 
 		job.RLock()
@@ -341,7 +435,9 @@ func (db *db) storeNewJobs(jobs []*Job, ignoreAdded bool) (jobsToQueue []*Job, j
 		for _, depGroup := range job.DepGroups {
 			if depGroup != "" {
 				dgLookups = append(dgLookups, [2][]byte{db.generateLookupKey(depGroup, key), nil})
-				depGroups[depGroup] = true
+				if !upToDate {
+					depGroups[depGroup] = true
+				}
 			}
 		}
 
@@ -356,14 +452,22 @@ func (db *db) storeNewJobs(jobs []*Job, ignoreAdded bool) (jobsToQueue []*Job, j
 		if err != nil {
 			return
 		}
-		encodedJobs = append(encodedJobs, [2][]byte{key, encoded})
-	}
 
-	if len(encodedJobs) > 0 {
-		if !ignoreAdded {
-			keptJobs = jobs
+		// up-to-date jobs go straight to the complete bucket without
+		// resurrecting anything that depends on them
+		if upToDate {
+			alreadyAdded++
+			encodedCompleteJobs = append(encodedCompleteJobs, [2][]byte{key, encoded})
+			etLookups = append(etLookups, [2][]byte{endTimeKey(job.EndTime, key), nil})
+			continue
 		}
 
+		newJobKeys[keyStr] = true
+		keptJobs = append(keptJobs, job)
+		encodedJobs = append(encodedJobs, [2][]byte{key, encoded})
+	}
+
+	if len(encodedJobs) > 0 || len(encodedCompleteJobs) > 0 {
 		// first determine if any of these new jobs are the parent of previously
 		// stored jobs
 		if len(depGroups) > 0 {
@@ -383,7 +487,7 @@ func (db *db) storeNewJobs(jobs []*Job, ignoreAdded bool) (jobsToQueue []*Job, j
 			}
 
 			if len(jobsToQueue) > 0 {
-				jobsToQueue = append(jobsToQueue, jobs...)
+				jobsToQueue = append(jobsToQueue, keptJobs...)
 			} else {
 				jobsToQueue = keptJobs
 			}
@@ -399,6 +503,9 @@ func (db *db) storeNewJobs(jobs []*Job, ignoreAdded bool) (jobsToQueue []*Job, j
 		if len(rdgLookups) > 0 {
 			numStores++
 		}
+		if len(encodedCompleteJobs) > 0 {
+			numStores += 2
+		}
 		errors := make(chan error, numStores)
 
 		go func() {
@@ -425,6 +532,18 @@ func (db *db) storeNewJobs(jobs []*Job, ignoreAdded bool) (jobsToQueue []*Job, j
 			errors <- db.storeBatched(bucketJobsLive, encodedJobs, db.storeEncodedJobs)
 		}()
 
+		if len(encodedCompleteJobs) > 0 {
+			go func() {
+				sort.Sort(encodedCompleteJobs)
+				errors <- db.storeBatched(bucketJobsComplete, encodedCompleteJobs, db.storeEncodedJobs)
+			}()
+
+			go func() {
+				sort.Sort(etLookups)
+				errors <- db.storeBatched(bucketETK, etLookups, db.storeLookups)
+			}()
+		}
+
 		seen := 0
 		for thisErr := range errors {
 			if thisErr != nil {
@@ -447,7 +566,7 @@ func (db *db) storeNewJobs(jobs []*Job, ignoreAdded bool) (jobsToQueue []*Job, j
 	// non-existent jobs based on lookups that shouldn't be there, they are
 	// silently skipped)
 
-	if err == nil && alreadyAdded != len(jobs) {
+	if err == nil && (alreadyAdded != len(jobs) || len(encodedCompleteJobs) > 0) {
 		db.backgroundBackup()
 	}
 
@@ -475,6 +594,19 @@ func (db *db) checkIfLive(key string) (isLive bool, err error) {
 	return
 }
 
+// checkIfComplete tells you if a job with the given key is currently in the
+// complete bucket.
+func (db *db) checkIfComplete(key string) (isComplete bool, err error) {
+	err = db.bolt.View(func(tx *bolt.Tx) error {
+		completeJobBucket := tx.Bucket(bucketJobsComplete)
+		if completeJobBucket.Get([]byte(key)) != nil {
+			isComplete = true
+		}
+		return nil
+	})
+	return
+}
+
 // checkIfAdded tells you if a job with the given key is currently in the
 // complete bucket or the live bucket.
 func (db *db) checkIfAdded(key string) (isInDB bool, err error) {
@@ -490,9 +622,10 @@ func (db *db) checkIfAdded(key string) (isInDB bool, err error) {
 }
 
 // archiveJob deletes a job from the live bucket, and adds a new version of it
-// (with different properties) to the complete bucket. The key you supply must
-// be the key of the job you supply, or bad things will happen - no checking is
-// done! A backgroundBackup() is triggered afterwards.
+// (with different properties) to the complete bucket, replacing its entry in
+// the time-ordered index of complete jobs if it had previously completed. The
+// key you supply must be the key of the job you supply, or bad things will
+// happen - no checking is done! A backgroundBackup() is triggered afterwards.
 func (db *db) archiveJob(key string, job *Job) (err error) {
 	var encoded []byte
 	enc := codec.NewEncoderBytes(&encoded, db.ch)
@@ -500,14 +633,32 @@ func (db *db) archiveJob(key string, job *Job) (err error) {
 	if err != nil {
 		return
 	}
+	endKey := endTimeKey(job.EndTime, []byte(key))
 
 	err = db.bolt.Batch(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketJobsLive)
 		b.Delete([]byte(key))
 
 		b = tx.Bucket(bucketJobsComplete)
+		if previous := b.Get([]byte(key)); len(previous) > 0 {
+			prevJob := &Job{}
+			dec := codec.NewDecoderBytes(previous, db.ch)
+			if derr := dec.Decode(prevJob); derr == nil {
+				prevKey := endTimeKey(prevJob.EndTime, []byte(key))
+				if !bytes.Equal(prevKey, endKey) {
+					if derr = tx.Bucket(bucketETK).Delete(prevKey); derr != nil {
+						return derr
+					}
+				}
+			}
+		}
 		err := b.Put([]byte(key), encoded)
-		return err
+		if err != nil {
+			return err
+		}
+
+		b = tx.Bucket(bucketETK)
+		return b.Put(endKey, nil)
 	})
 
 	db.backgroundBackup()
@@ -523,6 +674,24 @@ func (db *db) deleteLiveJob(key string) {
 	//*** we're not removing the lookup entries from the bucket*TK buckets...
 }
 
+// updateLiveJob replaces a job in the live bucket with its current state, for
+// use when its properties have been modified after it was added, so that the
+// modifications survive a restart.
+func (db *db) updateLiveJob(job *Job) (err error) {
+	var encoded []byte
+	enc := codec.NewEncoderBytes(&encoded, db.ch)
+	job.RLock()
+	err = enc.Encode(job)
+	key := job.key()
+	job.RUnlock()
+	if err != nil {
+		return
+	}
+	err = db.storeEncodedJobs(bucketJobsLive, sobsd{[2][]byte{[]byte(key), encoded}})
+	db.backgroundBackup()
+	return
+}
+
 // recoverIncompleteJobs returns all jobs in the live bucket, for use when
 // restarting the server, allowing you start working on any jobs that were
 // stored with storeNewJobs() but not yet archived with archiveJob(). Note that
@@ -548,6 +717,42 @@ func (db *db) recoverIncompleteJobs() (jobs []*Job, err error) {
 	return
 }
 
+// storeArray stores the state of an array Job that has not yet been fully
+// expanded, for use when restarting the server. It is removed from the db once
+// fully expanded.
+func (db *db) storeArray(id string, state *jobArrayState) (err error) {
+	var encoded []byte
+	enc := codec.NewEncoderBytes(&encoded, db.ch)
+	err = enc.Encode(state)
+	if err != nil {
+		return
+	}
+	err = db.store(bucketArrays, id, encoded)
+	if err != nil {
+		return
+	}
+	db.backgroundBackup()
+	return
+}
+
+// retrieveArrays returns the states of all array Jobs stored with storeArray().
+func (db *db) retrieveArrays() (states []*jobArrayState, err error) {
+	err = db.bolt.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketArrays)
+		return b.ForEach(func(_, encoded []byte) error {
+			dec := codec.NewDecoderBytes(encoded, db.ch)
+			state := &jobArrayState{}
+			derr := dec.Decode(state)
+			if derr != nil {
+				return derr
+			}
+			states = append(states, state)
+			return nil
+		})
+	})
+	return
+}
+
 // retrieveCompleteJobsByKeys gets jobs with the given keys from the completed
 // jobs bucket (ie. those that have gone through the queue and been Remove()d).
 func (db *db) retrieveCompleteJobsByKeys(keys []string, getstd bool, getenv bool) (jobs []*Job, err error) {
@@ -597,6 +802,31 @@ func (db *db) retrieveCompleteJobsByRepGroup(repgroup string) (jobs []*Job, err
 	return
 }
 
+// retrieveCompleteJobKeysByRepGroup gets up to max keys of jobs with the given
+// RepGroup from the completed jobs bucket that sort after the given key, in key
+// order, skipping those that are also currently live. Unlike
+// retrieveCompleteJobsByRepGroup(), no jobs are decoded, so you can cheaply
+// page through the keys of huge RepGroups.
+func (db *db) retrieveCompleteJobKeysByRepGroup(repgroup string, after string, max int) (keys []string, err error) {
+	err = db.bolt.View(func(tx *bolt.Tx) error {
+		newJobBucket := tx.Bucket(bucketJobsLive)
+		completeJobBucket := tx.Bucket(bucketJobsComplete)
+		lookupBucket := tx.Bucket(bucketRTK).Cursor()
+		prefix := []byte(repgroup + dbDelimiter)
+		for k, _ := lookupBucket.Seek([]byte(repgroup + dbDelimiter + after)); bytes.HasPrefix(k, prefix) && len(keys) < max; k, _ = lookupBucket.Next() {
+			key := bytes.TrimPrefix(k, prefix)
+			if string(key) == after {
+				continue
+			}
+			if len(completeJobBucket.Get(key)) > 0 && newJobBucket.Get(key) == nil {
+				keys = append(keys, string(key))
+			}
+		}
+		return nil
+	})
+	return
+}
+
 // retrieveDependentJobs gets previously stored jobs that had a dependency on
 // one for the input depGroups. If the job is found in the live bucket, then it
 // is returned in the jobsToUpdate return value. If it is found in the complete
@@ -738,18 +968,19 @@ func (db *db) retrieveEnv(envkey string) (envc []byte) {
 	return
 }
 
-// updateJobAfterExit stores the Job's peak RAM usage and wall time against the
-// Job's ReqGroup, allowing recommendedReqGroup*(ReqGroup) to work. It also
-// updates the stdout/err associated with a job. We don't want to store these in
-// the job, since that would waste a lot of the queue's memory; we store in db
-// instead, and only retrieve when a client needs to see these. To stop the db
-// file becoming enormous, we only store these if the cmd failed (or if
-// forceStorage is true: used when the job got buried) and also delete these
-// from db when the cmd completes successfully. By doing the deletion upfront,
-// we also ensure we have the latest std, which may be nil even on cmd failure.
-// Since it is not critical to the running of jobs and workflows that this works
-// 100% of the time, we ignore errors and write to bolt in a goroutine, giving
-// us a significant speed boost.
+// updateJobAfterExit stores the Job's peak RAM usage, wall time, cores used and
+// peak disk usage against the Job's ReqGroup and end time, allowing
+// recommendedReqGroup*(ReqGroup) to work. It also updates the stdout/err
+// associated with a job. We don't want to store these in the job, since that
+// would waste a lot of the queue's memory; we store in db instead, and only
+// retrieve when a client needs to see these. To stop the db file becoming
+// enormous, we only store these if the cmd failed (or if forceStorage is true:
+// used when the job got buried) and also delete these from db when the cmd
+// completes successfully. By doing the deletion upfront, we also ensure we have
+// the latest std, which may be nil even on cmd failure. Since it is not
+// critical to the running of jobs and workflows that this works 100% of the
+// time, we ignore errors and write to bolt in a goroutine, giving us a
+// significant speed boost.
 func (db *db) updateJobAfterExit(job *Job, stdo []byte, stde []byte, forceStorage bool) {
 	jobkey := job.key()
 	job.RLock()
@@ -757,6 +988,13 @@ func (db *db) updateJobAfterExit(job *Job, stdo []byte, stde []byte, forceStorag
 	jrg := job.ReqGroup
 	jpm := job.PeakRAM
 	jec := job.Exitcode
+	var jcpu int
+	if wall := job.EndTime.Sub(job.StartTime).Seconds(); wall > 0 {
+		jcpu = int(math.Ceil((job.CPUtime.Seconds() / wall) * 100))
+	}
+	jpd := job.PeakDisk
+	jet := job.EndTime
+	cacheHit := job.CacheStatus == CacheHit
 	job.RUnlock()
 	go func() {
 		db.Lock()
@@ -782,13 +1020,36 @@ func (db *db) updateJobAfterExit(job *Job, stdo []byte, stde []byte, forceStorag
 				return err
 			}
 
+			// restoring outputs from the result cache tells us nothing about
+			// the resources the cmd would really need
+			if cacheHit {
+				return err
+			}
+
 			b := tx.Bucket(bucketJobMBs)
-			err = b.Put([]byte(fmt.Sprintf("%s%s%20d", jrg, dbDelimiter, jpm)), []byte(strconv.Itoa(jpm)))
+			err = b.Put(statKey(jrg, jpm, jet), []byte(strconv.Itoa(jpm)))
 			if err != nil {
 				return err
 			}
 			b = tx.Bucket(bucketJobSecs)
-			err = b.Put([]byte(fmt.Sprintf("%s%s%20d", jrg, dbDelimiter, secs)), []byte(strconv.Itoa(secs)))
+			err = b.Put(statKey(jrg, secs, jet), []byte(strconv.Itoa(secs)))
+			if err != nil {
+				return err
+			}
+
+			// jobs that never really ran (eg. were lost) have no cpu time, and
+			// disk usage is only measured for jobs with a unique ActualCwd
+			if jcpu > 0 {
+				b = tx.Bucket(bucketJobCores)
+				err = b.Put(statKey(jrg, jcpu, jet), []byte(strconv.Itoa(jcpu)))
+				if err != nil {
+					return err
+				}
+			}
+			if jpd > 0 {
+				b = tx.Bucket(bucketJobDisk)
+				err = b.Put(statKey(jrg, jpd, jet), []byte(strconv.Itoa(jpd)))
+			}
 
 			return err
 		})
@@ -833,78 +1094,91 @@ func (db *db) retrieveJobStd(jobkey string) (stdo []byte, stde []byte) {
 	return
 }
 
-// recommendedReqGroupMemory returns the 95th percentile peak memory usage of
-// all jobs that previously ran with the given reqGroup. If there are too few
-// prior values to calculate a 95th percentile, or if the 95th percentile is
-// very close to the maximum value, returns the maximum value instead. In either
-// case, the true value is rounded up to the nearest 100 MB. Returns 0 if there
+// recommendedReqGroupMemory returns the 95th percentile (or as configured by
+// the reqGroup's RecommendationConfig) peak memory usage of recent jobs that
+// previously ran with the given reqGroup. If there are too few prior values to
+// calculate the percentile, or if the percentile is very close to the maximum
+// value, returns the maximum value instead. In either case, the true value is
+// rounded up to the nearest 100 MB (or configured MBRound). Returns 0 if there
 // are no prior values.
 func (db *db) recommendedReqGroupMemory(reqGroup string) (mbs int, err error) {
-	mbs, err = db.recommendedReqGroupStat(bucketJobMBs, reqGroup, RecMBRound)
+	conf := db.recConfig(reqGroup)
+	mbs, err = db.recommendedReqGroupStat(bucketJobMBs, reqGroup, conf, conf.mbRound())
 	return
 }
 
-// recommendReqGroupTime returns the 95th percentile wall time taken of all jobs
-// that previously ran with the given reqGroup. If there are too few prior
-// values to calculate a 95th percentile, or if the 95th percentile is very
-// close to the maximum value, returns the maximum value instead. In either
-// case, the true value is rounded up to the nearest 30mins (but returned in
-// seconds). Returns 0 if there are no prior values.
+// recommendReqGroupTime returns the 95th percentile (or as configured) wall
+// time taken of recent jobs that previously ran with the given reqGroup. If
+// there are too few prior values to calculate the percentile, or if the
+// percentile is very close to the maximum value, returns the maximum value
+// instead. In either case, the true value is rounded up to the nearest 30mins
+// (or configured SecRound, but returned in seconds). Returns 0 if there are no
+// prior values.
 func (db *db) recommendedReqGroupTime(reqGroup string) (seconds int, err error) {
-	seconds, err = db.recommendedReqGroupStat(bucketJobSecs, reqGroup, RecSecRound)
+	conf := db.recConfig(reqGroup)
+	seconds, err = db.recommendedReqGroupStat(bucketJobSecs, reqGroup, conf, conf.secRound())
 	return
 }
 
-// recommendedReqGroupStat is the implementation for the other recommend*()
-// methods.
-func (db *db) recommendedReqGroupStat(statBucket []byte, reqGroup string, roundAmount int) (recommendation int, err error) {
-	prefix := []byte(reqGroup)
-	max := 0
+// recommendedReqGroupCores returns the 95th percentile (or as configured)
+// number of cores used (cpu time divided by wall time) by recent jobs that
+// previously ran with the given reqGroup, rounded up to a whole core. Returns 0
+// if there are no prior values.
+func (db *db) recommendedReqGroupCores(reqGroup string) (cores int, err error) {
+	percent, err := db.recommendedReqGroupStat(bucketJobCores, reqGroup, db.recConfig(reqGroup), RecCoreRound)
+	cores = int(math.Ceil(float64(percent) / 100))
+	return
+}
+
+// recommendedReqGroupDisk returns the 95th percentile (or as configured) disk
+// space used by recent jobs that previously ran with the given reqGroup,
+// rounded up to the nearest GB (but returned in GB). Returns 0 if there are no
+// prior values.
+func (db *db) recommendedReqGroupDisk(reqGroup string) (gbs int, err error) {
+	mbs, err := db.recommendedReqGroupStat(bucketJobDisk, reqGroup, db.recConfig(reqGroup), RecDiskRound)
+	gbs = int(math.Ceil(float64(mbs) / 1024))
+	return
+}
+
+// maxReqGroupStat returns the largest value stored in the given stat bucket
+// (bucketJobMBs or bucketJobSecs) for jobs that previously ran with the given
+// reqGroup. Returns 0 if there are no prior values.
+func (db *db) maxReqGroupStat(statBucket []byte, reqGroup string) (max int, err error) {
+	prefix := []byte(reqGroup + dbDelimiter)
 	err = db.bolt.View(func(tx *bolt.Tx) error {
+		// keys are sorted by their zero-padded values, so the max is the last
+		// key with our prefix
 		c := tx.Bucket(statBucket).Cursor()
-
-		// we seek over the bucket, and to avoid having to do it twice (first to
-		// get the overall count, then to get the 95th percentile), we keep the
-		// previous 5%-sized window of values, updating recommendation as the
-		// window fills
-		count := 0
-		window := jobStatWindowPercent
-		var prev []int
-		for k, v := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		k, v := c.Seek(append(prefix, 0xff))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		if bytes.HasPrefix(k, prefix) {
 			max, _ = strconv.Atoi(string(v))
-
-			count++
-			if count > 100 {
-				window = (float32(count) / 100) * jobStatWindowPercent
-			}
-
-			prev = append(prev, max)
-			if float32(len(prev)) > window {
-				recommendation, prev = prev[0], prev[1:]
-			}
 		}
+		return nil
+	})
+	return
+}
 
+// recommendedReqGroupStat is the implementation for the other recommend*()
+// methods. Only the values within the recency window of the given config are
+// considered.
+func (db *db) recommendedReqGroupStat(statBucket []byte, reqGroup string, conf *RecommendationConfig, roundAmount int) (recommendation int, err error) {
+	var values []int
+	err = db.bolt.View(func(tx *bolt.Tx) error {
+		in, _ := windowStatEntries(reqGroupStatEntries(tx.Bucket(statBucket), reqGroup), conf)
+		for _, e := range in {
+			values = append(values, e.value)
+		}
 		return nil
 	})
 	if err != nil {
 		return
 	}
-
-	if recommendation == 0 {
-		if max == 0 {
-			return
-		}
-		recommendation = max
-	}
-
-	if max-recommendation < roundAmount {
-		recommendation = max
-	}
-
-	if recommendation%roundAmount > 0 {
-		recommendation = int(math.Ceil(float64(recommendation)/float64(roundAmount))) * roundAmount
-	}
-
+	recommendation = percentileRecommendation(values, conf.percentile(), roundAmount)
 	return
 }
 
@@ -1057,7 +1331,9 @@ func (db *db) backgroundBackup() {
 
 	db.backingUp = true
 	slowBackups := db.slowBackups
+	backupCB := db.backupCB
 	go func() {
+		started := time.Now()
 		if slowBackups {
 			// just for testing purposes
 			<-time.After(100 * time.Millisecond)
@@ -1080,6 +1356,9 @@ func (db *db) backgroundBackup() {
 		} else {
 			// backup succeeded, move it over any old backup
 			os.Rename(tmpBackupPath, db.backupPath)
+			if backupCB != nil {
+				backupCB(time.Since(started))
+			}
 		}
 
 		db.Lock()
@@ -1104,6 +1383,14 @@ func (db *db) backgroundBackup() {
 	}()
 }
 
+// setBackupCallback sets a function that will be called with the time taken by
+// each successful backgroundBackup().
+func (db *db) setBackupCallback(cb func(time.Duration)) {
+	db.Lock()
+	defer db.Unlock()
+	db.backupCB = cb
+}
+
 // backup backs up the database to the given writer. Can be called at the same
 // time as an active backgroundBackup() or even another backup(). You will get
 // a consistent view of the database at the time you call this. NB: this can be
@@ -0,0 +1,329 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for emailing admins about persistent scheduler
+// problems and bad servers, and users about their buried jobs.
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emailDefaultInterval is the default minimum time between emails to the same
+// address.
+const emailDefaultInterval = 1 * time.Hour
+
+// emailExamples is the maximum number of example buried cmds we list per
+// RepGroup in users' emails.
+const emailExamples = 3
+
+// emailIssuePersistence is how long a scheduler issue has to keep happening
+// before we consider it persistent and worth emailing about; issues that stop
+// happening before then are forgotten.
+var emailIssuePersistence = 15 * time.Minute
+
+// emailCheckInterval is how often we check if there's anything to email.
+var emailCheckInterval = 1 * time.Minute
+
+// EmailConfig is supplied as ServerConfig.Email to have the server send
+// notification emails.
+type EmailConfig struct {
+	// SMTP is the host:port of the mail server to send through.
+	SMTP string
+
+	// Username and Password, if set, are used to authenticate with the mail
+	// server using PLAIN auth, which requires the mail server to support TLS
+	// (unless SMTP is on localhost).
+	Username string
+	Password string
+
+	// From is the address emails are sent from. Defaults to wr@ the host the
+	// server is running on.
+	From string
+
+	// Admins are the addresses to email about persistent scheduler problems
+	// and servers that have gone bad.
+	Admins []string
+
+	// UserDomain, if set, results in users being emailed about their buried
+	// Jobs at username@UserDomain.
+	UserDomain string
+
+	// Interval is the minimum time between emails to the same address;
+	// notifications that happen in between are sent as a single digest once
+	// Interval has passed. Defaults to 1 hour.
+	Interval time.Duration
+}
+
+// emailIssue records the occurrences of a scheduler issue.
+type emailIssue struct {
+	first time.Time
+	last  time.Time
+	count int
+}
+
+// emailBuried records the buried Jobs of a RepGroup.
+type emailBuried struct {
+	count    int
+	examples []string
+}
+
+// emailer gathers up notifications and periodically emails digests of them,
+// at most once per Interval to any one address.
+type emailer struct {
+	sync.Mutex
+	config   *EmailConfig
+	auth     smtp.Auth
+	from     string
+	info     *ServerInfo
+	issues   map[string]*emailIssue
+	servers  map[string]*badServer
+	buried   map[string]map[string]*emailBuried // keyed on user, then RepGroup
+	lastSent map[string]time.Time               // keyed on user, "" for admins
+}
+
+// newEmailer creates a new emailer that will email using the given config on
+// behalf of the server described by info. Call run() to start sending.
+func newEmailer(config *EmailConfig, info *ServerInfo) *emailer {
+	e := &emailer{
+		config:   config,
+		from:     config.From,
+		info:     info,
+		issues:   make(map[string]*emailIssue),
+		servers:  make(map[string]*badServer),
+		buried:   make(map[string]map[string]*emailBuried),
+		lastSent: make(map[string]time.Time),
+	}
+	if e.from == "" {
+		e.from = "wr@" + info.Host
+	}
+	if config.Username != "" {
+		host, _, err := net.SplitHostPort(config.SMTP)
+		if err != nil {
+			host = config.SMTP
+		}
+		e.auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return e
+}
+
+// schedulerIssue records that the scheduler had the given problem. Admins will
+// only be emailed about it if it keeps happening for emailIssuePersistence.
+func (e *emailer) schedulerIssue(msg string) {
+	if len(e.config.Admins) == 0 {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	now := time.Now()
+	issue, exists := e.issues[msg]
+	if !exists {
+		issue = &emailIssue{first: now}
+		e.issues[msg] = issue
+	}
+	issue.last = now
+	issue.count++
+}
+
+// badServer records that the given server went bad, or forgets about it if it
+// is no longer bad and we haven't yet emailed about it.
+func (e *emailer) badServer(server *badServer) {
+	if len(e.config.Admins) == 0 {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	if server.IsBad {
+		e.servers[server.ID] = server
+	} else {
+		delete(e.servers, server.ID)
+	}
+}
+
+// jobBuried records that the given Job got buried, so that its user can be
+// emailed about it. You must not hold the Job's lock.
+func (e *emailer) jobBuried(job *Job) {
+	if e.config.UserDomain == "" {
+		return
+	}
+	job.RLock()
+	user, repGroup := job.User, job.RepGroup
+	example := job.Cmd
+	if job.FailReason != "" {
+		example += " (" + job.FailReason + ")"
+	}
+	job.RUnlock()
+
+	e.Lock()
+	defer e.Unlock()
+	groups, exists := e.buried[user]
+	if !exists {
+		groups = make(map[string]*emailBuried)
+		e.buried[user] = groups
+	}
+	b, exists := groups[repGroup]
+	if !exists {
+		b = &emailBuried{}
+		groups[repGroup] = b
+	}
+	b.count++
+	if len(b.examples) < emailExamples {
+		b.examples = append(b.examples, example)
+	}
+}
+
+// run periodically emails digests of what has been recorded, until stop is
+// closed.
+func (e *emailer) run(stop chan bool) {
+	go func() {
+		ticker := time.NewTicker(emailCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.flush(time.Now())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// emailMessage is an email we're about to send.
+type emailMessage struct {
+	to      []string
+	subject string
+	body    string
+}
+
+// flush emails a digest to each address that has something to be told and
+// hasn't been emailed within the last Interval.
+func (e *emailer) flush(now time.Time) {
+	interval := e.config.Interval
+	if interval <= 0 {
+		interval = emailDefaultInterval
+	}
+
+	var msgs []*emailMessage
+	e.Lock()
+	if now.Sub(e.lastSent[""]) >= interval {
+		if body := e.adminDigest(now); body != "" {
+			msgs = append(msgs, &emailMessage{to: e.config.Admins, subject: "problems", body: body})
+			e.lastSent[""] = now
+		}
+	}
+	for user, groups := range e.buried {
+		if now.Sub(e.lastSent[user]) < interval {
+			continue
+		}
+		msgs = append(msgs, &emailMessage{to: []string{user + "@" + e.config.UserDomain}, subject: "buried commands", body: e.userDigest(groups)})
+		delete(e.buried, user)
+		e.lastSent[user] = now
+	}
+	e.Unlock()
+
+	for _, msg := range msgs {
+		if err := e.send(msg, now); err != nil {
+			logger.Error("failed to send email", "to", strings.Join(msg.to, ", "), "subject", msg.subject, "err", err)
+		}
+	}
+}
+
+// adminDigest describes the persistent scheduler issues and bad servers,
+// forgetting about them (and any issues that turned out not to be persistent)
+// so they aren't reported again. Returns an empty string if there's nothing
+// to report. You must hold the lock.
+func (e *emailer) adminDigest(now time.Time) string {
+	var issues []string
+	for msg, issue := range e.issues {
+		switch {
+		case issue.last.Sub(issue.first) >= emailIssuePersistence:
+			issues = append(issues, fmt.Sprintf("  %s\n    (%d times between %s and %s)\n", msg, issue.count, issue.first.Format(time.RFC1123), issue.last.Format(time.RFC1123)))
+			delete(e.issues, msg)
+		case now.Sub(issue.last) >= emailIssuePersistence:
+			delete(e.issues, msg)
+		}
+	}
+
+	var servers []string
+	for id, server := range e.servers {
+		servers = append(servers, fmt.Sprintf("  %s (%s, id %s): %s\n", server.Name, server.IP, id, server.Problem))
+		delete(e.servers, id)
+	}
+
+	if len(issues) == 0 && len(servers) == 0 {
+		return ""
+	}
+	sort.Strings(issues)
+	sort.Strings(servers)
+
+	var b bytes.Buffer
+	if len(issues) > 0 {
+		b.WriteString("The scheduler has been having these problems:\n\n")
+		b.WriteString(strings.Join(issues, ""))
+		b.WriteString("\n")
+	}
+	if len(servers) > 0 {
+		b.WriteString("These servers have gone bad and should be confirmed as bad (which terminates them) via the web interface:\n\n")
+		b.WriteString(strings.Join(servers, ""))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// userDigest describes the buried Jobs of a user.
+func (e *emailer) userDigest(groups map[string]*emailBuried) string {
+	repGroups := make([]string, 0, len(groups))
+	for repGroup := range groups {
+		repGroups = append(repGroups, repGroup)
+	}
+	sort.Strings(repGroups)
+
+	var b bytes.Buffer
+	b.WriteString("Some of the commands you added have failed and been buried. Once you've fixed the problem, you can retry them with 'wr retry', or remove them with 'wr remove'.\n\n")
+	for _, repGroup := range repGroups {
+		bg := groups[repGroup]
+		fmt.Fprintf(&b, "Reporting group %s: %d buried, eg.\n", repGroup, bg.count)
+		for _, example := range bg.examples {
+			fmt.Fprintf(&b, "  %s\n", example)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// send emails the given message.
+func (e *emailer) send(msg *emailMessage, now time.Time) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.to, ", "))
+	fmt.Fprintf(&b, "Subject: wr %s manager on %s: %s\r\n", e.info.Deployment, e.info.Host, msg.subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.Replace(msg.body, "\n", "\r\n", -1))
+	fmt.Fprintf(&b, "See http://%s:%s for details.\r\n", e.info.Host, e.info.WebPort)
+	return smtp.SendMail(e.config.SMTP, e.auth, e.from, msg.to, b.Bytes())
+}
@@ -0,0 +1,214 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEmail is an email received by smtpStandIn.
+type testEmail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpStandIn starts a minimal SMTP server on localhost that accepts
+// everything, sending the emails it receives down the returned channel.
+func smtpStandIn() (net.Listener, chan *testEmail, error) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	emails := make(chan *testEmail, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				tp := textproto.NewConn(conn)
+				tp.PrintfLine("220 localhost stand-in")
+				email := &testEmail{}
+				for {
+					line, err := tp.ReadLine()
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(line)
+					switch {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						tp.PrintfLine("250 localhost")
+					case strings.HasPrefix(cmd, "MAIL FROM:"):
+						email.from = strings.Trim(line[10:], "<>")
+						tp.PrintfLine("250 ok")
+					case strings.HasPrefix(cmd, "RCPT TO:"):
+						email.to = append(email.to, strings.Trim(line[8:], "<>"))
+						tp.PrintfLine("250 ok")
+					case cmd == "DATA":
+						tp.PrintfLine("354 go ahead")
+						data, err := tp.ReadDotBytes()
+						if err != nil {
+							return
+						}
+						email.data = string(data)
+						emails <- email
+						email = &testEmail{}
+						tp.PrintfLine("250 ok")
+					case cmd == "QUIT":
+						tp.PrintfLine("221 bye")
+						return
+					default:
+						tp.PrintfLine("250 ok")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln, emails, nil
+}
+
+func TestEmail(t *testing.T) {
+	ln, emails, err := smtpStandIn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := func() *testEmail {
+		select {
+		case email := <-emails:
+			return email
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+	noneReceived := func() bool {
+		select {
+		case <-emails:
+			return false
+		case <-time.After(50 * time.Millisecond):
+			return true
+		}
+	}
+
+	info := &ServerInfo{Host: "mgr", WebPort: "8080", Deployment: "development"}
+	config := &EmailConfig{SMTP: ln.Addr().String(), Admins: []string{"admin1@example.com", "admin2@example.com"}, UserDomain: "example.com"}
+
+	Convey("Admins are emailed about persistent scheduler issues", t, func() {
+		e := newEmailer(config, info)
+		So(e.from, ShouldEqual, "wr@mgr")
+		now := time.Now()
+
+		e.schedulerIssue("transient")
+		e.schedulerIssue("persistent")
+		e.schedulerIssue("persistent")
+		e.flush(now)
+		So(noneReceived(), ShouldBeTrue)
+
+		e.issues["persistent"].first = now.Add(-emailIssuePersistence)
+		e.flush(now)
+		email := received()
+		So(email, ShouldNotBeNil)
+		So(email.from, ShouldEqual, "wr@mgr")
+		So(email.to, ShouldResemble, config.Admins)
+		So(email.data, ShouldContainSubstring, "Subject: wr development manager on mgr: problems")
+		So(email.data, ShouldContainSubstring, "persistent\n    (2 times between")
+		So(email.data, ShouldNotContainSubstring, "transient")
+		So(email.data, ShouldContainSubstring, "See http://mgr:8080 for details.")
+		So(len(e.issues), ShouldEqual, 1)
+
+		Convey("Transient issues are forgotten", func() {
+			e.lastSent[""] = time.Time{}
+			e.flush(now.Add(2 * emailIssuePersistence))
+			So(noneReceived(), ShouldBeTrue)
+			So(len(e.issues), ShouldEqual, 0)
+		})
+
+		Convey("Bad servers are sent in a digest once the interval has passed", func() {
+			e.badServer(&badServer{ID: "id1", Name: "s1", IP: "10.0.0.1", IsBad: true, Problem: "unresponsive"})
+			e.badServer(&badServer{ID: "id2", Name: "s2", IsBad: true})
+			e.badServer(&badServer{ID: "id2", Name: "s2", IsBad: false})
+			e.flush(now.Add(emailDefaultInterval - time.Minute))
+			So(noneReceived(), ShouldBeTrue)
+
+			e.flush(now.Add(emailDefaultInterval))
+			email := received()
+			So(email, ShouldNotBeNil)
+			So(email.data, ShouldContainSubstring, "s1 (10.0.0.1, id id1): unresponsive")
+			So(email.data, ShouldNotContainSubstring, "s2")
+			So(len(e.servers), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Users are emailed digests of their buried jobs", t, func() {
+		e := newEmailer(config, info)
+		now := time.Now()
+		for i := 0; i < emailExamples+2; i++ {
+			e.jobBuried(&Job{Cmd: "false", User: "alice", RepGroup: "rg1", FailReason: FailReasonExit})
+		}
+		e.jobBuried(&Job{Cmd: "oom", User: "alice", RepGroup: "rg2"})
+		e.jobBuried(&Job{Cmd: "false", User: "bob", RepGroup: "rg1"})
+
+		e.flush(now)
+		got := make(map[string]*testEmail)
+		for i := 0; i < 2; i++ {
+			email := received()
+			So(email, ShouldNotBeNil)
+			So(len(email.to), ShouldEqual, 1)
+			got[email.to[0]] = email
+		}
+		So(noneReceived(), ShouldBeTrue)
+
+		alice := got["alice@example.com"]
+		So(alice, ShouldNotBeNil)
+		So(alice.data, ShouldContainSubstring, "Subject: wr development manager on mgr: buried commands")
+		So(alice.data, ShouldContainSubstring, "Reporting group rg1: 5 buried, eg.")
+		So(strings.Count(alice.data, "false ("+FailReasonExit+")"), ShouldEqual, emailExamples)
+		So(alice.data, ShouldContainSubstring, "Reporting group rg2: 1 buried, eg.\n  oom\n")
+		So(got["bob@example.com"], ShouldNotBeNil)
+
+		e.jobBuried(&Job{Cmd: "false", User: "alice", RepGroup: "rg1"})
+		e.flush(now.Add(time.Minute))
+		So(noneReceived(), ShouldBeTrue)
+		e.flush(now.Add(emailDefaultInterval))
+		email := received()
+		So(email, ShouldNotBeNil)
+		So(email.to, ShouldResemble, []string{"alice@example.com"})
+		So(email.data, ShouldContainSubstring, "Reporting group rg1: 1 buried")
+	})
+
+	Convey("Nothing is recorded for people who won't be emailed", t, func() {
+		e := newEmailer(&EmailConfig{SMTP: ln.Addr().String(), From: "wr@example.com"}, info)
+		So(e.from, ShouldEqual, "wr@example.com")
+		e.schedulerIssue("problem")
+		e.badServer(&badServer{ID: "id1", IsBad: true})
+		e.jobBuried(&Job{Cmd: "false", User: "alice"})
+		So(len(e.issues), ShouldEqual, 0)
+		So(len(e.servers), ShouldEqual, 0)
+		So(len(e.buried), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,370 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for increasing the resource requirements of Jobs
+// that failed because they used too much memory, time or disk space.
+
+import (
+	"code.cloudfoundry.org/bytefmt"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/ugorji/go/codec"
+	"math"
+	"time"
+)
+
+// EscalationPolicy describes how a Job's Requirements should be increased
+// after it fails due to using too much RAM or time. Jobs that don't have their
+// own policy use the one set for their ReqGroup with
+// Client.SetReqGroupEscalationPolicy(), if any. The zero value gives the
+// default behaviour: RAM is increased to the Job's peak usage multiplied by
+// RAMIncreaseMultLow (or RAMIncreaseMultHigh above RAMIncreaseMultBreakpoint)
+// or by at least RAMIncreaseMin, and time is increased by 1 hour, without
+// limit.
+type EscalationPolicy struct {
+	// RAMMultiplier, if greater than 0, is what the Job's peak RAM usage is
+	// multiplied by to get its new RAM requirement.
+	RAMMultiplier float64
+
+	// RAMStep is the minimum number of MB to increase RAM by. Defaults to
+	// RAMIncreaseMin.
+	RAMStep int
+
+	// MaxRAM, if greater than 0, is the most MB RAM will be increased to.
+	MaxRAM int
+
+	// TimeMultiplier, if greater than 1, is what the Job's current time
+	// requirement is multiplied by to get its new time requirement.
+	TimeMultiplier float64
+
+	// TimeStep is the minimum amount to increase time by. Defaults to 1 hour.
+	TimeStep time.Duration
+
+	// MaxTime, if greater than 0, is the most time will be increased to.
+	MaxTime time.Duration
+
+	// UseReqGroupMax, if true, increases requirements to at least the
+	// maximum RAM or time that has been used by any prior Job with the same
+	// ReqGroup.
+	UseReqGroupMax bool
+
+	// MaxEscalations, if greater than 0, is the maximum number of times the
+	// Job's requirements will be increased.
+	MaxEscalations uint8
+}
+
+// escalateRAM returns the new RAM requirement (in MB) for a Job that used
+// peakMB and currently requires currentMB, given the maximum RAM used by prior
+// Jobs in its ReqGroup.
+func (p *EscalationPolicy) escalateRAM(peakMB, currentMB, groupMaxMB int) int {
+	mb := float64(peakMB)
+	switch {
+	case p.RAMMultiplier > 0:
+		mb *= p.RAMMultiplier
+	case mb <= RAMIncreaseMultBreakpoint:
+		mb *= RAMIncreaseMultLow
+	default:
+		mb *= RAMIncreaseMultHigh
+	}
+	step := float64(p.RAMStep)
+	if step <= 0 {
+		step = RAMIncreaseMin
+	}
+	if mb < float64(peakMB)+step {
+		mb = float64(peakMB) + step
+	}
+	if p.UseReqGroupMax && float64(groupMaxMB) > mb {
+		mb = float64(groupMaxMB)
+	}
+
+	// round up to nearest 100
+	newMB := int(math.Ceil(mb/100) * 100)
+
+	if p.MaxRAM > 0 && newMB > p.MaxRAM {
+		newMB = p.MaxRAM
+		if newMB < currentMB {
+			newMB = currentMB
+		}
+	}
+	return newMB
+}
+
+// escalateTime returns the new time requirement for a Job that currently
+// requires current, given the maximum time used by prior Jobs in its ReqGroup.
+func (p *EscalationPolicy) escalateTime(current, groupMax time.Duration) time.Duration {
+	d := current
+	if p.TimeMultiplier > 1 {
+		d = time.Duration(float64(d) * p.TimeMultiplier)
+	}
+	step := p.TimeStep
+	if step <= 0 {
+		step = 1 * time.Hour
+	}
+	if d < current+step {
+		d = current + step
+	}
+	if p.UseReqGroupMax && groupMax > d {
+		d = groupMax
+	}
+	if p.MaxTime > 0 && d > p.MaxTime {
+		d = p.MaxTime
+		if d < current {
+			d = current
+		}
+	}
+	return d
+}
+
+// escalateDisk returns the new disk requirement (in GB) for a Job that used
+// peakMB of disk space and currently requires currentGB. Disk is always
+// increased to its peak usage multiplied by DiskIncreaseMult, or by at least
+// 1GB.
+func escalateDisk(peakMB, currentGB int) int {
+	gb := int(math.Ceil(float64(peakMB) * DiskIncreaseMult / 1024))
+	if gb <= currentGB {
+		gb = currentGB + 1
+	}
+	return gb
+}
+
+// EscalationPolicyViaJSON describes an EscalationPolicy in a form suitable for
+// JSON and YAML job definitions.
+type EscalationPolicyViaJSON struct {
+	RAMMultiplier float64 `json:"ram_multiplier"`
+	// RAMStep and MaxRAM are a number and unit suffix, eg. 1G for 1 Gigabyte.
+	RAMStep        string  `json:"ram_step"`
+	MaxRAM         string  `json:"max_ram"`
+	TimeMultiplier float64 `json:"time_multiplier"`
+	// TimeStep and MaxTime are durations with a unit suffix, eg. 1h for 1
+	// hour.
+	TimeStep       string `json:"time_step"`
+	MaxTime        string `json:"max_time"`
+	UseReqGroupMax bool   `json:"use_req_grp_max"`
+	MaxEscalations int    `json:"max_escalations"`
+}
+
+// EscalationPolicy converts to an EscalationPolicy, returning an error if any
+// of the values are invalid.
+func (e *EscalationPolicyViaJSON) EscalationPolicy() (p *EscalationPolicy, err error) {
+	if e.RAMMultiplier < 0 || e.TimeMultiplier < 0 {
+		err = fmt.Errorf("escalation multipliers may not be negative")
+		return
+	}
+	if e.MaxEscalations < 0 || e.MaxEscalations > 255 {
+		err = fmt.Errorf("max_escalations value (%d) is not in the range 0..255", e.MaxEscalations)
+		return
+	}
+	p = &EscalationPolicy{
+		RAMMultiplier:  e.RAMMultiplier,
+		TimeMultiplier: e.TimeMultiplier,
+		UseReqGroupMax: e.UseReqGroupMax,
+		MaxEscalations: uint8(e.MaxEscalations),
+	}
+
+	toMB := func(name, value string) (int, error) {
+		if value == "" {
+			return 0, nil
+		}
+		mb, berr := bytefmt.ToMegabytes(value)
+		if berr != nil {
+			return 0, fmt.Errorf("escalation %s value (%s) was not specified correctly: %s", name, value, berr)
+		}
+		return int(mb), nil
+	}
+	toDuration := func(name, value string) (time.Duration, error) {
+		if value == "" {
+			return 0, nil
+		}
+		d, perr := time.ParseDuration(value)
+		if perr != nil {
+			return 0, fmt.Errorf("escalation %s value (%s) was not specified correctly: %s", name, value, perr)
+		}
+		return d, nil
+	}
+
+	if p.RAMStep, err = toMB("ram_step", e.RAMStep); err != nil {
+		return
+	}
+	if p.MaxRAM, err = toMB("max_ram", e.MaxRAM); err != nil {
+		return
+	}
+	if p.TimeStep, err = toDuration("time_step", e.TimeStep); err != nil {
+		return
+	}
+	p.MaxTime, err = toDuration("max_time", e.MaxTime)
+	return
+}
+
+// Escalation records an increase in a Job's Requirements following a failure.
+type Escalation struct {
+	Time       time.Time
+	FailReason string
+	OldRAM     int
+	NewRAM     int
+	OldTime    time.Duration
+	NewTime    time.Duration
+	OldDisk    int
+	NewDisk    int
+}
+
+// String describes the escalation, like "RAM 1000MB => 2000MB (command used
+// too much RAM)".
+func (e *Escalation) String() string {
+	if e.NewRAM != e.OldRAM {
+		return fmt.Sprintf("RAM %dMB => %dMB (%s)", e.OldRAM, e.NewRAM, e.FailReason)
+	}
+	if e.NewDisk != e.OldDisk {
+		return fmt.Sprintf("disk %dGB => %dGB (%s)", e.OldDisk, e.NewDisk, e.FailReason)
+	}
+	return fmt.Sprintf("time %s => %s (%s)", e.OldTime, e.NewTime, e.FailReason)
+}
+
+// updateRecsAfterFailure increases the Job's Requirements according to the
+// given EscalationPolicy (nil meaning the default behaviour) if it failed due
+// to using too much RAM or time (or disk space, which is increased according to
+// escalateDisk()), recording the change in its Escalations. You supply the
+// maximum RAM and time used by prior Jobs in the same ReqGroup, which only
+// matter if the policy has UseReqGroupMax. Returns true if the Job failed for
+// one of those reasons but the policy didn't allow the requirements to be
+// increased any further, in which case there is no point in retrying it.
+func (j *Job) updateRecsAfterFailure(policy *EscalationPolicy, groupMaxMB int, groupMaxTime time.Duration) (capped bool) {
+	if j.FailReason != FailReasonRAM && j.FailReason != FailReasonTime && j.FailReason != FailReasonDisk {
+		return
+	}
+
+	p := policy
+	if p == nil {
+		p = &EscalationPolicy{}
+	}
+	if p.MaxEscalations > 0 && len(j.Escalations) >= int(p.MaxEscalations) {
+		return true
+	}
+
+	e := &Escalation{
+		Time:       time.Now(),
+		FailReason: j.FailReason,
+		OldRAM:     j.Requirements.RAM,
+		NewRAM:     j.Requirements.RAM,
+		OldTime:    j.Requirements.Time,
+		NewTime:    j.Requirements.Time,
+		OldDisk:    j.Requirements.Disk,
+		NewDisk:    j.Requirements.Disk,
+	}
+	switch j.FailReason {
+	case FailReasonRAM:
+		e.NewRAM = p.escalateRAM(j.PeakRAM, j.Requirements.RAM, groupMaxMB)
+	case FailReasonTime:
+		e.NewTime = p.escalateTime(j.Requirements.Time, groupMaxTime)
+	default:
+		e.NewDisk = escalateDisk(j.PeakDisk, j.Requirements.Disk)
+	}
+	if e.NewRAM == e.OldRAM && e.NewTime == e.OldTime && e.NewDisk == e.OldDisk {
+		// (without a policy we keep retrying, as we always used to)
+		return policy != nil
+	}
+
+	j.Requirements.RAM = e.NewRAM
+	j.Requirements.Time = e.NewTime
+	j.Requirements.Disk = e.NewDisk
+	j.Override = uint8(1)
+	j.Escalations = append(j.Escalations, e)
+	return
+}
+
+// escalateAfterFailure increases the given Job's Requirements according to
+// its EscalationPolicy, or that of its ReqGroup if it doesn't have its own. See
+// Job.updateRecsAfterFailure() for the meaning of the return value.
+func (s *Server) escalateAfterFailure(job *Job) (capped bool) {
+	policy := job.EscalationPolicy
+	if policy == nil {
+		policy = s.db.escalationPolicy(job.ReqGroup)
+	}
+	var mb int
+	var d time.Duration
+	if policy != nil && policy.UseReqGroupMax {
+		mb, _ = s.db.maxReqGroupStat(bucketJobMBs, job.ReqGroup)
+		secs, _ := s.db.maxReqGroupStat(bucketJobSecs, job.ReqGroup)
+		d = time.Duration(secs) * time.Second
+	}
+	return job.updateRecsAfterFailure(policy, mb, d)
+}
+
+// escalationPolicy returns the EscalationPolicy set for the given reqGroup, or
+// nil if there isn't one.
+func (db *db) escalationPolicy(reqGroup string) *EscalationPolicy {
+	db.RLock()
+	defer db.RUnlock()
+	return db.escPolicies[reqGroup]
+}
+
+// loadEscalationPolicies loads the per-ReqGroup EscalationPolicys that were
+// previously stored.
+func (db *db) loadEscalationPolicies() error {
+	policies := make(map[string]*EscalationPolicy)
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketEscPolicies).ForEach(func(k, v []byte) error {
+			policy := &EscalationPolicy{}
+			dec := codec.NewDecoderBytes(v, db.ch)
+			if derr := dec.Decode(policy); derr != nil {
+				return derr
+			}
+			policies[string(k)] = policy
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	db.Lock()
+	defer db.Unlock()
+	db.escPolicies = policies
+	return nil
+}
+
+// setReqGroupEscalationPolicy stores an EscalationPolicy that will be used by
+// Jobs in the given reqGroup that don't have their own. Supplying nil removes
+// it.
+func (db *db) setReqGroupEscalationPolicy(reqGroup string, policy *EscalationPolicy) error {
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketEscPolicies)
+		if policy == nil {
+			return b.Delete([]byte(reqGroup))
+		}
+		var encoded []byte
+		enc := codec.NewEncoderBytes(&encoded, db.ch)
+		if err := enc.Encode(policy); err != nil {
+			return err
+		}
+		return b.Put([]byte(reqGroup), encoded)
+	})
+	if err != nil {
+		return err
+	}
+
+	db.Lock()
+	defer db.Unlock()
+	if policy == nil {
+		delete(db.escPolicies, reqGroup)
+	} else {
+		db.escPolicies[reqGroup] = policy
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	jqs "github.com/VertebrateResequencing/wr/jobqueue/scheduler"
+	"github.com/boltdb/bolt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEscalationPolicy(t *testing.T) {
+	Convey("Without a policy, requirements escalate as they always have", t, func() {
+		job := &Job{Requirements: &jqs.Requirements{RAM: 100, Time: 1 * time.Minute}, PeakRAM: 150, FailReason: FailReasonRAM}
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.RAM, ShouldEqual, 1200)
+		So(job.Override, ShouldEqual, 1)
+		So(len(job.Escalations), ShouldEqual, 1)
+		So(job.Escalations[0].String(), ShouldEqual, "RAM 100MB => 1200MB (command used too much RAM)")
+
+		job.PeakRAM = 10000
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.RAM, ShouldEqual, 13000)
+
+		job.FailReason = FailReasonTime
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.Time, ShouldEqual, 61*time.Minute)
+		So(len(job.Escalations), ShouldEqual, 3)
+		So(job.Escalations[2].String(), ShouldEqual, "time 1m0s => 1h1m0s (command used too much time)")
+
+		job.FailReason = FailReasonExit
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(len(job.Escalations), ShouldEqual, 3)
+
+		job.FailReason = FailReasonDisk
+		job.Requirements.Disk = 1
+		job.PeakDisk = 1100
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.Disk, ShouldEqual, 3)
+		So(job.Escalations[3].String(), ShouldEqual, "disk 1GB => 3GB (command used too much disk space)")
+
+		job.PeakDisk = 100
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.Disk, ShouldEqual, 4)
+	})
+
+	Convey("Policies can change and cap how requirements escalate", t, func() {
+		p := &EscalationPolicy{RAMMultiplier: 1.5, RAMStep: 100, MaxRAM: 2000, TimeMultiplier: 2, TimeStep: 1 * time.Minute, MaxTime: 3 * time.Hour}
+		job := &Job{Requirements: &jqs.Requirements{RAM: 1000, Time: 1 * time.Hour}, PeakRAM: 1000, FailReason: FailReasonRAM, EscalationPolicy: p}
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.RAM, ShouldEqual, 1500)
+
+		job.PeakRAM = 1500
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.RAM, ShouldEqual, 2000)
+
+		job.PeakRAM = 2000
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeTrue)
+		So(job.Requirements.RAM, ShouldEqual, 2000)
+		So(len(job.Escalations), ShouldEqual, 2)
+
+		job.FailReason = FailReasonTime
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.Time, ShouldEqual, 2*time.Hour)
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeFalse)
+		So(job.Requirements.Time, ShouldEqual, 3*time.Hour)
+		So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeTrue)
+
+		Convey("And limit the number of escalations", func() {
+			p.MaxEscalations = 4
+			job.FailReason = FailReasonRAM
+			job.Requirements.RAM = 100
+			job.PeakRAM = 100
+			So(job.updateRecsAfterFailure(job.EscalationPolicy, 0, 0), ShouldBeTrue)
+			So(job.Requirements.RAM, ShouldEqual, 100)
+		})
+
+		Convey("And use the maximum seen in the ReqGroup", func() {
+			p.UseReqGroupMax = true
+			p.MaxRAM = 0
+			job.FailReason = FailReasonRAM
+			So(job.updateRecsAfterFailure(job.EscalationPolicy, 5000, 0), ShouldBeFalse)
+			So(job.Requirements.RAM, ShouldEqual, 5000)
+		})
+	})
+
+	Convey("Policies can be specified via JSON", t, func() {
+		epj := &EscalationPolicyViaJSON{RAMMultiplier: 1.5, RAMStep: "500M", MaxRAM: "2G", TimeStep: "30m", MaxTime: "48h", UseReqGroupMax: true, MaxEscalations: 3}
+		p, err := epj.EscalationPolicy()
+		So(err, ShouldBeNil)
+		So(p.RAMMultiplier, ShouldEqual, 1.5)
+		So(p.RAMStep, ShouldEqual, 500)
+		So(p.MaxRAM, ShouldEqual, 2048)
+		So(p.TimeStep, ShouldEqual, 30*time.Minute)
+		So(p.MaxTime, ShouldEqual, 48*time.Hour)
+		So(p.UseReqGroupMax, ShouldBeTrue)
+		So(p.MaxEscalations, ShouldEqual, 3)
+
+		epj.MaxRAM = "lots"
+		_, err = epj.EscalationPolicy()
+		So(err, ShouldNotBeNil)
+
+		epj.MaxRAM = ""
+		epj.MaxEscalations = -1
+		_, err = epj.EscalationPolicy()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Jobs without a policy use their ReqGroup's", t, func() {
+		dir, err := ioutil.TempDir("", "wr_escalation_test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		boltdb, err := bolt.Open(filepath.Join(dir, "db"), dbFilePermission, nil)
+		So(err, ShouldBeNil)
+		defer boltdb.Close()
+		err = boltdb.Update(func(tx *bolt.Tx) error {
+			_, berr := tx.CreateBucketIfNotExists(bucketEscPolicies)
+			return berr
+		})
+		So(err, ShouldBeNil)
+		db := &db{bolt: boltdb, ch: new(codec.BincHandle), escPolicies: make(map[string]*EscalationPolicy)}
+		s := &Server{db: db}
+
+		err = db.setReqGroupEscalationPolicy("grp", &EscalationPolicy{RAMMultiplier: 3, MaxEscalations: 1})
+		So(err, ShouldBeNil)
+		So(db.escalationPolicy("grp").RAMMultiplier, ShouldEqual, 3)
+		So(db.escalationPolicy("other"), ShouldBeNil)
+
+		db.escPolicies = make(map[string]*EscalationPolicy)
+		So(db.loadEscalationPolicies(), ShouldBeNil)
+		So(db.escalationPolicy("grp").RAMMultiplier, ShouldEqual, 3)
+
+		job := &Job{ReqGroup: "grp", Requirements: &jqs.Requirements{RAM: 100, Time: 1 * time.Minute}, PeakRAM: 1000, FailReason: FailReasonRAM}
+		So(s.escalateAfterFailure(job), ShouldBeFalse)
+		So(job.Requirements.RAM, ShouldEqual, 3000)
+		So(s.escalateAfterFailure(job), ShouldBeTrue)
+
+		job = &Job{ReqGroup: "grp", Requirements: &jqs.Requirements{RAM: 100, Time: 1 * time.Minute}, PeakRAM: 1000, FailReason: FailReasonRAM, EscalationPolicy: &EscalationPolicy{RAMMultiplier: 4}}
+		So(s.escalateAfterFailure(job), ShouldBeFalse)
+		So(job.Requirements.RAM, ShouldEqual, 4000)
+
+		err = db.setReqGroupEscalationPolicy("grp", nil)
+		So(err, ShouldBeNil)
+		So(db.escalationPolicy("grp"), ShouldBeNil)
+		db.escPolicies = make(map[string]*EscalationPolicy)
+		So(db.loadEscalationPolicies(), ShouldBeNil)
+		So(db.escalationPolicy("grp"), ShouldBeNil)
+	})
+}
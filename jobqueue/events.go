@@ -0,0 +1,296 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for streaming the state changes of jobs to
+// clients as server-sent events.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const restEventsEndpoint = "/rest/v1/events"
+
+// eventBufferSize is the number of the most recent events we keep, so that
+// clients that reconnect with a Last-Event-ID can be sent the ones they
+// missed.
+const eventBufferSize = 10000
+
+// eventSubscriberBuffer is the number of events that can be waiting to be sent
+// to a subscriber before we consider it too slow and disconnect it; it can
+// then reconnect and catch up from the replay buffer.
+const eventSubscriberBuffer = 1000
+
+// eventKeepAlive is how often we send a comment to subscribers when there are
+// no events, so that proxies don't close idle connections.
+const eventKeepAlive = 30 * time.Second
+
+// jobEvent describes a job changing state, as sent to event subscribers.
+type jobEvent struct {
+	ID       uint64
+	Key      string
+	RepGroup string
+	User     string
+	From     JobState
+	To       JobState
+	Time     int64 // seconds since Unix epoch
+}
+
+// eventFilter limits the events a subscriber gets to those of jobs with any of
+// the given RepGroups, users or keys. Empty sets don't limit.
+type eventFilter struct {
+	repGroups map[string]bool
+	users     map[string]bool
+	keys      map[string]bool
+}
+
+// matches tells you if the given event passes the filter.
+func (f *eventFilter) matches(e *jobEvent) bool {
+	if len(f.repGroups) > 0 && !f.repGroups[e.RepGroup] {
+		return false
+	}
+	if len(f.users) > 0 && !f.users[e.User] {
+		return false
+	}
+	return len(f.keys) == 0 || f.keys[e.Key]
+}
+
+// eventSubscriber is a client that wants to be sent events.
+type eventSubscriber struct {
+	filter *eventFilter
+	events chan *jobEvent
+}
+
+// eventStream numbers the job state change events, keeps the most recent ones
+// for replay, and sends them on to subscribers.
+//
+// Event IDs have the time the eventStream was created (in seconds since the
+// Unix epoch) in their upper 32 bits, and a count of events in their lower 32
+// bits, so that they keep increasing across restarts of the server, and IDs
+// from a previous run can be recognised.
+type eventStream struct {
+	sync.Mutex
+	firstID     uint64 // the ID before the first event of this run
+	lastID      uint64
+	buffer      []*jobEvent // a ring of the most recent events
+	next        int         // the index in buffer the next event goes in
+	subscribers map[*eventSubscriber]bool
+}
+
+// newEventStream creates a new eventStream.
+func newEventStream() *eventStream {
+	firstID := uint64(time.Now().Unix()) << 32
+	return &eventStream{
+		firstID:     firstID,
+		lastID:      firstID,
+		buffer:      make([]*jobEvent, 0, eventBufferSize),
+		subscribers: make(map[*eventSubscriber]bool),
+	}
+}
+
+// publish records that the given jobs changed state, and sends out the events.
+// Subscribers that have fallen too far behind are dropped.
+func (es *eventStream) publish(events ...*jobEvent) {
+	es.Lock()
+	defer es.Unlock()
+	now := time.Now().Unix()
+	for _, e := range events {
+		es.lastID++
+		e.ID = es.lastID
+		e.Time = now
+		if len(es.buffer) < eventBufferSize {
+			es.buffer = append(es.buffer, e)
+		} else {
+			es.buffer[es.next] = e
+		}
+		es.next = (es.next + 1) % eventBufferSize
+
+		for sub := range es.subscribers {
+			if !sub.filter.matches(e) {
+				continue
+			}
+			select {
+			case sub.events <- e:
+			default:
+				close(sub.events)
+				delete(es.subscribers, sub)
+			}
+		}
+	}
+}
+
+// subscribe starts sending events that pass the filter to a new subscriber.
+// If lastID is not 0, the buffered events after that ID are returned for
+// replay; missed will be true if events after lastID have already been dropped
+// from the buffer or lastID is not from this run of the server, in which case
+// all buffered events are returned.
+func (es *eventStream) subscribe(filter *eventFilter, lastID uint64) (sub *eventSubscriber, replay []*jobEvent, missed bool) {
+	es.Lock()
+	defer es.Unlock()
+	sub = &eventSubscriber{filter: filter, events: make(chan *jobEvent, eventSubscriberBuffer)}
+	es.subscribers[sub] = true
+
+	if lastID == 0 || lastID == es.lastID {
+		return
+	}
+	oldest := es.lastID - uint64(len(es.buffer)) + 1
+	if lastID < es.firstID || lastID > es.lastID || lastID+1 < oldest {
+		missed = true
+		lastID = 0
+	}
+
+	// go through the ring in order, starting with the oldest
+	start := 0
+	if len(es.buffer) == eventBufferSize {
+		start = es.next
+	}
+	for i := 0; i < len(es.buffer); i++ {
+		e := es.buffer[(start+i)%len(es.buffer)]
+		if e.ID > lastID && filter.matches(e) {
+			replay = append(replay, e)
+		}
+	}
+	return
+}
+
+// unsubscribe stops sending events to the given subscriber.
+func (es *eventStream) unsubscribe(sub *eventSubscriber) {
+	es.Lock()
+	defer es.Unlock()
+	if es.subscribers[sub] {
+		close(sub.events)
+		delete(es.subscribers, sub)
+	}
+}
+
+// jobStateEvent creates an event for the given job changing state. You must
+// hold the job's read lock.
+func jobStateEvent(job *Job, from, to JobState) *jobEvent {
+	return &jobEvent{Key: job.key(), RepGroup: job.RepGroup, User: job.User, From: from, To: to}
+}
+
+// restEvents streams job state changes as server-sent events. Possible query
+// parameters are repgroup, user and key, which take comma separated lists to
+// limit the events to jobs with any of those RepGroups, users or keys.
+// Reconnecting clients should supply the ID of the last event they got in a
+// Last-Event-ID header (or last_event_id parameter) to be sent the events they
+// missed; if some can no longer be sent (including because the server has
+// restarted since), a "missed" event is sent first.
+func restEvents(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		r.ParseForm()
+
+		filter := &eventFilter{
+			repGroups: eventFilterSet(r.Form.Get("repgroup")),
+			users:     eventFilterSet(r.Form.Get("user")),
+			keys:      eventFilterSet(r.Form.Get("key")),
+		}
+		last := r.Header.Get("Last-Event-ID")
+		if last == "" {
+			last = r.Form.Get("last_event_id")
+		}
+		var lastID uint64
+		if last != "" {
+			var err error
+			lastID, err = strconv.ParseUint(last, 10, 64)
+			if err != nil {
+				http.Error(w, "Last-Event-ID must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		sub, replay, missed := s.events.subscribe(filter, lastID)
+		defer s.events.unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if missed {
+			fmt.Fprint(w, "event: missed\ndata: {}\n\n")
+		}
+		for _, e := range replay {
+			if writeEvent(w, e) != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		ticker := time.NewTicker(eventKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case e, open := <-sub.events:
+				if !open {
+					// we were too slow; the client can reconnect and catch up
+					return
+				}
+				if writeEvent(w, e) != nil {
+					return
+				}
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			case <-s.stopBackground:
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes a jobEvent in server-sent event format.
+func writeEvent(w http.ResponseWriter, e *jobEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: state\ndata: %s\n\n", e.ID, data)
+	return err
+}
+
+// eventFilterSet converts a comma separated list to a set.
+func eventFilterSet(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		set[item] = true
+	}
+	return set
+}
@@ -0,0 +1,109 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	Convey("Events can be filtered", t, func() {
+		e := &jobEvent{Key: "k1", RepGroup: "rg1", User: "alice"}
+		So((&eventFilter{}).matches(e), ShouldBeTrue)
+		So((&eventFilter{repGroups: eventFilterSet("rg2,rg1")}).matches(e), ShouldBeTrue)
+		So((&eventFilter{repGroups: eventFilterSet("rg2")}).matches(e), ShouldBeFalse)
+		So((&eventFilter{repGroups: eventFilterSet("rg1"), users: eventFilterSet("bob")}).matches(e), ShouldBeFalse)
+		So((&eventFilter{keys: eventFilterSet("k1")}).matches(e), ShouldBeTrue)
+		So(eventFilterSet(""), ShouldBeNil)
+	})
+
+	Convey("Published events are numbered and sent to matching subscribers", t, func() {
+		es := newEventStream()
+		So(es.firstID>>32, ShouldEqual, time.Now().Unix()>>0)
+		all, replay, missed := es.subscribe(&eventFilter{}, 0)
+		So(len(replay), ShouldEqual, 0)
+		So(missed, ShouldBeFalse)
+		rg1, _, _ := es.subscribe(&eventFilter{repGroups: eventFilterSet("rg1")}, 0)
+
+		es.publish(&jobEvent{Key: "k1", RepGroup: "rg1", From: JobStateReady, To: JobStateRunning}, &jobEvent{Key: "k2", RepGroup: "rg2"})
+		So(len(all.events), ShouldEqual, 2)
+		So(len(rg1.events), ShouldEqual, 1)
+		e := <-rg1.events
+		So(e.ID, ShouldEqual, es.firstID+1)
+		So(e.Key, ShouldEqual, "k1")
+		So(e.Time, ShouldBeGreaterThan, 0)
+
+		es.unsubscribe(rg1)
+		_, open := <-rg1.events
+		So(open, ShouldBeFalse)
+		es.unsubscribe(rg1)
+
+		Convey("Reconnecting subscribers get the events they missed", func() {
+			es.publish(&jobEvent{Key: "k3", RepGroup: "rg1"})
+			_, replay, missed := es.subscribe(&eventFilter{repGroups: eventFilterSet("rg1")}, es.firstID+1)
+			So(missed, ShouldBeFalse)
+			So(len(replay), ShouldEqual, 1)
+			So(replay[0].ID, ShouldEqual, es.firstID+3)
+
+			_, replay, missed = es.subscribe(&eventFilter{}, es.firstID+3)
+			So(missed, ShouldBeFalse)
+			So(len(replay), ShouldEqual, 0)
+
+			_, replay, missed = es.subscribe(&eventFilter{}, es.firstID+99)
+			So(missed, ShouldBeTrue)
+			So(len(replay), ShouldEqual, 3)
+
+			// IDs from a previous run of the server are older than any of ours
+			_, replay, missed = es.subscribe(&eventFilter{}, es.firstID-(1<<32)+3)
+			So(missed, ShouldBeTrue)
+			So(len(replay), ShouldEqual, 3)
+		})
+
+		Convey("Once the buffer is full, the oldest events can't be replayed", func() {
+			for i := 0; i < eventBufferSize; i++ {
+				es.publish(&jobEvent{Key: fmt.Sprintf("k%d", i)})
+			}
+			_, replay, missed := es.subscribe(&eventFilter{}, es.firstID+1)
+			So(missed, ShouldBeTrue)
+			So(len(replay), ShouldEqual, eventBufferSize)
+			So(replay[0].ID, ShouldEqual, es.firstID+3)
+			So(replay[eventBufferSize-1].ID, ShouldEqual, es.firstID+eventBufferSize+2)
+
+			_, replay, missed = es.subscribe(&eventFilter{}, es.firstID+eventBufferSize)
+			So(missed, ShouldBeFalse)
+			So(len(replay), ShouldEqual, 2)
+			So(replay[0].ID, ShouldEqual, es.firstID+eventBufferSize+1)
+		})
+
+		Convey("Subscribers that fall too far behind are dropped", func() {
+			for i := 0; i < eventSubscriberBuffer; i++ {
+				es.publish(&jobEvent{Key: "k"})
+			}
+			received := 0
+			for range all.events {
+				received++
+			}
+			So(received, ShouldEqual, eventSubscriberBuffer)
+			So(es.subscribers[all], ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,229 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for sharing out the ready queue fairly between
+// the users and RepGroups that added Jobs, instead of purely in Priority then
+// FIFO order.
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FairShare* are the modes that ServerConfig.FairShare can be set to, which
+// determine how Jobs are grouped for the purpose of sharing out the ready
+// queue. With FairShareBoth, each RepGroup of each user is its own group,
+// named "user/repgroup".
+const (
+	FairShareUser     = "user"
+	FairShareRepGroup = "repgroup"
+	FairShareBoth     = "both"
+)
+
+// ParseShareWeights converts a string like "alice:2,bob:0.5,carol/urgent:4" in
+// to the form needed for ServerConfig.ShareWeights. Each comma separated entry
+// is a share group name (a user, a RepGroup, or "user/repgroup", depending on
+// the fair share mode) followed by a colon and a positive weight. An empty
+// string returns a nil map.
+func ParseShareWeights(str string) (map[string]float64, error) {
+	if str == "" {
+		return nil, nil
+	}
+
+	weights := make(map[string]float64)
+	for _, entry := range strings.Split(str, ",") {
+		entry = strings.TrimSpace(entry)
+		colon := strings.LastIndex(entry, ":")
+		if colon < 1 {
+			return nil, fmt.Errorf("share weight [%s] is not of the form name:weight", entry)
+		}
+		weight, err := strconv.ParseFloat(entry[colon+1:], 64)
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("share weight [%s] does not have a positive weight", entry)
+		}
+		weights[entry[:colon]] = weight
+	}
+	return weights, nil
+}
+
+// validFairShare checks that a ServerConfig.FairShare mode is one we know
+// about.
+func validFairShare(mode string) error {
+	switch mode {
+	case "", FairShareUser, FairShareRepGroup, FairShareBoth:
+		return nil
+	}
+	return fmt.Errorf("unknown fair share mode [%s]", mode)
+}
+
+// shareGroup returns the share group the given Job belongs to under our fair
+// share mode, along with the weight of that group (see shareWeight()). NB: it
+// reads the Job's User and RepGroup without locking, since it is called by the
+// queue while it is locked; these are never changed once a Job is in a queue.
+func (s *Server) shareGroup(job *Job) (group string, weight float64) {
+	switch s.fairShare {
+	case FairShareUser:
+		group = job.User
+	case FairShareRepGroup:
+		group = job.RepGroup
+	case FairShareBoth:
+		group = job.User + "/" + job.RepGroup
+	}
+	return group, s.shareWeight(group)
+}
+
+// shareWeight returns the weight of the given share group. Groups without a
+// configured weight get a weight of 1, except that in FairShareBoth mode a
+// user's weight applies to all their RepGroups that don't have their own.
+func (s *Server) shareWeight(group string) float64 {
+	if w, exists := s.shareWeights[group]; exists {
+		return w
+	}
+	if s.fairShare == FairShareBoth {
+		user := strings.SplitN(group, "/", 2)[0]
+		if w, exists := s.shareWeights[user]; exists {
+			return w
+		}
+	}
+	return 1
+}
+
+// jshare is the fair share info we send to the status webpage about each
+// share group that currently has ready or running Jobs.
+type jshare struct {
+	ShareGroup string
+	Weight     float64
+	Ready      int
+	// Running includes Jobs that are currently lost, since they may still be
+	// running.
+	Running int
+	// Share is the fraction of all running Jobs that belong to this group.
+	Share float64
+	// Target is the fraction of running Jobs this group should get, given
+	// its weight relative to the other groups that have ready Jobs.
+	Target float64
+}
+
+// jshares is how we send all the current jshares to the status webpage.
+type jshares struct {
+	Shares []*jshare
+}
+
+// shareCount is the number of ready and running Jobs in a share group.
+type shareCount struct {
+	ready   int
+	running int
+}
+
+// shareCounts keeps track of the shareCount of every share group of every
+// queue as Jobs change state, so that we don't have to look at every Job to
+// report how the queue is being shared out.
+type shareCounts struct {
+	counts map[string]map[string]*shareCount
+	sync.Mutex
+}
+
+// newShareCounts creates a new shareCounts.
+func newShareCounts() *shareCounts {
+	return &shareCounts{counts: make(map[string]map[string]*shareCount)}
+}
+
+// change records that n Jobs of the given share group in the given queue
+// changed from one state to another.
+func (sc *shareCounts) change(queue, group string, from, to JobState, n int) {
+	sc.Lock()
+	defer sc.Unlock()
+	groups, exists := sc.counts[queue]
+	if !exists {
+		groups = make(map[string]*shareCount)
+		sc.counts[queue] = groups
+	}
+	count, exists := groups[group]
+	if !exists {
+		count = &shareCount{}
+		groups[group] = count
+	}
+	switch from {
+	case JobStateReady:
+		count.ready -= n
+	case JobStateRunning:
+		count.running -= n
+	}
+	switch to {
+	case JobStateReady:
+		count.ready += n
+	case JobStateRunning:
+		count.running += n
+	}
+	if count.ready <= 0 && count.running <= 0 {
+		delete(groups, group)
+	}
+}
+
+// shares works out the jshares of the given queue, sorted by group name. It
+// returns nil if fair share isn't turned on.
+func (s *Server) shares(queue string) []*jshare {
+	if s.fairShare == "" {
+		return nil
+	}
+
+	s.shareCounts.Lock()
+	groups := make(map[string]*jshare)
+	var running int
+	for name, count := range s.shareCounts.counts[queue] {
+		share := &jshare{ShareGroup: name, Weight: s.shareWeight(name)}
+		if count.ready > 0 {
+			share.Ready = count.ready
+		}
+		if count.running > 0 {
+			share.Running = count.running
+			running += count.running
+		}
+		groups[name] = share
+	}
+	s.shareCounts.Unlock()
+
+	// only groups that want more Jobs run count towards the targets; a group
+	// that is only running isn't competing for anything
+	var competing float64
+	for _, share := range groups {
+		if share.Ready > 0 {
+			competing += share.Weight
+		}
+	}
+
+	shares := make([]*jshare, 0, len(groups))
+	for _, share := range groups {
+		if running > 0 {
+			share.Share = float64(share.Running) / float64(running)
+		}
+		if share.Ready > 0 && competing > 0 {
+			share.Target = share.Weight / competing
+		}
+		shares = append(shares, share)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].ShareGroup < shares[j].ShareGroup
+	})
+	return shares
+}
@@ -0,0 +1,103 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestFairShare(t *testing.T) {
+	Convey("Share weights can be parsed", t, func() {
+		weights, err := ParseShareWeights("alice:2, bob:0.5,carol/urgent:4")
+		So(err, ShouldBeNil)
+		So(weights, ShouldResemble, map[string]float64{"alice": 2, "bob": 0.5, "carol/urgent": 4})
+
+		weights, err = ParseShareWeights("")
+		So(err, ShouldBeNil)
+		So(weights, ShouldBeNil)
+
+		_, err = ParseShareWeights("alice")
+		So(err, ShouldNotBeNil)
+		_, err = ParseShareWeights("alice:0")
+		So(err, ShouldNotBeNil)
+		_, err = ParseShareWeights("alice:lots")
+		So(err, ShouldNotBeNil)
+
+		So(validFairShare(FairShareBoth), ShouldBeNil)
+		So(validFairShare("everyone"), ShouldNotBeNil)
+	})
+
+	Convey("Jobs are put in the right share group with the right weight", t, func() {
+		s := &Server{fairShare: FairShareUser, shareWeights: map[string]float64{"alice": 2, "carol/urgent": 4}}
+		aliceJob := &Job{User: "alice", RepGroup: "a", State: JobStateRunning}
+		carolJob := &Job{User: "carol", RepGroup: "urgent", State: JobStateReady}
+
+		group, weight := s.shareGroup(aliceJob)
+		So(group, ShouldEqual, "alice")
+		So(weight, ShouldEqual, 2)
+		group, weight = s.shareGroup(carolJob)
+		So(group, ShouldEqual, "carol")
+		So(weight, ShouldEqual, 1)
+
+		s.fairShare = FairShareBoth
+		group, weight = s.shareGroup(aliceJob)
+		So(group, ShouldEqual, "alice/a")
+		So(weight, ShouldEqual, 2)
+		group, weight = s.shareGroup(carolJob)
+		So(group, ShouldEqual, "carol/urgent")
+		So(weight, ShouldEqual, 4)
+
+		s.fairShare = FairShareRepGroup
+		group, weight = s.shareGroup(carolJob)
+		So(group, ShouldEqual, "urgent")
+		So(weight, ShouldEqual, 1)
+
+		Convey("Shares and targets can be calculated", func() {
+			s.fairShare = FairShareUser
+			s.shareCounts = newShareCounts()
+			jobs := []*Job{
+				aliceJob,
+				{User: "alice", State: JobStateRunning},
+				{User: "alice", State: JobStateReady},
+				{User: "bob", State: JobStateRunning},
+				{User: "bob", State: JobStateBuried},
+				carolJob,
+			}
+			for _, job := range jobs {
+				group, _ := s.shareGroup(job)
+				s.shareCounts.change("cmds", group, JobStateNew, job.State, 1)
+			}
+			s.shareCounts.change("cmds", "dave", JobStateNew, JobStateReady, 2)
+			s.shareCounts.change("cmds", "dave", JobStateReady, JobStateRunning, 1)
+			s.shareCounts.change("cmds", "dave", JobStateReady, JobStateDeleted, 1)
+			s.shareCounts.change("cmds", "dave", JobStateRunning, JobStateComplete, 1)
+
+			shares := s.shares("cmds")
+			So(len(shares), ShouldEqual, 3)
+			So(*shares[0], ShouldResemble, jshare{ShareGroup: "alice", Weight: 2, Ready: 1, Running: 2, Share: 2.0 / 3, Target: 2.0 / 3})
+			So(*shares[1], ShouldResemble, jshare{ShareGroup: "bob", Weight: 1, Ready: 0, Running: 1, Share: 1.0 / 3, Target: 0})
+			So(*shares[2], ShouldResemble, jshare{ShareGroup: "carol", Weight: 1, Ready: 1, Running: 0, Share: 0, Target: 1.0 / 3})
+			So(s.shares("other"), ShouldBeEmpty)
+
+			s.fairShare = ""
+			So(s.shares("cmds"), ShouldBeNil)
+		})
+	})
+}
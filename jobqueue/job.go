@@ -27,7 +27,6 @@ import (
 	"github.com/VertebrateResequencing/wr/queue"
 	"github.com/satori/go.uuid"
 	"github.com/ugorji/go/codec"
-	"math"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -43,8 +42,9 @@ type JobState string
 // JobState* constants represent all the possible job states. The fake "new" and
 // "deleted" states are for the benefit of the web interface (jstateCount).
 // "lost" is also a "fake" state indicating the job was running and we lost
-// contact with it; it may be dead. "unknown" is an error case that shouldn't
-// happen.
+// contact with it; it may be dead. "quota" is likewise a ready job that is
+// waiting for its user or RepGroup to have enough of their quota free.
+// "unknown" is an error case that shouldn't happen.
 const (
 	JobStateNew       JobState = "new"
 	JobStateDelayed   JobState = "delayed"
@@ -54,11 +54,28 @@ const (
 	JobStateLost      JobState = "lost"
 	JobStateBuried    JobState = "buried"
 	JobStateDependent JobState = "dependent"
+	JobStateQuota     JobState = "quota"
 	JobStateComplete  JobState = "complete"
 	JobStateDeleted   JobState = "deleted"
 	JobStateUnknown   JobState = "unknown"
 )
 
+// Freshness* constants describe the decisions that can be made about a Job
+// that specified Outputs when it was added to the queue.
+const (
+	// FreshnessUpToDate means all Outputs existed and were newer than all
+	// Inputs, so the Job was considered complete without being run.
+	FreshnessUpToDate = "up to date"
+
+	// FreshnessStale means an Output was missing or older than an Input, so
+	// the Job will be run.
+	FreshnessStale = "stale"
+
+	// FreshnessRerun means the Job had previously completed, but was found to
+	// be stale, so it is being run again.
+	FreshnessRerun = "re-run because stale"
+)
+
 // subqueueToJobState converts queue.SubQueue entries to JobStates.
 var subqueueToJobState = map[queue.SubQueue]JobState{
 	queue.SubQueueNew:       JobStateNew,
@@ -118,9 +135,9 @@ type Job struct {
 	ReqGroup string
 
 	// Requirements describes the resources this Cmd needs to run, such as RAM,
-	// Disk and time. These may be determined for you by the system (depending
-	// on Override) based on past experience of running jobs with the same
-	// ReqGroup.
+	// Disk, cores and time. These may be determined for you by the system
+	// (depending on Override) based on past experience of running jobs with
+	// the same ReqGroup.
 	Requirements *scheduler.Requirements
 
 	// Override determines if your own supplied Requirements get used, or if the
@@ -136,6 +153,35 @@ type Job struct {
 	// Retries is the number of times to retry running a Cmd if it fails.
 	Retries uint8
 
+	// RetryPolicy optionally refines how the Job is retried when it fails: how
+	// long to wait between retries, which exit codes are worth retrying, and a
+	// separate number of retries for infrastructure failures.
+	RetryPolicy *RetryPolicy
+
+	// TimeLimit, if greater than 0, is a multiple of Requirements.Time after
+	// which Cmd will be sent SIGTERM, followed by SIGKILL if it's still
+	// running after ClientKillGracePeriod (or KillSequence is carried out, if
+	// set); it then fails with FailReasonTime. Eg. 2 kills Cmd if it runs for
+	// twice its expected time. When adding Jobs, 0 means use the server's
+	// default and a negative value means never kill.
+	TimeLimit float64
+
+	// KillSequence optionally describes how to stop Cmd gracefully when the
+	// runner is signalled, Kill() is called or TimeLimit is reached, so that it
+	// can checkpoint or flush its output.
+	KillSequence KillSequence
+
+	// Checkpoint optionally describes how Cmd can save its progress when it is
+	// stopped early, so that the next attempt can resume instead of starting
+	// from scratch.
+	Checkpoint *Checkpoint
+
+	// EscalationPolicy optionally changes how much Requirements are increased
+	// by (and limits how far they can increase) when Cmd fails due to using
+	// too much RAM or time. If nil, the policy set for ReqGroup (if any) is
+	// used. See Escalations.
+	EscalationPolicy *EscalationPolicy
+
 	// DepGroups are the dependency groups this job belongs to that other jobs
 	// can refer to in their Dependencies.
 	DepGroups []string
@@ -164,6 +210,42 @@ type Job struct {
 	// ActualCwd.
 	MountConfigs MountConfigs
 
+	// Inputs and Outputs are optional paths to the files that Cmd reads and
+	// writes; relative paths are taken to be relative to Cwd. If Outputs are
+	// specified, then when the Job is added to the queue it will be considered
+	// complete without being run if all Outputs exist and are newer than all
+	// Inputs. Otherwise it will be run, even if it had previously completed.
+	// See Freshness.
+	Inputs  []string
+	Outputs []string
+
+	// Cache, if true and Outputs are specified, means that after Cmd runs
+	// successfully its Outputs will be stored in the manager's result cache
+	// (if one has been configured), keyed on Cmd and the contents of Inputs.
+	// Future Jobs with the same key will then have their Outputs restored from
+	// the cache instead of their Cmd being run. Only set this for Cmds that
+	// are deterministic and have no other side effects. See CacheStatus.
+	Cache bool
+
+	// Array, if set, makes this an array Job: instead of Cmd being run once,
+	// the server creates a Job (an "element" of the array) for each index or
+	// value in the Array, with ArrayIndexPlaceholder and ArrayValuePlaceholder
+	// in Cmd, Inputs and Outputs replaced with that element's index and value.
+	// Elements are created lazily as earlier ones start running (unless
+	// DepGroups are set, in which case they are all created immediately), and
+	// can otherwise be treated like normal Jobs (eg. individually Kick()ed or
+	// Kill()ed using their Cmd). See ArrayID and Client.GetArrayStatus().
+	Array *JobArray
+
+	// Webhook, if set, is an absolute http(s) URL that will be POSTed a JSON
+	// description of this Job when it gets buried or completes, and of its
+	// RepGroup when all of that RepGroup's Jobs have completed. Only the
+	// Webhook of the RepGroup's Job that completes last is told about the
+	// RepGroup completing, so all the Jobs in a RepGroup should have the same
+	// Webhook. This is in addition to any webhooks the server has been
+	// configured with.
+	Webhook string
+
 	// The remaining properties are used to record information about what
 	// happened when Cmd was executed, or otherwise provide its current state.
 	// It is meaningless to set these yourself.
@@ -173,6 +255,9 @@ type Job struct {
 	ActualCwd string
 	// peak RAM (MB) used.
 	PeakRAM int
+	// peak disk space (MB) used in ActualCwd and its TMPDIR; only measured if
+	// CwdMatters is false.
+	PeakDisk int
 	// true if the Cmd was run and exited.
 	Exited bool
 	// if the job ran and exited, its exit code is recorded here, but check
@@ -195,7 +280,7 @@ type Job struct {
 	StartTime time.Time
 	// time the cmd stopped running.
 	EndTime time.Time
-	// CPU time used.
+	// CPU time (user + system) used.
 	CPUtime time.Duration
 	// to read, call job.StdErr() instead; if the job ran, its (truncated)
 	// STDERR will be here.
@@ -216,6 +301,13 @@ type Job struct {
 	Attempts uint32
 	// remaining number of Release()s allowed before being buried instead.
 	UntilBuried uint8
+	// if RetryPolicy is set with InfraRetries, the remaining number of
+	// Release()s allowed due to infrastructure failures before being buried
+	// instead.
+	InfraUntilBuried uint8
+	// the history of increases to Requirements following failures due to
+	// using too much RAM or time.
+	Escalations []*Escalation
 	// we note which client reserved this job, for validating if that client has
 	// permission to do other stuff to this Job; the server only ever sets this
 	// on Reserve(), so clients can't cheat by changing this on their end.
@@ -228,6 +320,25 @@ type Job struct {
 	Similar int
 	// name of the queue the Job was added to.
 	Queue string
+	// if Outputs were specified, one of the Freshness* strings recording
+	// what was decided when the Job was added.
+	Freshness string
+	// if Cache was true and the Job ran, the key its Outputs were cached
+	// under.
+	CacheKey string
+	// if Cache was true and the Job ran, one of the Cache* strings recording
+	// if its Outputs were restored from the cache.
+	CacheStatus string
+	// if this is an element of an array Job, the key of that array Job.
+	ArrayID string
+	// if this is an element of an array Job, the index it replaced
+	// ArrayIndexPlaceholder with.
+	ArrayIndex int
+	// if this is an element of an array Job, the number of elements in that
+	// array.
+	ArraySize int
+	// the user that added the Job.
+	User string
 
 	// we add this internally to match up runners we spawn via the scheduler to
 	// the Jobs they're allowed to ReserveFiltered().
@@ -237,6 +348,10 @@ type Job struct {
 	// job.
 	scheduledRunner bool
 
+	// the server uses this to track if this ready job is being held back
+	// because its user or RepGroup is at their quota.
+	quotaHeld bool
+
 	// we store the MuxFys that we mount during Mount() so we can Unmount() them
 	// later; this is purely client side
 	mountedFS []*muxfys.MuxFys
@@ -244,6 +359,14 @@ type Job struct {
 	// killCalled is set for running jobs if Kill() is called on them
 	killCalled bool
 
+	// the server uses this to track if this element of an array Job has ever
+	// left the ready queue.
+	arrayDequeued bool
+
+	// the location of the manager's result cache, told to us on Reserve();
+	// this is purely client side
+	cacheDir string
+
 	sync.RWMutex
 }
 
@@ -267,25 +390,15 @@ func (j *Job) WallTime() (d time.Duration) {
 // queue, returns current environment variables instead. In both cases, alters
 // the return value to apply any overrides stored in job.EnvOverride.
 func (j *Job) Env() (env []string, err error) {
-	overrideEs := &envStr{}
-	if len(j.EnvOverride) > 0 {
-		decompressed, derr := decompress(j.EnvOverride)
-		if derr != nil {
-			err = derr
-			return
-		}
-		ch := new(codec.BincHandle)
-		dec := codec.NewDecoderBytes([]byte(decompressed), ch)
-		err = dec.Decode(overrideEs)
-		if err != nil {
-			return
-		}
+	overrides, err := j.EnvOverrides()
+	if err != nil {
+		return
 	}
 
 	if len(j.EnvC) == 0 {
 		env = os.Environ()
-		if len(overrideEs.Environ) > 0 {
-			env = envOverride(env, overrideEs.Environ)
+		if len(overrides) > 0 {
+			env = envOverride(env, overrides)
 		}
 		return
 	}
@@ -307,13 +420,32 @@ func (j *Job) Env() (env []string, err error) {
 		env = os.Environ()
 	}
 
-	if len(overrideEs.Environ) > 0 {
-		env = envOverride(env, overrideEs.Environ)
+	if len(overrides) > 0 {
+		env = envOverride(env, overrides)
 	}
 
 	return
 }
 
+// EnvOverrides decompresses and decodes job.EnvOverride, returning just the
+// environment variables that were specifically set for this Job (eg. with the
+// env option of 'wr add').
+func (j *Job) EnvOverrides() (env []string, err error) {
+	if len(j.EnvOverride) == 0 {
+		return
+	}
+	decompressed, err := decompress(j.EnvOverride)
+	if err != nil {
+		return
+	}
+	ch := new(codec.BincHandle)
+	dec := codec.NewDecoderBytes([]byte(decompressed), ch)
+	es := &envStr{}
+	err = dec.Decode(es)
+	env = es.Environ
+	return
+}
+
 // StdOut returns the decompressed job.StdOutC, which is the head and tail of
 // job.Cmd's STDOUT when it ran. If the Cmd hasn't run yet, or if it output
 // nothing to STDOUT, you will get an empty string. Note that StdOutC is only
@@ -518,29 +650,46 @@ func (j *Job) Unmount(stopUploads ...bool) (logs string, err error) {
 	return
 }
 
-// updateRecsAfterFailure checks the FailReason and bumps RAM or Time as
-// appropriate.
-func (j *Job) updateRecsAfterFailure() {
-	switch j.FailReason {
-	case FailReasonRAM:
-		// increase by 1GB or [100% if under 8GB, 30% if over], whichever is
-		// greater, and round up to nearest 100
-		// *** increase to greater than max seen for jobs in our ReqGroup?
-		updatedMB := float64(j.PeakRAM)
-		if updatedMB <= RAMIncreaseMultBreakpoint {
-			updatedMB *= RAMIncreaseMultLow
-		} else {
-			updatedMB *= RAMIncreaseMultHigh
+// CheckFreshness looks at the modification times of the Job's Inputs and
+// Outputs on the local file system, and sets Freshness to FreshnessUpToDate if
+// all Outputs exist and none are older than any Input, or FreshnessStale
+// otherwise (including if an Input doesn't exist). It does nothing if there are
+// no Outputs, or if this is an array Job (whose elements are not checked).
+// Client.Add() calls this for you.
+func (j *Job) CheckFreshness() {
+	if len(j.Outputs) == 0 || j.Array != nil {
+		return
+	}
+	j.Freshness = FreshnessStale
+
+	var oldestOutput time.Time
+	for _, path := range j.Outputs {
+		info, err := os.Stat(j.absPath(path))
+		if err != nil {
+			return
 		}
-		if updatedMB < float64(j.PeakRAM)+RAMIncreaseMin {
-			updatedMB = float64(j.PeakRAM) + RAMIncreaseMin
+		if oldestOutput.IsZero() || info.ModTime().Before(oldestOutput) {
+			oldestOutput = info.ModTime()
+		}
+	}
+
+	for _, path := range j.Inputs {
+		info, err := os.Stat(j.absPath(path))
+		if err != nil || info.ModTime().After(oldestOutput) {
+			return
 		}
-		j.Requirements.RAM = int(math.Ceil(updatedMB/100) * 100)
-		j.Override = uint8(1)
-	case FailReasonTime:
-		j.Requirements.Time += 1 * time.Hour
-		j.Override = uint8(1)
 	}
+
+	j.Freshness = FreshnessUpToDate
+}
+
+// absPath returns the given path if absolute, otherwise the path relative to
+// Cwd.
+func (j *Job) absPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(j.Cwd, path)
 }
 
 // key calculates a unique key to describe the job.
@@ -567,6 +716,22 @@ func (j *Job) setScheduledRunner(newval bool) {
 	j.scheduledRunner = newval
 }
 
+// getQuotaHeld provides a thread-safe way of getting the quotaHeld property of
+// a Job.
+func (j *Job) getQuotaHeld() bool {
+	j.RLock()
+	defer j.RUnlock()
+	return j.quotaHeld
+}
+
+// setQuotaHeld provides a thread-safe way of setting the quotaHeld property of
+// a Job.
+func (j *Job) setQuotaHeld(newval bool) {
+	j.Lock()
+	defer j.Unlock()
+	j.quotaHeld = newval
+}
+
 // getSchedulerGroup provides a thread-safe way of getting the schedulerGroup
 // property of a Job.
 func (j *Job) getSchedulerGroup() string {
@@ -251,6 +251,23 @@ func TestJobqueue(t *testing.T) {
 				// tests
 			})
 
+			Convey("Jobs with a hard time limit are stopped when they take too long", func() {
+				ClientReleaseDelay = 100 * time.Second
+				job2.TimeLimit = 1.5
+				t := time.Now()
+				err := jq.Execute(job2, config.RunnerExecShell)
+				So(err, ShouldNotBeNil)
+				jqerr, ok := err.(Error)
+				So(ok, ShouldBeTrue)
+				So(jqerr.Err, ShouldEqual, FailReasonTime)
+				So(time.Since(t), ShouldBeLessThan, 3*time.Second)
+				So(job2.State, ShouldEqual, JobStateDelayed)
+				So(job2.Exitcode, ShouldEqual, -1)
+				So(job2.FailReason, ShouldEqual, FailReasonTime)
+				So(job2.Requirements.Time.Seconds(), ShouldEqual, 3601)
+				ClientReleaseDelay = 100 * time.Millisecond
+			})
+
 			RecSecRound = 1800 // revert back to normal
 		})
 
@@ -348,8 +365,10 @@ func TestJobqueue(t *testing.T) {
 			Convey("You can store their (fake) runtime stats and get recommendations", func() {
 				for index, job := range jobs {
 					job.PeakRAM = index + 1
+					job.PeakDisk = (index + 1) * 100
 					job.StartTime = time.Now()
 					job.EndTime = job.StartTime.Add(time.Duration(index+1) * time.Second)
+					job.CPUtime = time.Duration(float64(index+1)*1.5) * time.Second
 					server.db.updateJobAfterExit(job, []byte{}, []byte{}, false)
 				}
 				<-time.After(100 * time.Millisecond)
@@ -359,6 +378,12 @@ func TestJobqueue(t *testing.T) {
 				rtime, err := server.db.recommendedReqGroupTime("fake_group")
 				So(err, ShouldBeNil)
 				So(rtime, ShouldEqual, 1800)
+				rcores, err := server.db.recommendedReqGroupCores("fake_group")
+				So(err, ShouldBeNil)
+				So(rcores, ShouldEqual, 2)
+				rdisk, err := server.db.recommendedReqGroupDisk("fake_group")
+				So(err, ShouldBeNil)
+				So(rdisk, ShouldEqual, 1)
 
 				for i := 11; i <= 100; i++ {
 					job := &Job{Cmd: fmt.Sprintf("test cmd %d", i), Cwd: "/fake/cwd", ReqGroup: "fake_group", Requirements: &jqs.Requirements{RAM: 1024, Time: 4 * time.Hour, Cores: 1}, Retries: uint8(3), RepGroup: "manually_added"}
@@ -904,6 +929,18 @@ func TestJobqueue(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(job, ShouldBeNil)
 
+				entries, err := jq.GetAudit(&AuditFilter{Limit: len(jobs)})
+				So(err, ShouldBeNil)
+				So(len(entries), ShouldEqual, len(jobs))
+				for i, entry := range entries {
+					So(entry.Action, ShouldEqual, AuditDelete)
+					So(entry.User, ShouldEqual, jq.user)
+					So(entry.Host, ShouldEqual, jq.host)
+					So(entry.Peer, ShouldNotBeBlank)
+					So(entry.Queue, ShouldEqual, "test_queue")
+					So(entry.Keys, ShouldResemble, []string{jobs[i].key()})
+				}
+
 				Convey("Cmds with pipes in them are handled correctly", func() {
 					jobs = nil
 					jobs = append(jobs, &Job{Cmd: "sleep 0.1 && true | true", Cwd: "/tmp", ReqGroup: "fake_group", Requirements: standardReqs, Retries: uint8(3), RepGroup: "should_pass"})
@@ -1485,6 +1522,209 @@ func TestJobqueue(t *testing.T) {
 			})
 		})
 
+		Convey("Jobs with up-to-date outputs are completed without being run", func() {
+			jq, err := Connect(addr, "test_queue", clientConnectTime)
+			So(err, ShouldBeNil)
+			defer jq.Disconnect()
+
+			dir, err := ioutil.TempDir("", "wr_jobqueue_test_freshness_")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			input := filepath.Join(dir, "in")
+			output := filepath.Join(dir, "out")
+			err = ioutil.WriteFile(input, []byte("in"), 0644)
+			So(err, ShouldBeNil)
+			err = ioutil.WriteFile(output, []byte("out"), 0644)
+			So(err, ShouldBeNil)
+			past := time.Now().Add(-1 * time.Hour)
+			err = os.Chtimes(input, past, past)
+			So(err, ShouldBeNil)
+
+			newJob := func() *Job {
+				return &Job{Cmd: "echo freshtest", Cwd: dir, ReqGroup: "fake_group", Requirements: standardReqs, Retries: uint8(3), RepGroup: "fresh", Inputs: []string{"in"}, Outputs: []string{output}}
+			}
+			job := newJob()
+			inserts, already, err := jq.Add([]*Job{job}, envVars, true)
+			So(err, ShouldBeNil)
+			So(inserts, ShouldEqual, 0)
+			So(already, ShouldEqual, 1)
+			So(job.Freshness, ShouldEqual, FreshnessUpToDate)
+
+			got, err := jq.GetByEssence(&JobEssence{Cmd: "echo freshtest"}, false, false)
+			So(err, ShouldBeNil)
+			So(got, ShouldNotBeNil)
+			So(got.State, ShouldEqual, JobStateComplete)
+			So(got.Freshness, ShouldEqual, FreshnessUpToDate)
+
+			reserved, err := jq.Reserve(50 * time.Millisecond)
+			So(err, ShouldBeNil)
+			So(reserved, ShouldBeNil)
+
+			Convey("Once an input is modified, adding it again makes it run", func() {
+				future := time.Now().Add(1 * time.Hour)
+				err = os.Chtimes(input, future, future)
+				So(err, ShouldBeNil)
+
+				job = newJob()
+				inserts, already, err = jq.Add([]*Job{job}, envVars, true)
+				So(err, ShouldBeNil)
+				So(inserts, ShouldEqual, 1)
+				So(already, ShouldEqual, 0)
+				So(job.Freshness, ShouldEqual, FreshnessStale)
+
+				reserved, err = jq.Reserve(50 * time.Millisecond)
+				So(err, ShouldBeNil)
+				So(reserved, ShouldNotBeNil)
+				So(reserved.Cmd, ShouldEqual, "echo freshtest")
+				So(reserved.Freshness, ShouldEqual, FreshnessRerun)
+				err = jq.Execute(reserved, config.RunnerExecShell)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Once an output is missing, adding it again makes it run", func() {
+				err = os.Remove(output)
+				So(err, ShouldBeNil)
+
+				job = newJob()
+				inserts, already, err = jq.Add([]*Job{job}, envVars, true)
+				So(err, ShouldBeNil)
+				So(inserts, ShouldEqual, 1)
+				So(job.Freshness, ShouldEqual, FreshnessStale)
+			})
+		})
+
+		Convey("Array jobs are lazily expanded in to their elements", func() {
+			jq, err := Connect(addr, "array_queue", clientConnectTime)
+			So(err, ShouldBeNil)
+			defer jq.Disconnect()
+
+			origBatchSize := ServerArrayBatchSize
+			ServerArrayBatchSize = 2
+			defer func() {
+				ServerArrayBatchSize = origBatchSize
+			}()
+
+			_, _, err = jq.Add([]*Job{{Cmd: "echo array", Cwd: "/tmp", ReqGroup: "fake_group", Requirements: standardReqs, RepGroup: "arraytest", Array: &JobArray{Start: 1, End: 5}}}, envVars, true)
+			So(err, ShouldNotBeNil)
+
+			newArray := func() *Job {
+				return &Job{Cmd: "echo array {{index}}", Cwd: "/tmp", ReqGroup: "fake_group", Requirements: standardReqs, Retries: uint8(3), RepGroup: "arraytest", Array: &JobArray{Start: 1, End: 5}}
+			}
+			inserts, already, err := jq.Add([]*Job{newArray()}, envVars, true)
+			So(err, ShouldBeNil)
+			So(inserts, ShouldEqual, 5)
+			So(already, ShouldEqual, 0)
+
+			statuses, err := jq.GetArrayStatus("arraytest")
+			So(err, ShouldBeNil)
+			So(len(statuses), ShouldEqual, 1)
+			So(statuses[0].Size, ShouldEqual, 5)
+			So(statuses[0].Pending, ShouldEqual, 3)
+			So(statuses[0].States[JobStateReady], ShouldEqual, 2)
+
+			inserts, already, err = jq.Add([]*Job{newArray()}, envVars, true)
+			So(err, ShouldBeNil)
+			So(inserts, ShouldEqual, 0)
+			So(already, ShouldEqual, 5)
+
+			Convey("More elements are created as earlier ones start running", func() {
+				job, err := jq.Reserve(50 * time.Millisecond)
+				So(err, ShouldBeNil)
+				So(job, ShouldNotBeNil)
+				So(job.Cmd, ShouldEqual, "echo array 1")
+				So(job.ArrayIndex, ShouldEqual, 1)
+				So(job.ArraySize, ShouldEqual, 5)
+				So(job.ArrayID, ShouldEqual, statuses[0].ID)
+				err = jq.Execute(job, config.RunnerExecShell)
+				So(err, ShouldBeNil)
+
+				<-time.After(100 * time.Millisecond)
+				statuses, err = jq.GetArrayStatus("arraytest")
+				So(err, ShouldBeNil)
+				So(len(statuses), ShouldEqual, 1)
+				So(statuses[0].Pending, ShouldEqual, 2)
+				So(statuses[0].States[JobStateComplete], ShouldEqual, 1)
+				So(statuses[0].States[JobStateReady], ShouldEqual, 2)
+
+				for i := 2; i <= 5; i++ {
+					job, err = jq.Reserve(50 * time.Millisecond)
+					So(err, ShouldBeNil)
+					So(job, ShouldNotBeNil)
+					So(job.Cmd, ShouldEqual, fmt.Sprintf("echo array %d", i))
+					err = jq.Execute(job, config.RunnerExecShell)
+					So(err, ShouldBeNil)
+					<-time.After(100 * time.Millisecond)
+				}
+
+				statuses, err = jq.GetArrayStatus("arraytest")
+				So(err, ShouldBeNil)
+				So(len(statuses), ShouldEqual, 1)
+				So(statuses[0].Pending, ShouldEqual, 0)
+				So(statuses[0].States[JobStateComplete], ShouldEqual, 5)
+			})
+
+			Convey("Killing an element doesn't stop the rest of the array being created", func() {
+				job, err := jq.Reserve(50 * time.Millisecond)
+				So(err, ShouldBeNil)
+				So(job, ShouldNotBeNil)
+				<-time.After(100 * time.Millisecond)
+
+				killed, err := jq.Kill([]*JobEssence{{JobKey: job.key()}})
+				So(err, ShouldBeNil)
+				So(killed, ShouldEqual, 1)
+
+				statuses, err = jq.GetArrayStatus("arraytest")
+				So(err, ShouldBeNil)
+				So(len(statuses), ShouldEqual, 1)
+				So(statuses[0].Pending, ShouldEqual, 2)
+				So(statuses[0].States[JobStateRunning], ShouldEqual, 1)
+				So(statuses[0].States[JobStateReady], ShouldEqual, 2)
+
+				for i := 2; i <= 5; i++ {
+					job, err = jq.Reserve(50 * time.Millisecond)
+					So(err, ShouldBeNil)
+					So(job, ShouldNotBeNil)
+					So(job.Cmd, ShouldEqual, fmt.Sprintf("echo array %d", i))
+					<-time.After(100 * time.Millisecond)
+				}
+				job, err = jq.Reserve(50 * time.Millisecond)
+				So(err, ShouldBeNil)
+				So(job, ShouldBeNil)
+			})
+
+			Convey("Cancelling the array stops the rest of it being created", func() {
+				job, err := jq.Reserve(50 * time.Millisecond)
+				So(err, ShouldBeNil)
+				So(job, ShouldNotBeNil)
+				<-time.After(100 * time.Millisecond)
+
+				dropped, err := jq.CancelArray([]string{statuses[0].ID})
+				So(err, ShouldBeNil)
+				So(dropped, ShouldEqual, 2)
+
+				statuses, err = jq.GetArrayStatus("arraytest")
+				So(err, ShouldBeNil)
+				So(len(statuses), ShouldEqual, 1)
+				So(statuses[0].Pending, ShouldEqual, 0)
+				So(statuses[0].States[JobStateRunning], ShouldEqual, 1)
+				So(statuses[0].States[JobStateReady], ShouldEqual, 2)
+
+				for i := 0; i < 2; i++ {
+					job, err = jq.Reserve(50 * time.Millisecond)
+					So(err, ShouldBeNil)
+					So(job, ShouldNotBeNil)
+				}
+				<-time.After(100 * time.Millisecond)
+				job, err = jq.Reserve(50 * time.Millisecond)
+				So(err, ShouldBeNil)
+				So(job, ShouldBeNil)
+
+				dropped, err = jq.CancelArray([]string{statuses[0].ID})
+				So(err, ShouldBeNil)
+				So(dropped, ShouldEqual, 0)
+			})
+		})
+
 		Convey("After connecting and adding some jobs under some RepGroups", func() {
 			jq, err := Connect(addr, "dep_queue", clientConnectTime)
 			So(err, ShouldBeNil)
@@ -3099,6 +3339,154 @@ func TestJobqueue(t *testing.T) {
 		server.Stop(true)
 	}
 
+	Convey("Once a new jobqueue server is up with quotas", t, func() {
+		quotaConfig := serverConfig
+		quotaConfig.UserQuotas = map[string]*Quota{QuotaDefault: {Jobs: 1}}
+		server, _, err := Serve(quotaConfig)
+		So(err, ShouldBeNil)
+
+		Convey("Jobs that would go over quota can't be reserved until quota frees up", func() {
+			jq, err := Connect(addr, "test_queue", clientConnectTime)
+			So(err, ShouldBeNil)
+			defer jq.Disconnect()
+
+			var jobs []*Job
+			for i := 0; i < 2; i++ {
+				jobs = append(jobs, &Job{Cmd: fmt.Sprintf("echo quota%d", i), Cwd: "/tmp", ReqGroup: "fake_group", Requirements: standardReqs, Priority: uint8(2 - i), Retries: uint8(0), RepGroup: "quota"})
+			}
+			inserts, already, err := jq.Add(jobs, envVars, true)
+			So(err, ShouldBeNil)
+			So(inserts, ShouldEqual, 2)
+			So(already, ShouldEqual, 0)
+
+			job, err := jq.Reserve(50 * time.Millisecond)
+			So(err, ShouldBeNil)
+			So(job, ShouldNotBeNil)
+			So(job.Cmd, ShouldEqual, "echo quota0")
+
+			job2, err := jq.Reserve(50 * time.Millisecond)
+			So(err, ShouldBeNil)
+			So(job2, ShouldBeNil)
+
+			<-time.After(100 * time.Millisecond)
+			held, err := jq.GetByEssence(&JobEssence{Cmd: "echo quota1"}, false, false)
+			So(err, ShouldBeNil)
+			So(held, ShouldNotBeNil)
+			So(held.State, ShouldEqual, JobStateQuota)
+
+			err = jq.Execute(job, config.RunnerExecShell)
+			So(err, ShouldBeNil)
+			So(job.State, ShouldEqual, JobStateComplete)
+
+			job2, err = jq.Reserve(1 * time.Second)
+			So(err, ShouldBeNil)
+			So(job2, ShouldNotBeNil)
+			So(job2.Cmd, ShouldEqual, "echo quota1")
+
+			err = jq.Execute(job2, config.RunnerExecShell)
+			So(err, ShouldBeNil)
+			So(job2.State, ShouldEqual, JobStateComplete)
+		})
+
+		Reset(func() {
+			if server != nil {
+				server.Stop(true)
+			}
+		})
+	})
+
+	if server != nil {
+		server.Stop(true)
+	}
+
+	Convey("Once a new jobqueue server is up with jobs that have run", t, func() {
+		server, _, err := Serve(serverConfig)
+		So(err, ShouldBeNil)
+
+		jq, err := Connect(addr, "test_queue", clientConnectTime)
+		So(err, ShouldBeNil)
+		defer jq.Disconnect()
+
+		before := time.Now()
+		var jobs []*Job
+		jobs = append(jobs, &Job{Cmd: "echo search 1", Cwd: "/tmp", ReqGroup: "fake_group", Requirements: standardReqs, Priority: uint8(3), Retries: uint8(0), RepGroup: "search"})
+		jobs = append(jobs, &Job{Cmd: "echo search 2 && false", Cwd: "/tmp", ReqGroup: "fake_group", Requirements: standardReqs, Priority: uint8(2), Retries: uint8(0), RepGroup: "search"})
+		jobs = append(jobs, &Job{Cmd: "echo search 3", Cwd: "/tmp", ReqGroup: "fake_group", Requirements: standardReqs, Priority: uint8(1), Retries: uint8(0), RepGroup: "search"})
+		jobs = append(jobs, &Job{Cmd: "echo search unrun", Cwd: "/tmp", ReqGroup: "fake_group", Requirements: standardReqs, Retries: uint8(0), RepGroup: "search", Dependencies: Dependencies{NewDepGroupDependency("search_never")}})
+		inserts, _, err := jq.Add(jobs, envVars, true)
+		So(err, ShouldBeNil)
+		So(inserts, ShouldEqual, 4)
+
+		for _, cmd := range []string{"echo search 1", "echo search 2 && false", "echo search 3"} {
+			job, err := jq.Reserve(50 * time.Millisecond)
+			So(err, ShouldBeNil)
+			So(job, ShouldNotBeNil)
+			So(job.Cmd, ShouldEqual, cmd)
+			jq.Execute(job, config.RunnerExecShell)
+			<-time.After(10 * time.Millisecond)
+		}
+
+		cmds := func(jobs []*Job) []string {
+			var cmds []string
+			for _, job := range jobs {
+				cmds = append(cmds, job.Cmd)
+			}
+			return cmds
+		}
+
+		Convey("You can search for them, getting them in the order they finished", func() {
+			found, err := jq.SearchJobs(&JobSearch{Since: before}, 0, false, false)
+			So(err, ShouldBeNil)
+			So(cmds(found), ShouldResemble, []string{"echo search 1", "echo search 2 && false", "echo search 3"})
+			So(found[1].State, ShouldEqual, JobStateBuried)
+			So(found[2].State, ShouldEqual, JobStateComplete)
+
+			exitcode := 1
+			found, err = jq.SearchJobs(&JobSearch{Exitcode: &exitcode, Cmd: "^echo search"}, 0, true, false)
+			So(err, ShouldBeNil)
+			So(cmds(found), ShouldResemble, []string{"echo search 2 && false"})
+			stdout, err := found[0].StdOut()
+			So(err, ShouldBeNil)
+			So(stdout, ShouldEqual, "search 2")
+
+			found, err = jq.SearchJobs(&JobSearch{Cmd: "search [13]$", Until: time.Now()}, 0, false, false)
+			So(err, ShouldBeNil)
+			So(cmds(found), ShouldResemble, []string{"echo search 1", "echo search 3"})
+
+			found, err = jq.SearchJobs(&JobSearch{Since: time.Now()}, 0, false, false)
+			So(err, ShouldBeNil)
+			So(len(found), ShouldEqual, 0)
+		})
+
+		Convey("Limiting keeps the jobs of each group that finished first", func() {
+			found, err := jq.SearchJobs(&JobSearch{Since: before}, 1, false, false)
+			So(err, ShouldBeNil)
+			So(cmds(found), ShouldResemble, []string{"echo search 1", "echo search 2 && false"})
+			So(found[0].Similar, ShouldEqual, 1)
+		})
+
+		Convey("Bad searches are rejected", func() {
+			_, err := jq.SearchJobs(&JobSearch{Cmd: "("}, 0, false, false)
+			So(err, ShouldNotBeNil)
+			jqerr, ok := err.(Error)
+			So(ok, ShouldBeTrue)
+			So(jqerr.Err, ShouldEqual, ErrBadRequest)
+
+			_, err = jq.SearchJobs(nil, 0, false, false)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			if server != nil {
+				server.Stop(true)
+			}
+		})
+	})
+
+	if server != nil {
+		server.Stop(true)
+	}
+
 	// start these tests anew because these tests have the server spawn runners
 	// that fail, simulating some network issue
 	Convey("Once a new jobqueue server is up with bad runners", t, func() {
@@ -0,0 +1,138 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for stopping running Cmds: they are started in
+// their own process group so that we can signal the whole pipeline they
+// represent, and can be asked to stop gracefully before being killed.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// killSignals are the signals that can be named in a KillSequence.
+var killSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+}
+
+// KillStep is one step in a KillSequence: Signal is sent to all the processes
+// of a Cmd, and then we wait up to Wait for it to exit.
+type KillStep struct {
+	Signal syscall.Signal
+	Wait   time.Duration
+}
+
+// KillSequence describes how a running Cmd should be stopped, giving it the
+// chance to checkpoint or flush its output before it is killed. Each step is
+// carried out in turn until Cmd exits; if it is still running after the last
+// step, it is sent SIGKILL.
+type KillSequence []*KillStep
+
+// ParseKillSequence converts a string like "INT:60s,TERM:30s" in to a
+// KillSequence. Each comma separated step is a signal name (with or without a
+// SIG prefix) or number, optionally followed by a colon and how long to wait
+// for the Cmd to exit before moving on to the next step. The wait defaults to
+// ClientKillGracePeriod. An empty string returns a nil KillSequence.
+func ParseKillSequence(str string) (KillSequence, error) {
+	var ks KillSequence
+	if str == "" {
+		return ks, nil
+	}
+
+	for _, step := range strings.Split(str, ",") {
+		parts := strings.SplitN(strings.TrimSpace(step), ":", 2)
+		sig, err := parseSignal(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("kill sequence step [%s] has an unknown signal", step)
+		}
+
+		wait := ClientKillGracePeriod
+		if len(parts) == 2 {
+			wait, err = time.ParseDuration(parts[1])
+			if err != nil || wait < 0 {
+				return nil, fmt.Errorf("kill sequence step [%s] has a bad wait time", step)
+			}
+		}
+
+		ks = append(ks, &KillStep{Signal: sig, Wait: wait})
+	}
+	return ks, nil
+}
+
+// parseSignal converts a signal name (with or without a SIG prefix) or number
+// in to a Signal.
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.TrimPrefix(strings.ToUpper(name), "SIG")
+	if sig, known := killSignals[name]; known {
+		return sig, nil
+	}
+	num, err := strconv.Atoi(name)
+	if err != nil || num < 1 || num > 64 {
+		return 0, fmt.Errorf("unknown signal [%s]", name)
+	}
+	return syscall.Signal(num), nil
+}
+
+// String returns the KillSequence in the form accepted by ParseKillSequence().
+func (ks KillSequence) String() string {
+	steps := make([]string, len(ks))
+	for i, step := range ks {
+		name := strconv.Itoa(int(step.Signal))
+		for n, sig := range killSignals {
+			if sig == step.Signal {
+				name = n
+				break
+			}
+		}
+		steps[i] = name + ":" + step.Wait.String()
+	}
+	return strings.Join(steps, ",")
+}
+
+// run carries out the sequence against the process group led by pid, stopping
+// early if exited is closed. Finally the whole group is sent SIGKILL. A nil
+// sequence just kills the group immediately.
+func (ks KillSequence) run(pid int, exited <-chan bool) {
+	for _, step := range ks {
+		signalGroup(pid, step.Signal)
+		select {
+		case <-exited:
+			return
+		case <-time.After(step.Wait):
+		}
+	}
+	signalGroup(pid, syscall.SIGKILL)
+}
+
+// signalGroup sends a signal to every process in the process group led by pid.
+// Processes started by Execute() lead their own group, which contains all
+// their descendants that haven't deliberately left it.
+func signalGroup(pid int, sig syscall.Signal) error {
+	return syscall.Kill(-pid, sig)
+}
@@ -0,0 +1,69 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKillSequence(t *testing.T) {
+	Convey("Kill sequences can be parsed", t, func() {
+		ks, err := ParseKillSequence("")
+		So(err, ShouldBeNil)
+		So(ks, ShouldBeNil)
+
+		ks, err = ParseKillSequence("INT:60s, sigterm:1m30s,10")
+		So(err, ShouldBeNil)
+		So(len(ks), ShouldEqual, 3)
+		So(ks[0].Signal, ShouldEqual, syscall.SIGINT)
+		So(ks[0].Wait, ShouldEqual, 60*time.Second)
+		So(ks[1].Signal, ShouldEqual, syscall.SIGTERM)
+		So(ks[1].Wait, ShouldEqual, 90*time.Second)
+		So(ks[2].Signal, ShouldEqual, syscall.Signal(10))
+		So(ks[2].Wait, ShouldEqual, ClientKillGracePeriod)
+		So(ks[:2].String(), ShouldEqual, "INT:1m0s,TERM:1m30s")
+
+		_, err = ParseKillSequence("FOO:1s")
+		So(err, ShouldNotBeNil)
+		_, err = ParseKillSequence("TERM:soon")
+		So(err, ShouldNotBeNil)
+		_, err = ParseKillSequence("TERM:-1s")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Kill sequences stop whole process groups", t, func() {
+		cmd := exec.Command("sh", "-c", "sleep 20 | sleep 20")
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		err := cmd.Start()
+		So(err, ShouldBeNil)
+		pid := cmd.Process.Pid
+
+		exited := make(chan bool)
+		started := time.Now()
+		go KillSequence{{Signal: syscall.SIGTERM, Wait: 10 * time.Second}}.run(pid, exited)
+		err = cmd.Wait()
+		close(exited)
+		So(err, ShouldNotBeNil)
+		So(time.Since(started), ShouldBeLessThan, 5*time.Second)
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for our structured, levelled logging.
+
+import (
+	"fmt"
+	"github.com/inconshreveable/log15"
+)
+
+// logger is what the server logs with. Messages are short and constant, with
+// the details in key/value context, so that logs can be searched and parsed.
+var logger = log15.New("pkg", "jobqueue")
+
+func init() {
+	logger.SetHandler(log15.StderrHandler)
+}
+
+// SetLogHandler sets where and how the server logs. By default it logs
+// everything to STDERR in logfmt format (coloured for terminals). To log JSON
+// at the info level and above to a file, you could supply:
+//
+//	log15.LvlFilterHandler(log15.LvlInfo,
+//	    log15.Must.FileHandler(path, log15.JsonFormat()))
+//
+// Messages from runners sent via Client.ServerLog() are also logged here.
+func SetLogHandler(h log15.Handler) {
+	logger.SetHandler(h)
+}
+
+// clientLog is a message a client wants the server to log.
+type clientLog struct {
+	Lvl log15.Lvl
+	Msg string
+	Ctx []string
+	PID int
+}
+
+// logAt logs the message and context to l at the given level.
+func logAt(l log15.Logger, lvl log15.Lvl, msg string, ctx ...interface{}) {
+	switch lvl {
+	case log15.LvlCrit:
+		l.Crit(msg, ctx...)
+	case log15.LvlError:
+		l.Error(msg, ctx...)
+	case log15.LvlWarn:
+		l.Warn(msg, ctx...)
+	case log15.LvlInfo:
+		l.Info(msg, ctx...)
+	default:
+		l.Debug(msg, ctx...)
+	}
+}
+
+// logContext converts a key/value context to strings, so that it can be sent
+// from clients to the server.
+func logContext(ctx []interface{}) []string {
+	strs := make([]string, len(ctx))
+	for i, v := range ctx {
+		strs[i] = fmt.Sprint(v)
+	}
+	return strs
+}
@@ -0,0 +1,64 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/inconshreveable/log15"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	Convey("Log messages can be captured as JSON at a chosen level", t, func() {
+		var records []*log15.Record
+		SetLogHandler(log15.LvlFilterHandler(log15.LvlWarn, log15.FuncHandler(func(r *log15.Record) error {
+			records = append(records, r)
+			return nil
+		})))
+		defer SetLogHandler(log15.StderrHandler)
+
+		rlog := logger.New("method", "log", "user", "alice")
+		ctx := logContext([]interface{}{"pid", 123, "err", errors.New("oops")})
+		So(ctx, ShouldResemble, []string{"pid", "123", "err", "oops"})
+		args := make([]interface{}, len(ctx))
+		for i, v := range ctx {
+			args[i] = v
+		}
+		for _, lvl := range []log15.Lvl{log15.LvlDebug, log15.LvlInfo, log15.LvlWarn, log15.LvlError, log15.LvlCrit} {
+			logAt(rlog, lvl, "runner exiting", args...)
+		}
+		So(len(records), ShouldEqual, 3)
+		So(records[0].Lvl, ShouldEqual, log15.LvlWarn)
+		So(records[1].Lvl, ShouldEqual, log15.LvlError)
+		So(records[2].Lvl, ShouldEqual, log15.LvlCrit)
+
+		var decoded map[string]interface{}
+		err := json.Unmarshal(log15.JsonFormat().Format(records[0]), &decoded)
+		So(err, ShouldBeNil)
+		So(decoded["msg"], ShouldEqual, "runner exiting")
+		So(decoded["lvl"], ShouldEqual, "warn")
+		So(decoded["pkg"], ShouldEqual, "jobqueue")
+		So(decoded["method"], ShouldEqual, "log")
+		So(decoded["user"], ShouldEqual, "alice")
+		So(decoded["pid"], ShouldEqual, "123")
+		So(decoded["err"], ShouldEqual, "oops")
+	})
+}
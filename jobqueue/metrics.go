@@ -0,0 +1,322 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for exposing metrics in the Prometheus text
+// format, so that the server can be scraped by Prometheus.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const restMetricsEndpoint = "/metrics"
+
+// metricsContentType is the content type of the Prometheus text format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// the upper bounds of our histogram buckets
+var (
+	metricsJobTimeBuckets = []float64{1, 10, 60, 300, 600, 1800, 3600, 7200, 14400, 28800, 86400}
+	metricsRAMBuckets     = []float64{128 << 20, 256 << 20, 512 << 20, 1 << 30, 2 << 30, 4 << 30, 8 << 30, 16 << 30, 32 << 30, 64 << 30, 128 << 30}
+	metricsRequestBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5, 10}
+	metricsBackupBuckets  = []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300}
+)
+
+// metricsHistogram counts observations in to cumulative buckets, the way
+// Prometheus histograms do.
+type metricsHistogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] is the number of observations <= bounds[i]
+	sum    float64
+	count  uint64
+}
+
+// newMetricsHistogram creates a metricsHistogram with the given bucket upper
+// bounds, which must be sorted.
+func newMetricsHistogram(bounds []float64) *metricsHistogram {
+	return &metricsHistogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// observe records a value.
+func (h *metricsHistogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// metricsHistograms is a set of metricsHistograms keyed on the value of a
+// label.
+type metricsHistograms struct {
+	label  string
+	bounds []float64
+	byKey  map[string]*metricsHistogram
+}
+
+// newMetricsHistograms creates a metricsHistograms for the given label, whose
+// histograms will have the given bucket upper bounds.
+func newMetricsHistograms(label string, bounds []float64) *metricsHistograms {
+	return &metricsHistograms{label: label, bounds: bounds, byKey: make(map[string]*metricsHistogram)}
+}
+
+// observe records a value in the histogram for the given label value.
+func (hs *metricsHistograms) observe(key string, v float64) {
+	h, exists := hs.byKey[key]
+	if !exists {
+		h = newMetricsHistogram(hs.bounds)
+		hs.byKey[key] = h
+	}
+	h.observe(v)
+}
+
+// metrics holds the counters and histograms that the server updates as things
+// happen; gauges are worked out when scraped.
+type metrics struct {
+	sync.Mutex
+	completed map[string]uint64 // keyed on queue name
+	buried    map[string]uint64
+	lost      map[string]uint64
+	waitTime  *metricsHistograms // keyed on ReqGroup
+	wallTime  *metricsHistograms
+	peakRAM   *metricsHistograms
+	requests  *metricsHistograms // keyed on clientRequest Method
+	backups   *metricsHistogram
+}
+
+// newMetrics creates a new metrics.
+func newMetrics() *metrics {
+	return &metrics{
+		completed: make(map[string]uint64),
+		buried:    make(map[string]uint64),
+		lost:      make(map[string]uint64),
+		waitTime:  newMetricsHistograms("req_grp", metricsJobTimeBuckets),
+		wallTime:  newMetricsHistograms("req_grp", metricsJobTimeBuckets),
+		peakRAM:   newMetricsHistograms("req_grp", metricsRAMBuckets),
+		requests:  newMetricsHistograms("method", metricsRequestBuckets),
+		backups:   newMetricsHistogram(metricsBackupBuckets),
+	}
+}
+
+// jobsChanged counts jobs in the given queue completing, being buried or
+// becoming lost.
+func (m *metrics) jobsChanged(queue string, to JobState, count int) {
+	m.Lock()
+	defer m.Unlock()
+	switch to {
+	case JobStateComplete:
+		m.completed[queue] += uint64(count)
+	case JobStateBuried:
+		m.buried[queue] += uint64(count)
+	case JobStateLost:
+		m.lost[queue] += uint64(count)
+	}
+}
+
+// jobStarted records how long a Job in the given ReqGroup waited between being
+// added and first starting to run.
+func (m *metrics) jobStarted(reqGroup string, wait time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.waitTime.observe(reqGroup, wait.Seconds())
+}
+
+// jobEnded records how long a Job in the given ReqGroup ran for, and its peak
+// memory usage in MB.
+func (m *metrics) jobEnded(reqGroup string, wall time.Duration, peakRAM int) {
+	m.Lock()
+	defer m.Unlock()
+	m.wallTime.observe(reqGroup, wall.Seconds())
+	m.peakRAM.observe(reqGroup, float64(peakRAM)*1024*1024)
+}
+
+// request records how long we took to handle a client request.
+func (m *metrics) request(method string, took time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.requests.observe(method, took.Seconds())
+}
+
+// backup records how long a database backup took.
+func (m *metrics) backup(took time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.backups.observe(took.Seconds())
+}
+
+// metricsWriter writes metrics in the Prometheus text format.
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+// header writes the HELP and TYPE lines of a metric.
+func (mw *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a single sample, with the given label name and value pairs.
+func (mw *metricsWriter) sample(name string, v float64, labels ...string) {
+	mw.w.WriteString(name)
+	if len(labels) > 0 {
+		mw.w.WriteString("{")
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				mw.w.WriteString(",")
+			}
+			fmt.Fprintf(mw.w, "%s=\"%s\"", labels[i], metricsEscaper.Replace(labels[i+1]))
+		}
+		mw.w.WriteString("}")
+	}
+	fmt.Fprintf(mw.w, " %s\n", metricsFloat(v))
+}
+
+// counts writes a sample for each entry in the given map, labelled with its
+// key.
+func (mw *metricsWriter) counts(name, label string, counts map[string]uint64) {
+	for _, key := range metricsSortedKeys(counts) {
+		mw.sample(name, float64(counts[key]), label, key)
+	}
+}
+
+// histogram writes the samples of a histogram, with the given label name and
+// value pairs.
+func (mw *metricsWriter) histogram(name string, h *metricsHistogram, labels ...string) {
+	for i, bound := range h.bounds {
+		mw.sample(name+"_bucket", float64(h.counts[i]), append(labels, "le", metricsFloat(bound))...)
+	}
+	mw.sample(name+"_bucket", float64(h.count), append(labels, "le", "+Inf")...)
+	mw.sample(name+"_sum", h.sum, labels...)
+	mw.sample(name+"_count", float64(h.count), labels...)
+}
+
+// histograms writes the samples of each histogram in a metricsHistograms.
+func (mw *metricsWriter) histograms(name string, hs *metricsHistograms) {
+	keys := make([]string, 0, len(hs.byKey))
+	for key := range hs.byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		mw.histogram(name, hs.byKey[key], hs.label, key)
+	}
+}
+
+// metricsEscaper escapes label values.
+var metricsEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsFloat formats a sample value or bucket bound.
+func metricsFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricsSortedKeys returns the keys of a map in sorted order.
+func metricsSortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeMetrics writes all of the server's metrics to w in the Prometheus text
+// format.
+func (s *Server) writeMetrics(w io.Writer) error {
+	mw := &metricsWriter{w: bufio.NewWriter(w)}
+
+	// gauges of the current state of things
+	s.racmutex.RLock()
+	qnames := make([]string, 0, len(s.qs))
+	stats := make(map[string][]int)
+	for qname, q := range s.qs {
+		qnames = append(qnames, qname)
+		qs := q.Stats()
+		stats[qname] = []int{qs.Delayed, qs.Ready, qs.Running, qs.Buried, qs.Dependant}
+	}
+	s.racmutex.RUnlock()
+	sort.Strings(qnames)
+	mw.header("wr_jobs", "gauge", "Number of incomplete jobs in each state in each queue.")
+	for _, qname := range qnames {
+		for i, state := range []JobState{JobStateDelayed, JobStateReady, JobStateRunning, JobStateBuried, JobStateDependent} {
+			mw.sample("wr_jobs", float64(stats[qname][i]), "queue", qname, "state", string(state))
+		}
+	}
+
+	s.sgcmutex.Lock()
+	runners := make(map[string]uint64, len(s.sgroupcounts))
+	for group, count := range s.sgroupcounts {
+		runners[group] = uint64(count)
+	}
+	s.sgcmutex.Unlock()
+	mw.header("wr_runners_scheduled", "gauge", "Number of runners scheduled for each scheduler group.")
+	mw.counts("wr_runners_scheduled", "scheduler_group", runners)
+
+	servers, standins := s.scheduler.ServerCounts()
+	mw.header("wr_cloud_servers", "gauge", "Number of cloud servers spawned.")
+	mw.sample("wr_cloud_servers", float64(servers))
+	mw.header("wr_cloud_standins", "gauge", "Number of cloud servers in the process of being spawned.")
+	mw.sample("wr_cloud_standins", float64(standins))
+
+	// counters and histograms of what has happened
+	m := s.metrics
+	m.Lock()
+	mw.header("wr_jobs_completed_total", "counter", "Number of jobs that completed in each queue.")
+	mw.counts("wr_jobs_completed_total", "queue", m.completed)
+	mw.header("wr_jobs_buried_total", "counter", "Number of times jobs were buried in each queue.")
+	mw.counts("wr_jobs_buried_total", "queue", m.buried)
+	mw.header("wr_jobs_lost_total", "counter", "Number of times jobs were lost contact with in each queue.")
+	mw.counts("wr_jobs_lost_total", "queue", m.lost)
+	mw.header("wr_job_wait_seconds", "histogram", "Time between jobs being added and first starting to run, per req_grp.")
+	mw.histograms("wr_job_wait_seconds", m.waitTime)
+	mw.header("wr_job_wall_time_seconds", "histogram", "Time jobs ran for, per req_grp.")
+	mw.histograms("wr_job_wall_time_seconds", m.wallTime)
+	mw.header("wr_job_peak_ram_bytes", "histogram", "Peak memory usage of jobs, per req_grp.")
+	mw.histograms("wr_job_peak_ram_bytes", m.peakRAM)
+	mw.header("wr_request_duration_seconds", "histogram", "Time taken to handle client requests, per method.")
+	mw.histograms("wr_request_duration_seconds", m.requests)
+	mw.header("wr_db_backup_duration_seconds", "histogram", "Time taken to back up the database.")
+	mw.histogram("wr_db_backup_duration_seconds", m.backups)
+	m.Unlock()
+
+	return mw.w.Flush()
+}
+
+// restMetrics serves the server's metrics for scraping by Prometheus.
+func restMetrics(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", metricsContentType)
+		w.WriteHeader(http.StatusOK)
+		s.writeMetrics(w)
+	}
+}
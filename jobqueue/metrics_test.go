@@ -0,0 +1,77 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	"bufio"
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Histograms count observations in to cumulative buckets", t, func() {
+		h := newMetricsHistogram([]float64{1, 10})
+		h.observe(0.5)
+		h.observe(1)
+		h.observe(5)
+		h.observe(100)
+		So(h.counts, ShouldResemble, []uint64{2, 3})
+		So(h.count, ShouldEqual, 4)
+		So(h.sum, ShouldEqual, 106.5)
+	})
+
+	Convey("Metrics are recorded and written in the Prometheus text format", t, func() {
+		m := newMetrics()
+		m.jobsChanged("cmds", JobStateComplete, 2)
+		m.jobsChanged("cmds", JobStateComplete, 1)
+		m.jobsChanged("cmds", JobStateBuried, 1)
+		m.jobsChanged("other", JobStateLost, 1)
+		m.jobsChanged("cmds", JobStateReady, 5)
+		So(m.completed, ShouldResemble, map[string]uint64{"cmds": 3})
+		So(m.buried, ShouldResemble, map[string]uint64{"cmds": 1})
+		So(m.lost, ShouldResemble, map[string]uint64{"other": 1})
+
+		m.jobEnded("rg", 90*time.Second, 300)
+		h := m.wallTime.byKey["rg"]
+		So(h.count, ShouldEqual, 1)
+		So(h.sum, ShouldEqual, 90)
+		So(m.peakRAM.byKey["rg"].sum, ShouldEqual, 300*1024*1024)
+
+		var b bytes.Buffer
+		mw := &metricsWriter{w: bufio.NewWriter(&b)}
+		mw.header("wr_jobs_completed_total", "counter", "Number of jobs that completed in each queue.")
+		mw.counts("wr_jobs_completed_total", "queue", map[string]uint64{"b": 2, "a\"\\\n": 1})
+		hs := newMetricsHistograms("req_grp", []float64{0.5, 60})
+		hs.observe("rg", 1.5)
+		mw.histograms("wr_job_wall_time_seconds", hs)
+		mw.w.Flush()
+		So(b.String(), ShouldEqual, `# HELP wr_jobs_completed_total Number of jobs that completed in each queue.
+# TYPE wr_jobs_completed_total counter
+wr_jobs_completed_total{queue="a\"\\\n"} 1
+wr_jobs_completed_total{queue="b"} 2
+wr_job_wall_time_seconds_bucket{req_grp="rg",le="0.5"} 0
+wr_job_wall_time_seconds_bucket{req_grp="rg",le="60"} 1
+wr_job_wall_time_seconds_bucket{req_grp="rg",le="+Inf"} 1
+wr_job_wall_time_seconds_sum{req_grp="rg"} 1.5
+wr_job_wall_time_seconds_count{req_grp="rg"} 1
+`)
+	})
+}
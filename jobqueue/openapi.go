@@ -0,0 +1,422 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the OpenAPI 3 specification of the REST API. The schemas
+// of the request and response bodies are generated from the Go types that are
+// actually decoded and encoded by the handlers in serverREST.go, so that they
+// can't get out of sync.
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const restOpenAPIEndpoint = "/rest/v1/openapi.json"
+
+// openAPISchemaPrefix is how schemas in the spec's components are referred to.
+const openAPISchemaPrefix = "#/components/schemas/"
+
+// openAPISchemaNames are the names we give the schemas of the unexported types
+// that are encoded as responses.
+var openAPISchemaNames = map[reflect.Type]string{
+	reflect.TypeOf(jstatus{}):         "JobStatus",
+	reflect.TypeOf(schedulerIssue{}):  "Warning",
+	reflect.TypeOf(badServer{}):       "BadServer",
+	reflect.TypeOf(jobEvent{}):        "JobEvent",
+	reflect.TypeOf(webhookDelivery{}): "WebhookDelivery",
+	reflect.TypeOf(webhookPayload{}):  "WebhookPayload",
+}
+
+// OpenAPISpec returns the OpenAPI 3 specification of the REST API, as served
+// at /rest/v1/openapi.json, in JSON format.
+func OpenAPISpec() ([]byte, error) {
+	return json.Marshal(openAPISpec())
+}
+
+// openAPISpec builds the OpenAPI 3 specification of the REST API.
+func openAPISpec() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	jobs := openAPIArray(openAPISchema(reflect.TypeOf(jstatus{}), schemas))
+	jobsResponse := func(description string) map[string]interface{} {
+		return openAPIResponse(description, jobs)
+	}
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content":     map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+		}
+	}
+
+	fields := openAPIParam("fields", "comma separated list of the JobStatus properties to return, eg. Key,State", "string")
+	state := openAPIParam("state", "only consider jobs in this state; running and reserved are treated the same, and ready includes quota", "string")
+	state["schema"].(map[string]interface{})["enum"] = []string{"delayed", "ready", "reserved", "running", "lost", "buried", "dependent", "quota", "complete"}
+	ids := map[string]interface{}{
+		"name":        "ids",
+		"in":          "path",
+		"required":    true,
+		"description": "comma separated job keys or RepGroups",
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+	arrayIDs := make(map[string]interface{})
+	for key, val := range ids {
+		arrayIDs[key] = val
+	}
+	arrayIDs["description"] = "comma separated ArrayIDs"
+	filters := []interface{}{
+		ids, state, fields,
+		openAPIParam("exitcode", "only consider jobs that exited with this code", "integer"),
+		openAPIParam("fail_reason", "only consider jobs that failed for this reason", "string"),
+	}
+	targetResponses := map[string]interface{}{
+		"200": jobsResponse("the affected jobs"),
+		"400": errorResponse("invalid parameters"),
+		"404": errorResponse("no incomplete jobs matched"),
+	}
+
+	statusParams := []interface{}{
+		state, fields,
+		openAPIParam("std", "set to true to get the STDOUT and STDERR of failed jobs", "boolean"),
+		openAPIParam("limit", "group jobs by state, exitcode and fail reason, returning at most this many of each group", "integer"),
+		openAPIParam("page_size", "return at most this many jobs, with a Link header for the next page", "integer"),
+		openAPIParam("after", "the opaque cursor of the page to get, as given in a Link header", "string"),
+		openAPIParam("sort", "with page_size, sort by start, walltime or peakram instead of key; prefix with - for descending order; refused if too many jobs were requested", "string"),
+	}
+	searchParams := append([]interface{}{
+		openAPIParam("since", "search for jobs that ended at or after this RFC 3339 time", "string"),
+		openAPIParam("until", "search for jobs that ended at or before this RFC 3339 time", "string"),
+		openAPIParam("exitcode", "search for jobs that exited with this code", "integer"),
+		openAPIParam("fail_reason", "search for jobs that failed for this reason", "string"),
+		openAPIParam("host", "search for jobs that ran on this host", "string"),
+		openAPIParam("req_grp", "search for jobs in this requirements group", "string"),
+		openAPIParam("user", "search for jobs added by this user", "string"),
+		openAPIParam("cmd", "search for jobs with commands matching this regular expression", "string"),
+	}, statusParams...)
+	pageResponse := jobsResponse("the requested jobs")
+	pageResponse["headers"] = map[string]interface{}{
+		"Link": map[string]interface{}{
+			"description": `with page_size, the url of the next page, with rel="next"`,
+			"schema":      map[string]interface{}{"type": "string"},
+		},
+	}
+	statusResponses := map[string]interface{}{
+		"200": pageResponse,
+		"400": errorResponse("invalid parameters"),
+		"500": errorResponse("the database could not be read"),
+	}
+
+	addParams := []interface{}{fields}
+	jobSchema := openAPISchema(reflect.TypeOf(JobViaJSON{}), schemas)
+	for _, name := range []string{"cwd", "rep_grp", "req_grp", "cpus", "disk", "override", "priority", "retries",
+		"dep_grps", "deps", "env", "cloud_os", "cloud_username", "cloud_script", "cloud_ram", "cwd_matters",
+		"change_home", "cache", "memory", "time", "on_failure", "on_success", "on_exit", "retry_policy",
+		"escalation", "time_limit", "kill_sequence", "checkpoint", "mounts", "webhook"} {
+		addParams = append(addParams, openAPIParam(name, "default "+name+" for the posted jobs; JSON for objects, comma separated for lists", "string"))
+	}
+
+	modifyParams := append([]interface{}{}, filters...)
+	for _, name := range []string{"priority", "retries", "override", "memory", "time", "cpus", "disk"} {
+		modifyParams = append(modifyParams, openAPIParam(name, "the new "+name+", as per the POSTed job property", "string"))
+	}
+
+	paths := map[string]interface{}{
+		restJobsEndpoint: map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "get the status of all incomplete jobs, or search the jobs that have run",
+				"parameters": searchParams,
+				"responses":  statusResponses,
+			},
+			"post": map[string]interface{}{
+				"summary":    "add jobs",
+				"parameters": addParams,
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": openAPIArray(jobSchema)}},
+				},
+				"responses": map[string]interface{}{
+					"201": jobsResponse("the added jobs, in their current state"),
+					"400": errorResponse("invalid jobs or parameters"),
+					"500": errorResponse("the jobs could not be stored"),
+				},
+			},
+		},
+		restJobsEndpoint + "{ids}": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "get the status of the given jobs",
+				"parameters": append([]interface{}{ids}, statusParams...),
+				"responses":  statusResponses,
+			},
+			"put": map[string]interface{}{
+				"summary":    "modify the given non-running jobs",
+				"parameters": modifyParams,
+				"responses":  targetResponses,
+			},
+			"delete": map[string]interface{}{
+				"summary":    "remove the given non-running jobs",
+				"parameters": filters,
+				"responses":  targetResponses,
+			},
+		},
+		restJobsEndpoint + "{ids}" + restJobsKick: map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":    "retry the given buried jobs",
+				"parameters": filters,
+				"responses":  targetResponses,
+			},
+		},
+		restJobsEndpoint + "{ids}" + restJobsKill: map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":    "kill the given running jobs",
+				"parameters": filters,
+				"responses":  targetResponses,
+			},
+		},
+		restJobsEndpoint + "{ids}" + restJobsCancel: map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":    "stop any more elements of the given array jobs being created",
+				"parameters": []interface{}{arrayIDs, fields},
+				"responses": map[string]interface{}{
+					"200": jobsResponse("the incomplete elements of the arrays that had already been created"),
+					"400": errorResponse("invalid parameters"),
+					"404": errorResponse("no array jobs with uncreated elements matched"),
+				},
+			},
+		},
+		restWarningsEndpoint: map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary": "get and dismiss the scheduler warnings",
+				"responses": map[string]interface{}{
+					"200": openAPIResponse("the warnings", openAPIArray(openAPISchema(reflect.TypeOf(schedulerIssue{}), schemas))),
+				},
+			},
+		},
+		restBadServersEndpoint: map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary": "get the cloud servers that have gone bad",
+				"responses": map[string]interface{}{
+					"200": openAPIResponse("the bad servers", openAPIArray(openAPISchema(reflect.TypeOf(badServer{}), schemas))),
+				},
+			},
+			"delete": map[string]interface{}{
+				"summary": "confirm a server is bad, terminating it",
+				"parameters": []interface{}{
+					map[string]interface{}{
+						"name":        "id",
+						"in":          "query",
+						"required":    true,
+						"description": "the ID of the bad server",
+						"schema":      map[string]interface{}{"type": "string"},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{"description": "the server was terminated"},
+					"400": errorResponse("id was not supplied"),
+					"404": errorResponse("the server was not known to be bad"),
+				},
+			},
+		},
+		restEventsEndpoint: map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary": "stream job state changes as server-sent events",
+				"parameters": []interface{}{
+					openAPIParam("repgroup", "comma separated RepGroups to limit events to", "string"),
+					openAPIParam("user", "comma separated users to limit events to", "string"),
+					openAPIParam("key", "comma separated job keys to limit events to", "string"),
+					openAPIParam("last_event_id", "alternative to the Last-Event-ID header, to replay the events after this one", "integer"),
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": `a stream of "state" events, whose ids are event IDs and whose data are JobEvents; a "missed" event is sent first if some events after the Last-Event-ID could not be replayed, eg. because the server restarted`,
+						"content":     map[string]interface{}{"text/event-stream": map[string]interface{}{"schema": openAPISchema(reflect.TypeOf(jobEvent{}), schemas)}},
+					},
+					"400": errorResponse("invalid Last-Event-ID"),
+				},
+			},
+		},
+		restAuditEndpoint: map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary": "get the audit trail of user actions, oldest first",
+				"parameters": []interface{}{
+					openAPIParam("from", "only get entries made at or after this RFC 3339 time", "string"),
+					openAPIParam("to", "only get entries made at or before this RFC 3339 time", "string"),
+					openAPIParam("user", "only get entries made by this user", "string"),
+					openAPIParam("limit", "only get this many of the most recent matching entries", "integer"),
+				},
+				"responses": map[string]interface{}{
+					"200": openAPIResponse("the entries", openAPIArray(openAPISchema(reflect.TypeOf(AuditEntry{}), schemas))),
+					"400": errorResponse("invalid parameters"),
+					"500": errorResponse("the database could not be read"),
+				},
+			},
+		},
+		restWebhooksEndpoint: map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary": "get the most recent webhook deliveries, most recent first",
+				"responses": map[string]interface{}{
+					"200": openAPIResponse("the deliveries", openAPIArray(openAPISchema(reflect.TypeOf(webhookDelivery{}), schemas))),
+				},
+			},
+		},
+		restOpenAPIEndpoint: map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary": "get this specification",
+				"responses": map[string]interface{}{
+					"200": openAPIResponse("the OpenAPI 3 specification", map[string]interface{}{"type": "object"}),
+				},
+			},
+		},
+	}
+
+	// what we POST to webhooks isn't a response, but receivers will want to
+	// know what to expect
+	openAPISchema(reflect.TypeOf(webhookPayload{}), schemas)
+
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":       "wr REST API",
+			"description": "Add jobs to wr's queue and manage them using JSON over HTTP. Requests to the events, audit, webhooks and openapi.json endpoints with a method other than GET get a 405 response with an Allow header.",
+			"version":     "1",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// openAPIParam describes a query parameter.
+func openAPIParam(name, description, kind string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": kind},
+	}
+}
+
+// openAPIArray describes an array of the given schema.
+func openAPIArray(items interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+// openAPIResponse describes a JSON response with the given schema.
+func openAPIResponse(description string, schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+	}
+}
+
+// openAPISchema describes a Go type the way encoding/json would encode it.
+// Structs are added to schemas (if not already there), and a reference to
+// them is returned.
+func openAPISchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return openAPINullable(openAPISchema(t.Elem(), schemas))
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return openAPINullable(map[string]interface{}{"type": "string", "format": "byte"})
+		}
+		return openAPINullable(openAPIArray(openAPISchema(t.Elem(), schemas)))
+	case reflect.Map:
+		return openAPINullable(map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas)})
+	case reflect.Struct:
+		name := openAPISchemaNames[t]
+		if name == "" {
+			name = t.Name()
+		}
+		ref := map[string]interface{}{"$ref": openAPISchemaPrefix + name}
+		if _, exists := schemas[name]; exists {
+			return ref
+		}
+
+		// reserve the name before recursing, in case of cycles
+		properties := make(map[string]interface{})
+		schemas[name] = map[string]interface{}{"type": "object", "properties": properties}
+		for name, field := range openAPIFields(t) {
+			properties[name] = openAPISchema(field.Type, schemas)
+		}
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// openAPINullable marks a schema as also allowing null, as encoding/json uses
+// for nil pointers, slices and maps. References can't have siblings, so are
+// wrapped.
+func openAPINullable(schema map[string]interface{}) map[string]interface{} {
+	if _, isRef := schema["$ref"]; isRef {
+		return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+	}
+	schema["nullable"] = true
+	return schema
+}
+
+// openAPIFields returns the fields of a struct that encoding/json would
+// encode, keyed on the names they'd be encoded with.
+func openAPIFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				name = tagName
+			}
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// restOpenAPI serves our OpenAPI specification.
+func restOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(openAPISpec())
+}
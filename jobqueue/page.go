@@ -0,0 +1,505 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for paging through the status of large numbers
+// of jobs, as used by the REST API.
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/VertebrateResequencing/wr/queue"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jobSort* are the orders (other than the default of by key) that pages of
+// jobs can be sorted in. Prefixing them with jobSortDesc reverses the order.
+const (
+	jobSortStart    = "start"
+	jobSortWalltime = "walltime"
+	jobSortPeakRAM  = "peakram"
+	jobSortDesc     = "-"
+)
+
+// errTooManyToSort is returned by pageJobs() when asked to sort more than
+// ServerMaxSortJobs jobs.
+var errTooManyToSort = errors.New("too many jobs to sort; page through them in key order, or ask for fewer jobs")
+
+// jobPage describes which page of jobs a user wants.
+type jobPage struct {
+	size   int
+	after  *jobCursor
+	sortBy string
+	desc   bool
+	state  JobState
+	getStd bool
+	getEnv bool
+}
+
+// jobCursor marks the position of the last job on a page, so that the next
+// page can start from the job after it. value is only meaningful when sorting
+// by something other than key.
+type jobCursor struct {
+	value int64
+	key   string
+}
+
+// String encodes the cursor in the opaque form we give to users.
+func (c *jobCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", c.value, c.key)))
+}
+
+// parseJobCursor decodes the output of jobCursor.String().
+func parseJobCursor(str string) (*jobCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor [%s]", str)
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor [%s]", str)
+	}
+	value, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor [%s]", str)
+	}
+	return &jobCursor{value: value, key: parts[1]}, nil
+}
+
+// parseJobPage creates a jobPage from the page_size, after and sort query
+// parameters, returning nil if page_size wasn't supplied.
+func parseJobPage(form url.Values, state JobState, getStd bool, getEnv bool) (*jobPage, error) {
+	if form.Get("page_size") == "" {
+		if form.Get("after") != "" || form.Get("sort") != "" {
+			return nil, fmt.Errorf("after and sort can only be used with page_size")
+		}
+		return nil, nil
+	}
+
+	size, err := strconv.Atoi(form.Get("page_size"))
+	if err != nil || size < 1 {
+		return nil, fmt.Errorf("page_size must be a positive number")
+	}
+	page := &jobPage{size: size, state: state, getStd: getStd, getEnv: getEnv}
+
+	if form.Get("after") != "" {
+		page.after, err = parseJobCursor(form.Get("after"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sortBy := form.Get("sort")
+	if strings.HasPrefix(sortBy, jobSortDesc) {
+		page.desc = true
+		sortBy = strings.TrimPrefix(sortBy, jobSortDesc)
+	}
+	switch sortBy {
+	case "", "key":
+		if page.desc {
+			return nil, fmt.Errorf("jobs can't be sorted by descending key")
+		}
+	case jobSortStart, jobSortWalltime, jobSortPeakRAM:
+		page.sortBy = sortBy
+	default:
+		return nil, fmt.Errorf("jobs can't be sorted by [%s]", sortBy)
+	}
+	return page, nil
+}
+
+// cursor returns the cursor for the given job in this page's sort order.
+func (p *jobPage) cursor(job *Job) *jobCursor {
+	job.RLock()
+	defer job.RUnlock()
+	c := &jobCursor{key: job.key()}
+	switch p.sortBy {
+	case jobSortStart:
+		if !job.StartTime.IsZero() {
+			c.value = job.StartTime.UnixNano()
+		}
+	case jobSortWalltime:
+		c.value = int64(job.WallTime())
+	case jobSortPeakRAM:
+		c.value = int64(job.PeakRAM)
+	}
+	return c
+}
+
+// less tells you if cursor a comes before cursor b in this page's sort order.
+// Ties are broken by key, so that every job has a fixed position.
+func (p *jobPage) less(a, b *jobCursor) bool {
+	if a.value != b.value {
+		if p.desc {
+			return a.value > b.value
+		}
+		return a.value < b.value
+	}
+	return a.key < b.key
+}
+
+// matches tells you if the given job is in the state this page is limited to.
+// States 'reserved' and 'running' are treated as the same state, and 'ready'
+// includes jobs waiting on quota, as in limitJobs().
+func (p *jobPage) matches(job *Job) bool {
+	if p.state == "" {
+		return true
+	}
+	job.RLock()
+	jState := job.State
+	jLost := job.Lost
+	job.RUnlock()
+	if jState == JobStateRunning {
+		if jLost {
+			jState = JobStateLost
+		} else {
+			jState = JobStateReserved
+		}
+	}
+	state := p.state
+	if state == JobStateRunning {
+		state = JobStateReserved
+	}
+	return jState == state || (state == JobStateReady && jState == JobStateQuota)
+}
+
+// pageJobs gets a page of the jobs identified by the given ids (job keys or
+// RepGroups, as per restJobsStatus()), or of all current jobs if there are no
+// ids. It also returns the cursor for the next page, which is nil if this is
+// the last page.
+func (s *Server) pageJobs(q *queue.Queue, ids []string, page *jobPage) (jobs []*Job, next *jobCursor, err error) {
+	if page.sortBy == "" {
+		jobs, err = s.pageJobsByKey(q, ids, page)
+	} else {
+		jobs, err = s.pageJobsSorted(q, ids, page)
+	}
+	if err != nil {
+		return
+	}
+
+	if len(jobs) > page.size {
+		jobs = jobs[:page.size]
+		next = page.cursor(jobs[page.size-1])
+	}
+
+	if page.getStd || page.getEnv {
+		for _, job := range jobs {
+			s.jobPopulateStdEnv(job, page.getStd, page.getEnv)
+		}
+	}
+	return
+}
+
+// pageJobsByKey gets up to page.size+1 jobs in key order. Only the keys of
+// complete jobs are read from the database, a batch at a time, so this is
+// cheap even for RepGroups with millions of jobs.
+func (s *Server) pageJobsByKey(q *queue.Queue, ids []string, page *jobPage) (jobs []*Job, err error) {
+	// work out where the keys of the jobs we want come from
+	liveKeys := make(map[string]bool)
+	completeKeys := make(map[string]bool)
+	keyRepGroups := make(map[string]string)
+	var repGroups []string
+	if len(ids) == 0 {
+		for _, item := range q.AllItems() {
+			liveKeys[item.Key] = true
+		}
+	}
+	for _, id := range ids {
+		if len(id) == 32 {
+			// id might be a Job.key()
+			if item, qerr := q.Get(id); qerr == nil && item != nil {
+				liveKeys[id] = true
+				continue
+			}
+			var complete bool
+			complete, err = s.db.checkIfComplete(id)
+			if err != nil {
+				return
+			}
+			if complete {
+				completeKeys[id] = true
+				continue
+			}
+		}
+
+		// id might be a Job.RepGroup
+		s.rpl.RLock()
+		for key := range s.rpl.lookup[id] {
+			liveKeys[key] = true
+		}
+		s.rpl.RUnlock()
+		repGroups = append(repGroups, id)
+	}
+	sortedLive := sortedKeys(liveKeys)
+	sortedComplete := sortedKeys(completeKeys)
+	wantComplete := page.state == "" || page.state == JobStateComplete
+
+	var after string
+	if page.after != nil {
+		after = page.after.key
+	}
+	for len(jobs) <= page.size {
+		// each source gives us its next n keys, so the first n of them all
+		// are the next n keys overall
+		n := page.size + 1 - len(jobs)
+		batch := keysAfter(sortedLive, after, n)
+		fromDB := make(map[string]bool)
+		if wantComplete {
+			for _, key := range keysAfter(sortedComplete, after, n) {
+				batch = append(batch, key)
+				fromDB[key] = true
+			}
+			for _, rg := range repGroups {
+				var keys []string
+				keys, err = s.db.retrieveCompleteJobKeysByRepGroup(rg, after, n)
+				if err != nil {
+					return
+				}
+				for _, key := range keys {
+					batch = append(batch, key)
+					fromDB[key] = true
+					if _, done := keyRepGroups[key]; !done {
+						keyRepGroups[key] = rg
+					}
+				}
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+		batch = sortedKeys(stringSet(batch))
+		if len(batch) > n {
+			batch = batch[:n]
+		}
+		after = batch[len(batch)-1]
+
+		// get the jobs for the keys in the batch, preferring live ones
+		var dbKeys []string
+		byKey := make(map[string]*Job)
+		for _, key := range batch {
+			if liveKeys[key] {
+				if item, qerr := q.Get(key); qerr == nil && item != nil {
+					byKey[key] = s.itemToJob(item, false, false)
+					continue
+				}
+			}
+			if fromDB[key] {
+				dbKeys = append(dbKeys, key)
+			}
+		}
+		if len(dbKeys) > 0 {
+			var complete []*Job
+			complete, err = s.db.retrieveCompleteJobsByKeys(dbKeys, false, false)
+			if err != nil {
+				return
+			}
+			for _, job := range complete {
+				key := job.key()
+				if rg, exists := keyRepGroups[key]; exists {
+					// as in getJobsByRepGroup(), report the RepGroup the user
+					// asked for
+					job.RepGroup = rg
+				}
+				byKey[key] = job
+			}
+		}
+
+		for _, key := range batch {
+			if job, exists := byKey[key]; exists && page.matches(job) {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return
+}
+
+// pageJobsSorted gets up to page.size+1 jobs in page.sortBy order. Since the
+// sort values can only be known by looking at every job, all the requested jobs
+// have to be retrieved, but only a page of them is returned. To stop a single
+// request loading millions of complete jobs, this fails with
+// errTooManyToSort if there are more than ServerMaxSortJobs requested jobs;
+// users must then page by key or ask for fewer jobs.
+func (s *Server) pageJobsSorted(q *queue.Queue, ids []string, page *jobPage) (jobs []*Job, err error) {
+	n, err := s.countJobsToSort(q, ids, page, ServerMaxSortJobs+1)
+	if err != nil {
+		return
+	}
+	if n > ServerMaxSortJobs {
+		err = errTooManyToSort
+		return
+	}
+
+	var all []*Job
+	if len(ids) == 0 {
+		all = s.getJobsCurrent(q, 0, "", false, false)
+	}
+	for _, id := range ids {
+		if len(id) == 32 {
+			// id might be a Job.key()
+			theseJobs, _, qerr := s.getJobsByKeys(q, []string{id}, false, false)
+			if qerr == "" && len(theseJobs) > 0 {
+				all = append(all, theseJobs...)
+				continue
+			}
+		}
+
+		// id might be a Job.RepGroup
+		theseJobs, _, qerr := s.getJobsByRepGroup(q, id, 0, page.state, false, false)
+		if qerr != "" {
+			err = fmt.Errorf(qerr)
+			return
+		}
+		all = append(all, theseJobs...)
+	}
+
+	seen := make(map[string]bool)
+	var cursors []*jobCursor
+	byKey := make(map[string]*Job)
+	for _, job := range all {
+		c := page.cursor(job)
+		if seen[c.key] || !page.matches(job) || (page.after != nil && !page.less(page.after, c)) {
+			continue
+		}
+		seen[c.key] = true
+		cursors = append(cursors, c)
+		byKey[c.key] = job
+	}
+	sort.Slice(cursors, func(i, j int) bool {
+		return page.less(cursors[i], cursors[j])
+	})
+
+	for i, c := range cursors {
+		if i > page.size {
+			break
+		}
+		jobs = append(jobs, byKey[c.key])
+	}
+	return
+}
+
+// countJobsToSort counts the jobs that pageJobsSorted() would have to
+// retrieve, giving up once max is reached. Only the keys of complete jobs are
+// read from the database.
+func (s *Server) countJobsToSort(q *queue.Queue, ids []string, page *jobPage, max int) (n int, err error) {
+	if len(ids) == 0 {
+		return len(q.AllItems()), nil
+	}
+	wantComplete := page.state == "" || page.state == JobStateComplete
+	for _, id := range ids {
+		if n >= max {
+			return
+		}
+		if len(id) == 32 {
+			// id might be a Job.key()
+			if item, qerr := q.Get(id); qerr == nil && item != nil {
+				n++
+				continue
+			}
+			var complete bool
+			complete, err = s.db.checkIfComplete(id)
+			if err != nil {
+				return
+			}
+			if complete {
+				n++
+				continue
+			}
+		}
+
+		// id might be a Job.RepGroup
+		s.rpl.RLock()
+		n += len(s.rpl.lookup[id])
+		s.rpl.RUnlock()
+		if wantComplete && n < max {
+			var keys []string
+			keys, err = s.db.retrieveCompleteJobKeysByRepGroup(id, "", max-n)
+			if err != nil {
+				return
+			}
+			n += len(keys)
+		}
+	}
+	return
+}
+
+// keysAfter returns up to n of the given sorted keys that sort after the given
+// key.
+func keysAfter(keys []string, after string, n int) []string {
+	i := sort.SearchStrings(keys, after)
+	if i < len(keys) && keys[i] == after {
+		i++
+	}
+	if i+n < len(keys) {
+		return keys[i : i+n]
+	}
+	return keys[i:]
+}
+
+// stringSet converts a slice of strings to a set.
+func stringSet(strs []string) map[string]bool {
+	set := make(map[string]bool, len(strs))
+	for _, str := range strs {
+		set[str] = true
+	}
+	return set
+}
+
+// sortedKeys returns the members of a set in sorted order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jstatusFields converts a comma separated list of jstatus field names (case
+// insensitive) in to their proper names, for use with selectFields().
+func jstatusFields(list string) ([]string, error) {
+	known := make(map[string]string)
+	t := reflect.TypeOf(jstatus{})
+	for i := 0; i < t.NumField(); i++ {
+		known[strings.ToLower(t.Field(i).Name)] = t.Field(i).Name
+	}
+
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		name, exists := known[strings.ToLower(strings.TrimSpace(field))]
+		if !exists {
+			return nil, fmt.Errorf("unknown field [%s]", field)
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// selectFields returns just the given fields of a jstatus, for JSON encoding.
+func selectFields(status jstatus, fields []string) map[string]interface{} {
+	v := reflect.ValueOf(status)
+	selected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		selected[field] = v.FieldByName(field).Interface()
+	}
+	return selected
+}
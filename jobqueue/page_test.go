@@ -0,0 +1,117 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPage(t *testing.T) {
+	Convey("Cursors can be encoded and decoded", t, func() {
+		c := &jobCursor{value: -5, key: "abc"}
+		decoded, err := parseJobCursor(c.String())
+		So(err, ShouldBeNil)
+		So(decoded, ShouldResemble, c)
+
+		_, err = parseJobCursor("!!")
+		So(err, ShouldNotBeNil)
+		_, err = parseJobCursor((&jobCursor{key: "abc"}).String()[2:])
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Pages can be parsed from query parameters", t, func() {
+		page, err := parseJobPage(url.Values{}, "", false, false)
+		So(err, ShouldBeNil)
+		So(page, ShouldBeNil)
+
+		_, err = parseJobPage(url.Values{"sort": {"start"}}, "", false, false)
+		So(err, ShouldNotBeNil)
+		_, err = parseJobPage(url.Values{"page_size": {"0"}}, "", false, false)
+		So(err, ShouldNotBeNil)
+		_, err = parseJobPage(url.Values{"page_size": {"10"}, "sort": {"-key"}}, "", false, false)
+		So(err, ShouldNotBeNil)
+		_, err = parseJobPage(url.Values{"page_size": {"10"}, "sort": {"cmd"}}, "", false, false)
+		So(err, ShouldNotBeNil)
+
+		after := &jobCursor{value: 3, key: "abc"}
+		page, err = parseJobPage(url.Values{"page_size": {"10"}, "sort": {"-peakram"}, "after": {after.String()}}, JobStateReady, true, false)
+		So(err, ShouldBeNil)
+		So(page, ShouldResemble, &jobPage{size: 10, after: after, sortBy: jobSortPeakRAM, desc: true, state: JobStateReady, getStd: true})
+	})
+
+	Convey("Jobs are ordered by their sort value, then key", t, func() {
+		page := &jobPage{size: 10, sortBy: jobSortPeakRAM}
+		small := &Job{Cmd: "a", PeakRAM: 10}
+		big := &Job{Cmd: "b", PeakRAM: 20}
+		c1, c2 := page.cursor(small), page.cursor(big)
+		So(c1.value, ShouldEqual, 10)
+		So(c1.key, ShouldEqual, small.key())
+		So(page.less(c1, c2), ShouldBeTrue)
+		So(page.less(c2, c1), ShouldBeFalse)
+
+		page.desc = true
+		So(page.less(c1, c2), ShouldBeFalse)
+		So(page.less(c2, c1), ShouldBeTrue)
+
+		page.sortBy = jobSortStart
+		So(page.cursor(small).value, ShouldEqual, 0)
+		start := time.Now()
+		small.StartTime = start
+		So(page.cursor(small).value, ShouldEqual, start.UnixNano())
+
+		tied := &jobCursor{value: c1.value, key: "0"}
+		So(page.less(tied, c1), ShouldBeTrue)
+	})
+
+	Convey("Jobs can be limited to a state", t, func() {
+		page := &jobPage{state: JobStateRunning}
+		So(page.matches(&Job{State: JobStateReserved}), ShouldBeTrue)
+		So(page.matches(&Job{State: JobStateRunning, Lost: true}), ShouldBeFalse)
+		So(page.matches(&Job{State: JobStateReady}), ShouldBeFalse)
+
+		page.state = JobStateReady
+		So(page.matches(&Job{State: JobStateQuota}), ShouldBeTrue)
+
+		page.state = ""
+		So(page.matches(&Job{State: JobStateBuried}), ShouldBeTrue)
+	})
+
+	Convey("You can get the keys that come after a given key", t, func() {
+		keys := []string{"a", "c", "e", "g"}
+		So(keysAfter(keys, "", 2), ShouldResemble, []string{"a", "c"})
+		So(keysAfter(keys, "c", 2), ShouldResemble, []string{"e", "g"})
+		So(keysAfter(keys, "d", 5), ShouldResemble, []string{"e", "g"})
+		So(len(keysAfter(keys, "g", 5)), ShouldEqual, 0)
+	})
+
+	Convey("You can select just some fields of a jstatus", t, func() {
+		fields, err := jstatusFields("key, STATE")
+		So(err, ShouldBeNil)
+		So(fields, ShouldResemble, []string{"Key", "State"})
+
+		_, err = jstatusFields("Key,Foo")
+		So(err, ShouldNotBeNil)
+
+		selected := selectFields(jstatus{Key: "abc", State: JobStateReady, Cmd: "echo"}, fields)
+		So(selected, ShouldResemble, map[string]interface{}{"Key": "abc", "State": JobStateReady})
+	})
+}
@@ -0,0 +1,362 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for limiting how much of the available resources
+// the running Jobs of each user and RepGroup can use at once.
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// QuotaDefault is the name that can be given a Quota in
+// ServerConfig.UserQuotas or RepGroupQuotas to have it apply separately to
+// every user or RepGroup that doesn't have its own Quota.
+const QuotaDefault = "*"
+
+// quotaHoldGroup is the ReserveGroup we give ready Jobs that would take their
+// user or RepGroup over quota, so that runners don't pick them up and we don't
+// spawn runners for them.
+const quotaHoldGroup = "+quota+"
+
+// Quota limits the resources that the running Jobs of a user or RepGroup can
+// use at once. 0 values mean no limit.
+type Quota struct {
+	// Jobs is the maximum number of Jobs that can run at once.
+	Jobs int
+
+	// Cores is the maximum total Requirements.Cores of running Jobs.
+	Cores int
+
+	// RAM is the maximum total Requirements.RAM (in MB) of running Jobs.
+	RAM int
+}
+
+// allows tells you if a Job needing the given cores and RAM can start running
+// given the current usage of this Quota's owner (a nil usage meaning nothing is
+// running).
+func (q *Quota) allows(usage *Quota, cores, ram int) bool {
+	if q == nil {
+		return true
+	}
+	if usage == nil {
+		usage = &Quota{}
+	}
+	if q.Jobs > 0 && usage.Jobs+1 > q.Jobs {
+		return false
+	}
+	if q.Cores > 0 && usage.Cores+cores > q.Cores {
+		return false
+	}
+	return q.RAM <= 0 || usage.RAM+ram <= q.RAM
+}
+
+// String describes the Quota in the form accepted by ParseQuotas().
+func (q *Quota) String() string {
+	var parts []string
+	if q.Jobs > 0 {
+		parts = append(parts, fmt.Sprintf("jobs=%d", q.Jobs))
+	}
+	if q.Cores > 0 {
+		parts = append(parts, fmt.Sprintf("cores=%d", q.Cores))
+	}
+	if q.RAM > 0 {
+		parts = append(parts, fmt.Sprintf("ram=%d", q.RAM))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseQuotas converts a string like "alice:jobs=100,cores=200;*:jobs=20" in to
+// the form needed for ServerConfig.UserQuotas and RepGroupQuotas. Each
+// semicolon separated entry is a user or RepGroup name (or QuotaDefault)
+// followed by a colon and a comma separated list of limits: any of jobs=N,
+// cores=N and ram=N (in MB). An empty string returns a nil map.
+func ParseQuotas(str string) (map[string]*Quota, error) {
+	if str == "" {
+		return nil, nil
+	}
+
+	quotas := make(map[string]*Quota)
+	for _, entry := range strings.Split(str, ";") {
+		entry = strings.TrimSpace(entry)
+		colon := strings.LastIndex(entry, ":")
+		if colon < 1 {
+			return nil, fmt.Errorf("quota [%s] is not of the form name:limit=N,...", entry)
+		}
+
+		quota := &Quota{}
+		for _, limit := range strings.Split(entry[colon+1:], ",") {
+			kv := strings.SplitN(strings.TrimSpace(limit), "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("quota [%s] has a limit [%s] that is not of the form limit=N", entry, limit)
+			}
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("quota [%s] has a limit [%s] that is not a positive number", entry, limit)
+			}
+			switch kv[0] {
+			case "jobs":
+				quota.Jobs = n
+			case "cores":
+				quota.Cores = n
+			case "ram":
+				quota.RAM = n
+			default:
+				return nil, fmt.Errorf("quota [%s] has an unknown limit [%s]", entry, kv[0])
+			}
+		}
+		quotas[entry[:colon]] = quota
+	}
+	return quotas, nil
+}
+
+// QuotaUsage describes how much of their Quota a user or RepGroup is currently
+// using, as reported in ServerStats.
+type QuotaUsage struct {
+	// Kind is "user" or "repgroup".
+	Kind  string
+	Name  string
+	Quota *Quota
+	// Usage is the total of the Jobs, Cores and RAM of the currently running
+	// Jobs of this user or RepGroup.
+	Usage *Quota
+}
+
+// quotaCharge is what a running Job counts against its user's and RepGroup's
+// quotas.
+type quotaCharge struct {
+	user     string
+	repGroup string
+	cores    int
+	ram      int
+}
+
+// quotas keeps track of the configured Quotas and how much of them the running
+// Jobs are using.
+type quotas struct {
+	sync.Mutex
+	users     map[string]*Quota
+	repGroups map[string]*Quota
+	userUse   map[string]*Quota
+	rgUse     map[string]*Quota
+	charges   map[string][]*quotaCharge // keyed on Job key
+	holding   int
+}
+
+// newQuotas returns a quotas for the given configuration, or nil if there are
+// no quotas configured.
+func newQuotas(users, repGroups map[string]*Quota) *quotas {
+	if len(users) == 0 && len(repGroups) == 0 {
+		return nil
+	}
+	return &quotas{
+		users:     users,
+		repGroups: repGroups,
+		userUse:   make(map[string]*Quota),
+		rgUse:     make(map[string]*Quota),
+		charges:   make(map[string][]*quotaCharge),
+	}
+}
+
+// quotaFor returns the Quota that applies to the given name, or nil if there
+// isn't one.
+func quotaFor(quotas map[string]*Quota, name string) *Quota {
+	if q, exists := quotas[name]; exists {
+		return q
+	}
+	return quotas[QuotaDefault]
+}
+
+// allows tells you if a Job with the given charge can start running without
+// going over quota, given that the Jobs in pending will also be started. You
+// must hold the lock.
+func (qs *quotas) allows(c *quotaCharge, pending *quotaTally) bool {
+	uuse, rguse := qs.userUse[c.user], qs.rgUse[c.repGroup]
+	if pending != nil {
+		uuse = addUse(uuse, pending.users[c.user])
+		rguse = addUse(rguse, pending.repGroups[c.repGroup])
+	}
+	return quotaFor(qs.users, c.user).allows(uuse, c.cores, c.ram) && quotaFor(qs.repGroups, c.repGroup).allows(rguse, c.cores, c.ram)
+}
+
+// charge tries to count a Job that is about to start running against its
+// quotas, returning false (and not counting it) if that would take it over
+// quota.
+func (qs *quotas) charge(key string, c *quotaCharge) bool {
+	qs.Lock()
+	defer qs.Unlock()
+	if !qs.allows(c, nil) {
+		return false
+	}
+	qs.charges[key] = append(qs.charges[key], c)
+	qs.userUse[c.user] = addCharge(qs.userUse[c.user], c, 1)
+	qs.rgUse[c.repGroup] = addCharge(qs.rgUse[c.repGroup], c, 1)
+	return true
+}
+
+// uncharge undoes the oldest charge() of the Job with the given key, for when
+// it stops running. It returns true if Jobs are being held back that might now
+// be able to run.
+func (qs *quotas) uncharge(key string) bool {
+	qs.Lock()
+	defer qs.Unlock()
+	charges := qs.charges[key]
+	if len(charges) == 0 {
+		return false
+	}
+	c := charges[0]
+	if len(charges) == 1 {
+		delete(qs.charges, key)
+	} else {
+		qs.charges[key] = charges[1:]
+	}
+	qs.userUse[c.user] = addCharge(qs.userUse[c.user], c, -1)
+	if qs.userUse[c.user].Jobs <= 0 {
+		delete(qs.userUse, c.user)
+	}
+	qs.rgUse[c.repGroup] = addCharge(qs.rgUse[c.repGroup], c, -1)
+	if qs.rgUse[c.repGroup].Jobs <= 0 {
+		delete(qs.rgUse, c.repGroup)
+	}
+	return qs.holding > 0
+}
+
+// usage reports the current usage of every user and RepGroup that either has
+// its own Quota or is running Jobs under the QuotaDefault, sorted by kind and
+// name.
+func (qs *quotas) usage() []*QuotaUsage {
+	qs.Lock()
+	defer qs.Unlock()
+	var usages []*QuotaUsage
+	report := func(kind string, quotas, use map[string]*Quota) {
+		names := make(map[string]bool)
+		for name := range quotas {
+			if name != QuotaDefault {
+				names[name] = true
+			}
+		}
+		for name := range use {
+			if quotaFor(quotas, name) != nil {
+				names[name] = true
+			}
+		}
+		for name := range names {
+			u := &Quota{}
+			if use[name] != nil {
+				*u = *use[name]
+			}
+			usages = append(usages, &QuotaUsage{Kind: kind, Name: name, Quota: quotaFor(quotas, name), Usage: u})
+		}
+	}
+	report("user", qs.users, qs.userUse)
+	report("repgroup", qs.repGroups, qs.rgUse)
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Kind == usages[j].Kind {
+			return usages[i].Name < usages[j].Name
+		}
+		return usages[i].Kind > usages[j].Kind
+	})
+	return usages
+}
+
+// hold is used when going through the ready Jobs, to decide if a Job with the
+// given charge should be held back because it couldn't start running without
+// going over quota, given the Jobs in the tally that we expect to run first. If
+// it isn't held back, it is added to the tally.
+func (qs *quotas) hold(c *quotaCharge, tally *quotaTally) bool {
+	qs.Lock()
+	defer qs.Unlock()
+	if qs.allows(c, tally) {
+		tally.add(c)
+		return false
+	}
+	return true
+}
+
+// setHolding records how many ready Jobs are currently being held back.
+func (qs *quotas) setHolding(n int) {
+	qs.Lock()
+	defer qs.Unlock()
+	qs.holding = n
+}
+
+// waiting tells you if a Job with the given charge couldn't start running right
+// now because it would go over quota.
+func (qs *quotas) waiting(c *quotaCharge) bool {
+	qs.Lock()
+	defer qs.Unlock()
+	return !qs.allows(c, nil)
+}
+
+// quotaTally accumulates the usage of Jobs we expect to start running.
+type quotaTally struct {
+	users     map[string]*Quota
+	repGroups map[string]*Quota
+}
+
+// newQuotaTally returns an empty quotaTally.
+func newQuotaTally() *quotaTally {
+	return &quotaTally{users: make(map[string]*Quota), repGroups: make(map[string]*Quota)}
+}
+
+// add counts a charge in the tally.
+func (t *quotaTally) add(c *quotaCharge) {
+	t.users[c.user] = addCharge(t.users[c.user], c, 1)
+	t.repGroups[c.repGroup] = addCharge(t.repGroups[c.repGroup], c, 1)
+}
+
+// addCharge adds (or with a sign of -1, subtracts) a charge to a usage,
+// returning the new usage.
+func addCharge(use *Quota, c *quotaCharge, sign int) *Quota {
+	if use == nil {
+		use = &Quota{}
+	}
+	use.Jobs += sign
+	use.Cores += sign * c.cores
+	use.RAM += sign * c.ram
+	return use
+}
+
+// addUse returns the sum of 2 usages, either of which may be nil.
+func addUse(a, b *Quota) *Quota {
+	sum := &Quota{}
+	for _, use := range []*Quota{a, b} {
+		if use != nil {
+			sum.Jobs += use.Jobs
+			sum.Cores += use.Cores
+			sum.RAM += use.RAM
+		}
+	}
+	return sum
+}
+
+// jobQuotaCharge returns what the given Job would count against its quotas if
+// it were to run. You must hold the Job's lock.
+func jobQuotaCharge(job *Job) *quotaCharge {
+	c := &quotaCharge{user: job.User, repGroup: job.RepGroup}
+	if job.Requirements != nil {
+		c.cores = job.Requirements.Cores
+		c.ram = job.Requirements.RAM
+	}
+	return c
+}
@@ -0,0 +1,101 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	Convey("Quotas can be parsed", t, func() {
+		quotas, err := ParseQuotas("alice:jobs=2,cores=4; *:ram=1000")
+		So(err, ShouldBeNil)
+		So(len(quotas), ShouldEqual, 2)
+		So(*quotas["alice"], ShouldResemble, Quota{Jobs: 2, Cores: 4})
+		So(*quotas[QuotaDefault], ShouldResemble, Quota{RAM: 1000})
+		So(quotas["alice"].String(), ShouldEqual, "jobs=2,cores=4")
+
+		quotas, err = ParseQuotas("")
+		So(err, ShouldBeNil)
+		So(quotas, ShouldBeNil)
+
+		_, err = ParseQuotas("alice")
+		So(err, ShouldNotBeNil)
+		_, err = ParseQuotas("alice:jobs")
+		So(err, ShouldNotBeNil)
+		_, err = ParseQuotas("alice:jobs=-1")
+		So(err, ShouldNotBeNil)
+		_, err = ParseQuotas("alice:gpus=1")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Without any quotas, nothing is tracked", t, func() {
+		So(newQuotas(nil, map[string]*Quota{}), ShouldBeNil)
+	})
+
+	Convey("Running jobs are counted against their quotas", t, func() {
+		qs := newQuotas(map[string]*Quota{"alice": {Jobs: 2, Cores: 4}, QuotaDefault: {RAM: 1000}}, map[string]*Quota{"big": {Jobs: 1}})
+		alice := &quotaCharge{user: "alice", repGroup: "a", cores: 2, ram: 5000}
+		bob := &quotaCharge{user: "bob", repGroup: "b", cores: 1, ram: 600}
+
+		So(qs.charge("a1", alice), ShouldBeTrue)
+		So(qs.waiting(alice), ShouldBeFalse)
+		So(qs.charge("a2", alice), ShouldBeTrue)
+		So(qs.waiting(alice), ShouldBeTrue)
+		So(qs.charge("a3", alice), ShouldBeFalse)
+
+		So(qs.charge("b1", bob), ShouldBeTrue)
+		So(qs.charge("b2", bob), ShouldBeFalse)
+
+		So(qs.charge("x1", &quotaCharge{user: "carol", repGroup: "big"}), ShouldBeTrue)
+		So(qs.charge("x2", &quotaCharge{user: "dave", repGroup: "big"}), ShouldBeFalse)
+
+		usage := qs.usage()
+		So(len(usage), ShouldEqual, 4)
+		So(usage[0].Kind, ShouldEqual, "user")
+		So(usage[0].Name, ShouldEqual, "alice")
+		So(*usage[0].Usage, ShouldResemble, Quota{Jobs: 2, Cores: 4, RAM: 10000})
+		So(usage[1].Name, ShouldEqual, "bob")
+		So(*usage[1].Quota, ShouldResemble, Quota{RAM: 1000})
+		So(usage[2].Name, ShouldEqual, "carol")
+		So(usage[3].Kind, ShouldEqual, "repgroup")
+		So(usage[3].Name, ShouldEqual, "big")
+		So(usage[3].Usage.Jobs, ShouldEqual, 1)
+
+		Convey("Jobs that stop running free up their quota", func() {
+			So(qs.uncharge("a1"), ShouldBeFalse)
+			So(qs.uncharge("a1"), ShouldBeFalse)
+			So(qs.charge("a3", alice), ShouldBeTrue)
+
+			qs.setHolding(1)
+			So(qs.uncharge("b1"), ShouldBeTrue)
+			So(qs.charge("b2", bob), ShouldBeTrue)
+		})
+
+		Convey("Ready jobs can be held back if they'd go over quota", func() {
+			So(qs.uncharge("a1"), ShouldBeFalse)
+			tally := newQuotaTally()
+			So(qs.hold(alice, tally), ShouldBeFalse)
+			So(qs.hold(alice, tally), ShouldBeTrue)
+			So(qs.hold(&quotaCharge{user: "carol", repGroup: "c"}, tally), ShouldBeFalse)
+			So(qs.hold(&quotaCharge{user: "carol", repGroup: "big"}, tally), ShouldBeTrue)
+		})
+	})
+}
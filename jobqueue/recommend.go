@@ -0,0 +1,451 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for configuring, inspecting and pruning the
+// resource usage stats we learn per ReqGroup, which are used to recommend the
+// Requirements of future Jobs.
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/ugorji/go/codec"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRecPercentile is the percentile of past resource usage we recommend
+// if not otherwise configured.
+const defaultRecPercentile = float64(95)
+
+// ServerRecPruneInterval is how often the server deletes learned resource
+// usage stats that have fallen outside of the configured recency windows.
+var ServerRecPruneInterval = 1 * time.Hour
+
+// statBuckets are the buckets we store learned resource usage stats in.
+var statBuckets = [][]byte{bucketJobMBs, bucketJobSecs, bucketJobCores, bucketJobDisk}
+
+// RecommendationConfig configures how the server turns the resource usage of
+// past Jobs in a ReqGroup in to recommended Requirements for future Jobs in
+// that ReqGroup. Zero values mean "use the default".
+type RecommendationConfig struct {
+	// Percentile of past usage to recommend. Defaults to 95.
+	Percentile float64
+
+	// MBRound is the number of MB memory recommendations are rounded up to
+	// the nearest multiple of. Defaults to RecMBRound.
+	MBRound int
+
+	// SecRound is the number of seconds time recommendations are rounded up
+	// to the nearest multiple of. Defaults to RecSecRound.
+	SecRound int
+
+	// WindowRuns, if greater than 0, means only the most recent WindowRuns
+	// runs are considered.
+	WindowRuns int
+
+	// WindowDays, if greater than 0, means only runs that ended in the last
+	// WindowDays days are considered.
+	WindowDays int
+}
+
+// merge returns a new RecommendationConfig with the non-zero values of other
+// taking precedence over our own. Either can be nil.
+func (c *RecommendationConfig) merge(other *RecommendationConfig) *RecommendationConfig {
+	merged := &RecommendationConfig{}
+	if c != nil {
+		*merged = *c
+	}
+	if other == nil {
+		return merged
+	}
+	if other.Percentile > 0 {
+		merged.Percentile = other.Percentile
+	}
+	if other.MBRound > 0 {
+		merged.MBRound = other.MBRound
+	}
+	if other.SecRound > 0 {
+		merged.SecRound = other.SecRound
+	}
+	if other.WindowRuns > 0 {
+		merged.WindowRuns = other.WindowRuns
+	}
+	if other.WindowDays > 0 {
+		merged.WindowDays = other.WindowDays
+	}
+	return merged
+}
+
+// percentile returns the configured Percentile (capped at 100), or the
+// default.
+func (c *RecommendationConfig) percentile() float64 {
+	switch {
+	case c.Percentile > 100:
+		return 100
+	case c.Percentile > 0:
+		return c.Percentile
+	}
+	return defaultRecPercentile
+}
+
+// mbRound returns the configured MBRound, or RecMBRound.
+func (c *RecommendationConfig) mbRound() int {
+	if c.MBRound > 0 {
+		return c.MBRound
+	}
+	return RecMBRound
+}
+
+// secRound returns the configured SecRound, or RecSecRound.
+func (c *RecommendationConfig) secRound() int {
+	if c.SecRound > 0 {
+		return c.SecRound
+	}
+	return RecSecRound
+}
+
+// String describes the config, like "95th percentile of the last 100 runs
+// within 30 days, rounded to 100MB and 1800s".
+func (c *RecommendationConfig) String() string {
+	window := "all runs"
+	switch {
+	case c.WindowRuns > 0 && c.WindowDays > 0:
+		window = fmt.Sprintf("the last %d runs within %d days", c.WindowRuns, c.WindowDays)
+	case c.WindowRuns > 0:
+		window = fmt.Sprintf("the last %d runs", c.WindowRuns)
+	case c.WindowDays > 0:
+		window = fmt.Sprintf("runs within the last %d days", c.WindowDays)
+	}
+	return fmt.Sprintf("%sth percentile of %s, rounded to %dMB and %ds", strconv.FormatFloat(c.percentile(), 'f', -1, 64), window, c.mbRound(), c.secRound())
+}
+
+// ReqGroupStats summarises what the server has learned about the resource
+// usage of Jobs in a ReqGroup.
+type ReqGroupStats struct {
+	ReqGroup string
+
+	// Config is the RecommendationConfig in effect for this ReqGroup, and
+	// Custom is true if some of it was set specifically for this ReqGroup.
+	Config *RecommendationConfig
+	Custom bool
+
+	// EscalationPolicy is the policy set for this ReqGroup with
+	// Client.SetReqGroupEscalationPolicy(), if any.
+	EscalationPolicy *EscalationPolicy
+
+	// Runs is the number of past runs that are being considered.
+	Runs int
+
+	// The current recommendations; 0 means nothing has been learned.
+	RAM   int // MB
+	Time  time.Duration
+	Cores int
+	Disk  int // GB
+}
+
+// statEntry is a single stored resource usage stat.
+type statEntry struct {
+	key   []byte
+	value int
+	when  int64 // unix nano time the run ended; 0 if not known
+}
+
+// statKey returns the key to store a resource usage stat under. Keys start
+// with the reqGroup, so that a reqGroup's stats can be found by prefix.
+func statKey(reqGroup string, value int, when time.Time) []byte {
+	return []byte(fmt.Sprintf("%s%s%20d%s%20d", reqGroup, dbDelimiter, value, dbDelimiter, when.UnixNano()))
+}
+
+// reqGroupStatEntries returns all the stats stored in the given bucket for the
+// given reqGroup.
+func reqGroupStatEntries(b *bolt.Bucket, reqGroup string) (entries []*statEntry) {
+	prefix := []byte(reqGroup + dbDelimiter)
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		entries = append(entries, newStatEntry(k, v, len(prefix)))
+	}
+	return
+}
+
+// newStatEntry parses a stored stat, given the length of its reqGroup prefix.
+// (Stats stored by old versions of wr did not record when the run ended.)
+func newStatEntry(k, v []byte, prefixLen int) *statEntry {
+	key := make([]byte, len(k))
+	copy(key, k)
+	e := &statEntry{key: key}
+	e.value, _ = strconv.Atoi(string(v))
+	rest := string(k[prefixLen:])
+	if i := strings.Index(rest, dbDelimiter); i >= 0 {
+		e.when, _ = strconv.ParseInt(strings.TrimSpace(rest[i+len(dbDelimiter):]), 10, 64)
+	}
+	return e
+}
+
+// windowStatEntries splits the given entries in to those that fall within the
+// recency windows of the given config, and those that don't.
+func windowStatEntries(entries []*statEntry, conf *RecommendationConfig) (in, out []*statEntry) {
+	if conf.WindowRuns <= 0 && conf.WindowDays <= 0 {
+		return entries, nil
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].when > entries[j].when
+	})
+	var cutoff int64
+	if conf.WindowDays > 0 {
+		cutoff = time.Now().Add(-time.Duration(conf.WindowDays) * 24 * time.Hour).UnixNano()
+	}
+	for i, e := range entries {
+		if (conf.WindowRuns > 0 && i >= conf.WindowRuns) || (cutoff > 0 && e.when < cutoff) {
+			out = append(out, e)
+		} else {
+			in = append(in, e)
+		}
+	}
+	return
+}
+
+// percentileRecommendation returns the given percentile of the values. If
+// there are too few values to calculate the percentile (we want at least 5 or
+// so values above it), or if the percentile is very close to the maximum
+// value, returns the maximum value instead. In either case, the true value is
+// rounded up to the nearest roundAmount. Returns 0 if there are no values.
+func percentileRecommendation(values []int, percentile float64, roundAmount int) (recommendation int) {
+	if len(values) == 0 {
+		return
+	}
+	sort.Ints(values)
+	max := values[len(values)-1]
+
+	window := 100 - percentile
+	if perWindow := float64(len(values)) / 100 * window; perWindow > window {
+		window = perWindow
+	}
+	if i := len(values) - int(window) - 1; i >= 0 {
+		recommendation = values[i]
+	}
+
+	if recommendation == 0 || max-recommendation < roundAmount {
+		recommendation = max
+	}
+	if recommendation%roundAmount > 0 {
+		recommendation = int(math.Ceil(float64(recommendation)/float64(roundAmount))) * roundAmount
+	}
+	return
+}
+
+// recConfig returns the RecommendationConfig in effect for the given
+// reqGroup.
+func (db *db) recConfig(reqGroup string) *RecommendationConfig {
+	db.RLock()
+	defer db.RUnlock()
+	return db.recDefaults.merge(db.recConfigs[reqGroup])
+}
+
+// setRecDefaults sets the deployment-wide RecommendationConfig, and loads any
+// per-ReqGroup configs that were previously stored.
+func (db *db) setRecDefaults(defaults *RecommendationConfig) error {
+	configs := make(map[string]*RecommendationConfig)
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRecConfigs).ForEach(func(k, v []byte) error {
+			conf := &RecommendationConfig{}
+			dec := codec.NewDecoderBytes(v, db.ch)
+			if derr := dec.Decode(conf); derr != nil {
+				return derr
+			}
+			configs[string(k)] = conf
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	db.Lock()
+	defer db.Unlock()
+	db.recDefaults = defaults
+	db.recConfigs = configs
+	return nil
+}
+
+// setReqGroupRecConfig stores a RecommendationConfig that overrides the
+// defaults for the given reqGroup. Supplying nil reverts to the defaults.
+func (db *db) setReqGroupRecConfig(reqGroup string, conf *RecommendationConfig) error {
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketRecConfigs)
+		if conf == nil {
+			return b.Delete([]byte(reqGroup))
+		}
+		var encoded []byte
+		enc := codec.NewEncoderBytes(&encoded, db.ch)
+		if err := enc.Encode(conf); err != nil {
+			return err
+		}
+		return b.Put([]byte(reqGroup), encoded)
+	})
+	if err != nil {
+		return err
+	}
+
+	db.Lock()
+	defer db.Unlock()
+	if conf == nil {
+		delete(db.recConfigs, reqGroup)
+	} else {
+		db.recConfigs[reqGroup] = conf
+	}
+	return nil
+}
+
+// reqGroups returns the names of all ReqGroups that we have learned stats
+// for, sorted.
+func (db *db) reqGroups() (names []string, err error) {
+	err = db.bolt.View(func(tx *bolt.Tx) error {
+		seen := make(map[string]bool)
+		return tx.Bucket(bucketJobMBs).ForEach(func(k, v []byte) error {
+			if i := bytes.Index(k, []byte(dbDelimiter)); i >= 0 {
+				name := string(k[:i])
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+			return nil
+		})
+	})
+	sort.Strings(names)
+	return
+}
+
+// reqGroupStats returns a summary of what we have learned about the given
+// reqGroup.
+func (db *db) reqGroupStats(reqGroup string) (stats *ReqGroupStats, err error) {
+	db.RLock()
+	_, custom := db.recConfigs[reqGroup]
+	db.RUnlock()
+	conf := db.recConfig(reqGroup)
+	stats = &ReqGroupStats{ReqGroup: reqGroup, Config: conf, Custom: custom, EscalationPolicy: db.escalationPolicy(reqGroup)}
+
+	err = db.bolt.View(func(tx *bolt.Tx) error {
+		in, _ := windowStatEntries(reqGroupStatEntries(tx.Bucket(bucketJobMBs), reqGroup), conf)
+		stats.Runs = len(in)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	stats.RAM, err = db.recommendedReqGroupMemory(reqGroup)
+	if err != nil {
+		return
+	}
+	secs, err := db.recommendedReqGroupTime(reqGroup)
+	if err != nil {
+		return
+	}
+	stats.Time = time.Duration(secs) * time.Second
+	stats.Cores, err = db.recommendedReqGroupCores(reqGroup)
+	if err != nil {
+		return
+	}
+	stats.Disk, err = db.recommendedReqGroupDisk(reqGroup)
+	return
+}
+
+// resetReqGroup forgets everything we have learned about the given reqGroup.
+// Any custom RecommendationConfig for it is kept.
+func (db *db) resetReqGroup(reqGroup string) (deleted int, err error) {
+	err = db.bolt.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range statBuckets {
+			b := tx.Bucket(bucket)
+			for _, e := range reqGroupStatEntries(b, reqGroup) {
+				if derr := b.Delete(e.key); derr != nil {
+					return derr
+				}
+				if bytes.Equal(bucket, bucketJobMBs) {
+					deleted++
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// pruneReqGroupStats deletes stats that have fallen outside of the recency
+// window of their reqGroup's RecommendationConfig, so that they don't
+// accumulate forever. Returns the number of runs forgotten.
+func (db *db) pruneReqGroupStats() (pruned int, err error) {
+	names, err := db.reqGroups()
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		conf := db.recConfig(name)
+		if conf.WindowRuns <= 0 && conf.WindowDays <= 0 {
+			continue
+		}
+		err = db.bolt.Update(func(tx *bolt.Tx) error {
+			for _, bucket := range statBuckets {
+				b := tx.Bucket(bucket)
+				_, out := windowStatEntries(reqGroupStatEntries(b, name), conf)
+				for _, e := range out {
+					if derr := b.Delete(e.key); derr != nil {
+						return derr
+					}
+				}
+				if bytes.Equal(bucket, bucketJobMBs) {
+					pruned += len(out)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// getReqGroupStats returns a summary of what we have learned about the given
+// reqGroup, or about all reqGroups if reqGroup is blank.
+func (s *Server) getReqGroupStats(reqGroup string) (stats []*ReqGroupStats, err error) {
+	names := []string{reqGroup}
+	if reqGroup == "" {
+		names, err = s.db.reqGroups()
+		if err != nil {
+			return
+		}
+	}
+	for _, name := range names {
+		var stat *ReqGroupStats
+		stat, err = s.db.reqGroupStats(name)
+		if err != nil {
+			return
+		}
+		stats = append(stats, stat)
+	}
+	return
+}
@@ -0,0 +1,92 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRecommendations(t *testing.T) {
+	Convey("Recommendations are a rounded percentile of past values", t, func() {
+		So(percentileRecommendation(nil, 95, 100), ShouldEqual, 0)
+
+		var values []int
+		for i := 1; i <= 100; i++ {
+			values = append(values, i*100)
+		}
+		So(percentileRecommendation(values, 95, 100), ShouldEqual, 9500)
+		So(percentileRecommendation(values, 50, 100), ShouldEqual, 5000)
+		So(percentileRecommendation(values, 100, 100), ShouldEqual, 10000)
+		So(percentileRecommendation(values, 95, 3000), ShouldEqual, 12000)
+
+		So(percentileRecommendation([]int{10, 20, 30}, 95, 100), ShouldEqual, 100)
+		So(percentileRecommendation([]int{10, 20, 3000}, 95, 100), ShouldEqual, 3000)
+	})
+
+	Convey("Configs merge with defaults", t, func() {
+		var defaults *RecommendationConfig
+		conf := defaults.merge(nil)
+		So(conf.percentile(), ShouldEqual, 95)
+		So(conf.mbRound(), ShouldEqual, RecMBRound)
+		So(conf.secRound(), ShouldEqual, RecSecRound)
+		So(conf.String(), ShouldEqual, "95th percentile of all runs, rounded to 100MB and 1800s")
+
+		defaults = &RecommendationConfig{Percentile: 90, MBRound: 50, WindowDays: 30}
+		conf = defaults.merge(&RecommendationConfig{Percentile: 99.5, WindowRuns: 10})
+		So(conf.Percentile, ShouldEqual, 99.5)
+		So(conf.MBRound, ShouldEqual, 50)
+		So(conf.WindowRuns, ShouldEqual, 10)
+		So(conf.WindowDays, ShouldEqual, 30)
+		So(conf.String(), ShouldEqual, "99.5th percentile of the last 10 runs within 30 days, rounded to 50MB and 1800s")
+		So(defaults.Percentile, ShouldEqual, 90)
+	})
+
+	Convey("Stats can be limited to a recency window", t, func() {
+		now := time.Now()
+		var entries []*statEntry
+		for i := 0; i < 10; i++ {
+			key := statKey("rg", i, now.Add(-time.Duration(i)*24*time.Hour))
+			entries = append(entries, newStatEntry(key, []byte{byte('0' + i)}, len("rg"+dbDelimiter)))
+		}
+		So(entries[3].value, ShouldEqual, 3)
+		So(entries[3].when, ShouldEqual, now.Add(-72*time.Hour).UnixNano())
+
+		old := newStatEntry([]byte("rg"+dbDelimiter+"                  10"), []byte("10"), len("rg"+dbDelimiter))
+		So(old.value, ShouldEqual, 10)
+		So(old.when, ShouldEqual, 0)
+		entries = append([]*statEntry{old}, entries...)
+
+		in, out := windowStatEntries(entries, &RecommendationConfig{})
+		So(len(in), ShouldEqual, 11)
+		So(len(out), ShouldEqual, 0)
+
+		in, out = windowStatEntries(entries, &RecommendationConfig{WindowRuns: 4})
+		So(len(in), ShouldEqual, 4)
+		So(in[0].value, ShouldEqual, 0)
+		So(in[3].value, ShouldEqual, 3)
+		So(len(out), ShouldEqual, 7)
+		So(out[6].value, ShouldEqual, 10)
+
+		in, out = windowStatEntries(entries, &RecommendationConfig{WindowDays: 5, WindowRuns: 8})
+		So(len(in), ShouldEqual, 5)
+		So(len(out), ShouldEqual, 6)
+	})
+}
@@ -0,0 +1,667 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+/*
+Package rest is a client for the REST API of wr's manager, as described by the
+OpenAPI specification it serves at /rest/v1/openapi.json.
+
+It is for services that can't use the mangos protocol of jobqueue.Client, eg.
+because they can only reach the manager's web interface port. It lets you add
+jobs, get their status, search their history, and remove, modify, retry or kill
+them, as well as read scheduler warnings, deal with bad cloud servers and read
+the audit trail.
+
+	import "github.com/VertebrateResequencing/wr/jobqueue/rest"
+	client := rest.New("http://localhost:11302", nil)
+	statuses, err := client.Add([]*jobqueue.JobViaJSON{{Cmd: "echo 1"}}, &jobqueue.JobViaJSON{RepGrp: "foo"})
+	statuses, err = client.Status([]string{"foo"}, &rest.StatusOptions{State: jobqueue.JobStateBuried})
+	statuses, err = client.Kick([]string{"foo"}, nil)
+*/
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/VertebrateResequencing/wr/jobqueue"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the endpoints of the REST API, relative to the base url
+const (
+	jobsEndpoint       = "/rest/v1/jobs/"
+	warningsEndpoint   = "/rest/v1/warnings/"
+	badServersEndpoint = "/rest/v1/servers/"
+	openAPIEndpoint    = "/rest/v1/openapi.json"
+	eventsEndpoint     = "/rest/v1/events"
+	webhooksEndpoint   = "/rest/v1/webhooks/"
+	auditEndpoint      = "/rest/v1/audit/"
+	kickSuffix         = "/kick"
+	killSuffix         = "/kill"
+	cancelSuffix       = "/cancel"
+)
+
+// linkNextRegexp finds the url of the next page in a Link header.
+var linkNextRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// Error records an error response from the server.
+type Error struct {
+	Op         string // name of the method
+	StatusCode int    // the HTTP status code the server responded with
+	Msg        string // the body of the server's response
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("rest %s(): %d %s", e.Op, e.StatusCode, e.Msg)
+}
+
+// JobStatus is the status of a job, as returned by the jobs endpoints.
+type JobStatus struct {
+	Key          string
+	RepGroup     string
+	DepGroups    []string
+	Dependencies []string
+	Cmd          string
+	State        jobqueue.JobState
+	Cwd          string
+	CwdBase      string
+	HomeChanged  bool
+	Behaviours   string
+	Mounts       string
+	// ExpectedRAM is in Megabytes.
+	ExpectedRAM int
+	// ExpectedTime is in seconds.
+	ExpectedTime float64
+	// RequestedDisk is in Gigabytes.
+	RequestedDisk int
+	Cores         int
+	PeakRAM       int
+	Exited        bool
+	Exitcode      int
+	FailReason    string
+	Pid           int
+	Host          string
+	HostID        string
+	HostIP        string
+	// Walltime and CPUtime are in seconds.
+	Walltime float64
+	CPUtime  float64
+	// Started and Ended are seconds since the Unix epoch.
+	Started  int64
+	Ended    int64
+	StdErr   string
+	StdOut   string
+	Attempts uint32
+	// Similar is the number of other jobs like this one that were grouped
+	// with it when StatusOptions.Limit was used.
+	Similar int
+}
+
+// Warning is a problem the manager's scheduler encountered.
+type Warning struct {
+	Msg string
+	// FirstDate and LastDate are seconds since the Unix epoch.
+	FirstDate int64
+	LastDate  int64
+	// Count is the number of times this Msg was seen.
+	Count int
+}
+
+// BadServer is a cloud server that has gone bad.
+type BadServer struct {
+	ID   string
+	Name string
+	IP   string
+	// Date is seconds since the Unix epoch.
+	Date    int64
+	IsBad   bool
+	Problem string
+}
+
+// Event is a job changing state, as streamed by Client.Events().
+type Event struct {
+	// ID increases with each event, and is what you supply to Events() to
+	// resume streaming after this event.
+	ID       uint64
+	Key      string
+	RepGroup string
+	User     string
+	From     jobqueue.JobState
+	To       jobqueue.JobState
+	// Time is seconds since the Unix epoch.
+	Time int64
+}
+
+// WebhookDelivery is an attempt by the manager to POST an event to a webhook.
+type WebhookDelivery struct {
+	ID         uint64
+	URL        string
+	Event      string
+	RepGroup   string
+	JobKey     string
+	Attempts   int
+	StatusCode int
+	Error      string
+	Delivered  bool
+	// Time is seconds since the Unix epoch of the latest attempt.
+	Time int64
+}
+
+// EventFilter limits the events Client.Events() gets to those of jobs with any
+// of the given RepGroups, users or keys. Empty slices don't limit.
+type EventFilter struct {
+	RepGroups []string
+	Users     []string
+	Keys      []string
+}
+
+// StatusOptions limit which jobs Client.Status() gets, and what it gets about
+// them.
+type StatusOptions struct {
+	// State limits to jobs in this state. JobStateRunning and
+	// JobStateReserved are treated the same, and JobStateReady includes
+	// JobStateQuota.
+	State jobqueue.JobState
+
+	// Limit groups jobs by state, exitcode and fail reason, and returns at
+	// most this many of each group.
+	Limit int
+
+	// Std gets the STDOUT and STDERR of failed jobs.
+	Std bool
+
+	// Fields limits the returned JobStatuses to just these fields being set,
+	// eg. []string{"Key", "State"}.
+	Fields []string
+}
+
+// SearchOptions are like StatusOptions, but for searching the jobs that have
+// run with Client.Search().
+type SearchOptions struct {
+	Limit  int
+	Std    bool
+	Fields []string
+}
+
+// PageOptions are like StatusOptions, but for getting jobs a page at a time
+// with Client.StatusPage().
+type PageOptions struct {
+	// Size is the maximum number of jobs on a page. Required.
+	Size int
+
+	// After is the cursor of the page you want, as returned by a previous
+	// call to StatusPage(). Leave empty for the first page.
+	After string
+
+	// Sort is one of "start", "walltime" or "peakram", optionally prefixed
+	// with "-" for descending order. Defaults to sorting by key.
+	Sort string
+
+	State  jobqueue.JobState
+	Std    bool
+	Fields []string
+}
+
+// Filter limits which of the jobs you supply the ids of are acted on by
+// Client.Delete(), Modify(), Kick() and Kill().
+type Filter struct {
+	State      jobqueue.JobState
+	Exitcode   *int
+	FailReason string
+}
+
+// Modification describes the changes Client.Modify() should make. Only
+// non-nil (or non-empty) fields are changed.
+type Modification struct {
+	Priority *int
+	Retries  *int
+	Override *int
+	// Memory is a number and unit suffix, eg. 1G for 1 Gigabyte.
+	Memory string
+	Time   *time.Duration
+	CPUs   *int
+	// Disk is in Gigabytes.
+	Disk *int
+}
+
+// Client lets you talk to the REST API of a wr manager.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New returns a Client for the manager whose web interface is at the given
+// url, eg. "http://localhost:11302". If httpClient is nil,
+// http.DefaultClient is used.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: httpClient}
+}
+
+// Add adds the given jobs to the queue. Properties not set on the jobs are
+// taken from those set on defaults (which can be nil); note that the Cmd,
+// CmdDeps, InputFiles, OutputFiles and Array of defaults are ignored. It
+// returns the status of the jobs that are now in the queue, which may be
+// fewer than supplied if some were duplicates or already complete.
+func (c *Client) Add(jobs []*jobqueue.JobViaJSON, defaults *jobqueue.JobViaJSON) ([]*JobStatus, error) {
+	params, err := defaultsParams(defaults)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(jobs)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []*JobStatus
+	_, err = c.request("Add", http.MethodPost, jobsEndpoint, params, bytes.NewReader(body), &statuses)
+	return statuses, err
+}
+
+// Status gets the status of the jobs with the given ids (job keys or
+// RepGroups), or of all incomplete jobs if ids is empty. opts can be nil.
+func (c *Client) Status(ids []string, opts *StatusOptions) ([]*JobStatus, error) {
+	params := url.Values{}
+	if opts != nil {
+		setParam(params, "state", string(opts.State))
+		if opts.Limit > 0 {
+			params.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		if opts.Std {
+			params.Set("std", "true")
+		}
+		setParam(params, "fields", strings.Join(opts.Fields, ","))
+	}
+	var statuses []*JobStatus
+	_, err := c.request("Status", http.MethodGet, jobsEndpoint+strings.Join(ids, ","), params, nil, &statuses)
+	return statuses, err
+}
+
+// Search gets the status of the jobs (complete or not) that have run and pass
+// the given search, in the order they ended. opts can be nil.
+func (c *Client) Search(search *jobqueue.JobSearch, opts *SearchOptions) ([]*JobStatus, error) {
+	params := url.Values{}
+	if !search.Since.IsZero() {
+		params.Set("since", search.Since.Format(time.RFC3339))
+	}
+	if !search.Until.IsZero() {
+		params.Set("until", search.Until.Format(time.RFC3339))
+	}
+	if search.Exitcode != nil {
+		params.Set("exitcode", strconv.Itoa(*search.Exitcode))
+	}
+	setParam(params, "fail_reason", search.FailReason)
+	setParam(params, "host", search.Host)
+	setParam(params, "req_grp", search.ReqGroup)
+	setParam(params, "user", search.User)
+	setParam(params, "cmd", search.Cmd)
+	if len(params) == 0 {
+		return nil, fmt.Errorf("rest Search(): at least one search criterion is required")
+	}
+	if opts != nil {
+		if opts.Limit > 0 {
+			params.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		if opts.Std {
+			params.Set("std", "true")
+		}
+		setParam(params, "fields", strings.Join(opts.Fields, ","))
+	}
+	var statuses []*JobStatus
+	_, err := c.request("Search", http.MethodGet, jobsEndpoint, params, nil, &statuses)
+	return statuses, err
+}
+
+// StatusPage is like Status(), but gets a page of jobs at a time, which you
+// need to do for RepGroups with very large numbers of jobs. It also returns
+// the cursor of the next page, to use as the After of your next call, which is
+// empty if this was the last page.
+func (c *Client) StatusPage(ids []string, opts *PageOptions) ([]*JobStatus, string, error) {
+	if opts == nil || opts.Size < 1 {
+		return nil, "", fmt.Errorf("rest StatusPage(): a page Size is required")
+	}
+	params := url.Values{}
+	params.Set("page_size", strconv.Itoa(opts.Size))
+	setParam(params, "after", opts.After)
+	setParam(params, "sort", opts.Sort)
+	setParam(params, "state", string(opts.State))
+	if opts.Std {
+		params.Set("std", "true")
+	}
+	setParam(params, "fields", strings.Join(opts.Fields, ","))
+
+	var statuses []*JobStatus
+	resp, err := c.request("StatusPage", http.MethodGet, jobsEndpoint+strings.Join(ids, ","), params, nil, &statuses)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if matches := linkNextRegexp.FindStringSubmatch(resp.Header.Get("Link")); matches != nil {
+		nextURL, perr := url.Parse(matches[1])
+		if perr != nil {
+			return nil, "", perr
+		}
+		next = nextURL.Query().Get("after")
+	}
+	return statuses, next, nil
+}
+
+// Delete removes the given incomplete, non-running jobs from the queue,
+// returning the ones that were removed.
+func (c *Client) Delete(ids []string, filter *Filter) ([]*JobStatus, error) {
+	return c.target("Delete", http.MethodDelete, ids, "", filter, nil)
+}
+
+// Modify changes the given incomplete, non-running jobs, returning the ones
+// that were modified.
+func (c *Client) Modify(ids []string, filter *Filter, mod *Modification) ([]*JobStatus, error) {
+	params := url.Values{}
+	if mod != nil {
+		setIntParam(params, "priority", mod.Priority)
+		setIntParam(params, "retries", mod.Retries)
+		setIntParam(params, "override", mod.Override)
+		setParam(params, "memory", mod.Memory)
+		if mod.Time != nil {
+			params.Set("time", mod.Time.String())
+		}
+		setIntParam(params, "cpus", mod.CPUs)
+		setIntParam(params, "disk", mod.Disk)
+	}
+	return c.target("Modify", http.MethodPut, ids, "", filter, params)
+}
+
+// Kick retries the given buried jobs, returning the ones that were kicked.
+func (c *Client) Kick(ids []string, filter *Filter) ([]*JobStatus, error) {
+	return c.target("Kick", http.MethodPost, ids, kickSuffix, filter, nil)
+}
+
+// Kill kills the given running jobs, returning the ones that will be killed.
+func (c *Client) Kill(ids []string, filter *Filter) ([]*JobStatus, error) {
+	return c.target("Kill", http.MethodPost, ids, killSuffix, filter, nil)
+}
+
+// CancelArray stops any more elements of the array jobs with the given
+// ArrayIDs being created, returning the elements that had already been created
+// and are still incomplete.
+func (c *Client) CancelArray(arrayIDs []string) ([]*JobStatus, error) {
+	return c.target("CancelArray", http.MethodPost, arrayIDs, cancelSuffix, nil, nil)
+}
+
+// Warnings gets the scheduler's warnings. Getting them dismisses them, so
+// subsequent calls only return new warnings.
+func (c *Client) Warnings() ([]*Warning, error) {
+	var warnings []*Warning
+	_, err := c.request("Warnings", http.MethodGet, warningsEndpoint, nil, nil, &warnings)
+	return warnings, err
+}
+
+// BadServers gets the cloud servers that have gone bad.
+func (c *Client) BadServers() ([]*BadServer, error) {
+	var servers []*BadServer
+	_, err := c.request("BadServers", http.MethodGet, badServersEndpoint, nil, nil, &servers)
+	return servers, err
+}
+
+// ConfirmBadServer confirms that the bad server with the given ID is bad,
+// which terminates it if it still exists.
+func (c *Client) ConfirmBadServer(id string) error {
+	_, err := c.request("ConfirmBadServer", http.MethodDelete, badServersEndpoint, url.Values{"id": {id}}, nil, nil)
+	return err
+}
+
+// WebhookDeliveries gets the manager's most recent attempts to notify webhooks,
+// most recent first.
+func (c *Client) WebhookDeliveries() ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	_, err := c.request("WebhookDeliveries", http.MethodGet, webhooksEndpoint, nil, nil, &deliveries)
+	return deliveries, err
+}
+
+// Audit gets the entries in the manager's audit trail of user actions that pass
+// the filter (which can be nil), oldest first.
+func (c *Client) Audit(filter *jobqueue.AuditFilter) ([]*jobqueue.AuditEntry, error) {
+	params := url.Values{}
+	if filter != nil {
+		if !filter.From.IsZero() {
+			params.Set("from", filter.From.Format(time.RFC3339))
+		}
+		if !filter.To.IsZero() {
+			params.Set("to", filter.To.Format(time.RFC3339))
+		}
+		setParam(params, "user", filter.User)
+		if filter.Limit > 0 {
+			params.Set("limit", strconv.Itoa(filter.Limit))
+		}
+	}
+	var entries []*jobqueue.AuditEntry
+	_, err := c.request("Audit", http.MethodGet, auditEndpoint, params, nil, &entries)
+	return entries, err
+}
+
+// Spec gets the OpenAPI 3 specification of the REST API in JSON format.
+func (c *Client) Spec() ([]byte, error) {
+	var spec json.RawMessage
+	_, err := c.request("Spec", http.MethodGet, openAPIEndpoint, nil, nil, &spec)
+	return spec, err
+}
+
+// Events streams job state changes, calling cb with each event, until ctx is
+// cancelled or the connection is lost. filter can be nil. To resume after a
+// previous call returned, supply the ID of the last event you got as lastID,
+// and you will first be sent the events you missed; if some of those are no
+// longer available (eg. because the manager restarted), cb is first called
+// with a nil event and missed true. It
+// returns the ID of the last event you got (or the lastID you supplied if
+// none).
+func (c *Client) Events(ctx context.Context, filter *EventFilter, lastID uint64, cb func(event *Event, missed bool)) (uint64, error) {
+	params := url.Values{}
+	if filter != nil {
+		setParam(params, "repgroup", strings.Join(filter.RepGroups, ","))
+		setParam(params, "user", strings.Join(filter.Users, ","))
+		setParam(params, "key", strings.Join(filter.Keys, ","))
+	}
+	u := c.baseURL + eventsEndpoint
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return lastID, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(lastID, 10))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return lastID, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return lastID, Error{Op: "Events", StatusCode: resp.StatusCode, Msg: strings.TrimSpace(string(msg))}
+	}
+
+	// parse the server-sent events, which are blocks of "field: value" lines
+	// ended by a blank line
+	var eventType, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			switch eventType {
+			case "missed":
+				cb(nil, true)
+			case "state":
+				event := &Event{}
+				if err = json.Unmarshal([]byte(data), event); err != nil {
+					return lastID, err
+				}
+				lastID = event.ID
+				cb(event, false)
+			}
+			eventType, data = "", ""
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	err = scanner.Err()
+	if ctx.Err() != nil {
+		err = nil
+	}
+	return lastID, err
+}
+
+// target does a request that acts on the jobs with the given ids.
+func (c *Client) target(op, method string, ids []string, suffix string, filter *Filter, params url.Values) ([]*JobStatus, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("rest %s(): job keys or RepGroups are required", op)
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	if filter != nil {
+		setParam(params, "state", string(filter.State))
+		setIntParam(params, "exitcode", filter.Exitcode)
+		setParam(params, "fail_reason", filter.FailReason)
+	}
+	var statuses []*JobStatus
+	_, err := c.request(op, method, jobsEndpoint+strings.Join(ids, ",")+suffix, params, nil, &statuses)
+	return statuses, err
+}
+
+// request does an HTTP request, decoding a successful JSON response in to
+// result (if not nil), and returning an Error for unsuccessful responses.
+func (c *Client) request(op, method, endpoint string, params url.Values, body io.Reader, result interface{}) (*http.Response, error) {
+	u := c.baseURL + endpoint
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return resp, Error{Op: op, StatusCode: resp.StatusCode, Msg: strings.TrimSpace(string(msg))}
+	}
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+	}
+	return resp, err
+}
+
+// defaultsParams converts a JobViaJSON in to the query parameters that the
+// server takes as defaults when adding jobs: lists are comma separated, and
+// objects are JSON.
+func defaultsParams(defaults *jobqueue.JobViaJSON) (url.Values, error) {
+	params := url.Values{}
+	if defaults == nil {
+		return params, nil
+	}
+
+	v := reflect.ValueOf(defaults).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		switch name {
+		case "", "-", "cmd", "cmd_deps", "input_files", "output_files", "array":
+			continue
+		}
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			if field.Elem().Kind() != reflect.Struct {
+				field = field.Elem()
+			}
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			setParam(params, name, field.String())
+		case reflect.Bool:
+			if field.Bool() {
+				params.Set(name, "true")
+			}
+		case reflect.Int, reflect.Int64:
+			params.Set(name, strconv.FormatInt(field.Int(), 10))
+		case reflect.Float64:
+			params.Set(name, strconv.FormatFloat(field.Float(), 'g', -1, 64))
+		case reflect.Slice:
+			if field.Len() == 0 {
+				continue
+			}
+			if strs, ok := field.Interface().([]string); ok {
+				params.Set(name, strings.Join(strs, ","))
+				continue
+			}
+			fallthrough
+		default:
+			b, err := json.Marshal(field.Interface())
+			if err != nil {
+				return nil, err
+			}
+			params.Set(name, string(b))
+		}
+	}
+	return params, nil
+}
+
+// setParam sets a query parameter if the value isn't empty.
+func setParam(params url.Values, name, value string) {
+	if value != "" {
+		params.Set(name, value)
+	}
+}
+
+// setIntParam sets a query parameter if the value isn't nil.
+func setIntParam(params url.Values, name string, value *int) {
+	if value != nil {
+		params.Set(name, strconv.Itoa(*value))
+	}
+}
@@ -0,0 +1,390 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/VertebrateResequencing/wr/internal"
+	"github.com/VertebrateResequencing/wr/jobqueue"
+	jqs "github.com/VertebrateResequencing/wr/jobqueue/scheduler"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	Convey("The client's types match the server's OpenAPI spec", t, func() {
+		b, err := jobqueue.OpenAPISpec()
+		So(err, ShouldBeNil)
+		var spec struct {
+			Components struct {
+				Schemas map[string]struct {
+					Properties map[string]interface{}
+				}
+			}
+		}
+		err = json.Unmarshal(b, &spec)
+		So(err, ShouldBeNil)
+
+		for name, v := range map[string]interface{}{"JobStatus": JobStatus{}, "Warning": Warning{}, "BadServer": BadServer{}, "JobEvent": Event{}, "WebhookDelivery": WebhookDelivery{}} {
+			var specFields []string
+			for field := range spec.Components.Schemas[name].Properties {
+				specFields = append(specFields, field)
+			}
+			sort.Strings(specFields)
+
+			var fields []string
+			typ := reflect.TypeOf(v)
+			for i := 0; i < typ.NumField(); i++ {
+				fields = append(fields, typ.Field(i).Name)
+			}
+			sort.Strings(fields)
+
+			So(fields, ShouldResemble, specFields)
+		}
+	})
+
+	var lastReq *http.Request
+	var lastBody string
+	status := http.StatusOK
+	var link string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = r
+		b, _ := ioutil.ReadAll(r.Body)
+		lastBody = string(b)
+		if status != http.StatusOK {
+			http.Error(w, "no incomplete jobs matched your request", status)
+			return
+		}
+		if link != "" {
+			w.Header().Set("Link", link)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		switch r.URL.Path {
+		case warningsEndpoint:
+			w.Write([]byte(`[{"Msg":"oops","Count":2}]`))
+		case badServersEndpoint:
+			w.Write([]byte(`[{"ID":"s1","IsBad":true}]`))
+		case auditEndpoint:
+			w.Write([]byte(`[{"Time":"2018-06-01T12:00:00Z","User":"alice","Host":"h1","Action":"kill","Queue":"cmds","Keys":["k1"],"Detail":"1 of 1 requested"}]`))
+		case webhooksEndpoint:
+			w.Write([]byte(`[{"ID":1,"URL":"http://host/hook","Event":"job_buried","Attempts":2,"StatusCode":200,"Delivered":true}]`))
+		case eventsEndpoint:
+			w.Header().Set("Content-Type", "text/event-stream")
+			if r.Header.Get("Last-Event-ID") == "1" {
+				w.Write([]byte("event: missed\ndata: {}\n\n"))
+			}
+			w.Write([]byte(": keepalive\n\nid: 2\nevent: state\ndata: {\"ID\":2,\"Key\":\"k1\",\"To\":\"ready\"}\n\n"))
+		default:
+			w.Write([]byte(`[{"Key":"k1","State":"buried","Exitcode":1}]`))
+		}
+	}))
+	defer server.Close()
+	client := New(server.URL+"/", nil)
+
+	Convey("You can add jobs with defaults", t, func() {
+		cpus := 2
+		statuses, err := client.Add([]*jobqueue.JobViaJSON{{Cmd: "echo 1"}}, &jobqueue.JobViaJSON{
+			Cmd:       "ignored",
+			RepGrp:    "foo",
+			CPUs:      &cpus,
+			DepGrps:   []string{"a", "b"},
+			Cache:     true,
+			OnFailure: jobqueue.BehavioursViaJSON{{Run: "cleanup.sh"}},
+		})
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 1)
+		So(statuses[0].Key, ShouldEqual, "k1")
+		So(statuses[0].State, ShouldEqual, jobqueue.JobStateBuried)
+
+		So(lastReq.Method, ShouldEqual, http.MethodPost)
+		So(lastReq.URL.Path, ShouldEqual, jobsEndpoint)
+		query := lastReq.URL.Query()
+		So(query.Get("cmd"), ShouldBeEmpty)
+		So(query.Get("rep_grp"), ShouldEqual, "foo")
+		So(query.Get("cpus"), ShouldEqual, "2")
+		So(query.Get("dep_grps"), ShouldEqual, "a,b")
+		So(query.Get("cache"), ShouldEqual, "true")
+		So(query.Get("on_failure"), ShouldEqual, `[{"run":"cleanup.sh"}]`)
+		So(query.Get("cwd_matters"), ShouldBeEmpty)
+		So(lastBody, ShouldContainSubstring, `"cmd":"echo 1"`)
+	})
+
+	Convey("You can get the status of jobs", t, func() {
+		statuses, err := client.Status([]string{"foo", "bar"}, &StatusOptions{State: jobqueue.JobStateBuried, Limit: 1, Std: true, Fields: []string{"Key", "State"}})
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 1)
+		So(lastReq.Method, ShouldEqual, http.MethodGet)
+		So(lastReq.URL.Path, ShouldEqual, jobsEndpoint+"foo,bar")
+		So(lastReq.URL.RawQuery, ShouldEqual, "fields=Key%2CState&limit=1&state=buried&std=true")
+
+		Convey("Or a page at a time", func() {
+			_, _, err := client.StatusPage(nil, nil)
+			So(err, ShouldNotBeNil)
+
+			link = `</rest/v1/jobs/foo?after=abc&page_size=1>; rel="next"`
+			statuses, next, err := client.StatusPage([]string{"foo"}, &PageOptions{Size: 1, Sort: "-peakram"})
+			So(err, ShouldBeNil)
+			So(len(statuses), ShouldEqual, 1)
+			So(next, ShouldEqual, "abc")
+			So(lastReq.URL.RawQuery, ShouldEqual, "page_size=1&sort=-peakram")
+
+			link = ""
+			_, next, err = client.StatusPage([]string{"foo"}, &PageOptions{Size: 1, After: next})
+			So(err, ShouldBeNil)
+			So(next, ShouldBeEmpty)
+			So(lastReq.URL.RawQuery, ShouldEqual, "after=abc&page_size=1")
+		})
+	})
+
+	Convey("You can search the jobs that have run", t, func() {
+		_, err := client.Search(&jobqueue.JobSearch{}, nil)
+		So(err, ShouldNotBeNil)
+
+		exitcode := 0
+		since := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+		statuses, err := client.Search(&jobqueue.JobSearch{Since: since, Exitcode: &exitcode, Host: "h1", Cmd: "^echo"}, &SearchOptions{Limit: 2})
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 1)
+		So(lastReq.URL.Path, ShouldEqual, jobsEndpoint)
+		So(lastReq.URL.RawQuery, ShouldEqual, "cmd=%5Eecho&exitcode=0&host=h1&limit=2&since=2018-06-01T00%3A00%3A00Z")
+	})
+
+	Convey("You can act on jobs", t, func() {
+		exitcode := 1
+		_, err := client.Kick(nil, nil)
+		So(err, ShouldNotBeNil)
+
+		statuses, err := client.Kick([]string{"foo"}, &Filter{Exitcode: &exitcode})
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 1)
+		So(lastReq.Method, ShouldEqual, http.MethodPost)
+		So(lastReq.URL.Path, ShouldEqual, jobsEndpoint+"foo"+kickSuffix)
+		So(lastReq.URL.RawQuery, ShouldEqual, "exitcode=1")
+
+		_, err = client.Kill([]string{"k1"}, nil)
+		So(err, ShouldBeNil)
+		So(lastReq.URL.Path, ShouldEqual, jobsEndpoint+"k1"+killSuffix)
+
+		_, err = client.CancelArray([]string{"a1", "a2"})
+		So(err, ShouldBeNil)
+		So(lastReq.Method, ShouldEqual, http.MethodPost)
+		So(lastReq.URL.Path, ShouldEqual, jobsEndpoint+"a1,a2"+cancelSuffix)
+
+		_, err = client.Delete([]string{"foo"}, &Filter{State: jobqueue.JobStateBuried, FailReason: "oom"})
+		So(err, ShouldBeNil)
+		So(lastReq.Method, ShouldEqual, http.MethodDelete)
+		So(lastReq.URL.RawQuery, ShouldEqual, "fail_reason=oom&state=buried")
+
+		priority := 5
+		d := 2 * time.Hour
+		_, err = client.Modify([]string{"foo"}, nil, &Modification{Priority: &priority, Memory: "2G", Time: &d})
+		So(err, ShouldBeNil)
+		So(lastReq.Method, ShouldEqual, http.MethodPut)
+		So(lastReq.URL.RawQuery, ShouldEqual, "memory=2G&priority=5&time=2h0m0s")
+
+		Convey("Error responses are returned as Errors", func() {
+			status = http.StatusNotFound
+			defer func() { status = http.StatusOK }()
+			_, err := client.Delete([]string{"foo"}, nil)
+			So(err, ShouldNotBeNil)
+			rerr, ok := err.(Error)
+			So(ok, ShouldBeTrue)
+			So(rerr.Op, ShouldEqual, "Delete")
+			So(rerr.StatusCode, ShouldEqual, http.StatusNotFound)
+			So(rerr.Msg, ShouldEqual, "no incomplete jobs matched your request")
+		})
+	})
+
+	Convey("You can stream events", t, func() {
+		var events []*Event
+		var missed int
+		cb := func(event *Event, wasMissed bool) {
+			if wasMissed {
+				missed++
+				return
+			}
+			events = append(events, event)
+		}
+		lastID, err := client.Events(context.Background(), &EventFilter{RepGroups: []string{"foo"}}, 0, cb)
+		So(err, ShouldBeNil)
+		So(lastID, ShouldEqual, 2)
+		So(missed, ShouldEqual, 0)
+		So(len(events), ShouldEqual, 1)
+		So(*events[0], ShouldResemble, Event{ID: 2, Key: "k1", To: jobqueue.JobStateReady})
+		So(lastReq.URL.RawQuery, ShouldEqual, "repgroup=foo")
+
+		lastID, err = client.Events(context.Background(), nil, 1, cb)
+		So(err, ShouldBeNil)
+		So(lastID, ShouldEqual, 2)
+		So(missed, ShouldEqual, 1)
+		So(len(events), ShouldEqual, 2)
+	})
+
+	Convey("You can get warnings and bad servers", t, func() {
+		warnings, err := client.Warnings()
+		So(err, ShouldBeNil)
+		So(len(warnings), ShouldEqual, 1)
+		So(*warnings[0], ShouldResemble, Warning{Msg: "oops", Count: 2})
+
+		servers, err := client.BadServers()
+		So(err, ShouldBeNil)
+		So(len(servers), ShouldEqual, 1)
+		So(servers[0].ID, ShouldEqual, "s1")
+
+		err = client.ConfirmBadServer("s1")
+		So(err, ShouldBeNil)
+		So(lastReq.Method, ShouldEqual, http.MethodDelete)
+		So(lastReq.URL.RawQuery, ShouldEqual, "id=s1")
+	})
+
+	Convey("You can get webhook deliveries", t, func() {
+		deliveries, err := client.WebhookDeliveries()
+		So(err, ShouldBeNil)
+		So(len(deliveries), ShouldEqual, 1)
+		So(*deliveries[0], ShouldResemble, WebhookDelivery{ID: 1, URL: "http://host/hook", Event: jobqueue.WebhookJobBuried, Attempts: 2, StatusCode: 200, Delivered: true})
+		So(lastReq.URL.Path, ShouldEqual, webhooksEndpoint)
+	})
+
+	Convey("You can get the audit trail", t, func() {
+		entries, err := client.Audit(nil)
+		So(err, ShouldBeNil)
+		So(lastReq.URL.RawQuery, ShouldBeEmpty)
+		So(len(entries), ShouldEqual, 1)
+		So(entries[0].Time.Equal(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)), ShouldBeTrue)
+		So(entries[0].User, ShouldEqual, "alice")
+		So(entries[0].Action, ShouldEqual, jobqueue.AuditKill)
+		So(entries[0].Keys, ShouldResemble, []string{"k1"})
+
+		from := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+		_, err = client.Audit(&jobqueue.AuditFilter{From: from, User: "alice", Limit: 5})
+		So(err, ShouldBeNil)
+		So(lastReq.URL.Path, ShouldEqual, auditEndpoint)
+		So(lastReq.URL.RawQuery, ShouldEqual, "from=2018-06-01T00%3A00%3A00Z&limit=5&user=alice")
+	})
+}
+
+func TestClientWithServer(t *testing.T) {
+	config := internal.ConfigLoad("development", true)
+	serverConfig := jobqueue.ServerConfig{
+		Port:            config.ManagerPort,
+		WebPort:         config.ManagerWeb,
+		SchedulerName:   "local",
+		SchedulerConfig: &jqs.ConfigLocal{Shell: config.RunnerExecShell},
+		DBFile:          config.ManagerDbFile,
+		DBFileBackup:    config.ManagerDbFile + "_bk",
+		Deployment:      config.Deployment,
+	}
+	jobqueue.ServerInterruptTime = 10 * time.Millisecond
+	jobqueue.ServerReserveTicker = 10 * time.Millisecond
+
+	Convey("Once a real server is up, the client can use it", t, func() {
+		server, _, err := jobqueue.Serve(serverConfig)
+		So(err, ShouldBeNil)
+		defer server.Stop(true)
+		client := New("http://localhost:"+config.ManagerWeb, nil)
+
+		spec, err := client.Spec()
+		So(err, ShouldBeNil)
+		So(string(spec), ShouldContainSubstring, `"openapi":"3.`)
+
+		events := make(chan *Event, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go client.Events(ctx, &EventFilter{RepGroups: []string{"clientRepGrp"}}, 0, func(event *Event, missed bool) {
+			if event != nil {
+				events <- event
+			}
+		})
+		<-time.After(100 * time.Millisecond)
+
+		statuses, err := client.Add([]*jobqueue.JobViaJSON{{Cmd: "echo client 1"}, {Cmd: "echo client 2"}}, &jobqueue.JobViaJSON{RepGrp: "clientRepGrp"})
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 2)
+		So(statuses[0].RepGroup, ShouldEqual, "clientRepGrp")
+		So(statuses[0].State, ShouldEqual, jobqueue.JobStateReady)
+
+		var event *Event
+		select {
+		case event = <-events:
+		case <-time.After(5 * time.Second):
+		}
+		So(event, ShouldNotBeNil)
+		So(event.RepGroup, ShouldEqual, "clientRepGrp")
+		So(event.To, ShouldEqual, jobqueue.JobStateReady)
+
+		statuses, err = client.Status([]string{"clientRepGrp"}, &StatusOptions{Fields: []string{"Key", "State"}})
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 2)
+		So(statuses[0].Key, ShouldNotBeBlank)
+		So(statuses[0].Cmd, ShouldBeBlank)
+
+		page, next, err := client.StatusPage([]string{"clientRepGrp"}, &PageOptions{Size: 1})
+		So(err, ShouldBeNil)
+		So(len(page), ShouldEqual, 1)
+		So(next, ShouldNotBeBlank)
+		page2, next, err := client.StatusPage([]string{"clientRepGrp"}, &PageOptions{Size: 1, After: next})
+		So(err, ShouldBeNil)
+		So(len(page2), ShouldEqual, 1)
+		So(page2[0].Key, ShouldNotEqual, page[0].Key)
+		So(next, ShouldBeBlank)
+
+		priority := 5
+		statuses, err = client.Modify([]string{"clientRepGrp"}, nil, &Modification{Priority: &priority, Memory: "2G"})
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 2)
+		So(statuses[0].ExpectedRAM, ShouldEqual, 2048)
+
+		_, err = client.Kick([]string{"clientRepGrp"}, nil)
+		So(err, ShouldNotBeNil)
+		rerr, ok := err.(Error)
+		So(ok, ShouldBeTrue)
+		So(rerr.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		_, err = client.CancelArray([]string{"noSuchArray"})
+		So(err, ShouldNotBeNil)
+		rerr, ok = err.(Error)
+		So(ok, ShouldBeTrue)
+		So(rerr.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		warnings, err := client.Warnings()
+		So(err, ShouldBeNil)
+		So(len(warnings), ShouldEqual, 0)
+
+		servers, err := client.BadServers()
+		So(err, ShouldBeNil)
+		So(len(servers), ShouldEqual, 0)
+
+		statuses, err = client.Delete([]string{"clientRepGrp"}, nil)
+		So(err, ShouldBeNil)
+		So(len(statuses), ShouldEqual, 2)
+
+		entries, err := client.Audit(&jobqueue.AuditFilter{Limit: 2})
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 2)
+		So(entries[0].Action, ShouldEqual, jobqueue.AuditModify)
+		So(entries[1].Action, ShouldEqual, jobqueue.AuditDelete)
+	})
+}
@@ -19,6 +19,7 @@
 package jobqueue
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -29,6 +30,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -183,6 +185,54 @@ func TestREST(t *testing.T) {
 					So(len(jstati), ShouldEqual, 1)
 					So(jstati[0].Similar, ShouldEqual, 1)
 				})
+
+				Convey("Or you can get them a page at a time, with only the fields you want", func() {
+					response, err := http.Get(jobsEndPoint + "/rp1?page_size=1&fields=key,state")
+					So(err, ShouldBeNil)
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+					responseData, err := ioutil.ReadAll(response.Body)
+					So(err, ShouldBeNil)
+
+					var page1 []map[string]interface{}
+					err = json.Unmarshal(responseData, &page1)
+					So(err, ShouldBeNil)
+					So(page1, ShouldResemble, []map[string]interface{}{{"Key": "db1e7d99becace3306c1c2470331c78e", "State": "ready"}})
+
+					link := response.Header.Get("Link")
+					So(link, ShouldStartWith, "</rest/v1/jobs/rp1?")
+					So(link, ShouldEndWith, `>; rel="next"`)
+					next := strings.TrimSuffix(strings.TrimPrefix(link, "</rest/v1/jobs"), `>; rel="next"`)
+
+					response, err = http.Get(jobsEndPoint + next)
+					So(err, ShouldBeNil)
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+					So(response.Header.Get("Link"), ShouldBeEmpty)
+					responseData, err = ioutil.ReadAll(response.Body)
+					So(err, ShouldBeNil)
+
+					var page2 []map[string]interface{}
+					err = json.Unmarshal(responseData, &page2)
+					So(err, ShouldBeNil)
+					So(len(page2), ShouldEqual, 1)
+					So(page2[0]["Key"], ShouldEqual, "de6d167c58701e55f5b9f9e1e91d7807")
+
+					response, err = http.Get(jobsEndPoint + "/rp1?page_size=1&limit=1")
+					So(err, ShouldBeNil)
+					So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+
+					response, err = http.Get(jobsEndPoint + "/rp1?page_size=1&sort=-peakram")
+					So(err, ShouldBeNil)
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+
+					defaultMax := ServerMaxSortJobs
+					ServerMaxSortJobs = 1
+					defer func() {
+						ServerMaxSortJobs = defaultMax
+					}()
+					response, err = http.Get(jobsEndPoint + "/rp1?page_size=1&sort=-peakram")
+					So(err, ShouldBeNil)
+					So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+				})
 			})
 
 			Convey("Once one of the jobs has changed state", func() {
@@ -207,6 +257,24 @@ func TestREST(t *testing.T) {
 				So(job.Exited, ShouldBeTrue)
 				So(job.Exitcode, ShouldEqual, 1)
 
+				Convey("You can GET metrics for Prometheus to scrape", func() {
+					response, err := http.Get(baseURL + "/metrics")
+					So(err, ShouldBeNil)
+					So(response.Header.Get("Content-Type"), ShouldEqual, metricsContentType)
+					responseData, err := ioutil.ReadAll(response.Body)
+					So(err, ShouldBeNil)
+					response.Body.Close()
+					metrics := string(responseData)
+					So(metrics, ShouldContainSubstring, "# TYPE wr_jobs gauge\n")
+					So(metrics, ShouldContainSubstring, `wr_jobs{queue="cmds",state="ready"} 2`+"\n")
+					So(metrics, ShouldContainSubstring, `wr_jobs{queue="cmds",state="buried"} 1`+"\n")
+					So(metrics, ShouldContainSubstring, "wr_cloud_servers 0\n")
+					So(metrics, ShouldContainSubstring, `wr_job_wait_seconds_count{req_grp="echo"} 1`+"\n")
+					So(metrics, ShouldContainSubstring, `wr_job_wall_time_seconds_count{req_grp="echo"} 1`+"\n")
+					So(metrics, ShouldContainSubstring, `wr_job_peak_ram_bytes_bucket{req_grp="echo",le="+Inf"} 1`+"\n")
+					So(metrics, ShouldContainSubstring, `wr_request_duration_seconds_count{method="jstart"} 1`+"\n")
+				})
+
 				Convey("You can GET all jobs by state, and get their stdout/err", func() {
 					response, err := http.Get(jobsEndPoint + "/?state=ready")
 					So(err, ShouldBeNil)
@@ -266,9 +334,200 @@ func TestREST(t *testing.T) {
 					So(len(jstati), ShouldEqual, 1)
 					So(jstati[0].Key, ShouldEqual, "de6d167c58701e55f5b9f9e1e91d7807")
 				})
+
+				restDo := func(method, url string) (*http.Response, []jstatus) {
+					req, err := http.NewRequest(method, url, nil)
+					So(err, ShouldBeNil)
+					response, err := http.DefaultClient.Do(req)
+					So(err, ShouldBeNil)
+					responseData, err := ioutil.ReadAll(response.Body)
+					So(err, ShouldBeNil)
+					var jstati []jstatus
+					if response.StatusCode == http.StatusOK {
+						err = json.Unmarshal(responseData, &jstati)
+						So(err, ShouldBeNil)
+					}
+					return response, jstati
+				}
+
+				Convey("You can GET the jobs that have run by searching", func() {
+					response, jstati := restDo(http.MethodGet, jobsEndPoint+"/?exitcode=1&cmd=%5Eecho+3&since="+url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339)))
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+					So(len(jstati), ShouldEqual, 1)
+					So(jstati[0].Key, ShouldEqual, "db1e7d99becace3306c1c2470331c78e")
+					So(jstati[0].State, ShouldEqual, "buried")
+
+					response, jstati = restDo(http.MethodGet, jobsEndPoint+"/?exitcode=0")
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+					So(len(jstati), ShouldEqual, 0)
+
+					response, _ = restDo(http.MethodGet, jobsEndPoint+"/?cmd=(")
+					So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+					response, _ = restDo(http.MethodGet, jobsEndPoint+"/?since=yesterday")
+					So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+					response, _ = restDo(http.MethodGet, jobsEndPoint+"/rp1?exitcode=1")
+					So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+				})
+
+				Convey("You can POST to kick buried jobs by RepGroup and exitcode", func() {
+					response, jstati := restDo(http.MethodPost, jobsEndPoint+"/rp1/kick?exitcode=2")
+					So(response.StatusCode, ShouldEqual, http.StatusNotFound)
+					So(len(jstati), ShouldEqual, 0)
+
+					response, jstati = restDo(http.MethodPost, jobsEndPoint+"/rp1/kick?exitcode=1")
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+					So(len(jstati), ShouldEqual, 1)
+					So(jstati[0].Key, ShouldEqual, "db1e7d99becace3306c1c2470331c78e")
+					So(jstati[0].State, ShouldEqual, "ready")
+
+					response, _ = restDo(http.MethodPost, jobsEndPoint+"/rp1/foo")
+					So(response.StatusCode, ShouldEqual, http.StatusNotFound)
+				})
+
+				Convey("You can PUT modifications to jobs", func() {
+					response, _ := restDo(http.MethodPut, jobsEndPoint+"/rp1")
+					So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+					response, _ = restDo(http.MethodPut, jobsEndPoint+"/rp1?priority=256")
+					So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+
+					response, jstati := restDo(http.MethodPut, jobsEndPoint+"/rp1?state=ready&priority=5&memory=2G&cpus=3")
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+					So(len(jstati), ShouldEqual, 1)
+					So(jstati[0].Key, ShouldEqual, "de6d167c58701e55f5b9f9e1e91d7807")
+					So(jstati[0].ExpectedRAM, ShouldEqual, 2048)
+					So(jstati[0].Cores, ShouldEqual, 3)
+				})
+
+				Convey("You can DELETE non-running jobs", func() {
+					response, jstati := restDo(http.MethodDelete, jobsEndPoint+"/db1e7d99becace3306c1c2470331c78e?fail_reason=")
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+					So(len(jstati), ShouldEqual, 1)
+					So(jstati[0].Key, ShouldEqual, "db1e7d99becace3306c1c2470331c78e")
+					So(jstati[0].State, ShouldEqual, "deleted")
+
+					response, err := http.Get(baseURL + restAuditEndpoint + "?limit=1")
+					So(err, ShouldBeNil)
+					So(response.StatusCode, ShouldEqual, http.StatusOK)
+					var entries []*AuditEntry
+					err = json.NewDecoder(response.Body).Decode(&entries)
+					So(err, ShouldBeNil)
+					So(len(entries), ShouldEqual, 1)
+					So(entries[0].Action, ShouldEqual, AuditDelete)
+					So(entries[0].Keys, ShouldResemble, []string{"db1e7d99becace3306c1c2470331c78e"})
+					So(entries[0].Detail, ShouldEqual, "1 of 1 requested")
+					So(entries[0].Peer, ShouldNotBeBlank)
+
+					response, _ = restDo(http.MethodDelete, jobsEndPoint+"/db1e7d99becace3306c1c2470331c78e")
+					So(response.StatusCode, ShouldEqual, http.StatusNotFound)
+					response, _ = restDo(http.MethodDelete, jobsEndPoint+"/")
+					So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+				})
 			})
 		})
 
+		Convey("The OpenAPI spec describes the responses of every endpoint", func() {
+			spec, err := getOpenAPISpec(baseURL)
+			So(err, ShouldBeNil)
+			So(spec["openapi"], ShouldStartWith, "3.")
+			So(len(spec["paths"].(map[string]interface{})), ShouldEqual, 11)
+
+			inputJobs := []*JobViaJSON{{Cmd: "echo spec 1", RepGrp: "specRepGrp"}, {Cmd: "echo spec 2", RepGrp: "specRepGrp", DepGrps: []string{"spec"}}}
+			jsonValue, err := json.Marshal(inputJobs)
+			So(err, ShouldBeNil)
+			response, err := http.Post(jobsEndPoint+"/", "application/json", bytes.NewBuffer(jsonValue))
+			So(err, ShouldBeNil)
+			So(response.StatusCode, ShouldEqual, http.StatusCreated)
+			So(checkOpenAPIResponse(spec, restJobsEndpoint, http.MethodPost, response), ShouldBeNil)
+
+			server.simutex.Lock()
+			server.schedIssues["spec"] = &schedulerIssue{Msg: "spec", FirstDate: time.Now().Unix(), LastDate: time.Now().Unix(), Count: 1}
+			server.simutex.Unlock()
+
+			// GETs first, so that they see the jobs before they're deleted
+			var ops [][2]string
+			for path, methods := range spec["paths"].(map[string]interface{}) {
+				for method := range methods.(map[string]interface{}) {
+					op := [2]string{path, strings.ToUpper(method)}
+					if op[1] == http.MethodGet {
+						ops = append([][2]string{op}, ops...)
+					} else {
+						ops = append(ops, op)
+					}
+				}
+			}
+			for _, op := range ops {
+				path, method := op[0], op[1]
+				u := baseURL + strings.Replace(path, "{ids}", "specRepGrp", 1)
+				if path == restJobsEndpoint+"{ids}" && method == http.MethodGet {
+					u += "?page_size=1&sort=start"
+				}
+				req, err := http.NewRequest(method, u, nil)
+				So(err, ShouldBeNil)
+				response, err := http.DefaultClient.Do(req)
+				So(err, ShouldBeNil)
+				So(checkOpenAPIResponse(spec, path, method, response), ShouldBeNil)
+			}
+
+			response, err = http.Get(baseURL + restAuditEndpoint)
+			So(err, ShouldBeNil)
+			So(response.StatusCode, ShouldEqual, http.StatusOK)
+			So(checkOpenAPIResponse(spec, restAuditEndpoint, http.MethodGet, response), ShouldBeNil)
+		})
+
+		Convey("GET-only endpoints reject other methods", func() {
+			for _, endpoint := range []string{restOpenAPIEndpoint, restEventsEndpoint, restWebhooksEndpoint, restMetricsEndpoint, restAuditEndpoint} {
+				response, err := http.Post(baseURL+endpoint, "application/json", nil)
+				So(err, ShouldBeNil)
+				So(response.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+				So(response.Header.Get("Allow"), ShouldEqual, http.MethodGet)
+			}
+		})
+
+		Convey("You can stream job state changes as server-sent events", func() {
+			response, err := http.Get(baseURL + restEventsEndpoint + "?repgroup=eventsRepGrp")
+			So(err, ShouldBeNil)
+			defer response.Body.Close()
+			So(response.StatusCode, ShouldEqual, http.StatusOK)
+			So(response.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+
+			inputJobs := []*JobViaJSON{{Cmd: "echo events", RepGrp: "eventsRepGrp"}, {Cmd: "echo other", RepGrp: "otherRepGrp"}}
+			jsonValue, err := json.Marshal(inputJobs)
+			So(err, ShouldBeNil)
+			_, err = http.Post(jobsEndPoint+"/", "application/json", bytes.NewBuffer(jsonValue))
+			So(err, ShouldBeNil)
+
+			lines := make(chan string)
+			go func() {
+				scanner := bufio.NewScanner(response.Body)
+				for scanner.Scan() {
+					if strings.HasPrefix(scanner.Text(), "data: ") {
+						lines <- strings.TrimPrefix(scanner.Text(), "data: ")
+					}
+				}
+				close(lines)
+			}()
+
+			spec, err := getOpenAPISpec(baseURL)
+			So(err, ShouldBeNil)
+			schema, err := openAPIContentSchema(spec, restEventsEndpoint, http.MethodGet, http.StatusOK, "text/event-stream")
+			So(err, ShouldBeNil)
+
+			var event jobEvent
+			select {
+			case line := <-lines:
+				err = json.Unmarshal([]byte(line), &event)
+				So(err, ShouldBeNil)
+				var v interface{}
+				err = json.Unmarshal([]byte(line), &v)
+				So(err, ShouldBeNil)
+				So(validateOpenAPI(v, schema, spec["components"].(map[string]interface{})["schemas"].(map[string]interface{}), "event"), ShouldBeNil)
+			case <-time.After(5 * time.Second):
+			}
+			So(event.ID, ShouldBeGreaterThan, 0)
+			So(event.RepGroup, ShouldEqual, "eventsRepGrp")
+			So(event.To, ShouldEqual, JobStateReady)
+		})
+
 		Convey("You must supply certain properties when adding jobs", func() {
 			inputJobs := []*JobViaJSON{{RepGrp: "foo"}}
 			jsonValue, err := json.Marshal(inputJobs)
@@ -417,3 +676,150 @@ func TestREST(t *testing.T) {
 		server.Stop(true)
 	}
 }
+
+// getOpenAPISpec gets the OpenAPI spec the server at baseURL is serving.
+func getOpenAPISpec(baseURL string) (map[string]interface{}, error) {
+	response, err := http.Get(baseURL + restOpenAPIEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var spec map[string]interface{}
+	err = json.NewDecoder(response.Body).Decode(&spec)
+	return spec, err
+}
+
+// openAPIContentSchema returns the schema the spec gives for the content of the
+// given response of an operation, or an error if the spec doesn't describe such
+// a response. A mediaType of "" just checks that the response is described.
+func openAPIContentSchema(spec map[string]interface{}, path, method string, status int, mediaType string) (map[string]interface{}, error) {
+	op, _ := spec["paths"].(map[string]interface{})[path].(map[string]interface{})[strings.ToLower(method)].(map[string]interface{})
+	if op == nil {
+		return nil, fmt.Errorf("%s %s is not in the spec", method, path)
+	}
+	response, _ := op["responses"].(map[string]interface{})[fmt.Sprintf("%d", status)].(map[string]interface{})
+	if response == nil {
+		return nil, fmt.Errorf("%s %s does not describe a %d response", method, path, status)
+	}
+	if mediaType == "" {
+		return nil, nil
+	}
+	content, _ := response["content"].(map[string]interface{})[mediaType].(map[string]interface{})
+	if content == nil {
+		return nil, fmt.Errorf("%s %s %d response does not describe %s content", method, path, status, mediaType)
+	}
+	return content["schema"].(map[string]interface{}), nil
+}
+
+// checkOpenAPIResponse checks that a response to a request for the given
+// operation is described by the spec, and that its body is valid according to
+// the schema for it. The body of event streams isn't read, since it never ends.
+func checkOpenAPIResponse(spec map[string]interface{}, path, method string, response *http.Response) error {
+	defer response.Body.Close()
+	mediaType := strings.TrimSpace(strings.Split(response.Header.Get("Content-Type"), ";")[0])
+	if mediaType == "text/event-stream" {
+		_, err := openAPIContentSchema(spec, path, method, response.StatusCode, mediaType)
+		return err
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		mediaType = ""
+	}
+	schema, err := openAPIContentSchema(spec, path, method, response.StatusCode, mediaType)
+	if err != nil || mediaType != "application/json" {
+		return err
+	}
+	var v interface{}
+	if err = json.Unmarshal(body, &v); err != nil {
+		return err
+	}
+	return validateOpenAPI(v, schema, spec["components"].(map[string]interface{})["schemas"].(map[string]interface{}), method+" "+path)
+}
+
+// validateOpenAPI checks that v, decoded from JSON, is valid according to the
+// given schema of our spec. Unlike OpenAPI in general, objects may not have
+// properties their schema doesn't mention, since our schemas are meant to be
+// complete.
+func validateOpenAPI(v interface{}, schema map[string]interface{}, schemas map[string]interface{}, at string) error {
+	if ref, isRef := schema["$ref"].(string); isRef {
+		return validateOpenAPI(v, schemas[strings.TrimPrefix(ref, openAPISchemaPrefix)].(map[string]interface{}), schemas, at)
+	}
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s is null", at)
+	}
+	if all, isAll := schema["allOf"].([]interface{}); isAll {
+		for _, sub := range all {
+			if err := validateOpenAPI(v, sub.(map[string]interface{}), schemas, at); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object", at)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for name, value := range obj {
+			var sub map[string]interface{}
+			if properties != nil {
+				sub, _ = properties[name].(map[string]interface{})
+			} else {
+				sub = additional
+			}
+			if sub == nil {
+				if properties == nil {
+					continue
+				}
+				return fmt.Errorf("%s has unexpected property %s", at, name)
+			}
+			if err := validateOpenAPI(value, sub, schemas, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an array", at)
+		}
+		for i, value := range arr {
+			if err := validateOpenAPI(value, schema["items"].(map[string]interface{}), schemas, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s is not a string", at)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s is not a date-time: %s", at, err)
+			}
+		}
+	case "integer":
+		num, ok := v.(float64)
+		if !ok || num != float64(int64(num)) {
+			return fmt.Errorf("%s is not an integer", at)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s is not a number", at)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s is not a boolean", at)
+		}
+	}
+	return nil
+}
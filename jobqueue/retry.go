@@ -0,0 +1,214 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for deciding if and when failed Jobs should be
+// tried again.
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetryPolicy describes how a Job should be retried if it fails, refining its
+// Retries count.
+type RetryPolicy struct {
+	// Delay is how long to wait before retrying after the first failure.
+	// Defaults to ClientReleaseDelay.
+	Delay time.Duration
+
+	// Multiplier is what Delay is multiplied by after each subsequent failure,
+	// for exponential backoff. Values less than 1 are treated as 1, ie. a
+	// fixed delay.
+	Multiplier float64
+
+	// MaxDelay, if greater than 0, caps the delay between retries.
+	MaxDelay time.Duration
+
+	// RetryExitCodes, if set, are the only exit codes of Cmd that will be
+	// retried; if Cmd exits with any other non-zero code the Job is buried
+	// immediately.
+	RetryExitCodes []int
+
+	// BuryExitCodes are exit codes of Cmd that are never retried, eg. 2 for
+	// usage errors; the Job is buried immediately.
+	BuryExitCodes []int
+
+	// InfraRetries, if greater than 0, is the number of times to retry a Job
+	// that failed due to infrastructure problems (see
+	// FailReasonIsInfrastructure()). These failures then do not use up the
+	// Job's Retries, which are only used for failures of the Cmd itself. If 0,
+	// infrastructure failures use up Retries like any other failure.
+	InfraRetries uint8
+}
+
+// delay returns how long to wait before retrying a Job that has failed the
+// given number of times in a row.
+func (p *RetryPolicy) delay(failures int) time.Duration {
+	d := p.Delay
+	if d <= 0 {
+		d = ClientReleaseDelay
+	}
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	for i := 1; i < failures && mult > 1; i++ {
+		d = time.Duration(float64(d) * mult)
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// buryExitCode tells you if a Cmd that exited with the given non-zero code
+// should be buried immediately instead of retried.
+func (p *RetryPolicy) buryExitCode(exitcode int) bool {
+	for _, code := range p.BuryExitCodes {
+		if code == exitcode {
+			return true
+		}
+	}
+	if len(p.RetryExitCodes) == 0 {
+		return false
+	}
+	for _, code := range p.RetryExitCodes {
+		if code == exitcode {
+			return false
+		}
+	}
+	return true
+}
+
+// RetryPolicyViaJSON describes a RetryPolicy in a form suitable for JSON and
+// YAML job definitions.
+type RetryPolicyViaJSON struct {
+	// Delay and MaxDelay are durations with a unit suffix, eg. 30s.
+	Delay          string  `json:"delay"`
+	Multiplier     float64 `json:"multiplier"`
+	MaxDelay       string  `json:"max_delay"`
+	RetryExitCodes []int   `json:"retry_exit_codes"`
+	BuryExitCodes  []int   `json:"bury_exit_codes"`
+	InfraRetries   int     `json:"infra_retries"`
+}
+
+// RetryPolicy converts to a RetryPolicy, returning an error if any of the
+// values are invalid.
+func (r *RetryPolicyViaJSON) RetryPolicy() (p *RetryPolicy, err error) {
+	p = &RetryPolicy{
+		Multiplier:     r.Multiplier,
+		RetryExitCodes: r.RetryExitCodes,
+		BuryExitCodes:  r.BuryExitCodes,
+	}
+	if r.Delay != "" {
+		p.Delay, err = time.ParseDuration(r.Delay)
+		if err != nil {
+			err = fmt.Errorf("retry delay value (%s) was not specified correctly: %s", r.Delay, err)
+			return
+		}
+	}
+	if r.MaxDelay != "" {
+		p.MaxDelay, err = time.ParseDuration(r.MaxDelay)
+		if err != nil {
+			err = fmt.Errorf("retry max_delay value (%s) was not specified correctly: %s", r.MaxDelay, err)
+			return
+		}
+	}
+	if r.Multiplier < 0 {
+		err = fmt.Errorf("retry multiplier value (%g) may not be negative", r.Multiplier)
+		return
+	}
+	if r.InfraRetries < 0 || r.InfraRetries > 255 {
+		err = fmt.Errorf("infra_retries value (%d) is not in the range 0..255", r.InfraRetries)
+		return
+	}
+	p.InfraRetries = uint8(r.InfraRetries)
+	return
+}
+
+// FailReasonIsInfrastructure tells you if the given FailReason* is due to a
+// problem with the infrastructure the Job was running on, rather than with the
+// Job's Cmd.
+func FailReasonIsInfrastructure(reason string) bool {
+	switch reason {
+	case FailReasonLost, FailReasonMount, FailReasonSignal:
+		return true
+	}
+	return false
+}
+
+// infraFailure tells you if a failure of the Job for the given FailReason*
+// uses up its InfraUntilBuried instead of its UntilBuried, which is only the
+// case if it has a RetryPolicy with InfraRetries.
+func (j *Job) infraFailure(reason string) bool {
+	return j.RetryPolicy != nil && j.RetryPolicy.InfraRetries > 0 && FailReasonIsInfrastructure(reason)
+}
+
+// resetRetries should be called when a Job is added or kicked, to give it its
+// full number of retries.
+func (j *Job) resetRetries() {
+	j.UntilBuried = j.Retries + 1
+	j.InfraUntilBuried = 0
+	if j.RetryPolicy != nil && j.RetryPolicy.InfraRetries > 0 {
+		j.InfraUntilBuried = j.RetryPolicy.InfraRetries + 1
+	}
+}
+
+// willRetry tells you if the Job would be retried instead of buried were it to
+// fail now for the given FailReason*, based on the retries counter that
+// failed() would use up.
+func (j *Job) willRetry(reason string) bool {
+	if j.infraFailure(reason) {
+		return j.InfraUntilBuried > 1
+	}
+	return j.UntilBuried > 1
+}
+
+// failed uses up one of the Job's retries (an infrastructure retry if it has
+// a RetryPolicy with InfraRetries and its FailReason is for an infrastructure
+// problem), and returns true if it should now be buried.
+func (j *Job) failed() (bury bool) {
+	if j.infraFailure(j.FailReason) {
+		if j.InfraUntilBuried > 0 {
+			j.InfraUntilBuried--
+		}
+		return j.InfraUntilBuried == 0
+	}
+	if j.UntilBuried > 0 {
+		j.UntilBuried--
+	}
+	return j.UntilBuried == 0
+}
+
+// releaseDelay returns how long the Job should wait in the delay queue after
+// being released, which is ClientReleaseDelay unless it has a RetryPolicy.
+func (j *Job) releaseDelay() time.Duration {
+	if j.RetryPolicy == nil {
+		return ClientReleaseDelay
+	}
+	failures := int(j.Retries) + 1 - int(j.UntilBuried)
+	if j.InfraUntilBuried > 0 {
+		failures += int(j.RetryPolicy.InfraRetries) + 1 - int(j.InfraUntilBuried)
+	}
+	return j.RetryPolicy.delay(failures)
+}
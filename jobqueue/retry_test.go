@@ -0,0 +1,140 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	Convey("RetryPolicies back off exponentially up to a maximum", t, func() {
+		p := &RetryPolicy{}
+		So(p.delay(1), ShouldEqual, ClientReleaseDelay)
+		So(p.delay(5), ShouldEqual, ClientReleaseDelay)
+
+		p = &RetryPolicy{Delay: 1 * time.Second, Multiplier: 2, MaxDelay: 10 * time.Second}
+		So(p.delay(0), ShouldEqual, 1*time.Second)
+		So(p.delay(1), ShouldEqual, 1*time.Second)
+		So(p.delay(2), ShouldEqual, 2*time.Second)
+		So(p.delay(4), ShouldEqual, 8*time.Second)
+		So(p.delay(5), ShouldEqual, 10*time.Second)
+		So(p.delay(255), ShouldEqual, 10*time.Second)
+
+		p.Multiplier = 0.5
+		So(p.delay(3), ShouldEqual, 1*time.Second)
+	})
+
+	Convey("RetryPolicies decide which exit codes to bury", t, func() {
+		p := &RetryPolicy{}
+		So(p.buryExitCode(1), ShouldBeFalse)
+
+		p.BuryExitCodes = []int{2}
+		So(p.buryExitCode(1), ShouldBeFalse)
+		So(p.buryExitCode(2), ShouldBeTrue)
+
+		p.RetryExitCodes = []int{137, 2}
+		So(p.buryExitCode(137), ShouldBeFalse)
+		So(p.buryExitCode(1), ShouldBeTrue)
+		So(p.buryExitCode(2), ShouldBeTrue)
+	})
+
+	Convey("RetryPolicies can be specified via JSON", t, func() {
+		rpj := &RetryPolicyViaJSON{Delay: "1m", Multiplier: 2, MaxDelay: "1h", BuryExitCodes: []int{2}, InfraRetries: 10}
+		p, err := rpj.RetryPolicy()
+		So(err, ShouldBeNil)
+		So(p.Delay, ShouldEqual, 1*time.Minute)
+		So(p.Multiplier, ShouldEqual, 2)
+		So(p.MaxDelay, ShouldEqual, 1*time.Hour)
+		So(p.BuryExitCodes, ShouldResemble, []int{2})
+		So(p.InfraRetries, ShouldEqual, 10)
+
+		rpj.Delay = "1 minute"
+		_, err = rpj.RetryPolicy()
+		So(err, ShouldNotBeNil)
+
+		rpj.Delay = ""
+		rpj.InfraRetries = 256
+		_, err = rpj.RetryPolicy()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Jobs use separate retries for infrastructure failures", t, func() {
+		So(FailReasonIsInfrastructure(FailReasonLost), ShouldBeTrue)
+		So(FailReasonIsInfrastructure(FailReasonMount), ShouldBeTrue)
+		So(FailReasonIsInfrastructure(FailReasonSignal), ShouldBeTrue)
+		So(FailReasonIsInfrastructure(FailReasonExit), ShouldBeFalse)
+
+		job := &Job{Retries: 1}
+		job.resetRetries()
+		So(job.UntilBuried, ShouldEqual, 2)
+		So(job.releaseDelay(), ShouldEqual, ClientReleaseDelay)
+		job.FailReason = FailReasonLost
+		So(job.failed(), ShouldBeFalse)
+		So(job.failed(), ShouldBeTrue)
+
+		job = &Job{Retries: 1, RetryPolicy: &RetryPolicy{Delay: 1 * time.Second, Multiplier: 10, InfraRetries: 2}}
+		job.resetRetries()
+		So(job.UntilBuried, ShouldEqual, 2)
+		So(job.InfraUntilBuried, ShouldEqual, 3)
+		So(job.releaseDelay(), ShouldEqual, 1*time.Second)
+
+		job.FailReason = FailReasonLost
+		So(job.failed(), ShouldBeFalse)
+		So(job.UntilBuried, ShouldEqual, 2)
+		So(job.InfraUntilBuried, ShouldEqual, 2)
+		So(job.releaseDelay(), ShouldEqual, 1*time.Second)
+
+		job.FailReason = FailReasonExit
+		So(job.failed(), ShouldBeFalse)
+		So(job.releaseDelay(), ShouldEqual, 10*time.Second)
+
+		job.FailReason = FailReasonSignal
+		So(job.failed(), ShouldBeFalse)
+		job.FailReason = FailReasonMount
+		So(job.failed(), ShouldBeTrue)
+		So(job.UntilBuried, ShouldEqual, 1)
+
+		job.resetRetries()
+		job.FailReason = FailReasonExit
+		So(job.failed(), ShouldBeFalse)
+		So(job.failed(), ShouldBeTrue)
+		So(job.InfraUntilBuried, ShouldEqual, 3)
+
+		job.resetRetries()
+		job.InfraUntilBuried = 1
+		So(job.willRetry(FailReasonExit), ShouldBeTrue)
+		So(job.willRetry(FailReasonLost), ShouldBeFalse)
+
+		job = &Job{Retries: 2, RetryPolicy: &RetryPolicy{Delay: 1 * time.Second}}
+		job.resetRetries()
+		So(job.UntilBuried, ShouldEqual, 3)
+		So(job.InfraUntilBuried, ShouldEqual, 0)
+		So(job.willRetry(FailReasonLost), ShouldBeTrue)
+		job.FailReason = FailReasonLost
+		So(job.failed(), ShouldBeFalse)
+		So(job.UntilBuried, ShouldEqual, 2)
+		job.FailReason = FailReasonMount
+		So(job.failed(), ShouldBeFalse)
+		So(job.willRetry(FailReasonSignal), ShouldBeFalse)
+		job.FailReason = FailReasonSignal
+		So(job.failed(), ShouldBeTrue)
+	})
+}
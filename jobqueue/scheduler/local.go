@@ -26,7 +26,6 @@ import (
 	"fmt"
 	"github.com/VertebrateResequencing/wr/queue"
 	"github.com/shirou/gopsutil/mem"
-	"log"
 	"math"
 	"os/exec"
 	"runtime"
@@ -456,6 +455,11 @@ func (s *local) hostToID(host string) string {
 	return ""
 }
 
+// serverCounts always returns zeros, since we're not in the cloud.
+func (s *local) serverCounts() (servers int, standins int) {
+	return 0, 0
+}
+
 // setMessageCallBack does nothing at the moment, since we don't generate any
 // messages for the user.
 func (s *local) setMessageCallBack(cb MessageCallBack) {
@@ -479,6 +483,6 @@ func (s *local) cleanup() {
 
 func (s *local) debug(msg string, a ...interface{}) {
 	if s.debugMode {
-		log.Printf(msg, a...)
+		debugf(logger, msg, a...)
 	}
 }
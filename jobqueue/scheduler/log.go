@@ -0,0 +1,44 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+	"github.com/inconshreveable/log15"
+	"strings"
+)
+
+// logger is what the job schedulers log with.
+var logger = log15.New("pkg", "scheduler")
+
+func init() {
+	logger.SetHandler(log15.StderrHandler)
+}
+
+// SetLogHandler sets where and how the job schedulers log. The default is to
+// log everything to STDERR in logfmt format. Debug messages are only logged at
+// all when the scheduler was configured with debug mode on.
+func SetLogHandler(h log15.Handler) {
+	logger.SetHandler(h)
+}
+
+// debugf logs a printf-style debug message to the given logger.
+func debugf(l log15.Logger, msg string, a ...interface{}) {
+	l.Debug(strings.TrimSpace(fmt.Sprintf(msg, a...)))
+}
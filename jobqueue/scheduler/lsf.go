@@ -670,6 +670,11 @@ func (s *lsf) hostToID(host string) string {
 	return ""
 }
 
+// serverCounts always returns zeros, since we're not in the cloud.
+func (s *lsf) serverCounts() (servers int, standins int) {
+	return 0, 0
+}
+
 // setMessageCallBack does nothing at the moment, since we don't generate any
 // messages for the user.
 func (s *lsf) setMessageCallBack(cb MessageCallBack) {
@@ -29,7 +29,6 @@ import (
 	"github.com/VertebrateResequencing/wr/queue"
 	"github.com/ricochet2200/go-disk-usage/du"
 	"github.com/satori/go.uuid"
-	"log"
 	"os/exec"
 	"runtime"
 	"strconv"
@@ -1141,6 +1140,19 @@ func (s *opst) hostToID(host string) string {
 	return server.ID
 }
 
+// serverCounts returns the number of servers we've spawned and the number of
+// standins for servers we're spawning.
+func (s *opst) serverCounts() (servers int, standins int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for sid := range s.servers {
+		if sid != "localhost" {
+			servers++
+		}
+	}
+	return servers, len(s.standins)
+}
+
 // setMessageCallBack sets the given callback.
 func (s *opst) setMessageCallBack(cb MessageCallBack) {
 	s.cbmutex.Lock()
@@ -1221,12 +1233,12 @@ func (s *opst) cleanup() {
 
 func (s *opst) debug(msg string, a ...interface{}) {
 	if s.debugMode {
-		log.Printf(msg, a...)
+		debugf(logger, msg, a...)
 	}
 }
 
 func (s *standin) debug(msg string, a ...interface{}) {
 	if s.debugMode {
-		log.Printf(msg, a...)
+		debugf(logger.New("standin", s.id), msg, a...)
 	}
 }
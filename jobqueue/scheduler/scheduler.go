@@ -145,6 +145,7 @@ type scheduleri interface {
 	reserveTimeout() int                                     // achieve the aims of ReserveTimeout()
 	maxQueueTime(req *Requirements) time.Duration            // achieve the aims of MaxQueueTime()
 	hostToID(host string) string                             // achieve the aims of HostToID()
+	serverCounts() (servers int, standins int)               // achieve the aims of ServerCounts()
 	setMessageCallBack(MessageCallBack)                      // achieve the aims of SetMessageCallBack()
 	setBadServerCallBack(BadServerCallBack)                  // achieve the aims of SetBadServerCallBack()
 	cleanup()                                                // do any clean up once you've finished using the job scheduler
@@ -268,6 +269,14 @@ func (s *Scheduler) HostToID(host string) string {
 	return s.impl.hostToID(host)
 }
 
+// ServerCounts returns the number of servers the scheduler has spawned (not
+// counting the one we're running on) and the number of "standins" for servers
+// that are in the process of being spawned, if the scheduler is cloud based.
+// Otherwise this just returns zeros.
+func (s *Scheduler) ServerCounts() (servers int, standins int) {
+	return s.impl.serverCounts()
+}
+
 // Cleanup means you've finished using a scheduler and it can delete any
 // remaining jobs in its system and clean up any other used resources.
 func (s *Scheduler) Cleanup() {
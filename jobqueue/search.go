@@ -0,0 +1,208 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for searching the history of jobs that have
+// run.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/VertebrateResequencing/wr/queue"
+	"github.com/boltdb/bolt"
+	"github.com/ugorji/go/codec"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// JobSearch describes the jobs you want from Client.SearchJobs(). Only jobs
+// that have run at least once are considered, and every non-zero criterion
+// must match.
+type JobSearch struct {
+	// Since and Until limit to jobs that last finished running within this
+	// time range.
+	Since time.Time
+	Until time.Time
+
+	// Exitcode, if not nil, limits to jobs that last exited with this code.
+	Exitcode *int
+
+	// FailReason limits to jobs that failed for this reason (one of the
+	// FailReason* constants) on their last failed attempt.
+	FailReason string
+
+	// Host limits to jobs that last ran on this host.
+	Host string
+
+	// ReqGroup and User limit to jobs with this ReqGroup, and added by this
+	// user.
+	ReqGroup string
+	User     string
+
+	// Cmd is a regular expression that the job's Cmd must match. To match a
+	// plain substring, use regexp.QuoteMeta().
+	Cmd string
+}
+
+// compile returns the compiled Cmd regexp, or nil if there isn't one.
+func (js *JobSearch) compile() (*regexp.Regexp, error) {
+	if js.Cmd == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(js.Cmd)
+	if err != nil {
+		return nil, fmt.Errorf("bad Cmd regular expression: %s", err)
+	}
+	return re, nil
+}
+
+// matches tells you if the given job passes the search, with re being the
+// result of compile(). You must hold the job's read lock.
+func (js *JobSearch) matches(job *Job, re *regexp.Regexp) bool {
+	switch {
+	case job.EndTime.IsZero(),
+		!js.Since.IsZero() && job.EndTime.Before(js.Since),
+		!js.Until.IsZero() && job.EndTime.After(js.Until),
+		js.Exitcode != nil && (!job.Exited || job.Exitcode != *js.Exitcode),
+		js.FailReason != "" && job.FailReason != js.FailReason,
+		js.Host != "" && job.Host != js.Host,
+		js.ReqGroup != "" && job.ReqGroup != js.ReqGroup,
+		js.User != "" && job.User != js.User,
+		re != nil && !re.MatchString(job.Cmd):
+		return false
+	}
+	return true
+}
+
+// endTimeKey returns the key of a job in the time-ordered index of complete
+// jobs.
+func endTimeKey(endTime time.Time, jobKey []byte) []byte {
+	key := make([]byte, 8, 8+len(jobKey))
+	binary.BigEndian.PutUint64(key, uint64(endTime.UnixNano()))
+	return append(key, jobKey...)
+}
+
+// indexCompleteJobs adds all the jobs in the complete bucket to the
+// time-ordered index, for use when the index is first created in a database
+// that already has complete jobs.
+func indexCompleteJobs(tx *bolt.Tx, ch codec.Handle) error {
+	index := tx.Bucket(bucketETK)
+	return tx.Bucket(bucketJobsComplete).ForEach(func(key, encoded []byte) error {
+		job := &Job{}
+		dec := codec.NewDecoderBytes(encoded, ch)
+		if err := dec.Decode(job); err != nil {
+			return err
+		}
+		return index.Put(endTimeKey(job.EndTime, key), nil)
+	})
+}
+
+// searchCompleteJobs returns the complete jobs (that aren't also currently
+// live) that pass the search, using the time-ordered index to only look at
+// those that finished in the desired time range. re is the result of
+// search.compile().
+func (db *db) searchCompleteJobs(search *JobSearch, re *regexp.Regexp) (jobs []*Job, err error) {
+	err = db.bolt.View(func(tx *bolt.Tx) error {
+		newJobBucket := tx.Bucket(bucketJobsLive)
+		completeJobBucket := tx.Bucket(bucketJobsComplete)
+		c := tx.Bucket(bucketETK).Cursor()
+		var k []byte
+		if search.Since.IsZero() {
+			k, _ = c.First()
+		} else {
+			k, _ = c.Seek(endTimeKey(search.Since, nil))
+		}
+		var until []byte
+		if !search.Until.IsZero() {
+			until = endTimeKey(search.Until.Add(1), nil)
+		}
+		for ; k != nil && (until == nil || bytes.Compare(k, until) < 0); k, _ = c.Next() {
+			key := k[8:]
+			encoded := completeJobBucket.Get(key)
+			if len(encoded) == 0 || newJobBucket.Get(key) != nil {
+				continue
+			}
+			job := &Job{}
+			dec := codec.NewDecoderBytes(encoded, db.ch)
+			if derr := dec.Decode(job); derr != nil {
+				return derr
+			}
+
+			// jobs that were re-run before archiveJob() replaced their entries
+			// have stale ones under the times they previously completed at
+			if uint64(job.EndTime.UnixNano()) != binary.BigEndian.Uint64(k[:8]) {
+				continue
+			}
+			if search.matches(job, re) {
+				jobs = append(jobs, job)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// searchJobs finds the jobs that have run and that pass the search, both
+// those that are complete and those still in the given queue (eg. because
+// they were buried), sorted by when they finished running. The limit, getStd
+// and getEnv args work as for getJobsCurrent(), with limit keeping the jobs of
+// each group that finished first.
+func (s *Server) searchJobs(q *queue.Queue, search *JobSearch, limit int, getStd bool, getEnv bool) (jobs []*Job, srerr string, qerr string) {
+	re, err := search.compile()
+	if err != nil {
+		srerr = ErrBadRequest
+		qerr = err.Error()
+		return
+	}
+
+	for _, item := range q.AllItems() {
+		sjob := item.Data.(*Job)
+		sjob.RLock()
+		matched := search.matches(sjob, re)
+		sjob.RUnlock()
+		if matched {
+			jobs = append(jobs, s.itemToJob(item, false, false))
+		}
+	}
+
+	complete, err := s.db.searchCompleteJobs(search, re)
+	if err != nil {
+		srerr = ErrDBError
+		qerr = err.Error()
+		return
+	}
+	jobs = append(jobs, complete...)
+
+	// sort before limiting, so that it's deterministic which jobs of each
+	// group are kept; limitJobs() returns its groups in no particular order,
+	// so we sort again after
+	byEndTime := func() {
+		sort.SliceStable(jobs, func(i, j int) bool {
+			return jobs[i].EndTime.Before(jobs[j].EndTime)
+		})
+	}
+	byEndTime()
+	if limit > 0 || getStd || getEnv {
+		jobs = s.limitJobs(jobs, limit, "", getStd, getEnv)
+		byEndTime()
+	}
+	return
+}
@@ -0,0 +1,164 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	"github.com/boltdb/bolt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	Convey("Jobs are matched against searches", t, func() {
+		end := time.Now()
+		job := &Job{Cmd: "echo foo", EndTime: end, Exited: true, Exitcode: 1, FailReason: FailReasonExit, Host: "h1", ReqGroup: "echo", User: "alice"}
+		zero, one := 0, 1
+
+		So((&JobSearch{}).matches(job, nil), ShouldBeTrue)
+		So((&JobSearch{}).matches(&Job{Cmd: "echo foo"}, nil), ShouldBeFalse)
+		So((&JobSearch{Since: end, Until: end}).matches(job, nil), ShouldBeTrue)
+		So((&JobSearch{Since: end.Add(time.Second)}).matches(job, nil), ShouldBeFalse)
+		So((&JobSearch{Until: end.Add(-time.Second)}).matches(job, nil), ShouldBeFalse)
+		So((&JobSearch{Exitcode: &one}).matches(job, nil), ShouldBeTrue)
+		So((&JobSearch{Exitcode: &zero}).matches(job, nil), ShouldBeFalse)
+		So((&JobSearch{Exitcode: &zero}).matches(&Job{EndTime: end}, nil), ShouldBeFalse)
+		So((&JobSearch{FailReason: FailReasonRAM}).matches(job, nil), ShouldBeFalse)
+		So((&JobSearch{Host: "h1", ReqGroup: "echo", User: "alice"}).matches(job, nil), ShouldBeTrue)
+		So((&JobSearch{Host: "h2"}).matches(job, nil), ShouldBeFalse)
+		So((&JobSearch{User: "bob"}).matches(job, nil), ShouldBeFalse)
+
+		search := &JobSearch{Cmd: "^echo f"}
+		re, err := search.compile()
+		So(err, ShouldBeNil)
+		So(search.matches(job, re), ShouldBeTrue)
+		So(search.matches(&Job{Cmd: "true; echo foo", EndTime: end}, re), ShouldBeFalse)
+
+		_, err = (&JobSearch{Cmd: "("}).compile()
+		So(err, ShouldNotBeNil)
+		re, err = (&JobSearch{}).compile()
+		So(err, ShouldBeNil)
+		So(re, ShouldBeNil)
+	})
+
+	Convey("End time keys sort in time order", t, func() {
+		now := time.Now()
+		key := endTimeKey(now, []byte("b"))
+		So(string(key[8:]), ShouldEqual, "b")
+		So(string(endTimeKey(now, []byte("c"))), ShouldBeGreaterThan, string(key))
+		So(string(endTimeKey(now.Add(time.Nanosecond), []byte("a"))), ShouldBeGreaterThan, string(key))
+	})
+
+	Convey("Complete jobs can be searched for by end time", t, func() {
+		dir, err := ioutil.TempDir("", "wr_search_test")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		boltdb, err := bolt.Open(filepath.Join(dir, "db"), dbFilePermission, nil)
+		So(err, ShouldBeNil)
+		defer boltdb.Close()
+		ch := new(codec.BincHandle)
+
+		start := time.Now().Add(-10 * time.Hour).Truncate(time.Second)
+		err = boltdb.Update(func(tx *bolt.Tx) error {
+			for _, bucket := range [][]byte{bucketJobsLive, bucketJobsComplete, bucketETK} {
+				if _, berr := tx.CreateBucketIfNotExists(bucket); berr != nil {
+					return berr
+				}
+			}
+			complete := tx.Bucket(bucketJobsComplete)
+			for i := 0; i < 5; i++ {
+				job := &Job{Cmd: "echo " + string('a'+rune(i)), EndTime: start.Add(time.Duration(i) * time.Hour), Exited: true, Exitcode: i % 2}
+				var encoded []byte
+				enc := codec.NewEncoderBytes(&encoded, ch)
+				if eerr := enc.Encode(job); eerr != nil {
+					return eerr
+				}
+				if perr := complete.Put([]byte(job.Cmd), encoded); perr != nil {
+					return perr
+				}
+			}
+
+			// "echo e" is currently being re-run, and "echo d" previously
+			// completed at an earlier time
+			if perr := tx.Bucket(bucketJobsLive).Put([]byte("echo e"), []byte("x")); perr != nil {
+				return perr
+			}
+			if perr := tx.Bucket(bucketETK).Put(endTimeKey(start.Add(-time.Hour), []byte("echo d")), nil); perr != nil {
+				return perr
+			}
+			return indexCompleteJobs(tx, ch)
+		})
+		So(err, ShouldBeNil)
+		db := &db{bolt: boltdb, ch: ch}
+
+		cmds := func(jobs []*Job) []string {
+			var cmds []string
+			for _, job := range jobs {
+				cmds = append(cmds, job.Cmd)
+			}
+			return cmds
+		}
+
+		jobs, err := db.searchCompleteJobs(&JobSearch{}, nil)
+		So(err, ShouldBeNil)
+		So(cmds(jobs), ShouldResemble, []string{"echo a", "echo b", "echo c", "echo d"})
+
+		jobs, err = db.searchCompleteJobs(&JobSearch{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)}, nil)
+		So(err, ShouldBeNil)
+		So(cmds(jobs), ShouldResemble, []string{"echo b", "echo c", "echo d"})
+
+		one := 1
+		jobs, err = db.searchCompleteJobs(&JobSearch{Exitcode: &one}, nil)
+		So(err, ShouldBeNil)
+		So(cmds(jobs), ShouldResemble, []string{"echo b", "echo d"})
+
+		search := &JobSearch{Until: start.Add(2 * time.Hour), Cmd: "[ac]$"}
+		re, err := search.compile()
+		So(err, ShouldBeNil)
+		jobs, err = db.searchCompleteJobs(search, re)
+		So(err, ShouldBeNil)
+		So(cmds(jobs), ShouldResemble, []string{"echo a", "echo c"})
+
+		Convey("Re-archiving a job replaces its entry in the index", func() {
+			job := &Job{Cmd: "echo b", EndTime: start.Add(6 * time.Hour), Exited: true}
+			err := db.archiveJob("echo b", job)
+			So(err, ShouldBeNil)
+
+			var indexed []string
+			err = boltdb.View(func(tx *bolt.Tx) error {
+				return tx.Bucket(bucketETK).ForEach(func(k, v []byte) error {
+					if string(k[8:]) == "echo b" {
+						indexed = append(indexed, string(k))
+					}
+					return nil
+				})
+			})
+			So(err, ShouldBeNil)
+			So(indexed, ShouldResemble, []string{string(endTimeKey(job.EndTime, []byte("echo b")))})
+
+			jobs, err := db.searchCompleteJobs(&JobSearch{}, nil)
+			So(err, ShouldBeNil)
+			So(cmds(jobs), ShouldResemble, []string{"echo a", "echo c", "echo d", "echo b"})
+		})
+	})
+}
@@ -33,7 +33,6 @@ import (
 	"github.com/grafov/bcast" // *** must be commit e9affb593f6c871f9b4c3ee6a3c77d421fe953df or status web page updates break in certain cases
 	"github.com/ugorji/go/codec"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"os"
@@ -76,6 +75,7 @@ var (
 	ServerReserveTicker   = 1 * time.Second
 	ServerCheckRunnerTime = 1 * time.Minute
 	ServerLogClientErrors = true
+	ServerMaxSortJobs     = 10000
 )
 
 // Error records an error and the operation, item and queue that caused it.
@@ -108,6 +108,10 @@ type serverResponse struct {
 	Jobs       []*Job
 	SStats     *ServerStats
 	DB         []byte
+	CacheDir   string
+	Arrays     []*ArrayStatus
+	ReqGroups  []*ReqGroupStats
+	Audit      []*AuditEntry
 }
 
 // ServerInfo holds basic addressing info about the server.
@@ -132,6 +136,7 @@ type ServerStats struct {
 	Running    int           // how many jobs are currently running
 	Buried     int           // how many jobs are no longer being processed because of seemingly permanent errors
 	ETC        time.Duration // how long until the the slowest of the currently running jobs is expected to complete
+	Quotas     []*QuotaUsage // usage of each user's and RepGroup's Quota, if quotas are configured
 }
 
 type rgToKeys struct {
@@ -193,6 +198,11 @@ type Server struct {
 	rc              string // runner command string compatible with fmt.Sprintf(..., queueName, schedulerGroup, deployment, serverAddr, reserveTimeout, maxMinsAllowed)
 	httpServer      *http.Server
 	statusCaster    *bcast.Group
+	events          *eventStream
+	webhooks        *webhooks
+	emails          *emailer
+	metrics         *metrics
+	auditRetention  time.Duration
 	badServerCaster *bcast.Group
 	schedCaster     *bcast.Group
 	racCheckTimer   *time.Timer
@@ -205,6 +215,17 @@ type Server struct {
 	krmutex         sync.RWMutex
 	killRunners     bool
 	stopServing     chan bool
+	cacheDir        string
+	timeLimit       float64
+	owner           string
+	fairShare       string
+	shareWeights    map[string]float64
+	shareCounts     *shareCounts
+	priorityAging   time.Duration
+	quotas          *quotas
+	stopBackground  chan bool
+	arrays          map[string]*serverArray
+	amutex          sync.RWMutex
 }
 
 // ServerConfig is supplied to Serve() to configure your jobqueue server. All
@@ -260,6 +281,80 @@ type ServerConfig struct {
 	// in which case it will do its best to pick correctly. (This is only a
 	// possible issue if you have multiple network interfaces.)
 	CIDR string
+
+	// CacheDir is the location of the result cache used by Jobs that have
+	// Cache set. It should be a directory that is accessible at the same path
+	// by all the hosts your Jobs might run on, or an S3 path of the form
+	// s3://[profile@]bucket/path. Leaving this unset (the default) disables
+	// result caching.
+	CacheDir string
+
+	// CacheMaxMB is the maximum size of a local CacheDir; every
+	// CacheEvictInterval the least recently used entries will be deleted until
+	// the cache is smaller than this. 0 (the default) means no limit. This has
+	// no effect on caches in S3, which you should manage with lifecycle rules
+	// instead.
+	CacheMaxMB int
+
+	// TimeLimit is the default hard time limit for Jobs that don't specify
+	// their own: Cmds that run for longer than this multiple of their
+	// expected time will be killed (see Job.TimeLimit). The default of 0 means
+	// no limit.
+	TimeLimit float64
+
+	// Recommendations configures how the resource usage of past Jobs is used
+	// to recommend the Requirements of new Jobs in the same ReqGroup. It can
+	// be overridden per ReqGroup with Client.SetReqGroupConfig(). The default
+	// (nil) is the 95th percentile of all past runs.
+	Recommendations *RecommendationConfig
+
+	// FairShare, if set to one of the FairShare* modes, makes Jobs of the
+	// same Priority get reserved in an interleaved order across the users
+	// and/or RepGroups that added them, instead of first come first served,
+	// so that one large submission doesn't hold up everyone else's. The
+	// default of "" turns this off.
+	FairShare string
+
+	// ShareWeights gives some share groups (see FairShare*) a larger or
+	// smaller share of the ready queue than others: a group with weight 2
+	// gets twice as many of its Jobs reserved as a group with weight 1 (the
+	// default). See ParseShareWeights().
+	ShareWeights map[string]float64
+
+	// PriorityAging, if set, makes Jobs that have been ready for this long
+	// get reserved as if their Priority was 1 higher, and so on for each
+	// further period, so that low Priority Jobs aren't starved forever. The
+	// default of 0 turns this off.
+	PriorityAging time.Duration
+
+	// UserQuotas limits the resources that the running Jobs added by each
+	// user can use at once, keyed on user name (or QuotaDefault for everyone
+	// without their own Quota). Jobs that would go over quota wait in the
+	// "quota" state until enough of the user's other Jobs finish. See
+	// ParseQuotas(). The default (nil) means no limits.
+	UserQuotas map[string]*Quota
+
+	// RepGroupQuotas is like UserQuotas, but keyed on RepGroup.
+	RepGroupQuotas map[string]*Quota
+
+	// Webhooks are POSTed JSON descriptions of the events they're interested
+	// in: Jobs being buried or completing, all the Jobs of a RepGroup
+	// completing, and servers going bad. See ParseWebhooks(). Jobs can also
+	// specify their own Webhook. Optional.
+	Webhooks []*Webhook
+
+	// WebhookSecret, if set, is used to sign the bodies of webhook POSTs; see
+	// WebhookSignatureHeader. Optional.
+	WebhookSecret string
+
+	// Email, if set (with an SMTP), results in admins being emailed about
+	// persistent scheduler problems and bad servers, and users about their
+	// buried Jobs. Optional.
+	Email *EmailConfig
+
+	// AuditRetention is how long entries in the audit trail of user actions
+	// are kept for. 0 means they are kept forever.
+	AuditRetention time.Duration
 }
 
 // Serve is for use by a server executable and makes it start listening on
@@ -293,6 +388,11 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 		allowedUsers = append(allowedUsers, owner)
 	}
 
+	err = validFairShare(config.FairShare)
+	if err != nil {
+		return
+	}
+
 	sock, err := rep.NewSocket()
 	if err != nil {
 		return
@@ -375,10 +475,38 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 		sgtr:            make(map[string]*scheduler.Requirements),
 		rc:              config.RunnerCmd,
 		statusCaster:    bcast.NewGroup(),
+		events:          newEventStream(),
+		webhooks:        newWebhooks(config.Webhooks, config.WebhookSecret),
+		metrics:         newMetrics(),
+		auditRetention:  config.AuditRetention,
 		badServerCaster: bcast.NewGroup(),
 		badServers:      make(map[string]*cloud.Server),
 		schedCaster:     bcast.NewGroup(),
 		schedIssues:     make(map[string]*schedulerIssue),
+		cacheDir:        config.CacheDir,
+		timeLimit:       config.TimeLimit,
+		owner:           owner,
+		fairShare:       config.FairShare,
+		shareWeights:    config.ShareWeights,
+		shareCounts:     newShareCounts(),
+		priorityAging:   config.PriorityAging,
+		quotas:          newQuotas(config.UserQuotas, config.RepGroupQuotas),
+		stopBackground:  make(chan bool),
+		arrays:          make(map[string]*serverArray),
+	}
+
+	if config.Email != nil && config.Email.SMTP != "" {
+		s.emails = newEmailer(config.Email, s.ServerInfo)
+	}
+	db.setBackupCallback(s.metrics.backup)
+
+	err = db.setRecDefaults(config.Recommendations)
+	if err != nil {
+		return
+	}
+	err = db.loadEscalationPolicies()
+	if err != nil {
+		return
 	}
 
 	// if we're restarting from a state where there were incomplete jobs, we
@@ -401,6 +529,74 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 		}
 	}
 
+	// and continue creating the elements of any array jobs
+	err = s.recoverArrays(priorJobs)
+	if err != nil {
+		return
+	}
+
+	// keep the result cache below its maximum size
+	if config.CacheDir != "" && config.CacheMaxMB > 0 && !internal.InS3(config.CacheDir) {
+		go func() {
+			defer s.logPanic("jobqueue result cache eviction", false)
+
+			ticker := time.NewTicker(CacheEvictInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					_, everr := evictResultCache(config.CacheDir, config.CacheMaxMB)
+					if everr != nil {
+						logger.Error("failed to evict from the result cache", "err", everr)
+					}
+				case <-s.stopBackground:
+					return
+				}
+			}
+		}()
+	}
+
+	// forget resource usage that has fallen outside of the recommendation
+	// windows, so that stats don't accumulate forever
+	go func() {
+		defer s.logPanic("jobqueue recommendation stat pruning", false)
+
+		ticker := time.NewTicker(ServerRecPruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, perr := s.db.pruneReqGroupStats()
+				if perr != nil {
+					logger.Error("failed to prune resource usage stats", "err", perr)
+				}
+			case <-s.stopBackground:
+				return
+			}
+		}
+	}()
+
+	// likewise, forget audit entries that are older than we want to keep
+	if s.auditRetention > 0 {
+		go func() {
+			defer s.logPanic("jobqueue audit pruning", false)
+
+			ticker := time.NewTicker(ServerAuditPruneInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					_, perr := s.db.pruneAudit(time.Now().Add(-s.auditRetention))
+					if perr != nil {
+						logger.Error("failed to prune the audit trail", "err", perr)
+					}
+				case <-s.stopBackground:
+					return
+				}
+			}
+		}()
+	}
+
 	// set up responding to command-line clients and signals
 	stopServing := make(chan bool, 1)
 	s.stopServing = stopServing
@@ -420,7 +616,7 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 					inShutdown := s.killRunners
 					s.krmutex.RUnlock()
 					if !inShutdown && rerr != mangos.ErrRecvTimeout {
-						log.Println(rerr)
+						logger.Warn("failed to receive a client request", "err", rerr)
 					}
 					continue
 				}
@@ -431,13 +627,8 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 					defer s.logPanic("jobqueue server client handling", false)
 
 					herr := s.handleRequest(m)
-					if ServerLogClientErrors && herr != nil {
-						s.krmutex.RLock()
-						inShutdown := s.killRunners
-						s.krmutex.RUnlock()
-						if !inShutdown {
-							log.Println(herr)
-						}
+					if _, isClientErr := herr.(Error); herr != nil && !isClientErr {
+						logger.Error("failed to handle a client request", "err", herr)
 					}
 				}()
 			}
@@ -477,6 +668,11 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 		mux.HandleFunc(restJobsEndpoint, restJobs(s, cmdsQ))
 		mux.HandleFunc(restWarningsEndpoint, restWarnings(s))
 		mux.HandleFunc(restBadServersEndpoint, restBadServers(s))
+		mux.HandleFunc(restOpenAPIEndpoint, restOpenAPI)
+		mux.HandleFunc(restEventsEndpoint, restEvents(s))
+		mux.HandleFunc(restWebhooksEndpoint, restWebhooks(s))
+		mux.HandleFunc(restMetricsEndpoint, restMetrics(s))
+		mux.HandleFunc(restAuditEndpoint, restAudit(s))
 		srv := &http.Server{Addr: "0.0.0.0:" + config.WebPort, Handler: mux}
 		go srv.ListenAndServe() // *** should use ListenAndServeTLS, which needs certs (http package has cert creation)...
 		s.httpServer = srv
@@ -484,6 +680,10 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 		go s.statusCaster.Broadcasting(0)
 		go s.badServerCaster.Broadcasting(0)
 		go s.schedCaster.Broadcasting(0)
+		s.webhooks.run(s.stopBackground)
+		if s.emails != nil {
+			s.emails.run(s.stopBackground)
+		}
 
 		badServerCB := func(server *cloud.Server) {
 			s.bsmutex.Lock()
@@ -502,14 +702,21 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 			s.bsmutex.Unlock()
 
 			if !skip {
-				s.badServerCaster.Send(&badServer{
+				bs := &badServer{
 					ID:      server.ID,
 					Name:    server.Name,
 					IP:      server.IP,
 					Date:    time.Now().Unix(),
 					IsBad:   server.IsBad(),
 					Problem: server.PermanentProblem(),
-				})
+				}
+				s.badServerCaster.Send(bs)
+				if s.emails != nil {
+					s.emails.badServer(bs)
+				}
+				if bs.IsBad {
+					s.webhooks.notify(&webhookPayload{Event: WebhookServerBad, Server: bs}, "")
+				}
 			}
 		}
 		s.scheduler.SetBadServerCallBack(badServerCB)
@@ -532,6 +739,9 @@ func Serve(config ServerConfig) (s *Server, msg string, err error) {
 			}
 			s.simutex.Unlock()
 			s.schedCaster.Send(si)
+			if s.emails != nil {
+				s.emails.schedulerIssue(msg)
+			}
 		}
 		s.scheduler.SetMessageCallBack(messageCB)
 
@@ -663,7 +873,12 @@ func (s *Server) GetServerStats() *ServerStats {
 		}
 	}
 
-	return &ServerStats{ServerInfo: s.ServerInfo, Delayed: delayed, Ready: ready, Running: running, Buried: buried, ETC: etc.Truncate(time.Minute).Sub(time.Now().Truncate(time.Minute))}
+	var quotaUsage []*QuotaUsage
+	if s.quotas != nil {
+		quotaUsage = s.quotas.usage()
+	}
+
+	return &ServerStats{ServerInfo: s.ServerInfo, Delayed: delayed, Ready: ready, Running: running, Buried: buried, ETC: etc.Truncate(time.Minute).Sub(time.Now().Truncate(time.Minute)), Quotas: quotaUsage}
 }
 
 // BackupDB lets you do a manual live backup of the server's database to a given
@@ -693,6 +908,38 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 		q = queue.New(qname)
 		s.qs[qname] = q
 
+		// share the ready queue out between the users and RepGroups that
+		// added jobs, and stop low priority jobs being starved
+		if s.fairShare != "" {
+			q.SetFairShare(func(data interface{}) (string, float64) {
+				return s.shareGroup(data.(*Job))
+			})
+		}
+		if s.priorityAging > 0 {
+			q.SetPriorityAging(s.priorityAging)
+		}
+
+		// don't let jobs start running if that would take their user or
+		// RepGroup over quota; jobs that pass are counted against their quotas
+		// until they stop running (see our changed callback)
+		if s.quotas != nil {
+			q.SetReserveFilter(func(data interface{}) bool {
+				job := data.(*Job)
+				job.RLock()
+				c := jobQuotaCharge(job)
+				key := job.key()
+				job.RUnlock()
+				if s.quotas.charge(key, c) {
+					return true
+				}
+
+				// our ready callback should have held this job back; get it to
+				// reconsider
+				go q.TriggerReadyAddedCallback()
+				return false
+			})
+		}
+
 		// we set a callback for things entering this queue's ready sub-queue.
 		// This function will be called in a go routine and receives a slice of
 		// all the ready jobs. Based on the requirements, we add to each job a
@@ -708,6 +955,16 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 				return
 			}
 
+			// when there are quotas, we rely on the queue giving us jobs in
+			// the order they would be reserved (taking account of fair share
+			// and aging), so that it's the ones that would run last that are
+			// held back
+			var tally *quotaTally
+			var holding int
+			if s.quotas != nil {
+				tally = newQuotaTally()
+			}
+
 			// calculate, set and count jobs by schedulerGroup
 			groups := make(map[string]int)
 			groupToReqs := make(map[string]*scheduler.Requirements)
@@ -716,7 +973,7 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 			for _, inter := range allitemdata {
 				job := inter.(*Job)
 
-				// depending on job.Override, get memory and time
+				// depending on job.Override, get memory, time, cores and disk
 				// recommendations, which are rounded to get fewer larger
 				// groups
 				noRec := false
@@ -727,14 +984,18 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 					} else {
 						recm, _ := s.db.recommendedReqGroupMemory(job.ReqGroup)
 						recs, _ := s.db.recommendedReqGroupTime(job.ReqGroup)
+						recc, _ := s.db.recommendedReqGroupCores(job.ReqGroup)
+						recd, _ := s.db.recommendedReqGroupDisk(job.ReqGroup)
 						if recm == 0 || recs == 0 {
 							groupToReqs[job.ReqGroup] = nil
 						} else {
-							recommendedReq = &scheduler.Requirements{RAM: recm, Time: time.Duration(recs) * time.Second}
+							recommendedReq = &scheduler.Requirements{RAM: recm, Time: time.Duration(recs) * time.Second, Cores: recc, Disk: recd}
 							groupToReqs[job.ReqGroup] = recommendedReq
 						}
 					}
 
+					// (cores and disk are only learned for jobs that ran in
+					// ways that let us measure them, so may not be known)
 					if recommendedReq != nil {
 						if job.Override == 1 {
 							if recommendedReq.RAM > job.Requirements.RAM {
@@ -743,9 +1004,21 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 							if recommendedReq.Time > job.Requirements.Time {
 								job.Requirements.Time = recommendedReq.Time
 							}
+							if recommendedReq.Cores > job.Requirements.Cores {
+								job.Requirements.Cores = recommendedReq.Cores
+							}
+							if recommendedReq.Disk > job.Requirements.Disk {
+								job.Requirements.Disk = recommendedReq.Disk
+							}
 						} else {
 							job.Requirements.RAM = recommendedReq.RAM
 							job.Requirements.Time = recommendedReq.Time
+							if recommendedReq.Cores > 0 {
+								job.Requirements.Cores = recommendedReq.Cores
+							}
+							if recommendedReq.Disk > 0 {
+								job.Requirements.Disk = recommendedReq.Disk
+							}
 						}
 					} else {
 						noRec = true
@@ -769,6 +1042,20 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 					req = job.Requirements
 				}
 
+				// jobs that would take their user or RepGroup over quota are
+				// put to one side, where runners won't find them and we won't
+				// schedule runners for them, until running jobs free up quota
+				var held bool
+				if s.quotas != nil {
+					job.RLock()
+					c := jobQuotaCharge(job)
+					job.RUnlock()
+					held = s.quotas.hold(c, tally)
+					if held {
+						holding++
+					}
+				}
+
 				prevSchedGroup := job.getSchedulerGroup()
 				schedulerGroup := req.Stringify()
 				if prevSchedGroup != schedulerGroup {
@@ -776,11 +1063,26 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 					if prevSchedGroup != "" {
 						job.setScheduledRunner(false)
 					}
-					if s.rc != "" {
+					if s.rc != "" && !held {
 						q.SetReserveGroup(job.key(), schedulerGroup)
 					}
 				}
 
+				if held != job.getQuotaHeld() {
+					job.setQuotaHeld(held)
+					reserveGroup := quotaHoldGroup
+					if !held {
+						reserveGroup = ""
+						if s.rc != "" {
+							reserveGroup = schedulerGroup
+						}
+					}
+					q.SetReserveGroup(job.key(), reserveGroup)
+				}
+				if held {
+					continue
+				}
+
 				if s.rc != "" {
 					if job.getScheduledRunner() {
 						groupsScheduledCounts[schedulerGroup]++
@@ -801,6 +1103,10 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 				}
 			}
 
+			if s.quotas != nil {
+				s.quotas.setHolding(holding)
+			}
+
 			if s.rc != "" {
 				// clear out groups we no longer need
 				s.sgcmutex.Lock()
@@ -908,17 +1214,37 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 			}
 			from = subqueueToJobState[fromQ]
 
-			// calculate counts per RepGroup
+			// calculate counts per RepGroup (and share group), and the events
+			// of each job
 			groups := make(map[string]int)
+			shareGroups := make(map[string]int)
 			groupsLost := make(map[string]int)
 			lost := 0
+			unheld := false
+			events := make([]*jobEvent, 0, len(data))
 			for _, inter := range data {
 				job := inter.(*Job)
+				job.RLock()
+				event := jobStateEvent(job, from, to)
+				webhook := job.Webhook
+				job.RUnlock()
+				events = append(events, event)
+				s.notifyJobWebhooks(job, to, webhook)
+				if s.fairShare != "" {
+					group, _ := s.shareGroup(job)
+					shareGroups[group]++
+				}
+				if to == JobStateBuried && s.emails != nil {
+					s.emails.jobBuried(job)
+				}
 
 				// if we change from running, mark that we have not scheduled a
-				// runner for the job
+				// runner for the job, and that it no longer uses its quotas
 				if from == JobStateRunning {
 					job.setScheduledRunner(false)
+					if s.quotas != nil && s.quotas.uncharge(job.key()) {
+						unheld = true
+					}
 
 					job.RLock()
 					l := job.Lost
@@ -926,12 +1252,18 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 					if l {
 						lost++
 						groupsLost[job.RepGroup]++
+						event.From = JobStateLost
 						continue
 					}
 				}
 
 				groups[job.RepGroup]++
 			}
+			s.events.publish(events...)
+			s.metrics.jobsChanged(q.Name, to, len(data))
+			for group, count := range shareGroups {
+				s.shareCounts.change(q.Name, group, from, to, count)
+			}
 
 			// send out the counts
 			s.statusCaster.Send(&jstateCount{"+all+", from, to, len(data) - lost})
@@ -945,6 +1277,15 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 					s.statusCaster.Send(&jstateCount{group, JobStateLost, to, count})
 				}
 			}
+
+			// jobs that were held back because of quotas may now be able to
+			// run
+			if s.quotas != nil && from == JobStateRunning {
+				q.ReserveFilterChanged()
+			}
+			if unheld {
+				q.TriggerReadyAddedCallback()
+			}
 		})
 
 		// we set a callback for running items that hit their ttr because the
@@ -966,6 +1307,8 @@ func (s *Server) getOrCreateQueue(qname string) *queue.Queue {
 				// transition from running to lost state
 				defer s.statusCaster.Send(&jstateCount{"+all+", JobStateRunning, JobStateLost, 1})
 				defer s.statusCaster.Send(&jstateCount{job.RepGroup, JobStateRunning, JobStateLost, 1})
+				s.events.publish(jobStateEvent(job, JobStateRunning, JobStateLost))
+				s.metrics.jobsChanged(q.Name, JobStateLost, 1)
 
 				return queue.SubQueueRun
 			}
@@ -998,15 +1341,28 @@ func (s *Server) enqueueItems(q *queue.Queue, itemdefs []*queue.ItemDef) (added
 	return
 }
 
-// createJobs creates new jobs, adding them to the database and the in-memory
-// queue. It returns 2 errors; the first is one of our Err constant strings,
-// the second is the actual error with more details.
-func (s *Server) createJobs(q *queue.Queue, inputJobs []*Job, envkey string, ignoreComplete bool) (added, dups, alreadyComplete int, srerr string, qerr error) {
+// createJobs creates new jobs on behalf of the given user, adding them to the
+// database and the in-memory queue. It returns 2 errors; the first is one of
+// our Err constant strings, the second is the actual error with more details.
+func (s *Server) createJobs(q *queue.Queue, inputJobs []*Job, envkey string, user string, ignoreComplete bool) (added, dups, alreadyComplete int, srerr string, qerr error) {
+	// jobs with webhooks we could never POST to are rejected outright, since
+	// the user would otherwise never find out
+	for _, job := range inputJobs {
+		if job.Webhook != "" {
+			if err := checkWebhookURL(job.Webhook); err != nil {
+				srerr = ErrBadRequest
+				qerr = err
+				return
+			}
+		}
+	}
+
 	// create itemdefs for the jobs
 	for _, job := range inputJobs {
 		job.Lock()
 		job.EnvKey = envkey
-		job.UntilBuried = job.Retries + 1
+		job.User = user
+		job.resetRetries()
 		job.Queue = q.Name
 		if s.rc != "" {
 			job.schedulerGroup = job.Requirements.Stringify()
@@ -1024,6 +1380,28 @@ func (s *Server) createJobs(q *queue.Queue, inputJobs []*Job, envkey string, ign
 		}
 	}
 
+	// array jobs aren't stored like normal jobs; instead we store them
+	// separately and create their elements in batches after dealing with the
+	// normal jobs
+	inputJobs, arrays, pending, arrayDups, err := s.createArrays(inputJobs, ignoreComplete)
+	if err != nil {
+		srerr = ErrBadRequest
+		qerr = err
+		return
+	}
+	defer func() {
+		if qerr == nil {
+			for _, arr := range arrays {
+				s.expandArray(q, arr)
+			}
+			added += pending
+			dups += arrayDups
+		}
+	}()
+	if len(inputJobs) == 0 {
+		return
+	}
+
 	// keep an on-disk record of these new jobs; we sacrifice a lot of speed by
 	// waiting on this database write to persist to disk. The alternative would
 	// be to return success to the client as soon as the jobs were in the in-
@@ -1074,6 +1452,164 @@ func (s *Server) createJobs(q *queue.Queue, inputJobs []*Job, envkey string, ign
 	return
 }
 
+// kickJobs moves the given buried jobs back to the ready queue, resetting their
+// retries, and returns the ones that were kicked.
+func (s *Server) kickJobs(q *queue.Queue, jobs []*Job) (kicked []*Job) {
+	for _, job := range jobs {
+		key := job.key()
+		item, err := q.Get(key)
+		if err != nil || item.Stats().State != queue.ItemStateBury {
+			continue
+		}
+		err = q.Kick(key)
+		if err != nil {
+			continue
+		}
+		job.Lock()
+		job.resetRetries()
+		job.Unlock()
+		kicked = append(kicked, job)
+	}
+	return
+}
+
+// removeJobs removes the given jobs from the queue and the live bucket, so they
+// will never run, and returns the ones that were removed. Running jobs, and
+// jobs that other jobs depend on, are not removed. The removed jobs are also
+// forgotten about as members of repGroup, if supplied, as well as their
+// current RepGroup.
+func (s *Server) removeJobs(q *queue.Queue, jobs []*Job, repGroup string) (removed []*Job) {
+	for _, job := range jobs {
+		key := job.key()
+		item, err := q.Get(key)
+		if err != nil || item.Stats().State == queue.ItemStateRun {
+			continue
+		}
+
+		// we can't allow the removal of jobs that have dependencies, as *queue
+		// would regard that as satisfying the dependency and downstream jobs
+		// would start
+		hasDeps, err := q.HasDependents(key)
+		if err != nil || hasDeps {
+			continue
+		}
+
+		err = q.Remove(key)
+		if err != nil {
+			continue
+		}
+		s.arrayElementDequeued(q, job)
+		s.db.deleteLiveJob(key)
+		if job.State == JobStateReady {
+			s.decrementGroupCount(job.getSchedulerGroup(), q)
+		}
+		removed = append(removed, job)
+	}
+
+	s.rpl.Lock()
+	for _, job := range removed {
+		key := job.key()
+		if repGroup != "" {
+			delete(s.rpl.lookup[repGroup], key)
+		}
+		delete(s.rpl.lookup[job.RepGroup], key)
+	}
+	s.rpl.Unlock()
+	return
+}
+
+// jobModification describes the changes to make to jobs in modifyJobs(). Nil
+// values are left unchanged.
+type jobModification struct {
+	Priority *uint8
+	Retries  *uint8
+	Override *uint8
+	RAM      *int
+	Time     *time.Duration
+	Cores    *int
+	Disk     *int
+}
+
+// modifyJobs changes the priority, retries and resource requirements of the
+// given jobs, returning the ones that were modified. Running jobs are not
+// modified.
+func (s *Server) modifyJobs(q *queue.Queue, jobs []*Job, mod *jobModification) (modified []*Job) {
+	reqsChanged := false
+	for _, job := range jobs {
+		key := job.key()
+		item, err := q.Get(key)
+		if err != nil {
+			continue
+		}
+		stats := item.Stats()
+		if stats.State == queue.ItemStateRun {
+			continue
+		}
+
+		job.Lock()
+		if mod.Priority != nil {
+			job.Priority = *mod.Priority
+		}
+		if mod.Retries != nil {
+			job.Retries = *mod.Retries
+			job.resetRetries()
+		}
+		if mod.Override != nil {
+			job.Override = *mod.Override
+		}
+		if mod.RAM != nil || mod.Time != nil || mod.Cores != nil || mod.Disk != nil {
+			req := *job.Requirements
+			if mod.RAM != nil {
+				req.RAM = *mod.RAM
+			}
+			if mod.Time != nil {
+				req.Time = *mod.Time
+			}
+			if mod.Cores != nil {
+				req.Cores = *mod.Cores
+			}
+			if mod.Disk != nil {
+				req.Disk = *mod.Disk
+			}
+			job.Requirements = &req
+			reqsChanged = true
+		}
+		priority := job.Priority
+		job.Unlock()
+
+		if mod.Priority != nil && priority != stats.Priority {
+			err = q.Update(key, item.ReserveGroup, job, priority, stats.Delay, stats.TTR)
+			if err != nil {
+				continue
+			}
+		}
+
+		err = s.db.updateLiveJob(job)
+		if err != nil {
+			logger.Error("failed to store modifications to job", "job", key, "err", err)
+		}
+		modified = append(modified, job)
+	}
+
+	// ready jobs with new requirements may need different runners
+	if reqsChanged {
+		q.TriggerReadyAddedCallback()
+	}
+	return
+}
+
+// killJobs calls killJob() on each of the given jobs, returning the ones that
+// were running and so will be killed.
+func (s *Server) killJobs(q *queue.Queue, jobs []*Job) (killed []*Job) {
+	for _, job := range jobs {
+		eligible, err := s.killJob(q, job.key())
+		if err == nil && eligible {
+			killed = append(killed, job)
+		}
+	}
+	return
+}
+
 // killJob sets the killCalled property on a job, to change the subsequent
 // behaviour of touching, which should result in an executing job killing
 // itself.
@@ -1096,16 +1632,16 @@ func (s *Server) killJob(q *queue.Queue, jobkey string) (eligible bool, err erro
 	job.killCalled = true
 
 	if job.Lost {
-		job.UntilBuried--
-		ub := job.UntilBuried
 		job.Exited = true
 		job.Exitcode = -1
 		job.EndTime = time.Now()
 		job.FailReason = FailReasonLost
+		bury := job.failed()
+		delay := job.releaseDelay()
 		job.Unlock()
 		s.db.updateJobAfterExit(job, []byte{}, []byte{}, false)
 
-		if ub <= 0 {
+		if bury {
 			err = q.Bury(item.Key)
 			if err != nil {
 				return
@@ -1113,6 +1649,7 @@ func (s *Server) killJob(q *queue.Queue, jobkey string) (eligible bool, err erro
 			s.decrementGroupCount(job.getSchedulerGroup(), q)
 			return
 		}
+		q.SetDelay(item.Key, delay)
 		err = q.Release(item.Key)
 		if err != nil {
 			return
@@ -1240,7 +1777,7 @@ func (s *Server) limitJobs(jobs []*Job, limit int, state JobState, getStd bool,
 			if state == JobStateRunning {
 				state = JobStateReserved
 			}
-			if jState != state {
+			if jState != state && !(state == JobStateReady && jState == JobStateQuota) {
 				continue
 			}
 		}
@@ -1334,9 +1871,12 @@ func (s *Server) scheduleRunners(q *queue.Queue, group string) {
 			}
 
 			if problem {
-				// log the error *** and inform (by email) the user about this
-				// problem if it's persistent, once per hour (day?)
-				log.Println(err)
+				// log the error, and email admins about this problem if it's
+				// persistent
+				logger.Error("failed to schedule runners", "queue", q.Name, "group", group, "err", err)
+				if s.emails != nil {
+					s.emails.schedulerIssue(err.Error())
+				}
 
 				// retry the schedule in a while
 				go func() {
@@ -1444,6 +1984,7 @@ func (s *Server) shutdown() {
 		<-time.After(ClientTouchInterval)
 	}
 	s.stopServing <- true
+	close(s.stopBackground)
 
 	s.Lock()
 	s.sock.Close()
@@ -1486,12 +2027,12 @@ func (s *Server) shutdown() {
 // logPanic is for (ideally temporary) use in a go routine, deferred at the
 // start of it, to figure out what is causing runtime panics that are killing
 // the server. If the die bool is true, the program exits, otherwise it
-// continues, after logging the error message and stack trace (to whatever
-// log.SetOutput is set to). Desc string should be used to describe briefly what
-// the goroutine you call this in does.
+// continues, after logging the error message and stack trace (see
+// SetLogHandler()). Desc string should be used to describe briefly what the
+// goroutine you call this in does.
 func (s *Server) logPanic(desc string, die bool) {
 	if err := recover(); err != nil {
-		log.Printf("internal error in %s: %s\n%s\n", desc, err, debug.Stack())
+		logger.Crit("internal error", "goroutine", desc, "err", err, "stack", string(debug.Stack()))
 		if die {
 			os.Exit(1)
 		}
@@ -40,13 +40,22 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 	if err != nil {
 		return err
 	}
+	cr.peer = mangosPeer(m)
 
 	q := s.getOrCreateQueue(cr.Queue)
+	rlog := logger.New("queue", cr.Queue, "method", cr.Method, "user", cr.User, "client", cr.ClientID.String())
 
 	var sr *serverResponse
 	var srerr string
 	var qerr string
 
+	started := time.Now()
+	defer func() {
+		if srerr != ErrUnknownCommand && srerr != ErrWrongUser {
+			s.metrics.request(cr.Method, time.Since(started))
+		}
+	}()
+
 	// check that the client making the request has the expected username; NB:
 	// *** this is not real security, since the client could just lie about its
 	// username! Right now this is intended to stop accidental use of someone
@@ -63,6 +72,18 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 		switch cr.Method {
 		case "ping":
 			// do nothing - not returning an error to client means ping success
+		case "log":
+			// log a message on behalf of the client, typically a runner
+			// explaining why it's having problems or exiting
+			if cr.Log == nil || cr.Log.Msg == "" {
+				srerr = ErrBadRequest
+			} else {
+				ctx := []interface{}{"host", cr.Host, "pid", cr.Log.PID}
+				for _, v := range cr.Log.Ctx {
+					ctx = append(ctx, v)
+				}
+				logAt(rlog, cr.Log.Lvl, cr.Log.Msg, ctx...)
+			}
 		case "sstats":
 			sr = &serverResponse{SStats: s.GetServerStats()}
 		case "backup":
@@ -75,6 +96,7 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 				qerr = err.Error()
 			} else {
 				sr = &serverResponse{DB: b.Bytes()}
+				s.audit(cr.User, cr.Host, cr.peer, AuditBackup, "", nil, "")
 			}
 		case "drain":
 			err := s.Drain()
@@ -83,8 +105,12 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 				qerr = err.Error()
 			} else {
 				sr = &serverResponse{SStats: s.GetServerStats()}
+				s.audit(cr.User, cr.Host, cr.peer, AuditDrain, "", nil, "")
 			}
 		case "shutdown":
+			// (we have to record this before stopping, since that closes the
+			// db)
+			s.audit(cr.User, cr.Host, cr.peer, AuditShutdown, "", nil, "")
 			err := s.Stop()
 			if err != nil {
 				srerr = ErrInternalError
@@ -104,12 +130,13 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 				} else {
 					if srerr == "" {
 						// create the jobs server-side
-						added, dups, alreadyComplete, thisSrerr, err := s.createJobs(q, cr.Jobs, envkey, cr.IgnoreComplete)
+						added, dups, alreadyComplete, thisSrerr, err := s.createJobs(q, cr.Jobs, envkey, cr.User, cr.IgnoreComplete)
 						if err != nil {
 							srerr = thisSrerr
 							qerr = err.Error()
 						} else {
 							sr = &serverResponse{Added: added, Existed: dups + alreadyComplete}
+							s.auditJobs(cr.User, cr.Host, cr.peer, AuditAdd, cr.Queue, cr.Jobs, fmt.Sprintf("%d added, %d already existed", added, dups+alreadyComplete))
 						}
 					}
 				}
@@ -205,24 +232,32 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 					sjob.PeakRAM = 0
 					sjob.Exitcode = -1
 					sjob.Unlock()
+					s.arrayElementDequeued(q, sjob)
 
 					q.SetDelay(item.Key, ClientReleaseDelay)
 
 					// make a copy of the job with some extra stuff filled in (that
 					// we don't want taking up memory here) for the client
 					job := s.itemToJob(item, false, true)
-					sr = &serverResponse{Job: job}
+					if job.TimeLimit == 0 {
+						job.TimeLimit = s.timeLimit
+					}
+					sr = &serverResponse{Job: job, CacheDir: s.cacheDir}
 				}
 			} // else we'll return nothing, as if there were no jobs in the queue
 		case "jstart":
 			// update the job's cmd-started-related properties
+			var item *queue.Item
 			var job *Job
-			_, job, srerr = s.getij(cr, q)
+			item, job, srerr = s.getij(cr, q)
 			if srerr == "" {
 				job.Lock()
 				if cr.Job.Pid <= 0 || cr.Job.Host == "" {
 					srerr = ErrBadRequest
 				} else {
+					if job.Attempts == 0 {
+						s.metrics.jobStarted(job.ReqGroup, item.Stats().Age)
+					}
 					job.Host = cr.Job.Host
 					if job.Host != "" {
 						job.HostID = s.scheduler.HostToID(job.Host)
@@ -273,6 +308,9 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 						// this transition from lost to running state
 						s.statusCaster.Send(&jstateCount{"+all+", JobStateLost, JobStateRunning, 1})
 						s.statusCaster.Send(&jstateCount{job.RepGroup, JobStateLost, JobStateRunning, 1})
+						job.RLock()
+						s.events.publish(jobStateEvent(job, JobStateLost, JobStateRunning))
+						job.RUnlock()
 					}
 				}
 				sr = &serverResponse{KillCalled: killCalled}
@@ -286,10 +324,17 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 				job.Exited = true
 				job.Exitcode = cr.Job.Exitcode
 				job.PeakRAM = cr.Job.PeakRAM
+				job.PeakDisk = cr.Job.PeakDisk
 				job.CPUtime = cr.Job.CPUtime
 				job.EndTime = time.Now()
 				job.ActualCwd = cr.Job.ActualCwd
+				job.CacheKey = cr.Job.CacheKey
+				job.CacheStatus = cr.Job.CacheStatus
+				reqGroup, ran, wall := job.ReqGroup, !job.StartTime.IsZero(), job.EndTime.Sub(job.StartTime)
 				job.Unlock()
+				if ran {
+					s.metrics.jobEnded(reqGroup, wall, cr.Job.PeakRAM)
+				}
 				s.db.updateJobAfterExit(job, cr.Job.StdOutC, cr.Job.StdErrC, false)
 			}
 		case "jarchive":
@@ -327,11 +372,16 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 							qerr = err.Error()
 						} else {
 							s.rpl.Lock()
+							allComplete := false
 							if m, exists := s.rpl.lookup[job.RepGroup]; exists {
 								delete(m, key)
+								allComplete = len(m) == 0
 							}
 							s.rpl.Unlock()
 							s.decrementGroupCount(job.schedulerGroup, q)
+							if allComplete {
+								s.notifyRepGroupWebhooks(job.RepGroup, job.Webhook)
+							}
 						}
 					}
 				}
@@ -345,15 +395,38 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 			if srerr == "" {
 				job.Lock()
 				job.FailReason = cr.Job.FailReason
-				if !job.StartTime.IsZero() {
-					// obey jobs's Retries count by adjusting UntilBuried if a
-					// client reserved this job and started to run the job's cmd
-					job.UntilBuried--
+				bury := job.UntilBuried == 0
+				if !job.StartTime.IsZero() || (job.RetryPolicy != nil && job.FailReason == FailReasonMount) {
+					// obey jobs's Retries count (or infrastructure retries) by
+					// adjusting UntilBuried if a client reserved this job and
+					// started to run the job's cmd (or failed to mount for it)
+					bury = job.failed()
+				}
+				if job.Exited && (job.Exitcode != 0 || job.FailReason == FailReasonTime) {
+					// increase requirements according to the job's escalation
+					// policy, burying if they can't go any higher
+					if s.escalateAfterFailure(job) {
+						bury = true
+					}
 				}
-				if job.Exited && job.Exitcode != 0 {
-					job.updateRecsAfterFailure()
+				delay := job.releaseDelay()
+
+				// tell the client what we did
+				req := *job.Requirements
+				rjob := &Job{
+					Requirements:     &req,
+					Override:         job.Override,
+					Escalations:      job.Escalations,
+					UntilBuried:      job.UntilBuried,
+					InfraUntilBuried: job.InfraUntilBuried,
+					State:            JobStateDelayed,
 				}
-				if job.UntilBuried <= 0 {
+				if bury {
+					rjob.State = JobStateBuried
+				}
+				sr = &serverResponse{Job: rjob}
+
+				if bury {
 					job.Unlock()
 					err = q.Bury(item.Key)
 					if err != nil {
@@ -364,6 +437,7 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 					}
 				} else {
 					job.Unlock()
+					q.SetDelay(item.Key, delay)
 					err = q.Release(item.Key)
 					if err != nil {
 						srerr = ErrInternalError
@@ -401,7 +475,7 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 			if cr.Keys == nil {
 				srerr = ErrBadRequest
 			} else {
-				kicked := 0
+				var kicked []string
 				for _, jobkey := range cr.Keys {
 					item, err := q.Get(jobkey)
 					if err != nil || item.Stats().State != queue.ItemStateBury {
@@ -411,19 +485,20 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 					if err == nil {
 						job := item.Data.(*Job)
 						job.Lock()
-						job.UntilBuried = job.Retries + 1
+						job.resetRetries()
 						job.Unlock()
-						kicked++
+						kicked = append(kicked, jobkey)
 					}
 				}
-				sr = &serverResponse{Existed: kicked}
+				sr = &serverResponse{Existed: len(kicked)}
+				s.audit(cr.User, cr.Host, cr.peer, AuditKick, cr.Queue, kicked, auditDetail(len(kicked), len(cr.Keys)))
 			}
 		case "jdel":
 			// remove the jobs from the bury queue and the live bucket
 			if cr.Keys == nil {
 				srerr = ErrBadRequest
 			} else {
-				deleted := 0
+				var deleted []string
 				for _, jobkey := range cr.Keys {
 					item, err := q.Get(jobkey)
 					if err != nil || item.Stats().State != queue.ItemStateBury {
@@ -440,11 +515,12 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 
 					err = q.Remove(jobkey)
 					if err == nil {
-						deleted++
+						deleted = append(deleted, jobkey)
 						s.db.deleteLiveJob(jobkey) //*** probably want to batch this up to delete many at once
 					}
 				}
-				sr = &serverResponse{Existed: deleted}
+				sr = &serverResponse{Existed: len(deleted)}
+				s.audit(cr.User, cr.Host, cr.peer, AuditDelete, cr.Queue, deleted, auditDetail(len(deleted), len(cr.Keys)))
 			}
 		case "jkill":
 			// set the killCalled property on the jobs, to change the subsequent
@@ -454,17 +530,34 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 			if cr.Keys == nil {
 				srerr = ErrBadRequest
 			} else {
-				killable := 0
+				var killable []string
 				for _, jobkey := range cr.Keys {
 					k, err := s.killJob(q, jobkey)
 					if err != nil {
 						continue
 					}
 					if k {
-						killable++
+						killable = append(killable, jobkey)
+					}
+				}
+				sr = &serverResponse{Existed: len(killable)}
+				s.audit(cr.User, cr.Host, cr.peer, AuditKill, cr.Queue, killable, auditDetail(len(killable), len(cr.Keys)))
+			}
+		case "jcancel":
+			// stop any more elements of the given array Jobs being created
+			if cr.Keys == nil {
+				srerr = ErrBadRequest
+			} else {
+				var cancelled []string
+				dropped := 0
+				for _, id := range cr.Keys {
+					if n := s.cancelArray(id); n > 0 {
+						cancelled = append(cancelled, id)
+						dropped += n
 					}
 				}
-				sr = &serverResponse{Existed: killable}
+				sr = &serverResponse{Existed: dropped}
+				s.audit(cr.User, cr.Host, cr.peer, AuditCancel, cr.Queue, cancelled, auditDetail(len(cancelled), len(cr.Keys)))
 			}
 		case "getbc":
 			// get jobs by their keys (which come from their Cmds & Cwds)
@@ -488,6 +581,97 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 					sr = &serverResponse{Jobs: jobs}
 				}
 			}
+		case "search":
+			// get jobs that have run, by their properties
+			if cr.Search == nil {
+				srerr = ErrBadRequest
+			} else {
+				var jobs []*Job
+				jobs, srerr, qerr = s.searchJobs(q, cr.Search, cr.Limit, cr.GetStd, cr.GetEnv)
+				if len(jobs) > 0 {
+					sr = &serverResponse{Jobs: jobs}
+				}
+			}
+		case "getarr":
+			// summarise the states of array job elements
+			if cr.Job == nil {
+				srerr = ErrBadRequest
+			} else {
+				var arrays []*ArrayStatus
+				arrays, srerr, qerr = s.getArrayStatuses(q, cr.Job.RepGroup)
+				if srerr == "" {
+					sr = &serverResponse{Arrays: arrays}
+				}
+			}
+		case "rgstats":
+			// summarise what we've learned about ReqGroups
+			if cr.Job == nil {
+				srerr = ErrBadRequest
+			} else {
+				stats, err := s.getReqGroupStats(cr.Job.ReqGroup)
+				if err != nil {
+					srerr = ErrDBError
+					qerr = err.Error()
+				} else {
+					sr = &serverResponse{ReqGroups: stats}
+				}
+			}
+		case "rgreset":
+			// forget what we've learned about a ReqGroup
+			if cr.Job == nil || cr.Job.ReqGroup == "" {
+				srerr = ErrBadRequest
+			} else {
+				_, err := s.db.resetReqGroup(cr.Job.ReqGroup)
+				if err != nil {
+					srerr = ErrDBError
+					qerr = err.Error()
+				} else {
+					s.audit(cr.User, cr.Host, cr.peer, AuditModify, "", nil, "reset the learned resource usage of ReqGroup "+cr.Job.ReqGroup)
+				}
+			}
+		case "rgconf":
+			// change how we recommend resources for a ReqGroup
+			if cr.Job == nil || cr.Job.ReqGroup == "" {
+				srerr = ErrBadRequest
+			} else {
+				err := s.db.setReqGroupRecConfig(cr.Job.ReqGroup, cr.RecConfig)
+				if err == nil {
+					var stats []*ReqGroupStats
+					stats, err = s.getReqGroupStats(cr.Job.ReqGroup)
+					sr = &serverResponse{ReqGroups: stats}
+					s.audit(cr.User, cr.Host, cr.peer, AuditModify, "", nil, "changed the resource recommendation config of ReqGroup "+cr.Job.ReqGroup)
+				}
+				if err != nil {
+					srerr = ErrDBError
+					qerr = err.Error()
+				}
+			}
+		case "rgescalate":
+			// change the escalation policy of a ReqGroup
+			if cr.Job == nil || cr.Job.ReqGroup == "" {
+				srerr = ErrBadRequest
+			} else {
+				err := s.db.setReqGroupEscalationPolicy(cr.Job.ReqGroup, cr.Job.EscalationPolicy)
+				if err != nil {
+					srerr = ErrDBError
+					qerr = err.Error()
+				} else {
+					s.audit(cr.User, cr.Host, cr.peer, AuditModify, "", nil, "changed the escalation policy of ReqGroup "+cr.Job.ReqGroup)
+				}
+			}
+		case "getaudit":
+			// get the audit trail
+			if cr.Audit == nil {
+				srerr = ErrBadRequest
+			} else {
+				entries, err := s.db.retrieveAudit(cr.Audit)
+				if err != nil {
+					srerr = ErrDBError
+					qerr = err.Error()
+				} else {
+					sr = &serverResponse{Audit: entries}
+				}
+			}
 		case "getin":
 			// get all jobs in the jobqueue
 			jobs := s.getJobsCurrent(q, cr.Limit, cr.State, cr.GetStd, cr.GetEnv)
@@ -510,6 +694,14 @@ func (s *Server) handleRequest(m *mangos.Message) error {
 		if cr.Job != nil {
 			key = cr.Job.key()
 		}
+		if ServerLogClientErrors {
+			s.krmutex.RLock()
+			inShutdown := s.killRunners
+			s.krmutex.RUnlock()
+			if !inShutdown {
+				rlog.Warn("client request failed", "job", key, "err", qerr)
+			}
+		}
 		return Error{cr.Queue, cr.Method, key, qerr}
 	}
 
@@ -563,43 +755,65 @@ func (s *Server) itemToJob(item *queue.Item, getStd bool, getEnv bool) (job *Job
 		state = JobStateUnknown
 	} else if state == JobStateReserved && sjob.Lost {
 		state = JobStateLost
+	} else if state == JobStateReady && sjob.quotaHeld {
+		state = JobStateQuota
 	}
 
 	// we're going to fill in some properties of the Job and return
 	// it to client, but don't want those properties set here for
 	// us, so we make a new Job and fill stuff in that
 	job = &Job{
-		RepGroup:     sjob.RepGroup,
-		ReqGroup:     sjob.ReqGroup,
-		DepGroups:    sjob.DepGroups,
-		Cmd:          sjob.Cmd,
-		Cwd:          sjob.Cwd,
-		CwdMatters:   sjob.CwdMatters,
-		ChangeHome:   sjob.ChangeHome,
-		ActualCwd:    sjob.ActualCwd,
-		Requirements: sjob.Requirements,
-		Priority:     sjob.Priority,
-		Retries:      sjob.Retries,
-		PeakRAM:      sjob.PeakRAM,
-		Exited:       sjob.Exited,
-		Exitcode:     sjob.Exitcode,
-		FailReason:   sjob.FailReason,
-		StartTime:    sjob.StartTime,
-		EndTime:      sjob.EndTime,
-		Pid:          sjob.Pid,
-		Host:         sjob.Host,
-		HostID:       sjob.HostID,
-		HostIP:       sjob.HostIP,
-		CPUtime:      sjob.CPUtime,
-		State:        state,
-		Attempts:     sjob.Attempts,
-		UntilBuried:  sjob.UntilBuried,
-		ReservedBy:   sjob.ReservedBy,
-		EnvKey:       sjob.EnvKey,
-		EnvOverride:  sjob.EnvOverride,
-		Dependencies: sjob.Dependencies,
-		Behaviours:   sjob.Behaviours,
-		MountConfigs: sjob.MountConfigs,
+		RepGroup:         sjob.RepGroup,
+		ReqGroup:         sjob.ReqGroup,
+		DepGroups:        sjob.DepGroups,
+		Cmd:              sjob.Cmd,
+		Cwd:              sjob.Cwd,
+		CwdMatters:       sjob.CwdMatters,
+		ChangeHome:       sjob.ChangeHome,
+		ActualCwd:        sjob.ActualCwd,
+		Requirements:     sjob.Requirements,
+		Priority:         sjob.Priority,
+		Retries:          sjob.Retries,
+		RetryPolicy:      sjob.RetryPolicy,
+		EscalationPolicy: sjob.EscalationPolicy,
+		TimeLimit:        sjob.TimeLimit,
+		KillSequence:     sjob.KillSequence,
+		Checkpoint:       sjob.Checkpoint,
+		PeakRAM:          sjob.PeakRAM,
+		PeakDisk:         sjob.PeakDisk,
+		Exited:           sjob.Exited,
+		Exitcode:         sjob.Exitcode,
+		FailReason:       sjob.FailReason,
+		StartTime:        sjob.StartTime,
+		EndTime:          sjob.EndTime,
+		Pid:              sjob.Pid,
+		Host:             sjob.Host,
+		HostID:           sjob.HostID,
+		HostIP:           sjob.HostIP,
+		CPUtime:          sjob.CPUtime,
+		State:            state,
+		Attempts:         sjob.Attempts,
+		UntilBuried:      sjob.UntilBuried,
+		InfraUntilBuried: sjob.InfraUntilBuried,
+		Escalations:      sjob.Escalations,
+		ReservedBy:       sjob.ReservedBy,
+		EnvKey:           sjob.EnvKey,
+		EnvOverride:      sjob.EnvOverride,
+		Dependencies:     sjob.Dependencies,
+		Behaviours:       sjob.Behaviours,
+		MountConfigs:     sjob.MountConfigs,
+		Inputs:           sjob.Inputs,
+		Outputs:          sjob.Outputs,
+		Cache:            sjob.Cache,
+		Webhook:          sjob.Webhook,
+		Array:            sjob.Array,
+		Freshness:        sjob.Freshness,
+		CacheKey:         sjob.CacheKey,
+		CacheStatus:      sjob.CacheStatus,
+		ArrayID:          sjob.ArrayID,
+		ArrayIndex:       sjob.ArrayIndex,
+		ArraySize:        sjob.ArraySize,
+		User:             sjob.User,
 	}
 
 	if !sjob.StartTime.IsZero() && state == JobStateReserved {
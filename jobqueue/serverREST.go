@@ -42,6 +42,16 @@ const restJobsEndpoint = "/rest/v1/jobs/"
 const restWarningsEndpoint = "/rest/v1/warnings/"
 const restBadServersEndpoint = "/rest/v1/servers/"
 
+// restJobsKick and restJobsKill are the suffixes of the restJobsEndpoint urls
+// that you POST to in order to retry buried jobs or kill running ones.
+// restJobsCancel is the suffix for stopping the rest of array Jobs being
+// created.
+const (
+	restJobsKick   = "/kick"
+	restJobsKill   = "/kill"
+	restJobsCancel = "/cancel"
+)
+
 // JobViaJSON describes the properties of a JOB that a user wishes to add to the
 // queue, convenient if they are supplying JSON.
 type JobViaJSON struct {
@@ -57,22 +67,32 @@ type JobViaJSON struct {
 	Time string `json:"time"`
 	CPUs *int   `json:"cpus"`
 	// Disk is the number of Gigabytes the cmd will use.
-	Disk        *int              `json:"disk"`
-	Override    *int              `json:"override"`
-	Priority    *int              `json:"priority"`
-	Retries     *int              `json:"retries"`
-	RepGrp      string            `json:"rep_grp"`
-	DepGrps     []string          `json:"dep_grps"`
-	Deps        []string          `json:"deps"`
-	CmdDeps     Dependencies      `json:"cmd_deps"`
-	OnFailure   BehavioursViaJSON `json:"on_failure"`
-	OnSuccess   BehavioursViaJSON `json:"on_success"`
-	OnExit      BehavioursViaJSON `json:"on_exit"`
-	Env         []string          `json:"env"`
-	CloudOS     string            `json:"cloud_os"`
-	CloudUser   string            `json:"cloud_username"`
-	CloudScript string            `json:"cloud_script"`
-	CloudOSRam  *int              `json:"cloud_ram"`
+	Disk        *int                     `json:"disk"`
+	Override    *int                     `json:"override"`
+	Priority    *int                     `json:"priority"`
+	Retries     *int                     `json:"retries"`
+	RetryPolicy *RetryPolicyViaJSON      `json:"retry_policy"`
+	Escalation  *EscalationPolicyViaJSON `json:"escalation"`
+	TimeLimit   *float64                 `json:"time_limit"`
+	KillSeq     string                   `json:"kill_sequence"`
+	Checkpoint  *CheckpointViaJSON       `json:"checkpoint"`
+	RepGrp      string                   `json:"rep_grp"`
+	DepGrps     []string                 `json:"dep_grps"`
+	Deps        []string                 `json:"deps"`
+	CmdDeps     Dependencies             `json:"cmd_deps"`
+	OnFailure   BehavioursViaJSON        `json:"on_failure"`
+	OnSuccess   BehavioursViaJSON        `json:"on_success"`
+	OnExit      BehavioursViaJSON        `json:"on_exit"`
+	Env         []string                 `json:"env"`
+	CloudOS     string                   `json:"cloud_os"`
+	CloudUser   string                   `json:"cloud_username"`
+	CloudScript string                   `json:"cloud_script"`
+	CloudOSRam  *int                     `json:"cloud_ram"`
+	InputFiles  []string                 `json:"input_files"`
+	OutputFiles []string                 `json:"output_files"`
+	Cache       bool                     `json:"cache"`
+	Array       *JobArray                `json:"array"`
+	Webhook     string                   `json:"webhook"`
 }
 
 // JobDefaults is supplied to JobViaJSON.Convert() to provide default values for
@@ -91,12 +111,23 @@ type JobDefaults struct {
 	// Time is the amount of time each cmd will run for. Defaults to 1 hour.
 	Time time.Duration
 	// Disk is the number of Gigabytes cmds will use.
-	Disk      int
-	Override  int
-	Priority  int
-	Retries   int
-	DepGroups []string
-	Deps      Dependencies
+	Disk     int
+	Override int
+	Priority int
+	Retries  int
+	// RetryPolicy refines how failed cmds are retried.
+	RetryPolicy *RetryPolicy
+	// EscalationPolicy changes how requirements are increased after cmds use
+	// too much memory or time.
+	EscalationPolicy *EscalationPolicy
+	// TimeLimit is the multiple of Time after which cmds are killed.
+	TimeLimit float64
+	// KillSequence describes how cmds are stopped gracefully.
+	KillSequence KillSequence
+	// Checkpoint describes how cmds save their progress.
+	Checkpoint *Checkpoint
+	DepGroups  []string
+	Deps       Dependencies
 	// Env is a comma separated list of key=val pairs.
 	Env          string
 	OnFailure    Behaviours
@@ -109,7 +140,11 @@ type JobDefaults struct {
 	CloudScript string
 	// CloudOSRam is the number of Megabytes that CloudOS needs to run. Defaults
 	// to 1000.
-	CloudOSRam    int
+	CloudOSRam int
+	// Cache turns on result caching for cmds that have output_files.
+	Cache bool
+	// Webhook is a URL to notify about jobs being buried or completing.
+	Webhook       string
 	compressedEnv []byte
 	osRAM         string
 }
@@ -192,6 +227,13 @@ func (jvj *JobViaJSON) Convert(jd *JobDefaults) (job *Job, err error) {
 		return
 	}
 
+	if jvj.Array != nil {
+		err = jvj.Array.validate(cmd)
+		if err != nil {
+			return
+		}
+	}
+
 	if jvj.Cwd == "" {
 		cwd = jd.DefaultCwd()
 	} else {
@@ -208,6 +250,22 @@ func (jvj *JobViaJSON) Convert(jd *JobDefaults) (job *Job, err error) {
 		changeHome = true
 	}
 
+	cache := jd.Cache
+	if jvj.Cache {
+		cache = true
+	}
+
+	webhook := jd.Webhook
+	if jvj.Webhook != "" {
+		webhook = jvj.Webhook
+	}
+	if webhook != "" {
+		err = checkWebhookURL(webhook)
+		if err != nil {
+			return
+		}
+	}
+
 	if jvj.ReqGrp == "" {
 		if jd.ReqGrp != "" {
 			rg = jd.ReqGrp
@@ -282,6 +340,47 @@ func (jvj *JobViaJSON) Convert(jd *JobDefaults) (job *Job, err error) {
 		return
 	}
 
+	retryPolicy := jd.RetryPolicy
+	if jvj.RetryPolicy != nil {
+		retryPolicy, err = jvj.RetryPolicy.RetryPolicy()
+		if err != nil {
+			return
+		}
+	}
+
+	escalationPolicy := jd.EscalationPolicy
+	if jvj.Escalation != nil {
+		escalationPolicy, err = jvj.Escalation.EscalationPolicy()
+		if err != nil {
+			return
+		}
+	}
+
+	timeLimit := jd.TimeLimit
+	if jvj.TimeLimit != nil {
+		timeLimit = *jvj.TimeLimit
+	}
+	if timeLimit > 0 && timeLimit < 1 {
+		err = fmt.Errorf("time_limit value (%g) would kill commands before their expected time", timeLimit)
+		return
+	}
+
+	killSequence := jd.KillSequence
+	if jvj.KillSeq != "" {
+		killSequence, err = ParseKillSequence(jvj.KillSeq)
+		if err != nil {
+			return
+		}
+	}
+
+	checkpoint := jd.Checkpoint
+	if jvj.Checkpoint != nil {
+		checkpoint, err = jvj.Checkpoint.Checkpoint()
+		if err != nil {
+			return
+		}
+	}
+
 	if len(jvj.DepGrps) == 0 {
 		depGroups = jd.DepGroups
 	} else {
@@ -364,41 +463,82 @@ func (jvj *JobViaJSON) Convert(jd *JobDefaults) (job *Job, err error) {
 	}
 
 	job = &Job{
-		RepGroup:     repg,
-		Cmd:          cmd,
-		Cwd:          cwd,
-		CwdMatters:   cwdMatters,
-		ChangeHome:   changeHome,
-		ReqGroup:     rg,
-		Requirements: &jqs.Requirements{RAM: mb, Time: dur, Cores: cpus, Disk: disk, Other: other},
-		Override:     uint8(override),
-		Priority:     uint8(priority),
-		Retries:      uint8(retries),
-		DepGroups:    depGroups,
-		Dependencies: deps,
-		EnvOverride:  envOverride,
-		Behaviours:   behaviours,
-		MountConfigs: mounts,
+		RepGroup:         repg,
+		Cmd:              cmd,
+		Cwd:              cwd,
+		CwdMatters:       cwdMatters,
+		ChangeHome:       changeHome,
+		ReqGroup:         rg,
+		Requirements:     &jqs.Requirements{RAM: mb, Time: dur, Cores: cpus, Disk: disk, Other: other},
+		Override:         uint8(override),
+		Priority:         uint8(priority),
+		Retries:          uint8(retries),
+		RetryPolicy:      retryPolicy,
+		EscalationPolicy: escalationPolicy,
+		TimeLimit:        timeLimit,
+		KillSequence:     killSequence,
+		Checkpoint:       checkpoint,
+		DepGroups:        depGroups,
+		Dependencies:     deps,
+		EnvOverride:      envOverride,
+		Behaviours:       behaviours,
+		MountConfigs:     mounts,
+		Inputs:           jvj.InputFiles,
+		Outputs:          jvj.OutputFiles,
+		Cache:            cache,
+		Array:            jvj.Array,
+		Webhook:          webhook,
 	}
 	return
 }
 
-// restJobs lets you do CRUD on jobs in the "cmds" queue.
+// restJobs lets you do CRUD on jobs in the "cmds" queue. As well as GETting
+// their status and POSTing new jobs, you can DELETE jobs, PUT modifications to
+// them, and POST to restJobsKick and restJobsKill suffixed urls to retry or kill
+// them; these all return the affected jobs.
 func restJobs(s *Server, q *queue.Queue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		r.ParseForm()
 
+		// handle the ?fields parameter, which applies to every response
+		var fields []string
+		if r.Form.Get("fields") != "" {
+			var err error
+			fields, err = jstatusFields(r.Form.Get("fields"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		// carry out a different action based on the HTTP Verb
 		var jobs []*Job
 		var status int
 		var err error
 		switch r.Method {
 		case http.MethodGet:
-			jobs, status, err = restJobsStatus(r, s, q)
+			jobs, status, err = restJobsStatus(w, r, s, q)
 		case http.MethodPost:
-			jobs, status, err = restJobsAdd(r, s, q)
+			switch {
+			case strings.HasSuffix(r.URL.Path, restJobsKick):
+				jobs, status, err = restJobsKickOrKill(r, s, q, restJobsKick)
+			case strings.HasSuffix(r.URL.Path, restJobsKill):
+				jobs, status, err = restJobsKickOrKill(r, s, q, restJobsKill)
+			case strings.HasSuffix(r.URL.Path, restJobsCancel):
+				jobs, status, err = restJobsCancelArrays(r, s, q)
+			case strings.TrimPrefix(r.URL.Path, restJobsEndpoint) != "":
+				status = http.StatusNotFound
+				err = fmt.Errorf("you can only POST new jobs, or POST to %s, %s or %s", restJobsKick, restJobsKill, restJobsCancel)
+			default:
+				jobs, status, err = restJobsAdd(r, s, q)
+			}
+		case http.MethodPut:
+			jobs, status, err = restJobsModify(r, s, q)
+		case http.MethodDelete:
+			jobs, status, err = restJobsDelete(r, s, q)
 		default:
-			http.Error(w, "So far only GET and POST are supported", http.StatusBadRequest)
+			w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+			http.Error(w, "Only GET, POST, PUT and DELETE are supported", http.StatusMethodNotAllowed)
 			return
 		}
 
@@ -418,6 +558,14 @@ func restJobs(s *Server, q *queue.Queue) http.HandlerFunc {
 		w.WriteHeader(status)
 		encoder := json.NewEncoder(w)
 		encoder.SetEscapeHTML(false)
+		if fields != nil {
+			selected := make([]map[string]interface{}, len(jstati))
+			for i, jstatus := range jstati {
+				selected[i] = selectFields(jstatus, fields)
+			}
+			encoder.Encode(selected)
+			return
+		}
 		encoder.Encode(jstati)
 	}
 }
@@ -426,8 +574,22 @@ func restJobs(s *Server, q *queue.Queue) http.HandlerFunc {
 // request url can be suffixed with comma seperated job keys or RepGroups.
 // Possible query parameters are std, env (which can take a "true" value), limit
 // (a number) and state (one of delayed|ready|reserved|running|lost|buried|
-// dependent|complete).
-func restJobsStatus(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, status int, err error) {
+// dependent|quota|complete).
+//
+// Instead of limit, you can supply page_size (a number) to get the jobs a page
+// at a time, in key order or sorted by sort (one of start|walltime|peakram,
+// prefixed with "-" for descending order; sorting is refused if more than
+// ServerMaxSortJobs jobs were requested). If there are more jobs, a Link
+// header with rel="next" gives the url of the next page, which has an after
+// parameter set to an opaque cursor.
+//
+// Instead, to search the history of jobs that have run, you can supply any of
+// the parameters of restJobSearch() (without any job keys or RepGroups in the
+// url); limit and std also apply to the results.
+//
+// All the jobs endpoints take a fields parameter, a comma separated list of
+// the jstatus fields you want returned, eg. fields=Key,State.
+func restJobsStatus(w http.ResponseWriter, r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, status int, err error) {
 	status = http.StatusOK
 
 	// handle possible ?query parameters
@@ -449,24 +611,61 @@ func restJobsStatus(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, st
 		}
 	}
 	if r.Form.Get("state") != "" {
-		switch r.Form.Get("state") {
-		case "delayed":
-			state = JobStateDelayed
-		case "ready":
-			state = JobStateReady
-		case "reserved":
-			state = JobStateReserved
-		case "running":
-			state = JobStateRunning
-		case "lost":
-			state = JobStateLost
-		case "buried":
-			state = JobStateBuried
-		case "dependent":
-			state = JobStateDependent
-		case "complete":
-			state = JobStateComplete
+		state = restJobState(r.Form.Get("state"))
+	}
+
+	page, err := parseJobPage(r.Form, state, getStd, getEnv)
+	if err == nil && page != nil && limit > 0 {
+		err = fmt.Errorf("limit and page_size can't be used together")
+	}
+	if err != nil {
+		status = http.StatusBadRequest
+		return
+	}
+
+	search, err := restJobSearch(r)
+	if err == nil && search != nil && (page != nil || len(r.URL.Path) > len(restJobsEndpoint)) {
+		err = fmt.Errorf("search parameters can't be used with page_size or job keys or RepGroups")
+	}
+	if err != nil {
+		status = http.StatusBadRequest
+		return
+	}
+	if search != nil {
+		var srerr, qerr string
+		jobs, srerr, qerr = s.searchJobs(q, search, limit, getStd, getEnv)
+		if srerr != "" {
+			status = http.StatusInternalServerError
+			if srerr == ErrBadRequest {
+				status = http.StatusBadRequest
+			}
+			err = fmt.Errorf(qerr)
+		}
+		return
+	}
+
+	if page != nil {
+		var ids []string
+		if len(r.URL.Path) > len(restJobsEndpoint) {
+			ids = strings.Split(r.URL.Path[len(restJobsEndpoint):], ",")
+		}
+		var next *jobCursor
+		jobs, next, err = s.pageJobs(q, ids, page)
+		if err != nil {
+			status = http.StatusInternalServerError
+			if err == errTooManyToSort {
+				status = http.StatusBadRequest
+			}
+			return
 		}
+		if next != nil {
+			nextURL := *r.URL
+			query := nextURL.Query()
+			query.Set("after", next.String())
+			nextURL.RawQuery = query.Encode()
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.RequestURI()))
+		}
+		return
 	}
 
 	if len(r.URL.Path) > len(restJobsEndpoint) {
@@ -501,6 +700,359 @@ func restJobsStatus(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, st
 	return
 }
 
+// restJobSearch converts the search parameters of a request in to a
+// JobSearch, returning nil if there weren't any. The parameters are since and
+// until (RFC 3339 times), exitcode (a number), fail_reason, host, req_grp, user
+// and cmd (a regular expression), as per the properties of JobSearch.
+func restJobSearch(r *http.Request) (search *JobSearch, err error) {
+	js := &JobSearch{
+		FailReason: r.Form.Get("fail_reason"),
+		Host:       r.Form.Get("host"),
+		ReqGroup:   r.Form.Get("req_grp"),
+		User:       r.Form.Get("user"),
+		Cmd:        r.Form.Get("cmd"),
+	}
+	given := js.FailReason != "" || js.Host != "" || js.ReqGroup != "" || js.User != "" || js.Cmd != ""
+	for i, t := range []*time.Time{&js.Since, &js.Until} {
+		name := []string{"since", "until"}[i]
+		if r.Form.Get(name) == "" {
+			continue
+		}
+		*t, err = time.Parse(time.RFC3339, r.Form.Get(name))
+		if err != nil {
+			err = fmt.Errorf("%s must be an RFC 3339 time", name)
+			return
+		}
+		given = true
+	}
+	if r.Form.Get("exitcode") != "" {
+		exitcode, perr := strconv.Atoi(r.Form.Get("exitcode"))
+		if perr != nil {
+			err = fmt.Errorf("exitcode must be a number")
+			return
+		}
+		js.Exitcode = &exitcode
+		given = true
+	}
+	if given {
+		search = js
+	}
+	return
+}
+
+// restJobState converts the value of a state url parameter to a JobState,
+// returning "" if it isn't a state that jobs can be requested by.
+func restJobState(value string) (state JobState) {
+	switch value {
+	case "delayed":
+		state = JobStateDelayed
+	case "ready":
+		state = JobStateReady
+	case "reserved":
+		state = JobStateReserved
+	case "running":
+		state = JobStateRunning
+	case "lost":
+		state = JobStateLost
+	case "buried":
+		state = JobStateBuried
+	case "dependent":
+		state = JobStateDependent
+	case "quota":
+		state = JobStateQuota
+	case "complete":
+		state = JobStateComplete
+	}
+	return
+}
+
+// restJobsTargets finds the incomplete jobs in the given queue that a DELETE,
+// PUT, kick or kill request is for. The request url must be suffixed with comma
+// separated job keys or RepGroups (optionally followed by an action suffix).
+// Possible query parameters, which limit the jobs to those that match, are
+// state (as per restJobsStatus()), exitcode (a number) and fail_reason. It
+// returns the server's own copies of the jobs, along with client copies of
+// them in their current state.
+func restJobsTargets(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, current []*Job, status int, err error) {
+	ids := strings.TrimPrefix(r.URL.Path, restJobsEndpoint)
+	ids = strings.TrimSuffix(strings.TrimSuffix(ids, restJobsKick), restJobsKill)
+	if ids == "" {
+		status = http.StatusBadRequest
+		err = fmt.Errorf("job keys or RepGroups must be supplied in the url")
+		return
+	}
+
+	// handle possible ?query parameters
+	var state JobState
+	if r.Form.Get("state") != "" {
+		state = restJobState(r.Form.Get("state"))
+		if state == "" || state == JobStateComplete {
+			status = http.StatusBadRequest
+			err = fmt.Errorf("state %s is not valid here", r.Form.Get("state"))
+			return
+		}
+	}
+	var exitcode int
+	filterExitcode := r.Form.Get("exitcode") != ""
+	if filterExitcode {
+		exitcode, err = strconv.Atoi(r.Form.Get("exitcode"))
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+	}
+	failReason := r.Form.Get("fail_reason")
+
+	// get the matching items from the queue
+	var items []*queue.Item
+	seen := make(map[string]bool)
+	addItem := func(key string) {
+		if seen[key] {
+			return
+		}
+		item, qerr := q.Get(key)
+		if qerr != nil || item == nil {
+			return
+		}
+		seen[key] = true
+		items = append(items, item)
+	}
+	for _, id := range strings.Split(ids, ",") {
+		if len(id) == 32 {
+			// id might be a Job.key()
+			if item, qerr := q.Get(id); qerr == nil && item != nil {
+				addItem(id)
+				continue
+			}
+		}
+
+		// id might be a Job.RepGroup
+		s.rpl.RLock()
+		var keys []string
+		for key := range s.rpl.lookup[id] {
+			keys = append(keys, key)
+		}
+		s.rpl.RUnlock()
+		for _, key := range keys {
+			addItem(key)
+		}
+	}
+
+	for _, item := range items {
+		job := s.itemToJob(item, false, false)
+		if state != "" {
+			jState := job.State
+			switch {
+			case jState == JobStateRunning && state == JobStateReserved:
+				jState = JobStateReserved
+			case jState == JobStateReserved && state == JobStateRunning:
+				jState = JobStateRunning
+			case jState == JobStateQuota && state == JobStateReady:
+				jState = JobStateReady
+			}
+			if jState != state {
+				continue
+			}
+		}
+		if filterExitcode && job.Exitcode != exitcode {
+			continue
+		}
+		if failReason != "" && job.FailReason != failReason {
+			continue
+		}
+		jobs = append(jobs, item.Data.(*Job))
+		current = append(current, job)
+	}
+
+	if len(jobs) == 0 {
+		status = http.StatusNotFound
+		err = fmt.Errorf("no incomplete jobs matched your request")
+		return
+	}
+	status = http.StatusOK
+	return
+}
+
+// restJobsRefresh gets client copies of the given server jobs in their current
+// state.
+func restJobsRefresh(s *Server, q *queue.Queue, jobs []*Job) (refreshed []*Job) {
+	for _, job := range jobs {
+		item, err := q.Get(job.key())
+		if err != nil || item == nil {
+			continue
+		}
+		refreshed = append(refreshed, s.itemToJob(item, false, false))
+	}
+	return
+}
+
+// restJobsDelete removes the requested non-running jobs (see
+// restJobsTargets()) from the given queue, returning the ones that were
+// removed, with a state of "deleted". Removing an element of an array Job only
+// affects that element; see restJobsCancelArrays() for stopping the rest of
+// the array being created.
+func restJobsDelete(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, status int, err error) {
+	targets, current, status, err := restJobsTargets(r, s, q)
+	if err != nil {
+		return
+	}
+
+	byKey := make(map[string]*Job)
+	for _, job := range current {
+		byKey[job.key()] = job
+	}
+	for _, job := range s.removeJobs(q, targets, "") {
+		deleted := byKey[job.key()]
+		deleted.State = JobStateDeleted
+		jobs = append(jobs, deleted)
+	}
+	s.auditJobs(s.owner, requestHost(r), r.RemoteAddr, AuditDelete, q.Name, jobs, auditDetail(len(jobs), len(targets)))
+	return
+}
+
+// restJobsKickOrKill retries the requested buried jobs or kills the requested
+// running jobs (see restJobsTargets()), depending on action, returning the
+// ones that were kicked or will be killed. Killing an element of an array Job
+// only affects that element; see restJobsCancelArrays() for stopping the rest
+// of the array being created.
+func restJobsKickOrKill(r *http.Request, s *Server, q *queue.Queue, action string) (jobs []*Job, status int, err error) {
+	targets, _, status, err := restJobsTargets(r, s, q)
+	if err != nil {
+		return
+	}
+
+	auditAction := AuditKick
+	if action == restJobsKick {
+		jobs = restJobsRefresh(s, q, s.kickJobs(q, targets))
+	} else {
+		jobs = restJobsRefresh(s, q, s.killJobs(q, targets))
+		auditAction = AuditKill
+	}
+	s.auditJobs(s.owner, requestHost(r), r.RemoteAddr, auditAction, q.Name, jobs, auditDetail(len(jobs), len(targets)))
+	return
+}
+
+// restJobsCancelArrays stops any more elements being created for the array
+// Jobs whose ArrayIDs the request url is suffixed with (comma separated),
+// returning the elements of those arrays that had already been created and are
+// still incomplete, so that they can be deleted or killed as desired.
+func restJobsCancelArrays(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, status int, err error) {
+	ids := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, restJobsEndpoint), restJobsCancel)
+	if ids == "" {
+		status = http.StatusBadRequest
+		err = fmt.Errorf("ArrayIDs must be supplied in the url")
+		return
+	}
+
+	cancelled := make(map[string]bool)
+	var cancelledIDs []string
+	requested := strings.Split(ids, ",")
+	for _, id := range requested {
+		if s.cancelArray(id) > 0 {
+			cancelled[id] = true
+			cancelledIDs = append(cancelledIDs, id)
+		}
+	}
+	s.audit(s.owner, requestHost(r), r.RemoteAddr, AuditCancel, q.Name, cancelledIDs, auditDetail(len(cancelledIDs), len(requested)))
+	if len(cancelledIDs) == 0 {
+		status = http.StatusNotFound
+		err = fmt.Errorf("no array jobs with uncreated elements matched your request")
+		return
+	}
+
+	for _, job := range s.getArrayElementsCurrent(q) {
+		if cancelled[job.ArrayID] {
+			jobs = append(jobs, job)
+		}
+	}
+	status = http.StatusOK
+	return
+}
+
+// restJobsModify changes the requested non-running jobs (see
+// restJobsTargets()), returning the ones that were modified. The changes are
+// given as query parameters: any of priority, retries, override, memory, time,
+// cpus and disk, which take values as per restJobsAdd().
+func restJobsModify(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, status int, err error) {
+	mod := &jobModification{}
+	var changes []string
+	uint8Param := func(name string) (*uint8, error) {
+		if r.Form.Get(name) == "" {
+			return nil, nil
+		}
+		n, perr := strconv.ParseUint(r.Form.Get(name), 10, 8)
+		if perr != nil {
+			return nil, fmt.Errorf("%s must be a number between 0 and 255", name)
+		}
+		changes = append(changes, name)
+		v := uint8(n)
+		return &v, nil
+	}
+	intParam := func(name string) (*int, error) {
+		if r.Form.Get(name) == "" {
+			return nil, nil
+		}
+		n, perr := strconv.Atoi(r.Form.Get(name))
+		if perr != nil || n < 0 {
+			return nil, fmt.Errorf("%s must be a positive number", name)
+		}
+		changes = append(changes, name)
+		return &n, nil
+	}
+
+	status = http.StatusBadRequest
+	if mod.Priority, err = uint8Param("priority"); err != nil {
+		return
+	}
+	if mod.Retries, err = uint8Param("retries"); err != nil {
+		return
+	}
+	if mod.Override, err = uint8Param("override"); err != nil {
+		return
+	}
+	if mod.Override != nil && *mod.Override > 2 {
+		err = fmt.Errorf("override must be 0, 1 or 2")
+		return
+	}
+	if mod.Cores, err = intParam("cpus"); err != nil {
+		return
+	}
+	if mod.Disk, err = intParam("disk"); err != nil {
+		return
+	}
+	if r.Form.Get("memory") != "" {
+		mb, berr := bytefmt.ToMegabytes(r.Form.Get("memory"))
+		if berr != nil {
+			err = berr
+			return
+		}
+		ram := int(mb)
+		mod.RAM = &ram
+		changes = append(changes, "memory")
+	}
+	if r.Form.Get("time") != "" {
+		var t time.Duration
+		t, err = time.ParseDuration(r.Form.Get("time"))
+		if err != nil {
+			return
+		}
+		mod.Time = &t
+		changes = append(changes, "time")
+	}
+	if len(changes) == 0 {
+		err = fmt.Errorf("no modifications were requested")
+		return
+	}
+
+	targets, _, status, err := restJobsTargets(r, s, q)
+	if err != nil {
+		return
+	}
+	jobs = restJobsRefresh(s, q, s.modifyJobs(q, targets, mod))
+	s.auditJobs(s.owner, requestHost(r), r.RemoteAddr, AuditModify, q.Name, jobs, auditDetail(len(jobs), len(targets))+"; changed "+strings.Join(changes, ", "))
+	return
+}
+
 // type JobViaJSON struct {
 //     MountConfigs MountConfigs      `json:"mounts"`
 // }
@@ -530,6 +1082,7 @@ func restJobsAdd(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, statu
 		CloudUser:   r.Form.Get("cloud_username"),
 		CloudScript: r.Form.Get("cloud_script"),
 		CloudOSRam:  urlStringToInt(r.Form.Get("cloud_ram")),
+		Webhook:     r.Form.Get("webhook"),
 	}
 	if r.Form.Get("cwd_matters") == "true" {
 		jd.CwdMatters = true
@@ -537,6 +1090,9 @@ func restJobsAdd(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, statu
 	if r.Form.Get("change_home") == "true" {
 		jd.ChangeHome = true
 	}
+	if r.Form.Get("cache") == "true" {
+		jd.Cache = true
+	}
 	if r.Form.Get("memory") != "" {
 		mb, berr := bytefmt.ToMegabytes(r.Form.Get("memory"))
 		if berr != nil {
@@ -592,6 +1148,59 @@ func restJobsAdd(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, statu
 			jd.OnExit = bvj.Behaviours(OnExit)
 		}
 	}
+	if r.Form.Get("retry_policy") != "" {
+		var rpvj RetryPolicyViaJSON
+		err = urlStringToStruct(r.Form.Get("retry_policy"), &rpvj)
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+		jd.RetryPolicy, err = rpvj.RetryPolicy()
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+	}
+	if r.Form.Get("escalation") != "" {
+		var epvj EscalationPolicyViaJSON
+		err = urlStringToStruct(r.Form.Get("escalation"), &epvj)
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+		jd.EscalationPolicy, err = epvj.EscalationPolicy()
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+	}
+	if r.Form.Get("time_limit") != "" {
+		jd.TimeLimit, err = strconv.ParseFloat(r.Form.Get("time_limit"), 64)
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+	}
+	if r.Form.Get("kill_sequence") != "" {
+		jd.KillSequence, err = ParseKillSequence(r.Form.Get("kill_sequence"))
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+	}
+	if r.Form.Get("checkpoint") != "" {
+		var cvj CheckpointViaJSON
+		err = urlStringToStruct(r.Form.Get("checkpoint"), &cvj)
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+		jd.Checkpoint, err = cvj.Checkpoint()
+		if err != nil {
+			status = http.StatusBadRequest
+			return
+		}
+	}
 	if r.Form.Get("mounts") != "" {
 		var mcs MountConfigs
 		err = urlStringToStruct(r.Form.Get("mounts"), &mcs)
@@ -621,6 +1230,10 @@ func restJobsAdd(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, statu
 			err = fmt.Errorf("There was a problem interpreting your job: %s", cerr)
 			return
 		}
+
+		// (unlike with Client.Add(), it is our own view of the file system
+		// that determines freshness)
+		job.CheckFreshness()
 		inputJobs = append(inputJobs, job)
 	}
 
@@ -630,12 +1243,13 @@ func restJobsAdd(r *http.Request, s *Server, q *queue.Queue) (jobs []*Job, statu
 		return
 	}
 
-	_, _, _, _, err = s.createJobs(q, inputJobs, envkey, true)
+	added, dups, alreadyComplete, _, err := s.createJobs(q, inputJobs, envkey, s.owner, true)
 	if err != nil {
 		status = http.StatusInternalServerError
 		return
 	}
 	status = http.StatusCreated
+	s.auditJobs(s.owner, requestHost(r), r.RemoteAddr, AuditAdd, q.Name, inputJobs, fmt.Sprintf("%d added, %d already existed", added, dups+alreadyComplete))
 
 	// see which of the inputJobs are now actually in the queue
 	// *** queue.AddMany doesn't currently return which jobs were added and
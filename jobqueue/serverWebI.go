@@ -23,7 +23,6 @@ package jobqueue
 import (
 	"github.com/VertebrateResequencing/wr/queue"
 	"github.com/gorilla/websocket"
-	"log"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -42,6 +41,8 @@ type jstatusReq struct {
 	// kill = kill running jobs or confirm lost jobs are dead.
 	// confirmBadServer = confirm that the server with ID ServerID is bad.
 	// dismissMsg = dismiss the given Msg.
+	// shares = get the fair share info of every share group with ready or
+	//          running jobs in the cmds queue.
 	Request string
 
 	// sending Key means "give me detailed info about this single job", and
@@ -166,11 +167,12 @@ func webInterfaceStatusWS(s *Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		conn, ok := webSocket(w, r)
 		if !ok {
-			log.Println("failed to set up websocket at", r.Host)
+			logger.Warn("failed to set up websocket", "host", r.Host)
 			return
 		}
 
 		writeMutex := &sync.Mutex{}
+		host, peer := requestHost(r), r.RemoteAddr
 
 		// go routine to read client requests and respond to them
 		go func(conn *websocket.Conn) {
@@ -223,6 +225,16 @@ func webInterfaceStatusWS(s *Server) http.HandlerFunc {
 							}
 						}
 
+						// and how the queue is being shared out
+						if !failed {
+							failed = webInterfaceStatusSendShares(conn, s.shares(q.Name)) != nil
+						}
+
+						// and summaries of array jobs
+						if !failed {
+							failed = conn.WriteJSON(&jarrays{Arrays: s.summariseArrays(jobs, "")}) != nil
+						}
+
 						// also send details of dead servers
 						for _, bs := range s.getBadServers() {
 							s.badServerCaster.Send(bs)
@@ -239,6 +251,21 @@ func webInterfaceStatusWS(s *Server) http.HandlerFunc {
 						if failed {
 							break
 						}
+					case "shares":
+						writeMutex.Lock()
+						err := webInterfaceStatusSendShares(conn, s.shares(q.Name))
+						writeMutex.Unlock()
+						if err != nil {
+							break
+						}
+					case "arrays":
+						statuses, _, _ := s.getArrayStatuses(q, "")
+						writeMutex.Lock()
+						err := conn.WriteJSON(&jarrays{Arrays: statuses})
+						writeMutex.Unlock()
+						if err != nil {
+							break
+						}
 					case "details":
 						// *** probably want to take the count as a req option,
 						// so user can request to see more than just 1 job per
@@ -263,48 +290,16 @@ func webInterfaceStatusWS(s *Server) http.HandlerFunc {
 						}
 					case "retry":
 						jobs := s.reqToJobs(q, req, []queue.ItemState{queue.ItemStateBury})
-						for _, job := range jobs {
-							err := q.Kick(job.key())
-							if err != nil {
-								continue
-							}
-							job.UntilBuried = job.Retries + 1
-						}
+						kicked := s.kickJobs(q, jobs)
+						s.auditJobs(s.owner, host, peer, AuditKick, q.Name, kicked, auditDetail(len(kicked), len(jobs)))
 					case "remove":
 						jobs := s.reqToJobs(q, req, []queue.ItemState{queue.ItemStateBury, queue.ItemStateDelay, queue.ItemStateDependent, queue.ItemStateReady})
-						var toDelete []string
-						for _, job := range jobs {
-							key := job.key()
-
-							// we can't allow the removal of jobs that have
-							// dependencies, as *queue would regard that as
-							// satisfying the dependency and downstream jobs
-							// would start
-							hasDeps, err := q.HasDependents(key)
-							if err != nil || hasDeps {
-								continue
-							}
-
-							err = q.Remove(key)
-							if err != nil {
-								continue
-							}
-							s.db.deleteLiveJob(key)
-							toDelete = append(toDelete, key)
-							if job.State == JobStateReady {
-								s.decrementGroupCount(job.schedulerGroup, q)
-							}
-						}
-						s.rpl.Lock()
-						for _, key := range toDelete {
-							delete(s.rpl.lookup[req.RepGroup], key)
-						}
-						s.rpl.Unlock()
+						removed := s.removeJobs(q, jobs, req.RepGroup)
+						s.auditJobs(s.owner, host, peer, AuditDelete, q.Name, removed, auditDetail(len(removed), len(jobs)))
 					case "kill":
 						jobs := s.reqToJobs(q, req, []queue.ItemState{queue.ItemStateRun})
-						for _, job := range jobs {
-							s.killJob(q, job.key())
-						}
+						killed := s.killJobs(q, jobs)
+						s.auditJobs(s.owner, host, peer, AuditKill, q.Name, killed, auditDetail(len(killed), len(jobs)))
 					case "confirmBadServer":
 						if req.ServerID != "" {
 							s.bsmutex.Lock()
@@ -501,3 +496,13 @@ func webInterfaceStatusSendGroupStateCount(conn *websocket.Conn, repGroup string
 	}
 	return
 }
+
+// webInterfaceStatusSendShares sends the fair share info of all share groups
+// to the status webpage websocket in one go, so that it can replace whatever
+// it displayed before. Nothing is sent if fair share isn't turned on.
+func webInterfaceStatusSendShares(conn *websocket.Conn, shares []*jshare) error {
+	if shares == nil {
+		return nil
+	}
+	return conn.WriteJSON(&jshares{Shares: shares})
+}
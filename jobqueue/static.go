@@ -3647,153 +3647,164 @@ EQAA
 
 	"/status.html": {
 		local:   "static/status.html",
-		size:    63693,
-		modtime: 1509012280,
+		size:    68548,
+		modtime: 1792343515,
 		compressed: `
-H4sIAAAJbogA/+x9f3fcthHg//kU8F6bXcW7Kzlprj1ZUp8tOY0vdq2z0/T69PRa7hLapcUlNyS4a13q
-734z+MGfIAlwuZLShi+xJBIYzAwGg8EAmDl5cvHu/Md/XL4iS7byz744wR/Ed4LF6YAGg7MvCDwnS+q4
-4lf+54oyh8yXThRTdjpI2M3kT4PcZ+Yxn579/T35wByWxCeH4kVaICv5ZDIhH/9PQqM7chNGZONEXpjE
-JGGe77G7MXEClwSUutQlszsyC0MWs8hZTz/GZDLJtRjPI2/NSBzNTweHH+PDjz8jzMnX06+nf5iuvAAq
-DM5ODkWxOkReKvAcl3VEYxoAAV4YcDxidud7waLYMOfEkrH1hP6ceJvTwf+d/O3F5DxcraHizKcDMg8D
-BnBOB69fnVJ3QQfl2oGzoqeDjUe36zBiuQpbz2XLU5duvDmd8D/GxAs85jn+JJ47Pj19lgcGyN2SiPqn
-A8SUxktKAdoyojfAk3kcH6bsm3wz/Wb6R84XeD9o4KOuigkrfwjC+W2YMM5JugFyyBJ4WOVfucFbWRHa
-+8P0yK490XcsJCvnlpJZwlgYxLzr2BIajsk2jG7J15OtA6JE2ZbSgKj2eLGUWgMcBVeeAVe+NsbyQ7ii
-JLwhYRKRcBuQBQ1o5PhkSf01jchNEsxR2lpkextNjoA1z2qabJeDFEDW+SeH2Qg/mYXunfg1A+p6G+K5
-p4PA2YCE+k4c899nTkTEj4lLb5zEh5aiECQTP3oLPnhy8pWCkhBQ1B0PmFAqUy4nm0ActWUFn9ZOUKow
-i6BbB3lNhIU0bR1CYyU0i69Kf1YZE/MGBm2UlcrTKAojqOU6zJnMvAA+wIihznx5THIlWtgDqiACCcZ/
-Jy5obpQl4BQoizperfMtMvqJHZPf4RsUqHUX/hSYUiB05rhAxIbWkZn73jeVucrQ7dQn/F8Y/1EA+qCm
-lrYmF73mOvh84IQ0FuHgURnchsS7OSaXUQjTxIqcnpLBoDDwGyEkCj03ZIy6BdayMPSZtz4mvxA+8R6T
-4esb1IExgf8+JjFwkTC6gunGgYkXRDWgoHg2MONCgTihY1F4RePYWVCy9XyfLELicMUJZVhM/ZvpkHwe
-nK28xZKBNiUuMOjkMGlHnxN/CNSb0Jrn1JP7YdWPSxoBzQ7MHGADiBaTGCcuzhQhq1Pymgm+BCEnHwaq
-i1NPlAQkZACCfAxnMRQLNjRmqAlBUBnMTEHi+D7w8IbchQnxvVvg9oziaCBLjzHRDiX/+gGBe+xfch4T
-3Ib2g5D4IRf+JHYAuf54rhnRhc+VMYHzRMuA+CvYNsdSNVc0Dn7kMxjq5JNZ1Azq9UUtoNcXFmAu68Fc
-moPZbQi/CWEM8ilizmrRuQCZmbIQf4wOUsza+1oIDGF3a5iGxR/ptDRjAYH/lf5cJ74/iXAIF0bF3Pfm
-tzAjRGAPTQHNGy9aXcD4FuptcPaaDWOwMLggi3EvmjFgmcnA33HQqxo0mIcJmNIRdWt5LMua93tNA8T5
-Nfaj1DE9dl+DDqn5tItpISeoGsMi/frrNyvmS+omgCF5jdOz1ax5jiI6OiBn5JnxlHkFggIKKqK4IG0W
-7u+wpF7Crx/vtFRDzNt4Ya4J3htw540jmDM6sFQAu/QgYq6Qq8WMA01xAeMHRktP2ttEb8mxYqS4XC9e
-gVn6VgznwdmF+Ltda92fMuILbemwOSbPjo5+/zwleUtByeI/k3gFFuJ6snKihVa55EGJQsfkiDgJC5/X
-qaLlt5UKz0EduahU4HeYqmGOWq19CuZnYYEMqy7gZVUuvODGx+4AeWWOn42Gw+W37dowR10eMgpxES6X
-5iNTTRmFiwg6f1AkFcY5dP/quBFOHawJOi7yf0xiFnlrHM24EqLFb0qzS9eG+gafCnRy9HApIeUgpdml
-vnN3OcdB/JQMf89NeSslXoREXcE/8yWQXgeUoWbqQL7oby3XosR5kUfQTWsauDRgPXWVhNZ7Z0m4+e6S
-r35lHQY0hZ17C6w8t59BxSH13EscZtZD2D8gmo++f7r3RhL00xdJgGO4794QULP+kC8efX8Uv4nlSec+
-8sO4H9WGgHruIQSZdY+f8488wj7asR9mSdSP4gJAXu/GgACa9YX4+9564X6MdkT2q6++4t7bO8qIhzby
-CmbQEqV5eYjCLRE2Z4sJn24B+ZNP8eTbOtv9JoxWBXlJZisPeiKiPyc0ZrCE+0sUJmtDK9kL1gmbLFpq
-8Fr5dUCu2gSWDaGy3Fm4WKBwSwe5fJvuasECAlfZwml+OniFXjACUD20QrwbD/5iIXH8OCQxpdyjLbaz
-cPvTgQURrEpWTuDGBBoFbbf12BJKOSwHYTo4y/4wWjRzYuTCE6U6XYMhqznyMGILY3Tj+AlFlrfyupFz
-sKQ1GcNyZVz24amNU4G4EAMYf/nGFv7deukBBST9bbIGG30y96K5n/Oim7nyWpjZOAaRl10HYVk3VAel
-VHFxGDHc3VCDIB4dTH0aLEBK6nTdybLksKnXSNUhrt1/1eCA70Zqn37kj6MD0O8RZUkUEH/quYBdhD/+
-TJ6RYzJ5Rj4ftCz0W30GTV5IK2eBYFKbw6BuesjNCEaOBFP/QUpLuw/BzHVQBrir+6AOXqe1KeGeLYcf
-DNJYD07kOROuk1ZecDo4KrxxPp0OQEwabYyqp2FMlDNt7USgTafxMtyCSHPFdSHW+WPiMBYhmGHWXhBu
-hwWAJmYKZ1ZuHHfzV3Aoejns7KpIMTPeem63FnmxX49o6LwbLeIhqzQKSAFsNyHp5inhcOrEZAcnSYrf
-oxMVdJjsW06qfpVGGXmPxRvkIweui2x08c1wGHq56OiWSbF6DBKx7/4veXKae1/4UZr6X4Hr1PudvEEc
-Sk3/d3UEpZg9BgnQOCP2LRUV31GjWOD5lgaZyIB1EYoO3icOQi8ROzieUsQeRCbup98rvqrGfn/JfUUN
-PZ+B69LznfxdHIi+7zu6ulK0HrDf97Z8oIyW+rtpbZCW7rg4gPr9Lg4QYGFxQMsuvUbMHka7J/M5/L7v
-oawOApgP53NZo0EGikC7SIGC0J8YKIiZHKg3DyII3R3e+NTXkzxM/VUuZY7nx+0OeK23RRxiq3eSFI7n
-xDEXhsK5NxAGvGRB8aTmUK7Kh+Tf/y68lUuw4VhVxhVNoSa30LPv68gDVO6KRYTNlhUSKrFQRqjyUvs4
-u2e15LArVFOCYrgp0/E8X1q/zRunObe14uqtyZtWwVA2EW5odOOH28mnY+4nNESSg4lXju+fnXh17sHz
-rfvSiXN+6NpiqYTNQz8EnQIK7i7nJvTwV96YGX1mepgXzemct3j6rX2kFKr3w0kOKuXmiuNRe0hPoNmd
-O7wxSw7tcwZMj2eSW3oHk4juaK4eiA3BLjt7wfB6C4sBSWZT0632gQKFveC6xlJpKr+2lL36tKZzPHX6
-/sXbHqhT4ADadDV7/epcHFB9TIT+6K1oj5QiODyMm0T8cuLe6M1pm/diQ5e6F158a2/k2HBOVGBnaZME
-27Rjn4Dh1unwAjWZifWXl+Zs5C3YsdJULQnkLWXtHEyoPnQFh7N/efoOzLz31InDYM+ClGuzan1ZtZ3h
-wM4uI7rht/yRjiSyHNwpYjYSUahYoOhJHxTJzsC77g9Ak04SMxGxEUcObn/j0lrQX33yUIXtXVtiO7BG
-dLt0m36u8RiC2x/veekSp7BFlGe76UUQYck0UYmdfWDuu4TZc03Ut+BMoWJhECMCnQZuCi5/miHngqm7
-joIOEmh2ip9G/NI8rCgFHkMwJr702XMs8uWCPTe96ldLZRd9UACgblH2wSikLAgDipTdP0l2I0nWsNYF
-3cfBqyh62HEACDyKcQB4PO5xsCuj/rPHQSfkOs26l9S5tV/GitqaSRfBdVzGcph2XOpCMFiceCezJ3ol
-tMLF0kdG8KvA7Y1cDusxE/t3x/eZta9C1NbQq8B19lVwyPsn+/zybz1SLaE9dqK/D+MOVq+W4u/l+YNH
-SCF5fdkjkSK6yv0sh3h7F7gYsggUlFHQ0QoUPLvobAbW8O3Clm8c3GOd9L2+JoRLcST91+rbeKK8G19+
-SUapd22AQSejDUapyu9cDtS5teJbfnbpYP+d9l9nuOwwl+t8pqKjOroX92UbpNj25kjtm8w33oYqUkUE
-lfsn9jdjotzsb8aEHQW/GRNmGP9mTKTPTsZENuvI463ipbXbq6Ol0M0R2skJ+sg8lr9e8blQN1z3LyBp
-U49YRlIc/8tlgp/VnHv0fsQibe1xS0aK5n+jcJgVtD7qFWysD99YcrpDXwNWu3XxPo4B7W24n2/v4ZzF
-95j/4HyJp7X7MtwQpIT4azbgXtKlg4eionvQtVlbj1jTZkj+h+jZzuelb4Al/J4fdaIb71OHGzYfvJXn
-O3bW/9O6M+kSWHbwU0S7V/F8Oq2ws8XLbueYeBSh2AElQ9WJLjKqoSN/RosTcsBTwETZUb4bcZRvf+ve
-bhUqzkUVEsNOc+wnuvh7ugo3lIcVGZyJP8xCEvXME3HP//Fw5JJiHpoHZEgWEOPxMAWs6YcVErWp8gg4
-gqH4RUD+B2GFvedeXmL6EXOifAxnxFmvYYKKeT6IMSYtEelS5mHiuzw/TEJ5SLhc4hmea4bEyXxJeLaV
-gDLM0IWxcKTufY55UjB4HLYA0Jw5E+lTbryAjjGhCs/BEtENxvAX6Vd4LJ2YU4Z3s1YO8+a8znZJAw5M
-ZXUBgDChUneqLlUZZX9IGbC//AyDs3PxB7kwzq5R6N/dBUL5Dq2vyGUMELHx8rRbmm3mDDZUOHgqvpvG
-scJJ3lk1QIpFfJqEH/boPODFvrYbzW3N9RzI0+HR+MgqdB3N9edyfD9e7Jj8Uml+48WYsfFYwnuL5X4S
-78aVwq7n+OHiHC9CDznESbwaVouJjHV4WRoxwJ++M6N+oY3veRnymXyu1sfLklgr4HmUhrlaL+HLj6BK
-fRixw7EEL75fyIvgGnhiMaGH+B3/1gazAPIzX3NXOk1mLMwCcR5iUtEBz9lSQ4IuSmIh8gcOjtEB34WT
-w0evnF5ElGfWihP5y9YJ+NRQsw4Q+OQyYSxpfVyBQs6MNISpDF5K89FPB7UBqFSkUQlmoB8hOdpp+y0Y
-Hjl16bi5dU9N+1jgPL/s4asenG4xxSqdO0lMa5G/KdwqEuj/uR7/RhVQ2L0yILFDO+0fy9J1aiVd9y4q
-xIFWc3m3qjxpJlln3tTy4RYt0vr+ExbTiIlseWiFgZHniHCMKqEdEjpfAdkxC9fQyXSeYIK758S5QZcG
-toDG2tYBoQV+eb6y9WIURXQWCjPkoPbWe7cujrgF0E4cL+f4GLM47UE51Da05PiQ8QWRnpCbmSvBlRhG
-VsDQZIXB04GQaoJXgaGZii3q9JaA1anNVhdythC1xSwpUV8G02rlsRecrsL2LYsSegA/ZDgn0cfTubP2
-mON7/4/y9FRvKAMmiJg3GHx6ODCIk7xnxG/AVLHE/Fkr3lZaV/UgDIgH7UI7TuzOAqNVhQrJzamRCaik
-6QiLMyeY04Z1utaO1Y3iqikbMzdM2CGNov7MWYBpa8v6izGRVi1zbcxa1ZaJTauqynznvPK7hGEI989G
-dmaVfa4MXBUL7Htgnruw550Nw4bplvIdEYcOhkYrARps6pcB7uIndMV05mG28d8bG+n6vvgIaPfBQrre
-gYezbDuvLw4CyD1zMNty64F/gO4O/APQvTFOobk/xr0KNl4UBpg+hPyEAfKgmT54CB+NedhoEOpaqbMF
-dZkQZGr4GltZu3hJs8nXJ9PsOE2W0zwUv8rdUo+jj7/q6BQ2+JfzcH33nHx99Ox/jvHfP5K/0AAXHe9p
-TJ1oviRvvBWuS6daqx0zYWAD2dsSQdn7at98dDaOeFvC7zachmu0keIpGCE0+tsaGAmK+JSbus/rKT88
-BJGnWxBg6vPtS7BaMEOI8oYnxa1ZlcOCu3yT+Ceo+hargkGoGUtORDDlO2Kx9OLqrWeeD975OfEiaE4m
-ejnltMzwOgsOiBdR5NyNDmrqijpg9gDiVhVnjisysls2qJID29VSS/JyrdoKMiajCqgJ9YbD5qLSBd9a
-7t2Lmu9bkFQMciUkJzIrhXwI6Ja0kA9F+ZiA0t98e1QtVcc1XG6/VHmnoXIqfSPP1QlcWjXrXgklS74i
-3tfVxkfmZZEZ+19f4FLHc/V39j9raP5sRZ/MT1ugbhUvGslTUlglDjM+82TPJgSmhadv4wVSCe32T6bK
-EAYU6lFKo34el0bH0cEUlB6YZ6NfSCpDx2WZ+nxQnS4lWBU2tGfAItZo30BlNKmewfLYpT3DlEFSe+8u
-kTJmb2KwB9gqS8UehGEPUGX8/D2Iwz54EPruP3nqJgB81CQz/8TouwkYwFCuqqVq5iSlla6Goo1rMTdL
-UG6mUusUqXdDRiVIRWyujeaYAoCM5OsaPax9q32JxheHBYTp8IQBfM09hJWPSmtqPwvdp/8kNZj2I9dD
-2i9Sm1zrzAfFaEHIGTlq4ilSvEow7aDvcXPh2dERORRMqI+4AwbwlsJc6Pj8oMn/+hM/brIJPZc4ZJYs
-iBfA6itkMYucdRqAvQncDBdf26UHKwF5zCQGrBAOblPwIw2TFV7Tg4JNcG7QD0ojvjWQMNxNoJ+8GAbU
-nI4J3fBTKWGyWCL+AR5laQImOIgRiJEtjTzkvHCBf2sazUEQPuDf0ehqlGPuVw0ydTAmLUVzEtZWOJW3
-1oKZ9LUVVbLYVi6TzIPrMUhGjYAqvoGljsFmMsa95y+ikWAoLBYbAOjYiUr1eiTBXh1d21TPzXkZiGcW
-INKpLav+tU11MYNllb+xqKwmqqz2Hyxqq/koq/1tXW29PsWn3vjWqmtc4tbrGanta0p8NpwnzddN6lre
-KbnSTCSFQm/C8JYvMH+pmykr+Szt1r7eIsA9XX0DlRegqWLKCGCEunJLZ3EIOrCaUwcnha0XuOF2+nc6
-+8ALwQrmlGCH4ym/5vVhzm8wXSfxcjT4R5hEZBaFW3hL3BBW+JjjN07WayCfpG3EA91KiFA/pk3tbdVC
-OQU0Gmzj48PDAcyHfjjn4QmmSxB7dPDBu8Fx4QtHAt4eCsT/udXikWtuGgYhqIDcqrLWkMnXilEK//eH
-d3+dYuqoYOHd3IFQytDNx2QwT6KIHwb+fFA3otrQmsPgLq52WxGr9tZ5GARUVIfZGkVl5QQOHplcOngI
-AChHHfKkjkv4HB5iJmeYO8VZ03UIUzUeamHRHT8SSidAM8i3F4ujF/O0zel0aqFNMtJXmqV+40L9I94p
-OCW8Q9ZgVdARnaKD9KC2Bo4LrDUFPrzbBpcRSEHE7kbD76JwxX1Ew4OmFgVj5DnYIFnN0MfDjy3MxW2p
-xprRArDF5q+GSlsMrxtr8HlTerkaCyJhEXdSDJ46vv900EYFxyfznxVUd3P8RTmcUwO/qCrLnI0WrQzV
-oZIq6StNG1fR4rpmBVBC0qrh9sL4DD1c2kcL/ZKrUno/zhtNM/tx5lQa2odzp9rIXpw9lWb24PyptLEX
-Z1ClFZmRa9/NpHl89k9Ona/LdjzsBKXBf2UuyTvVr/dJmcvfrpyUici6g8hlM9sFD75BUwYgrWtDIAZO
-M03DbU608lNj5OUfNe109q+VH24ApEAtXG1VzPhiLIPV6nUrP/WrxvxjVCjvpStRlzro8u+LvrnsS94t
-l3tb8Mhl73POuOxl5u0otSk0b/l9qiprHXflx9iRp2OSvWOv/Bg4+mxgVX2CZcefDbROPkINnFafoQ2w
-knvR1IdYfsx9itoRUPHS1YyHhnL1TkTtWGkoVes61I2jRszTUdVQKj/GWl2QOrbv5JIsP1aio4YWvzgp
-2salLw4ROzggcvy0vxI74jBYpt/Bet0LmOWYxYiQY+KGeJqbuHQeUTx8hdATcV7Gaqjh+eLn0k0UUXHl
-1IvVRYsl9ddW8AS/YjxJ5AWwAIchG+MAzoa02XwuweFVWjBJV6hK6hwWugfF5pbecedhZqeOSxbnOGc7
-jlMrcJzZc+PMMhvnbaxx0VoynHHxwcNJI8TOA9SOnsOPE/In+PH0qc1cgk/BlEBar7zra34pQTmMPSuL
-Qj1VmDl4djkfzEwMu5L7Z+DJfy4De7T5tJZn8wZCFUTThkL56b7BYE1f0bclvLWKXgP4Nb6witNs6tNg
-wZZkQp71gDRqS3mFEfQtbgT4vOlxepeO4CYICSO3YZM1B22VgOWGE4Nwmoq4BmBGiTuleMdLnrI0yDGO
-3tgQA1+P4ScCcXz4iYzlk2wAk0WqmU2AlVaWZl1S2QOy6tnmsdPqH76JwtUYiG0sGG89Nl+OhPM5c3Yb
-qaG5Az2fOTKNRiAipV+zmY3gGUyft+1FFWqp87MrcqmhvAf0pMu0G2rSNt8HWsrJ2hExtSDYA2rCMdsN
-L7EE2QNSypPbDS217OkNsR20RnY2i28+l7dsyjtUBxhCLFf+qlzgWg/hxzBVMm0Arko1rsmZ2ik7xwuV
-ZooK1LfcTucrjSELh4RFThB76Eobp7MYfA0W7YsPXHQALOko4LMb3wHlkwwfl8SZ8/uesIQE69EIv/ZJ
-yJJRkxKj2gWs1P0mjZyemrukxGLGkgxzF9m72Uc6Z1M0gZupOFBWkA3ypgT05QltLmG8i1mY3nPjzozo
-LhM8PmBg7TDF42OogPNI2k31WjQtJ/tOiNpM+hokrab9bghaTf86FO0MgE5IWhgCGgxtTIFO6FmZBBoE
-7YyCTihmW7bGbcizJE+szpLknxKVmZvWnE5z/0QHFSL3yh+MIal3+wH50TLxdDcuazchuQuH/Jk8I8dE
-c8kt/yDD0YI24TMugQO6lQY3/hgdkEkXm0hBObOwF3h7sqKBA8d4QseHuzZWFL3ycc6OjUGOA7BMI2+j
-jFNTcNyGfQ4G7ND3CcigsJPDgJIFHhOMcD9rjDauKcCVE91ir6ZmN4aBpHjdPY+xKTQeSpJH2kKKvYDg
-jWqz/T3svyfEZlFjM4YbTcGas7u6x2wUt9rnetryXp3eiLuqwL4mT61XHJx2G9HvhFc3tPpzXHNdcGSi
-BXbQvU3q1UCrstBENFgIBfmBhuIavKtHIndkVHv61vDkrf352XQopde70RUhDsrqbpIbehlQz+GJa36c
-msdjoi7GJ3MKhx1MfQJQy4mYN0/83Gnf58RxXa5aGQZB41gazWKCP3JQFAIymyoFQIkfaVZJApEyFQGY
-R5HDAMBmSUvQ4xHIfWSjCjibb1W7qrMVIqZjGoHM6MIJ5K0CkRDTvG4QbiuhCDI4hoAE6vlki7sf8sJH
-7m2lTHpKRiNAmBs9nOgDcogHAUwUET4m+1r4aOMbiH0OaL7+yH3+yc3SJUjWE1apPnBW3neJKXsdMOw2
-vxuD8UEpcHD/5410IdWQLzxMdluvun3mXFuddpzx0WJ45V3bi656DK0aXnRsJXM7TpH4FNW6EEQcc3ub
-pF5fGt0N8dgwJtTjUSwdrn5mjiujZYzBAsc9SX7oDNRpG6yspgiQ6cVcN+EFrtZpT+if1/FLxzXzBJYj
-gxhz1NhJqYlaotC8ABz31G9v40XHjuMRQBIf/pZXk3j/yY3qNnAwdYtTU3x9BUuuKNs2yIIINUJBJSFg
-4BE1HtGxtXwuAk8hFkrb/KfTSmkcFanmyNOnnumSPEY4CgBoIcNtCU/FWhFygX1n7MaGym+cmHFVJ2df
-+WebcOUgcFN3VDR7jepmHYUhpcx3+R7OUyNmY4m3cb+mUXHMb0xhLx7ne9Tw5D0PUcr7T9XO3pjCSEWg
-fPGgIiGGAIVQ6KEpgWkHZTi/pSOQK+Nc+KLOk5z2S/WtQfQiXLnMmUolwpdDkbgJi1lH1NGgSjU5C/CC
-77PAX6mpBopo9crnK4Y6mZyHQRz6dOqHi9FAgsLFCbRJxGW+gYqjodAA20cLyvBm71CErhuOiUL5uAyf
-3/nVDzjgFN6lxRNPdxQ4hu5wpA+0hTzRLq/njtOr1Uvd3GB4Q7zcK3yBGsv42TD33NxQvKXMA+fxI7S1
-UTtEtA4+N7T1KGaSU6voC7ERmO9VVbn52jnA4KX46jWtM872JnW3y6uvNAjJLb9eUVLbiB2Res9Ngf4Q
-EluGXZGR6/s+0eGGJPaZ8O3ivQ8vmPuJC1KX7h52wvYNXv3oD1W+T9iRcS/5Fl6PyMg9wY7onMu9th4R
-SrfvLFHKoOmQGYtL9K3ho9IVXpOBkpa29Cp0itmYf6TPgWeRTL0OWkya4dS4NHTRKtVTP8cX+Ta6sovu
-UtsdquemnlvnPuXnvFSyq0r4zabe4EEVwjVBwWlaFqVISMD11JU50RIsVFelKWiorvy7Fy2Fhe9u596o
-ISvXQfomdLTx7movzkkrM7+hmoFJpS705m2qHAljkTbtWAqUNqJKNytV2kOwQMfQvrnkADW6rBjov+IZ
-FpkW6hRhMXK/aYDbLGa/cQ0YOB9YYSJC+26MHvuWWD95DHmlptg5KWYjAHyFpesGoI55I55ZZE8deaFO
-3+s5VMw5YNeNMvS/XfBlkdk+DQqV9ktbj4jGsNg0rd/E4yJh+2Zxmg6ghlPFlASWbJbpAbrwOcuuYMNq
-0aDidQqjkd1FCvfK7yx5gJ72UvoCO26rZALW3M6lVbfgtWxudIXMzkA0qo8SfXvlNQ02epJLqQ7smKyy
-DVgz+VWwseGubIdLMlRtYmqJnr0wFX3eoXgt80iKtD6x9HjoQEmDAOsVN9L1TKrmk7TrmWquSNO5tpi7
-sc4NKkqVHYU1vkHBHcPCt/TOsGSUWlZGxWNhcRmVFckFLQpjfkTD4llGRMMK/BZGpazxchUGzY/hi1Kv
-5ofeWPbmWHZU41AsiIf8ayR+NA3LYjWZsUs2Z1wNRIOrgB/onXml1ImJNZUxbl6dSw2vK5Z5xhWVVAil
-xeVph8qYn9O8eiZiHMB36Z/mIESqN063t/Lw8M5T8szCSZLP3ZaXN8f36+SLh0LhC6icaq1dsTcASpGo
-W6g1uivSRVy9vLfsgZTc6DXy2AJELRDrRLKluhIaLYRUvFqAfJdTVc1i1gCoPlxo2976Q/bhDzgN1eig
-TsSae0BESCAqRkHi9eBC3M1pZulosnEyGTuYaoyiWiOoXi1ladRtLNDqJCpmzmGEkIbpL+0KNu+PGAo8
-pJv9XKaFNQXSZuK2sUClt++JDwhumP1mzQmsxTXOA7EClsiPiRPZtt5DMOMS2n5M3LiUeZIfRjAwP/Uj
-Yobagr5fZvyA+Sz64ALm8B6qn5Yc4Eio/dz7pf8CUOiVfgnXlgXnolpKPb/Hj8jtjw1GvhGBlsx27qij
-nV7M0863craS560lWZvpRoxsIj2TCYwXv7y+OCZZmrdau017rjOtZ7QKN+GezBdN8XSRPBdV40UWBauZ
-40Zx7fFF400rCTteAJfg32MijyyacEdiJE85tjKmaGryw3ebldydruSXLFa9DafOeu3fvfT4nBCPoOaY
-/G40/B8iWcDwoJgvpZgh9OQQ86mefXHCk52effH/AwAA//9BfgWuzfgAAA==
+H4sIAAAJbogA/+09a3cbt7Hf/Stg3jYkbZKSnea2V68cW7Ib3diNa7vJ7dHRaZdckFxrucvsQ7Sa6L/f
+mQGwD3IfwHIpyW18EpHcBQYzg8FgMABmjh6f/XD68e/vXrF5tHBPHh3hB3Mtb3bc4V7n5BGDf0dzbtni
+K/1c8Mhik7kVhDw67sTRdPinTuZ15EQuP/npPfsQWVEcHu2JB0mBtOTj4ZB9+mvMgxs29QN2bQWOH4cs
+jhzXiW4GzPJs5nFuc5uNb9jY96MwCqzl6FPIhsNMi+EkcJYRC4PJcWfvU7j36WeEOXw+ej76w2jheFCh
+c3K0J4qVIfJSgSdclgEPuQcEOL5HeITRjet4s3zDxIl5FC2H/OfYuT7u/N/wby+Gp/5iCRXHLu+wie9F
+AOe4c/7qmNsz3lmv7VkLfty5dvhq6QdRpsLKsaP5sc2vnQkf0o8Bczwncix3GE4slx8/ywID5K5YwN3j
+DmLKwznnAG0e8CnwZBKGewn7hl+Pvh79kfgCzzsVfCyqosPK7z1/cuXHEXGSXwM5bA483OTfeoNXsiK0
+94fRvll7ou8iny2sK87GcRT5XkhdF82h4ZCt/OCKPR+uLBAlHq0495hqj4ol1GrgKLjyDLjyXBvLD/6C
+M3/K/Dhg/spjM+7xwHLZnLtLHrBp7E1Q2mpkexUM94E1z0qarJeDBEDa+Ud76Qg/Gvv2jfiaArWda+bY
+xx3PugYJda0wpO9jK2DiY2jzqRW70FLgg2TiS2dGgycjXwkoCQFF3XKACWtl1svJJhDHwrKCT0vLW6sw
+DqBbO1lNhIUK2tqDxtbQzD9a+7nJmJAa6NRRtlaeB4EfQC3biqzh2PHgBYwYbk3mByxTooY9oAoCkGD8
+O7RBc6MsAadAWZTxapltMeKfowP2O3yCArVswp8cU3KEji0biLjmZWRm3rdNZaYydDt3Gf2F8R94oA9K
+ahXWJNGrroP/PhAhlUUSZXDlM2d6wN4FPkwTC3Z8zDqd3MCvhBAr9Gw/iridY23k+27kLA/YL4wm3gPW
+PZ+iDgwZ/PcpDoGLLOILmG4smHhBVD0OiucaZlwoEMZ8IAoveBhaM85Wjuuymc8sUpxQJgq5Ox112W3n
+ZOHM5hFoU2YDg4724hM94veAeh1as5x6fDes+jjnAdBswcwBNoBoMQ5x4iKmCFkdsfNI8MXziXwYqDZO
+PUHsMT8CEOyTPw6hmHfNwwg1IQhqBDOTF1uuCzycshs/Zq5zBdwecxwNbO5EkWiHs39+j8Cd6J9yHhPc
+hvY9n7k+CX8cWoBcezwvGNHVYwLniZoB8RewbQ6kat7QOPiSZjDUyUfjoBrU+VkpoPMzAzDvysG80wez
+3RB+48MYpCliEpWicwYyM4p8/Oj1E8zq+1oIDItuljANix/JtDSOPAb/K/25jF13GOAQzo2KietMrmBG
+CMAeGgGaUydYnMH4Fuqtc3IedUOwMEiQxbgXzWiwTGfgbznoVQ3uTfwYTOmA26U8lmX1+72kAWZ9if0o
+dUyL3VehQ0pebWNayAmqxLBI3n75ZsVkzu0YMGTnOD0bzZqnKKK9Pjthz7SnzAsQFFBQAccFabVwv8aS
+xRJ++XCnpRJi3oYzfU3wXoM7byzBnF7fUAFs04OIuUKuFDMCmuACxg+Mlpa0t47ekmNFS3HZTrgAs/St
+GM6dkzPxu15r3Y0yyvRUOLcCHkJnu9ybRXPosf0NdpG80sJcOngO2LP9/d8fJixacVDK+GcYLsCiXA4X
+VjArVEZH828UJFHmgO0fgjKyUaXAd+heQ9v3O39F1idoUPuG/RzzmOOSYcyxr4g6m6GzRHlPsCwuUcnL
+sucHOCj+HPjxMoRXFmhVGz13E38Bdq8N1vBHQJNHCBJrEkD0h4DRTNKgCjJU4GyGgKCQH7s2g2pgJ1to
+ZYNswQoEWIRiM2CrueOSbT0Hkz2BsLIctKWF2fzacgLRGlrLR3vzbwqYGaE1rdglftDfIUycNveEfZ/0
+Rp7xoHNAFBfE82J5i/Ie1M33wQmUOSHmHe3BN/z1E5GY/HyPvZL+EkxLfn8Q9MlfgtPi514UlI2CCrSO
+IlSkxZ4JkvNONTnVSiKyN3USUUAcQMUU2Q1ACI41rk4cbl5b9Ejj+j1iAHuCCgEnjNfOZ273nvXZU9b9
+fXc7okgXfct6cgSWtMFABwxrW6oUqNR5uPYCx1Ktai2dZUp1rhUE1s2XrHM/oiaMwDYIURWiXuSwuOBe
+RL+JvFStkVadW9ec/A430JNTx3NCMA9HYIqJb2l9qLZ0OdoooJpX6NYI+MK/5rbSmqThbeZC60FajbSy
+B2u7CYx3snBQIweuA4V8D/AEdMFkllpbqNgX1A0PXb2eQ0uRMwVCEkX5SlKdPFBsLFW0P4mpJfmNi/nk
+x8s4cDJ1/yJ7STB6R+pYDIHW1bGayxsrng/Ov3jjysL2I9KEAUz+6QHrKoHv9tuHLUV6J6BRC3dRz5YW
++Tn2I6u6iM1d6wZpry605Dimol3Q4YK07wLumAbOFpDfAc0as+/9T14tTkYZUMlsxKw48g/LFGXt9HXu
+qVkjv6M2tnDvepPtjjd10eYCWyKy3HT5XDgLrC/Ysxo/Axnn9TxcWv7u67pWAn8G9mloOotUwRriTmf2
+xzCMAmeJkyNunfD8O+UKknuh6h28ytFJ6KEtIOUgoZmG+bsJrvqFXXbbMdsryUMCC69faBgZ+kfWoab+
+A/mgvc2fGq/PQ+kmqWhb6ioJrfXOknCz3SUffWEdBjT5jXuLZuBWeoogtdxLgVp6ih5aitnswfdP896I
+vXb6QphsbfdGupQX/SEffGHjRexnNO4jtPVa6SQE1HIPIci0e9zMhuoD7KMt+wFs43YUlzCyW+4JATTt
+C/H7znrh7rz8T548SdwuDtrI6DhYozQrD4G/YsLmrDHhkzNj7vBzOPymzHaHBf8iJy/xeOFATwT855iH
+Ubpe17KSHW8ZR8NZTY2Nk3WZakNYNvjKco/82QyFW3q45NPkGBwsIHBbTni9jjuvcNucAVQn8cjg6RnL
+DX0Wci62B+j8GznBYEGUuMDEnsLKiebCG5ZCGHVOnIyDR2OXjYiRO1Uo1ckaDFlNyMOIzY3Ra8uNObK8
+lteVnBtHXkf/CMD6pr86aSkQF2IA4y/b2My9Wc4doIAl34ZLsNGHEyeYuJljN3p7/zXMrByDyMumg1Db
+DRz6AS3Skw2oao+wWAsHmuv3ggV84bZIAQ74rKcO9vbcQdAH/R7wKA485o4cG7AL8ONb9owdsOEzdtuv
+WejX+gyqji0YOQs0/d0l00NmRtByJOj6Dwx8CHqug7bdB62uTRlthVt0k6DAerACxxqSTlo43nFnP/fE
++nzcATGptDE2PQ0Dpnbfl1YA2nQUzv0ViDQprjOxzh8wK4oCBNNN2/P8VTcHUMdMWR/HzfwVFWZKY1eF
++VnVemvxCxONIu9GjXjIKpUCkgPbTEiaeUoqxWQLJ8nDFRV0mOxaTjb9KpUyQtvRFfKRAddENpr4Zirk
+oqFb5kFJxK77f82TU937wo9S1f8KXKPeb+QNqur/po6gh6sT5CHXHUvFhu+oUixwD71CJlJgTYSigfep
+QiK2cDzdr0zcTb9v+Koq+10cl6jo+RRck55v5O+q6PuGrq6H0O87Wz7wiK/1d9XaICndcHGAp5laXRwg
+wNzigEcPf3EQTybwfddDWR0E0B/Op7JGhQzkgTaRAgWhPTFQEFM5UE/uRRCaO7w3fFVFPEz8VTaPLMcN
+6x3whd4Wceul3EmSO88fhiQMuYsyIAx4K5vj1a7kYBP79dfcU3WSaaAq44omV1McrEreLwMHULnJF5HH
+upJCQiXmysjzR/n26bBTUksOu1w1JSiamzINLwBpe+MKLnosSL1VedPKvIT+NQ+mrr8afj4gP2HHZKAt
+LNc9OXLK3IOnK/ulFWb80KXFEgmb+K4POgUU3E3GTejgV2pMjz49Pbyuc97iWbXQTNe0w8k8NxeER+mt
+HoFmc+404dAuZ8DkPhe74jcwiYS648Q2IdiOTl5EeB8eTwHbkUnNgnOIChT2gm1rS6W7I8pefV7yCR7i
+fv/ibQvUKXAAbbQYn786FTfaHhKhH50Fb5FSBIe39+KAopnsjN6MtnkvNnS5feaEV+ZGjgnnFPeSJhm2
+acY+ycIyHZ6jJjWx/vxSn40NWKmrlhrJ2imYUG3oCoKze3l6DWbee26FvrdjQcq0uWl9GbWd5fa7gF9T
+WDCkIw54A+k0lYhyih63QZHsDAyOdQ80FUliKiIm4rjjcWks6K8+O6jCdq4tsR1YI9q8kaIsmmucCMHt
+jvdFnMIWUZ73G4iQ20zwP0T2D3FkzjU1xRhX2hzEiECjgVt4qCfjgim7v44OEmh2hK+S6y4CD7zu8pUb
+HWKRr2bRoW5skFb1QRGbHrfBKKTM8z2OlN09SWYjyXw0bTsOXgXB/Y4DQOBBjAPA42GPg20Z9e89Dhoh
+12jWfcetK/NlbOmki+AaLmMbcKkJwR/wnjVeG26FXgktF4nmgRH8yrNbI5dgPWRif7JcNzL2VZTSq8A1
+9lXcEdmn7/7WItUS2kMn+juKEdAKxd/J8wcPkEJ2/q5FIkU4xrtZDlF7Z7gYMogsurUVKHh21tgMLOHb
+mSnfHvSk77Q1IbwTR9K/VN/GY+Xd+Oor1ku8ax2MUh9cY5iZ7M5lR51byz+ls0v93Xfaf5zhssVcXuQz
+FR3V0L24K9ugfUdq22S+ca65IlWEXLx7Yn8zJn4zJn4zJn4zJr4cYyKddeTxVvHQ2O3V0FJo5ght5AR9
+YB7LL1d8zpIwrzsXkKSpBywjCY7/4TJBZzUnDr8bsUhae9iSkaD5nygcOzrq5V0bH74xPXFp3teA1XZd
+vItjQDsb7qerOzhn8R0mTDud42ltu7XFwIJLiF+yAfeSzy08FBXcga5N23rAmjZF8t9EzzY+Lz0FltA9
+P24FU+dzgxs2H5yF41pm1v/TsjPpElh68FOkx1LxfBqfXhKLl+3OMVEUodACJcPViS7WK6Eje0aLCOlT
+zsggPco3FUf5drfubVZhw7moQmKYaY7dpCN6TwHJKaxI50T80AtJ1DJPxD3/h8MRjGZ8rwxJA2I8JDFZ
+3q+QqE2VB8ARzN0lMnjdCyvMPffyEtNHTKL4yR8za7mECSqkBHIDzHIo8itOKN0LJpSMOYWEy2SqpOSU
+LIwnc0bpGT0eYUpfjIUjde8hJlbE4HHYAkCzJpHItzh1PD7ALDGUtDHg15j0S+RrpFg6lIGB7mYtrMiZ
+UJ3VXKa4UWkgAeAU82WM1KUqrXRxOxYETOjWOTkVP9iZdjq+lgVC+Q6Nr8ilDBCx8bK0G5pt+gzWVDh4
+Kr6ZxjHCSd5Z1UAqCmiahA9zdO7xYl/djea65loO5GlRND628G2r4Przenw/KnbAftlo/toJMcX7gYT3
+Fsv9KJ4NNgrbjuX6s1O8CN0liMNw0d0sJlJc42VpxAA/XWvM3Vwb31EZdstuN+vjZUms5VHi1W6m1kt4
+8xFUKSZ76Q4kePH+TF4EL4AnFhPFEF/TuzqYOZC3tObe6DSZ4jwNxLk3jxZuh5I8lpBQFCUxF/kDB0ev
+T7twcvgUK6cXAadUvGEsv6wsj6aGknWAwCeTOm/Oy+MK5JLspcnJRPBSno1+2ikNQJVmYSEwnUd1SpnX
+34KReYTszLqnpH0scJpd9tCqB6dbjtP0xIpDXor8NHerSKD/7aNmKiC3e6VBYoN26l+uS9exkXTduahQ
+KqdMot5vDUkuMm9K+XCFFml5/wmLqReJ9NpohYGRZ4lwjCoDNhI6WdiYYcpfQifzSYyplg6ZNUWXBraA
+xhom92PAL8dVth7mKJygs1CYIf3SW+/NulikzaonjspZLsYsLkjZlXd8yPiCSI9PZuZCcCWEkeVFaLLC
+4GlACNQgbdpMxeZ1ek3A6sRm69SP2YlmFtO2DKbFwoleEF257dsoiHkfPmQ4J9HHo4m1dCLLdf7FKZ/t
+Gx4BE0TMGww+TRnxarON7hbxKZgqhpg/q8XbSOuqHoQBca9daMaJ7VmgtapQIbmJGpmxVpqOsDizvAmv
+WKcX2rFFo3jTlA0j24+jPR4E7ZmzANPUlnVnAyat2sg2MWtVWzo2raqK4fZARVLlH+IIQ7jfatmZm+yz
+ZeCqUGDfAvPsmTnvTBjWTbaUb5g4dNDVWglw77p8GWDPfkRXTGMephv/rbGRL++Kj4B2Gyzkyy14OE63
+89riIIDcMQfTLbcW+AfobsE/AN0a4xSau2PcK+/aCXwP04ewHzFAHjTTBg/hpTYPKw3ColbKbMGiTAg0
+U5cZhcWLF1lFRa4qXHk0mybX0zzk38rdUofQx69FdAob/KuJv7w5ZM/3n/33AP/+kf2Ze7joeM9DbgWT
+OXvjLHBdOiq02jETBjaQPl0j6FFF33yyri3xdA2/K3/kL9FGCkdghPDgb0ubcgkfk6l7WE753h6IPF+B
+AHOXti/BasEMIcobHue3ZlUOC3L5xuGPUPUtVgWDsGAsWQELuTtFLOZOuHnrGV+OrJ9jJ4DmZKKXY6Jl
+jNdZcEBQRuFev6SuqANmDyBuVHFs2XRhJjBscMHD0JpxUzQpU7pZHZHO16yOWvqv1yqtIGM/qsCdUK/b
+rS4qXf215X54UfJ+BSMCg2kJCQ30SiEfPL5iOmyuBhzAOxqfAPHrb/Y3S5VxFpf+Ly37A0kNVE5GQs+x
+i4S/QNQklDQRjHheVhv/yRwxouDo/AyXXY5dHD/gtoAvt0b0vRXSnaNuEc4qyVMjYpO4yZzb57hXp0Ng
+Unj0NpwhldBuq2SCokvzDbOZc81Dcht58WKMGc2n+YTrnihdBCaMFwvahxTbggjKEzuHh6yj8lJ38onU
+o7kf8iJgqV9ozAGMyrWOG6FYz/OZ69NeoGyNUohXaAxBXrYD6fFAIFjWE6SpIzljUIXRB/Hz11/ZL7fF
+HeFMWS9MomGlCbk1eptgX9DHJTaxX9LVpcg63l+REYBtSVWcynpEFnJONFiFmQL49DjB7tIEKUmZ5J3z
+L86G8ofMSA2/ZRvNR6lKtgdkF1OSBNA9WJsA9vsjsB8Ak94vLFGBB+sq8bY/KAOrIvC2DFiE7W0bqAzM
+1jJYCgPcMkwZb7j17hLZl3YmBjuArRK+7EAYdgBVpqLYgTjsgge+a/+DsqAB4P0qmfkHBrKOYS0J5Ta1
+1GG1VrroijYuhfkpQdmpRVCmf2kiyUPKY3OpZSLlAKQkG6nx0gmHYAFhRXjCAL4kZ/vGS6U1C18L3Vf8
+SmqwwpekhwrfSG1yWWQhK0YLQk7YfhVPkeJFjBk8XYes3Wf7+2xPMKE8eBWYMysOppzl0pmt//kTndy6
+9h2bWWDRzHAmHsPiN4wCa5nkMqgCN0Y/xmruwKJantgKAStlC9HpoOECb7xCwSo4U9xS4AHtsoFlhcbe
+ZyeEATXhA8av6YCXH8/miL+Hp8KqgAkOYjBvZEslD4kXNvBvyYMJCMIH/B30LnoZ5j6pkKn+gNUUzUhY
+XeFE3moLptJXV1TJYl25VDL7lwOQjP5hJd9gMYpxm1LGvacHQU8wdMCeVwAoYicq1cueBHuxf2lSPTPn
+pSCeGYBIpra0+nOT6mIGSyt/bVBZTVRp7T8Y1FbzUVr7m7Lat2apKMrVNXqLyvWM1PYlJW4150n9Zb+6
+4XrMLi5rvC5vfP+KfCi/lM2UG6lhzdw7zszD4xHFDRSuVHnEACPUlSs+Dn3QgZvpqXBSWDme7a9GP/Hx
+ByoEC/Bjhh2OB2ar3RsZF9xoGYfzXufvfhywceCv4CmzfVhEYrrsMF4ugXyWtBF2ihbysGwOeVV7K+UL
+SgD1OqvwYG+vA/Oh608o0scIltsR+srhWecg94aQgKd7AvF/rArxyDQ38j0fVEBmTd2rmjpVrRCl8H8/
+/PCXEWZh82bO9AaEUkZBP2CdSRwEdK7+tl8xHqvmIelVxINYtNJUHge1kp/Q/TY8I01HY0CNDCrB+eyK
+86U4g4JS46N7nlcTmnO5AYukIIHgnWNu72vL7WlxzYRzos0axpkAFK7WGoC3A5zt9/fL1F+dDE1AE+c9
+a7VStDm0Tn3P46I6dA+O64XlWegemluh8CChwn/cqSBEdhFdDEs6abMz+1V23pMnT9BUEqf0lz5YZiiF
+UXBDh+n5EPgK6swJxaG1SYL1aDQymDxS5i0KHJOVbsVPeBvrmFGnL8GI5D0+wq2lfrkDCNQg1hoBJ39Y
+ee8CGPRBdNPrvg78BTnDuv06CcZRRA4x4VQMhWNPjMPqbGLBDLDF5i+6anLoXlbWIDNJ+u0rCyJhAblU
+O08t133aqaNCTLPJjkBupq4ecFJ7J+u5/My4ztlg1m+CSjInXxS0cRHMLi+1kDRq+Bet8/JdBz05wWyg
+V3o3vro7893diS/vjnx7d+HruxvfX5GUYS7DXTeTZEDbPTllrk3T8bAVlAp3pb4kb1W/3AWpL3/bclKm
+cGwOIpMHchs8aMt5HYBcTGkC0fCRNvCZapqJRdNOY3dqoQGQADXwrJasvVNYtU5WfSeB1qKnzCm7Rl3i
+j80+z7ti0zdZL2zmac4Bmz7P+F7Th6lza61NoXnXnyeqstRP29hv244ft4Ff1wTWpgt43c9rAq2RS7iJ
+i9gE2Jo3Wddl3NyFXDgCNpyyJeOholy5z7hwrFSUKvUUF42jSsyTUVVRKjvGaj3OrXugGym0ZHdBDi26
+ci7axqUvDhEzOCBydE9KiR2zIlim38B63fEiwzGLsXQHzPbxHgyz+SQgTxNCj8VJQ6OhhjczDqVXMODi
+sr4Tqitqc+4ujeAJfoV4BtPxYAEOQ5YO8aRDemCkn2D4g0m6QFVS5rAoE5srTmf2MrsOgzWLc5CxHQeJ
+FThI7blBapkNsjbWIG8tXeqLX3IWxqHzMvBxxP4EH0+fmswlG6YE0nrhXF7SdS61P+BcmsLM2TwJzAw8
+s2w5t4/aL7l7Bh79+zKwRZuv0PKs3i8y2z9qbz/JmL68b0v4exW9GvBLfGEbTrORy71ZNGdD9qwFpFFb
+ysvfoG9x38elpgfJLWSGe17MD2we6EBbxGC54cQgnKYiIgyYUeI2Pu5MyPPpNf7UZE8DUwYMcG8DgFgu
+fCJjaZL1YLJINLMOsLWVpV6XbGz5GfVs9dip9Q9PA38xAGKrd0lWTjSZ94TzOXV2a6mhiQU9nzoytUYg
+IlW8ZtMbwWOYPq8OtVFLnJ9NkUsM5R2gJ12mzVCTtvku0FJO1oaIqQXBDlATjtlmeIklyA6QUp7cZmip
+ZU9riG2hNdKjeHTWYH3LZn2Hqo/BFzPlL9YLXBZD+OgnSqYOwMVajUt2onbK6Ky7nqIC9S1PT9BKoxv5
+XRYFlhc66EobJLMYvPVmoQ44PJ0vHQU0u9EOKE0yNC6ZNaGb8rCEBOtRC79Ib0bRZ9RwjVH1ArbW/TqN
+HB/ru6TEYsaQDH0X2Q/jT3wSjdAErqair6wgE+R1CWjLE3rbzi5mbnrPjDs9optM8PgPDKwtpngDBdx8
+qi9E03Cyb4SoyaRfgKTRtN8MQaPpvwhFMwOgEZIGhkABhiamQCP0jEyCAgTNjIJGKKZbttptyLMkj43O
+klRQmbppD3fgtmmgQuRe+b0xJPFu3yM/bndlXJZuQpILh33LnrGDsvt8WYajBa3DZ1wCe3wlDW786PXZ
+sIlNpKCcGNgL1J6sqOHA0Z7QE9fGgqNXPszYsSHIMd1BdK6VcaoLjmzYQzBgu67LQAaFnex7nM3woGGA
++1kDtHF1AS6s4Ap7NTG7MYAux0AhWYx1oVEQXopRiBQ7HsNYFIG2ZfiYmSxqTMZwpSlYclS7+Siutc+L
+act6dVoj7mID9iXenjUcXcai3wivZmi157gmXbDf363urVKvGlo18nVEI/KhIB1oyK/Bm3okMkdGC0/f
+ap68NT8/mwylJGAFuiLEQdmi2BiaXgbUc3hmmw5kUyQ7bmNkRyt32EHXJwC1rCByJrGbOe17yCzbJtUa
+YfhIwlJrFhP8kYMiF8q+rz/v0JFmlV4VKVOx0+mSAYZOH+qCcjy5j6x94Gel2lWdrRDRHdMIZMxnlicv
+kYhUwvp1PX+1EVwlhaMJSKCeTVO7/SGvzN5WwqSnrNcDhMnoIaL7bI8uMWjieatZrjBii9jngOb7prP0
+GiTjCWut/pa3UoqkgC6MvJEupBLyhYfJbOu1aJ8501ajHefSDrpwLs1FNxENg/XJwEjmHm1fIq/WhSDi
+mNvZJHX+TutuiBN1Q8Ydiv9rkfoZW7aM7TMACxz3JOnQGajTOlhpTRFCxglJN+F9vUd688B5+NKy9TyB
+63GMtDmq7aQsiLGk0DwDHHdlXNCFJ62+E/eYhLeCybt7GJs5ENfwYC6b+vWX0cQNKzURi9arbKc6Amgj
+egsCxL1BzJIigho5NQe5MpHJJBESA4ric7ENKW/DWcNBRLGjYhd+y2tiNJbkoYFatvjyBButdWH5G6Rb
+OGkovNqddgEDjwtSXOLa8pk4crkoWnW2SNEMkUTgklMOe/rU0XWPhAhHAYAZQXOLyFFRuoQQYN9pbylA
+5TdWGNG0Iy0h+bNuoGcg0LKjl1+CaNVNOwoDI+rvuN6f10xYRhJv7X5N4qnp317DXjzI9qjmLQgKtE39
+p2qnT3RhJCKwfglkQ0I0AQqhKIamBGbQlq2RjECaGDOB7xobHJq3ZDXj3k0ilRCLlqaBuPmMubPUMa2y
+yAZU8H0aVjIxm0ERLV6J++ZlMjnxvdB3+cj1Z72OBIULRWiTiYuVHRXCRqEBdmjlTeCam9xdEYC1O2AK
+5YN1+HTJu3jAAafwXjOePrvhwDGcK5E+0BbydoG8bD1IohrMi+YGzeAM671CzoJQZoGAuWc65TRHY/hX
+Os5cGjBHBMqhuaGuRzEfqvJonIlN2WyvqsrVER8ABpUiT0JSZ5DuExcFdjjUQUhuv7aKktrSbYjUezIF
+2kNIbN82RUb6WtpEh4x67DPhZ8c7OI43cWMbpC7ZyW2E7Ru8htMeqrRn25BxL2k7tUVk5P5sQ3ROlSHe
+HkLJVqohSim0ImRq4oZuOlErY2yq0oYenkYRgbP/ykNerGNyaIxISSzk+jk+z7fehVlgpdLuUD03cuwy
+VzaduVMpGzeCO1f1BgW48JcMBadqWZQgIQH3LmqDTumFoi6qUhWSupjZNYWFH3Xr3ighK9NBh490aRPh
+hR9pkbbO/MOtTCp1uTprU2VIGIjknwdSoApD6NxuYw/BAh0D1GdS3JSFgs+lq9nw0ot8QYfVlWX+Gd3w
+6WnmGe0aMHA+RLmJCO27AfpgasJsZTGkSlVhqxLMegD4Aktf1hTPMq9H+bF21JFn6iZESfz4WfNulAls
+DGPz+6uzTDy2pF/qekQ0hsVGSf0qHucJ2zWLk6Q2ZVH6l1uwWSa5acLnNEeQCatFg4rXCYxKducp3Cm/
+0xQ4Jdkm8kl4zLitUuIYczvFyoTXsrneBTI7BVGpPtbo2ymvuXddTPJawh4zJqucOcZMfuVdm3BXtkOS
+DFWrmLpGz06Yij5vXzyW2ZBFcrpQejyKQEmDgLIk5A41lGQl2MiKbNYzmxmPdefafAbiMjeoKLXuKCzx
+DQruaBa+4jeaJYPEstIqHgqLS6usSJFrUBiz/GoWT/P6alagGzEbZbWXqzBoPvov1no1O/QGsjcHsqMq
+h2JOPOSvnvioGpb5ajLvpGxOuxqIBqmA7/mNfqXEiYk1lTGuX52khuqKZZ52RSUVQmmRPG1RGbNM61dP
+RYwAvE5+6oMQCUuJbmfh4EGqp+yZgZMkm4E0K2+W65bJF4WloQVURrWWrtgrANUu1CrdFckirlzea/ZA
+1tzoJfJYA0QtEMtEsqa6EpqDSvGqAfI6o6qqxawCUGl82NpzDvfZh9/jNFSigxoRq+8BEeGZuBgFsdOC
+C3E7p5mho8nEyaTtYCoxikqNoHK1RPnm33OMumtggW5OomLm7AYIqZt86euhL/0RXYGHdLOfyuTmukDq
+TNw6FuC5IRzhLfEBwXXTb8acwFqkce6JFbBEfkicSLf17oMZmH7rIXFDpQO7H8FwrZuHJRpiC/pumfE9
+ppJpgwtXAKirPg05QEio/dy7pf8MUGiVfgnXlAWnolpCPcVUQOR2xwYt34hAKxQHay11zNbByxaWXcvZ
+jQyhNWk+dTdiZBPJ+VhgvPhyfnaQSRBaarcVnrFN6vXb4p7thAsnDDExhTpYWOJFFgU3c472QmdbXinY
+4Qy4BH8PmDyyqMMdiZE85VjLmLypSYfvrhdyd3ojS/LhetZma7l0b146NCeEPag5YL/rdf9LpH7o9vOp
+ivJ5ro/2MCv4yaMjStl98uj/Aath1U3ECwEA
 `,
 	},
 
@@ -35,6 +35,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 // AppName gets used in certain places like naming the base directory of created
@@ -159,6 +160,66 @@ func copyFile(source string, dest string) (err error) {
 	return
 }
 
+// copyDir recursively copies the regular files and directories within source
+// to dest, creating dest if necessary. Other kinds of files are ignored.
+func copyDir(source string, dest string) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, os.ModePerm)
+		case info.Mode().IsRegular():
+			return copyFile(path, target)
+		}
+		return nil
+	})
+}
+
+// dirSize returns the total size in bytes of the files in the given directory
+// and its sub-directories, ignoring any that can't be read. It does not descend
+// in to other file systems mounted within dir, such as a Job's remote Mounts.
+func dirSize(dir string) (size int64) {
+	dev, devOK := fileDevice(dir, nil)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if d, ok := fileDevice(path, info); devOK && ok && d != dev {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		size += info.Size()
+		return nil
+	})
+	return
+}
+
+// fileDevice returns the id of the device that the given path is on. You can
+// supply the path's FileInfo if you already have it.
+func fileDevice(path string, info os.FileInfo) (dev uint64, ok bool) {
+	if info == nil {
+		var err error
+		info, err = os.Lstat(path)
+		if err != nil {
+			return
+		}
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	return uint64(st.Dev), true
+}
+
 // compress uses zlib to compress stuff, for transferring big stuff like
 // stdout, stderr and environment variables over the network, and for storing
 // of same on disk.
@@ -0,0 +1,414 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for notifying webhooks about significant events,
+// such as Jobs being buried or all the Jobs in a RepGroup completing.
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const restWebhooksEndpoint = "/rest/v1/webhooks/"
+
+// Webhook* are the events that webhooks can be notified about.
+const (
+	WebhookJobBuried        = "job_buried"
+	WebhookJobComplete      = "job_complete"
+	WebhookRepGroupComplete = "repgroup_complete"
+	WebhookServerBad        = "server_bad"
+)
+
+// WebhookAllEvents can be used in place of a list of events to have a webhook
+// notified about every event.
+const WebhookAllEvents = "*"
+
+// WebhookSignatureHeader is the header of webhook POSTs that contains
+// "sha256=" followed by the hex encoded HMAC-SHA256 of the body, keyed on
+// ServerConfig.WebhookSecret, when that is set.
+const WebhookSignatureHeader = "X-Wr-Signature"
+
+// webhookRetries is the number of times we retry delivering to a webhook that
+// doesn't respond successfully, waiting webhookRetryDelay before the first
+// retry and doubling the wait for each subsequent one.
+const webhookRetries = 3
+
+var webhookRetryDelay = 2 * time.Second
+
+// webhookTimeout is how long we wait for a webhook to respond.
+const webhookTimeout = 10 * time.Second
+
+// webhookLogSize is the number of most recent deliveries we remember, for
+// viewing via the REST API.
+const webhookLogSize = 1000
+
+// webhookWorkers is the number of deliveries we make at once.
+const webhookWorkers = 4
+
+// Webhook is a URL that will be POSTed a JSON description of an event
+// whenever one of its Events happens.
+type Webhook struct {
+	URL string
+	// Events are the Webhook* events to be notified about; nil means all of
+	// them.
+	Events []string
+}
+
+// wants tells you if the Webhook should be notified about the given event.
+func (w *Webhook) wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWebhooks converts a string like
+// "job_buried,repgroup_complete=https://host/hook *=https://other/hook" in to
+// the form needed for ServerConfig.Webhooks. Each space separated entry is a
+// comma separated list of Webhook* events (or WebhookAllEvents) followed by an
+// equals sign and the URL to POST to. An empty string returns nil.
+func ParseWebhooks(str string) ([]*Webhook, error) {
+	var hooks []*Webhook
+	for _, entry := range strings.Fields(str) {
+		eq := strings.Index(entry, "=")
+		if eq < 1 || eq == len(entry)-1 {
+			return nil, fmt.Errorf("webhook [%s] is not of the form events=url", entry)
+		}
+		hook := &Webhook{URL: entry[eq+1:]}
+		if err := checkWebhookURL(hook.URL); err != nil {
+			return nil, err
+		}
+		all := false
+		for _, event := range strings.Split(entry[:eq], ",") {
+			switch event {
+			case WebhookAllEvents:
+				all = true
+			case WebhookJobBuried, WebhookJobComplete, WebhookRepGroupComplete, WebhookServerBad:
+				hook.Events = append(hook.Events, event)
+			default:
+				return nil, fmt.Errorf("webhook [%s] has an unknown event [%s]", entry, event)
+			}
+		}
+		if all {
+			hook.Events = nil
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// checkWebhookURL returns an error if the given url is not an absolute http(s)
+// url, which is all we can POST to.
+func checkWebhookURL(webhook string) error {
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook [%s] is not an absolute http(s) url", webhook)
+	}
+	return nil
+}
+
+// webhookPayload is the JSON we POST to webhooks. Only the properties relevant
+// to the Event are set.
+type webhookPayload struct {
+	Event    string
+	Time     int64      // seconds since Unix epoch
+	RepGroup string     `json:",omitempty"`
+	Job      *jstatus   `json:",omitempty"`
+	Server   *badServer `json:",omitempty"`
+}
+
+// webhookDelivery records an attempt to tell a webhook about an event, as
+// viewable via the REST API.
+type webhookDelivery struct {
+	ID         uint64
+	URL        string
+	Event      string
+	RepGroup   string
+	JobKey     string
+	Attempts   int
+	StatusCode int
+	Error      string
+	Delivered  bool
+	Time       int64 // seconds since Unix epoch of the latest attempt
+	payload    []byte
+}
+
+// webhooks sends webhookPayloads to the configured Webhooks (and to those
+// given by Jobs), with retries, and remembers the most recent deliveries.
+type webhooks struct {
+	sync.Mutex
+	hooks   []*Webhook
+	secret  []byte
+	client  *http.Client
+	pending chan *webhookDelivery
+	log     []*webhookDelivery // a ring of the most recent deliveries
+	next    int
+	lastID  uint64
+}
+
+// newWebhooks creates a new webhooks that will notify the given Webhooks,
+// signing with the given secret if not empty. Call run() to start delivering.
+func newWebhooks(hooks []*Webhook, secret string) *webhooks {
+	return &webhooks{
+		hooks:   hooks,
+		secret:  []byte(secret),
+		client:  &http.Client{Timeout: webhookTimeout},
+		pending: make(chan *webhookDelivery, webhookLogSize),
+		log:     make([]*webhookDelivery, 0, webhookLogSize),
+	}
+}
+
+// urls returns the URLs that should be told about the given event: those of
+// the configured Webhooks that want it, plus the given extra one (if not
+// empty).
+func (wh *webhooks) urls(event string, extra string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, hook := range wh.hooks {
+		if hook.wants(event) && !seen[hook.URL] {
+			urls = append(urls, hook.URL)
+			seen[hook.URL] = true
+		}
+	}
+	if extra != "" && !seen[extra] {
+		urls = append(urls, extra)
+	}
+	return urls
+}
+
+// wanted tells you if any webhooks would be notified about the given event,
+// so that you can avoid creating a payload that would not be sent.
+func (wh *webhooks) wanted(event string, extra string) bool {
+	return len(wh.urls(event, extra)) > 0
+}
+
+// notify queues up the delivery of the given payload to every webhook that
+// wants it, including the given Job-specific one (which can be empty).
+func (wh *webhooks) notify(payload *webhookPayload, extra string) {
+	urls := wh.urls(payload.Event, extra)
+	if len(urls) == 0 {
+		return
+	}
+	payload.Time = time.Now().Unix()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	var jobKey string
+	if payload.Job != nil {
+		jobKey = payload.Job.Key
+	}
+	for _, url := range urls {
+		d := &webhookDelivery{URL: url, Event: payload.Event, RepGroup: payload.RepGroup, JobKey: jobKey, Time: payload.Time, payload: body}
+		wh.record(d)
+		select {
+		case wh.pending <- d:
+		default:
+			wh.update(d, func() {
+				d.Error = "too many pending deliveries"
+			})
+		}
+	}
+}
+
+// record adds a delivery to our log, giving it an ID.
+func (wh *webhooks) record(d *webhookDelivery) {
+	wh.Lock()
+	defer wh.Unlock()
+	wh.lastID++
+	d.ID = wh.lastID
+	if len(wh.log) < webhookLogSize {
+		wh.log = append(wh.log, d)
+	} else {
+		wh.log[wh.next] = d
+	}
+	wh.next = (wh.next + 1) % webhookLogSize
+}
+
+// update changes a delivery while holding the lock.
+func (wh *webhooks) update(d *webhookDelivery, change func()) {
+	wh.Lock()
+	defer wh.Unlock()
+	change()
+}
+
+// run delivers pending deliveries until stop is closed.
+func (wh *webhooks) run(stop chan bool) {
+	for i := 0; i < webhookWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case d := <-wh.pending:
+					wh.deliver(d, stop)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// deliver POSTs a delivery's payload to its URL, retrying on failure, and
+// records the outcome.
+func (wh *webhooks) deliver(d *webhookDelivery, stop chan bool) {
+	delay := webhookRetryDelay
+	for attempt := 1; attempt <= webhookRetries+1; attempt++ {
+		status, err := wh.post(d)
+		wh.update(d, func() {
+			d.Attempts = attempt
+			d.Time = time.Now().Unix()
+			d.StatusCode = status
+			d.Error = ""
+			if err != nil {
+				d.Error = err.Error()
+			} else {
+				d.Delivered = true
+			}
+		})
+		if err == nil || attempt > webhookRetries {
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-stop:
+			return
+		}
+	}
+}
+
+// post does a single attempt at POSTing a delivery's payload, returning the
+// HTTP status code of the response, and an error if it wasn't successful.
+func (wh *webhooks) post(d *webhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Wr-Event", d.Event)
+	req.Header.Set("X-Wr-Delivery", strconv.FormatUint(d.ID, 10))
+	if len(wh.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+webhookSignature(wh.secret, d.payload))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookSignature returns the hex encoded HMAC-SHA256 of the body, keyed on
+// secret.
+func webhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliveries returns copies of the logged deliveries, most recent first.
+func (wh *webhooks) deliveries() []*webhookDelivery {
+	wh.Lock()
+	defer wh.Unlock()
+	ds := make([]*webhookDelivery, 0, len(wh.log))
+	for i := 1; i <= len(wh.log); i++ {
+		d := *wh.log[(wh.next-i+len(wh.log))%len(wh.log)]
+		ds = append(ds, &d)
+	}
+	return ds
+}
+
+// notifyJobWebhooks tells the interested webhooks (including the Job's own
+// Webhook, supplied here since you must not hold the Job's lock) that the given
+// Job changed to the given state, if that state is one they can be notified
+// about.
+func (s *Server) notifyJobWebhooks(job *Job, to JobState, webhook string) {
+	var event string
+	switch to {
+	case JobStateBuried:
+		event = WebhookJobBuried
+	case JobStateComplete:
+		event = WebhookJobComplete
+	default:
+		return
+	}
+	if !s.webhooks.wanted(event, webhook) {
+		return
+	}
+	status := jobToStatus(job)
+	s.webhooks.notify(&webhookPayload{Event: event, RepGroup: status.RepGroup, Job: &status}, webhook)
+}
+
+// notifyRepGroupWebhooks tells the interested webhooks (including the given
+// Job-specific one, which is that of the Job in the RepGroup that completed
+// last) that all the Jobs in the given RepGroup have completed, unless it has
+// array Jobs that are still to create more elements.
+func (s *Server) notifyRepGroupWebhooks(repGroup string, webhook string) {
+	if !s.webhooks.wanted(WebhookRepGroupComplete, webhook) {
+		return
+	}
+	s.amutex.RLock()
+	for _, arr := range s.arrays {
+		if arr.Template.RepGroup == repGroup {
+			s.amutex.RUnlock()
+			return
+		}
+	}
+	s.amutex.RUnlock()
+	s.webhooks.notify(&webhookPayload{Event: WebhookRepGroupComplete, RepGroup: repGroup}, webhook)
+}
+
+// restWebhooks lets you GET the log of the most recent webhook deliveries,
+// most recent first.
+func restWebhooks(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(s.webhooks.deliveries())
+	}
+}
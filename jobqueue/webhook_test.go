@@ -0,0 +1,191 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	Convey("Webhooks can be parsed from a string", t, func() {
+		hooks, err := ParseWebhooks("")
+		So(err, ShouldBeNil)
+		So(hooks, ShouldBeNil)
+
+		hooks, err = ParseWebhooks("job_buried,server_bad=https://host/a  *=http://host/b repgroup_complete,*=http://host/c")
+		So(err, ShouldBeNil)
+		So(len(hooks), ShouldEqual, 3)
+		So(*hooks[0], ShouldResemble, Webhook{URL: "https://host/a", Events: []string{WebhookJobBuried, WebhookServerBad}})
+		So(*hooks[1], ShouldResemble, Webhook{URL: "http://host/b"})
+		So(*hooks[2], ShouldResemble, Webhook{URL: "http://host/c"})
+		So(hooks[0].wants(WebhookServerBad), ShouldBeTrue)
+		So(hooks[0].wants(WebhookJobComplete), ShouldBeFalse)
+		So(hooks[1].wants(WebhookJobComplete), ShouldBeTrue)
+
+		for _, bad := range []string{"https://host/a", "job_buried=", "=https://host/a", "job_buried=host/a", "job_done=https://host/a"} {
+			_, err = ParseWebhooks(bad)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Jobs can only have absolute http(s) webhook urls", t, func() {
+		So(checkWebhookURL("https://host/a?b=c"), ShouldBeNil)
+		So(checkWebhookURL("http://host:8080"), ShouldBeNil)
+		for _, bad := range []string{"host/a", "/a", "ftp://host/a", "http:///a", "mailto:a@host", "http://host/%zz"} {
+			So(checkWebhookURL(bad), ShouldNotBeNil)
+		}
+
+		job, err := (&JobViaJSON{Cmd: "echo", Webhook: "http://host/hook"}).Convert(&JobDefaults{})
+		So(err, ShouldBeNil)
+		So(job.Webhook, ShouldEqual, "http://host/hook")
+		_, err = (&JobViaJSON{Cmd: "echo", Webhook: "host/hook"}).Convert(&JobDefaults{})
+		So(err, ShouldNotBeNil)
+		_, err = (&JobViaJSON{Cmd: "echo"}).Convert(&JobDefaults{Webhook: "file:///hook"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Only interested webhooks are notified", t, func() {
+		wh := newWebhooks([]*Webhook{{URL: "http://host/a", Events: []string{WebhookJobBuried}}, {URL: "http://host/b"}}, "")
+		So(wh.urls(WebhookJobBuried, ""), ShouldResemble, []string{"http://host/a", "http://host/b"})
+		So(wh.urls(WebhookJobComplete, "http://host/job"), ShouldResemble, []string{"http://host/b", "http://host/job"})
+		So(wh.urls(WebhookJobComplete, "http://host/b"), ShouldResemble, []string{"http://host/b"})
+
+		wh = newWebhooks(nil, "")
+		So(wh.wanted(WebhookServerBad, ""), ShouldBeFalse)
+		So(wh.wanted(WebhookServerBad, "http://host/job"), ShouldBeTrue)
+		wh.notify(&webhookPayload{Event: WebhookServerBad}, "")
+		So(len(wh.deliveries()), ShouldEqual, 0)
+	})
+
+	Convey("Webhooks are POSTed signed payloads, with retries", t, func() {
+		origDelay := webhookRetryDelay
+		webhookRetryDelay = 10 * time.Millisecond
+		defer func() {
+			webhookRetryDelay = origDelay
+		}()
+
+		var mutex sync.Mutex
+		var bodies [][]byte
+		var headers []http.Header
+		failures := 1
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mutex.Lock()
+			defer mutex.Unlock()
+			bodies = append(bodies, body)
+			headers = append(headers, r.Header)
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		secret := "s3cret"
+		wh := newWebhooks([]*Webhook{{URL: server.URL, Events: []string{WebhookJobBuried}}}, secret)
+		stop := make(chan bool)
+		defer close(stop)
+		wh.run(stop)
+
+		waitForDeliveries := func(n int) []*webhookDelivery {
+			limit := time.After(5 * time.Second)
+			for {
+				ds := wh.deliveries()
+				done := len(ds) >= n
+				for _, d := range ds {
+					if !d.Delivered && d.Attempts <= webhookRetries {
+						done = false
+					}
+				}
+				if done {
+					return ds
+				}
+				select {
+				case <-time.After(5 * time.Millisecond):
+				case <-limit:
+					return ds
+				}
+			}
+		}
+
+		wh.notify(&webhookPayload{Event: WebhookJobBuried, RepGroup: "rg", Job: &jstatus{Key: "k1", RepGroup: "rg", State: JobStateBuried}}, "")
+		ds := waitForDeliveries(1)
+		So(len(ds), ShouldEqual, 1)
+		So(ds[0].ID, ShouldEqual, 1)
+		So(ds[0].URL, ShouldEqual, server.URL)
+		So(ds[0].Event, ShouldEqual, WebhookJobBuried)
+		So(ds[0].JobKey, ShouldEqual, "k1")
+		So(ds[0].Delivered, ShouldBeTrue)
+		So(ds[0].Attempts, ShouldEqual, 2)
+		So(ds[0].StatusCode, ShouldEqual, http.StatusNoContent)
+		So(ds[0].Error, ShouldBeEmpty)
+
+		mutex.Lock()
+		So(len(bodies), ShouldEqual, 2)
+		So(bodies[1], ShouldResemble, bodies[0])
+		So(headers[1].Get("X-Wr-Event"), ShouldEqual, WebhookJobBuried)
+		So(headers[1].Get("X-Wr-Delivery"), ShouldEqual, "1")
+		So(headers[1].Get(WebhookSignatureHeader), ShouldEqual, "sha256="+webhookSignature([]byte(secret), bodies[1]))
+		var payload webhookPayload
+		err := json.Unmarshal(bodies[1], &payload)
+		mutex.Unlock()
+		So(err, ShouldBeNil)
+		So(payload.Event, ShouldEqual, WebhookJobBuried)
+		So(payload.RepGroup, ShouldEqual, "rg")
+		So(payload.Job.Key, ShouldEqual, "k1")
+		So(payload.Server, ShouldBeNil)
+		So(payload.Time, ShouldBeGreaterThan, 0)
+
+		Convey("Webhooks that keep failing are given up on", func() {
+			mutex.Lock()
+			failures = webhookRetries + 1
+			mutex.Unlock()
+			wh.notify(&webhookPayload{Event: WebhookRepGroupComplete, RepGroup: "rg"}, server.URL)
+			ds := waitForDeliveries(2)
+			So(len(ds), ShouldEqual, 2)
+			So(ds[0].ID, ShouldEqual, 2)
+			So(ds[0].Event, ShouldEqual, WebhookRepGroupComplete)
+			So(ds[0].Delivered, ShouldBeFalse)
+			So(ds[0].Attempts, ShouldEqual, webhookRetries+1)
+			So(ds[0].StatusCode, ShouldEqual, http.StatusInternalServerError)
+			So(ds[0].Error, ShouldNotBeEmpty)
+			So(ds[1].ID, ShouldEqual, 1)
+		})
+	})
+
+	Convey("Only the most recent deliveries are remembered", t, func() {
+		wh := newWebhooks(nil, "")
+		for i := 0; i < webhookLogSize+5; i++ {
+			wh.record(&webhookDelivery{})
+		}
+		ds := wh.deliveries()
+		So(len(ds), ShouldEqual, webhookLogSize)
+		So(ds[0].ID, ShouldEqual, webhookLogSize+5)
+		So(ds[webhookLogSize-1].ID, ShouldEqual, 6)
+	})
+}
@@ -0,0 +1,462 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+// This file contains the code for declarative workflow definitions: a YAML file
+// of named steps that expands in to the Jobs that would otherwise have to be
+// given to Client.Add() by hand.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// workflowDelimiter separates the workflow name from the step name in the
+// RepGroup and DepGroup we give to the jobs of each step.
+const workflowDelimiter = "."
+
+// Workflow describes a named set of steps, each of which expands in to one or
+// more Jobs. It is normally created by parsing a YAML file with
+// ParseWorkflow().
+//
+// In YAML form it looks like:
+//
+//     name: myworkflow
+//     defaults:
+//       memory: 1G
+//       time: 30m
+//     steps:
+//       - name: align
+//         cmd: bwa mem ref.fa {{.Input}} > {{.Stem}}.sam
+//         glob: /data/*.fq
+//         req_grp: bwa
+//       - name: merge
+//         cmd: samtools merge all.bam *.sam
+//         after: [align]
+//
+// defaults and each step accept all the options that `wr add` accepts in its
+// JSON objects (with the same names), with the step values taking precedence.
+type Workflow struct {
+	Name     string          `json:"name"`
+	Defaults *JobViaJSON     `json:"defaults"`
+	Steps    []*WorkflowStep `json:"steps"`
+}
+
+// WorkflowStep describes one step of a Workflow. Its Cmd (along with any
+// InputFiles and OutputFiles) is a text/template that is executed once per
+// input (those given literally in Inputs plus those matching the Glob) with
+// WorkflowInput as its data. If there are no inputs, the step expands to a
+// single Job. After lists the names of other steps whose Jobs must all complete
+// before this step's Jobs can start.
+type WorkflowStep struct {
+	JobViaJSON
+	Name   string   `json:"name"`
+	Inputs []string `json:"inputs"`
+	Glob   string   `json:"glob"`
+	After  []string `json:"after"`
+}
+
+// WorkflowInput is the data supplied to a WorkflowStep's Cmd template. Index
+// counts from 0, Base is the basename of Input, Stem is Base without its
+// extension and Dir is the directory of Input.
+type WorkflowInput struct {
+	Input string
+	Index int
+	Base  string
+	Stem  string
+	Dir   string
+}
+
+// WorkflowJob is the JobViaJSON for one Job of a Workflow, along with the name
+// of the step it came from.
+type WorkflowJob struct {
+	JobViaJSON
+	Step string
+}
+
+// workflowFuncs lets ArrayIndexPlaceholder and ArrayValuePlaceholder pass
+// through the templating of a WorkflowStep unchanged, so that steps can also
+// be array Jobs.
+var workflowFuncs = template.FuncMap{
+	"index": func() string { return ArrayIndexPlaceholder },
+	"value": func() string { return ArrayValuePlaceholder },
+}
+
+// ParseWorkflow reads a YAML workflow definition from the given file and
+// validates it.
+func ParseWorkflow(path string) (*Workflow, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWorkflowYAML(content)
+}
+
+// ParseWorkflowYAML is like ParseWorkflow(), but takes the YAML content
+// directly.
+func ParseWorkflowYAML(content []byte) (*Workflow, error) {
+	// we unmarshal in to generic values then go via JSON, so that the options
+	// of a step are parsed exactly as they would be by `wr add`
+	var generic interface{}
+	err := yaml.Unmarshal(content, &generic)
+	if err != nil {
+		return nil, fmt.Errorf("workflow is not valid YAML: %s", err)
+	}
+	generic, err = yamlToJSONable(generic)
+	if err != nil {
+		return nil, err
+	}
+	j, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Workflow{}
+	err = json.Unmarshal(j, w)
+	if err != nil {
+		return nil, fmt.Errorf("workflow has bad option values: %s", err)
+	}
+
+	err = w.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return w, err
+}
+
+// yamlToJSONable converts the map[interface{}]interface{} values that yaml
+// creates in to map[string]interface{} so they can be marshalled as JSON.
+func yamlToJSONable(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for key, val := range t {
+			ks, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("workflow contains a non-string key (%v)", key)
+			}
+			jval, err := yamlToJSONable(val)
+			if err != nil {
+				return nil, err
+			}
+			m[ks] = jval
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			jval, err := yamlToJSONable(val)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = jval
+		}
+		return s, nil
+	}
+	return v, nil
+}
+
+// Validate checks that the workflow is named, that its steps have unique names
+// and a cmd, that "after" only refers to other steps, and that there are no
+// circular dependencies between steps.
+func (w *Workflow) Validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("workflow has no name")
+	}
+	if strings.Contains(w.Name, workflowDelimiter) {
+		return fmt.Errorf("workflow name '%s' may not contain '%s'", w.Name, workflowDelimiter)
+	}
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("workflow '%s' has no steps", w.Name)
+	}
+
+	steps := make(map[string]*WorkflowStep)
+	for i, step := range w.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("step %d of workflow '%s' has no name", i+1, w.Name)
+		}
+		if _, exists := steps[step.Name]; exists {
+			return fmt.Errorf("workflow '%s' has more than one step named '%s'", w.Name, step.Name)
+		}
+		if step.Cmd == "" {
+			return fmt.Errorf("step '%s' has no cmd", step.Name)
+		}
+		if _, err := template.New(step.Name).Funcs(workflowFuncs).Parse(step.Cmd); err != nil {
+			return fmt.Errorf("step '%s' has a bad cmd template: %s", step.Name, err)
+		}
+		steps[step.Name] = step
+	}
+
+	for _, step := range w.Steps {
+		for _, after := range step.After {
+			if _, exists := steps[after]; !exists {
+				return fmt.Errorf("step '%s' is after unknown step '%s'", step.Name, after)
+			}
+		}
+	}
+
+	// depth-first search for cycles; 1 means visiting, 2 means done
+	state := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("workflow '%s' has circular steps: %s", w.Name, strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, after := range steps[name].After {
+			if err := visit(after, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, step := range w.Steps {
+		if err := visit(step.Name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StepGroup returns the DepGroup (and default RepGroup) that the Jobs of the
+// given step are given.
+func (w *Workflow) StepGroup(step string) string {
+	return w.Name + workflowDelimiter + step
+}
+
+// Jobs expands the workflow in to Jobs ready to be passed to Client.Add(). The
+// supplied defaults (which can be nil) are overridden by the workflow's own
+// defaults, which are in turn overridden by each step's options.
+//
+// Each step's Jobs always get the DepGroup "[workflow name].[step name]", and
+// depend on the DepGroups of the steps they are after. Their RepGroup defaults
+// to the same value.
+func (w *Workflow) Jobs(jd *JobDefaults) (jobs []*Job, err error) {
+	if jd == nil {
+		jd = &JobDefaults{}
+	}
+	wjs, err := w.JobsViaJSON(jd)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, wj := range wjs {
+		job, errc := wj.Convert(jd)
+		if errc != nil {
+			return nil, fmt.Errorf("step '%s' had a problem: %s", wj.Step, errc)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, err
+}
+
+// JobsViaJSON is like Jobs(), but gives you the options of each Job instead.
+// Calling Convert() on each with the same defaults gives you the Jobs that
+// Jobs() would. Where not otherwise set, the cwd, rep_grp, dep_grps and
+// cmd_deps options are filled in from the supplied defaults, so that these
+// don't depend on the defaults used for the conversion.
+func (w *Workflow) JobsViaJSON(jd *JobDefaults) (wjs []*WorkflowJob, err error) {
+	if jd == nil {
+		jd = &JobDefaults{}
+	}
+	if w.Defaults != nil && w.Defaults.Cmd != "" {
+		return nil, fmt.Errorf("workflow defaults may not specify a cmd")
+	}
+
+	for _, step := range w.Steps {
+		inputs, errs := step.expandInputs()
+		if errs != nil {
+			return nil, errs
+		}
+
+		group := w.StepGroup(step.Name)
+		options := w.stepOptions(step)
+		if options.Cwd == "" {
+			options.Cwd = jd.DefaultCwd()
+		}
+		if options.RepGrp == "" {
+			options.RepGrp = jd.RepGrp
+			if options.RepGrp == "" {
+				options.RepGrp = group
+			}
+		}
+
+		// (we make new slices since they may be shared with the defaults)
+		depGrps := options.DepGrps
+		if len(depGrps) == 0 {
+			depGrps = jd.DepGroups
+		}
+		options.DepGrps = append(append([]string{}, depGrps...), group)
+		if len(options.Deps) == 0 && len(options.CmdDeps) == 0 {
+			options.CmdDeps = jd.Deps
+		}
+		deps := append([]string{}, options.Deps...)
+		for _, after := range step.After {
+			deps = append(deps, w.StepGroup(after))
+		}
+		options.Deps = deps
+
+		tmpl, errt := template.New(step.Name).Funcs(workflowFuncs).Parse(step.Cmd)
+		if errt != nil {
+			return nil, fmt.Errorf("step '%s' has a bad cmd template: %s", step.Name, errt)
+		}
+
+		for _, input := range inputs {
+			var cmd bytes.Buffer
+			err = tmpl.Execute(&cmd, input)
+			if err != nil {
+				return nil, fmt.Errorf("step '%s' cmd could not be expanded for input '%s': %s", step.Name, input.Input, err)
+			}
+
+			wj := &WorkflowJob{JobViaJSON: options, Step: step.Name}
+			wj.Cmd = cmd.String()
+			wj.InputFiles, err = expandPaths(step.InputFiles, input)
+			if err != nil {
+				return nil, fmt.Errorf("step '%s' input_files could not be expanded: %s", step.Name, err)
+			}
+			wj.OutputFiles, err = expandPaths(step.OutputFiles, input)
+			if err != nil {
+				return nil, fmt.Errorf("step '%s' output_files could not be expanded: %s", step.Name, err)
+			}
+			wjs = append(wjs, wj)
+		}
+	}
+
+	return wjs, err
+}
+
+// expandInputs returns the template data for each input of the step, in the
+// order they were listed followed by the sorted glob matches.
+func (step *WorkflowStep) expandInputs() ([]*WorkflowInput, error) {
+	paths := step.Inputs
+	if step.Glob != "" {
+		matches, err := filepath.Glob(step.Glob)
+		if err != nil {
+			return nil, fmt.Errorf("step '%s' has a bad glob: %s", step.Name, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("step '%s' glob [%s] matched no files", step.Name, step.Glob)
+		}
+		sort.Strings(matches)
+		paths = append(paths[:len(paths):len(paths)], matches...)
+	}
+
+	if len(paths) == 0 {
+		return []*WorkflowInput{{}}, nil
+	}
+
+	inputs := make([]*WorkflowInput, len(paths))
+	for i, path := range paths {
+		base := filepath.Base(path)
+		inputs[i] = &WorkflowInput{
+			Input: path,
+			Index: i,
+			Base:  base,
+			Stem:  strings.TrimSuffix(base, filepath.Ext(base)),
+			Dir:   filepath.Dir(path),
+		}
+	}
+	return inputs, nil
+}
+
+// expandPaths executes each of the given paths as a template with the given
+// input as data.
+func expandPaths(paths []string, input *WorkflowInput) (expanded []string, err error) {
+	for _, path := range paths {
+		tmpl, errp := template.New(path).Funcs(workflowFuncs).Parse(path)
+		if errp != nil {
+			return nil, errp
+		}
+		var b bytes.Buffer
+		err = tmpl.Execute(&b, input)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, b.String())
+	}
+	return
+}
+
+// stepOptions returns a copy of the step's options, with any it doesn't set
+// taken from the workflow's defaults. The cmd, array, input_files and
+// output_files of the defaults are ignored, and a step that sets deps or
+// cmd_deps doesn't get either from the defaults, matching how
+// JobViaJSON.Convert() treats its JobDefaults.
+func (w *Workflow) stepOptions(step *WorkflowStep) JobViaJSON {
+	jvj := step.JobViaJSON
+	if w.Defaults == nil {
+		return jvj
+	}
+	d := *w.Defaults
+	d.Cmd, d.Array, d.InputFiles, d.OutputFiles = "", nil, nil, nil
+	if len(jvj.Deps) > 0 || len(jvj.CmdDeps) > 0 {
+		d.Deps, d.CmdDeps = nil, nil
+	}
+
+	sv := reflect.ValueOf(&jvj).Elem()
+	dv := reflect.ValueOf(d)
+	for i := 0; i < sv.NumField(); i++ {
+		if optionUnset(sv.Field(i)) {
+			sv.Field(i).Set(dv.Field(i))
+		}
+	}
+	return jvj
+}
+
+// optionUnset tells you if the given field of a JobViaJSON was not set, in the
+// same sense that JobViaJSON.Convert() uses to decide if it should use a
+// default value instead.
+func optionUnset(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// OptionsJSON returns a JSON object of the options (other than the cmd) that
+// have been set, in the form accepted by `wr add`.
+func (jvj *JobViaJSON) OptionsJSON() ([]byte, error) {
+	opts := make(map[string]interface{})
+	v := reflect.ValueOf(jvj).Elem()
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "cmd" || optionUnset(v.Field(i)) {
+			continue
+		}
+		opts[name] = v.Field(i).Interface()
+	}
+	return json.Marshal(opts)
+}
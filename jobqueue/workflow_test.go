@@ -0,0 +1,223 @@
+// Copyright © 2018 Genome Research Limited
+// Author: Sendu Bala <sb10@sanger.ac.uk>.
+//
+//  This file is part of wr.
+//
+//  wr is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU Lesser General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  wr is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU Lesser General Public License for more details.
+//
+//  You should have received a copy of the GNU Lesser General Public License
+//  along with wr. If not, see <http://www.gnu.org/licenses/>.
+
+package jobqueue
+
+import (
+	"encoding/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWorkflow(t *testing.T) {
+	Convey("You can parse a valid workflow", t, func() {
+		dir, err := ioutil.TempDir("", "wr_jobqueue_test_workflow_dir_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		for _, name := range []string{"b.fq", "a.fq", "c.txt"} {
+			f, errc := os.Create(filepath.Join(dir, name))
+			So(errc, ShouldBeNil)
+			f.Close()
+		}
+
+		wf, err := ParseWorkflowYAML([]byte(`
+name: wgs
+defaults:
+  memory: 2G
+  time: 30m
+  priority: 5
+  env: ["FOO=bar"]
+  on_failure: [{"run": "echo failed"}]
+steps:
+  - name: align
+    cmd: align {{.Input}} > {{.Stem}}.{{.Index}}.sam
+    glob: ` + dir + `/*.fq
+    req_grp: aligner
+  - name: merge
+    cmd: merge *.sam
+    after: [align]
+    priority: 10
+    rep_grp: merging
+  - name: extra
+    cmd: extra {{.Base}} {{.Dir}}
+    inputs: [/x/y.txt]
+    after: [align, merge]
+`))
+		So(err, ShouldBeNil)
+		So(wf.Name, ShouldEqual, "wgs")
+		So(len(wf.Steps), ShouldEqual, 3)
+		So(wf.Steps[2].After, ShouldResemble, []string{"align", "merge"})
+
+		Convey("It expands in to the correct Jobs", func() {
+			jobs, err := wf.Jobs(&JobDefaults{Cwd: "/tmp/wf", Retries: 3})
+			So(err, ShouldBeNil)
+			So(len(jobs), ShouldEqual, 4)
+
+			So(jobs[0].Cmd, ShouldEqual, "align "+dir+"/a.fq > a.0.sam")
+			So(jobs[1].Cmd, ShouldEqual, "align "+dir+"/b.fq > b.1.sam")
+			So(jobs[2].Cmd, ShouldEqual, "merge *.sam")
+			So(jobs[3].Cmd, ShouldEqual, "extra y.txt /x")
+
+			So(jobs[0].Cwd, ShouldEqual, "/tmp/wf")
+			So(jobs[0].ReqGroup, ShouldEqual, "aligner")
+			So(jobs[2].ReqGroup, ShouldEqual, "merge")
+			So(jobs[0].Requirements.RAM, ShouldEqual, 2048)
+			So(jobs[0].Requirements.Time, ShouldEqual, 30*time.Minute)
+			So(jobs[0].Retries, ShouldEqual, 3)
+			So(jobs[0].Priority, ShouldEqual, 5)
+			So(jobs[2].Priority, ShouldEqual, 10)
+			So(len(jobs[0].EnvOverride), ShouldBeGreaterThan, 0)
+			So(len(jobs[0].Behaviours), ShouldEqual, 1)
+
+			So(jobs[0].RepGroup, ShouldEqual, "wgs.align")
+			So(jobs[2].RepGroup, ShouldEqual, "merging")
+			So(jobs[0].DepGroups, ShouldResemble, []string{"wgs.align"})
+			So(jobs[1].DepGroups, ShouldResemble, []string{"wgs.align"})
+			So(jobs[2].DepGroups, ShouldResemble, []string{"wgs.merge"})
+			So(jobs[0].Dependencies.DepGroups(), ShouldBeNil)
+			So(jobs[2].Dependencies.DepGroups(), ShouldResemble, []string{"wgs.align"})
+			So(jobs[3].Dependencies.DepGroups(), ShouldResemble, []string{"wgs.align", "wgs.merge"})
+		})
+
+		Convey("Its dry-run options convert back to the same Jobs", func() {
+			script := filepath.Join(dir, "script.sh")
+			err = ioutil.WriteFile(script, []byte("echo setup\n"), 0600)
+			So(err, ShouldBeNil)
+
+			wf, err = ParseWorkflowYAML([]byte(`
+name: opts
+defaults:
+  cwd_matters: true
+  retry_policy: {"delay": "1m", "retry_exit_codes": [2]}
+  cloud_os: ubuntu
+  cloud_script: ` + script + `
+steps:
+  - name: arr
+    cmd: arr {{.Input}} {{index}}
+    inputs: [/x/a.txt]
+    array: {"start": 1, "end": 3}
+    change_home: true
+    override: 1
+    disk: 2
+    cpus: 0
+    cloud_username: ubuntu
+    cloud_ram: 2048
+    escalation: {"ram_multiplier": 2, "max_ram": "8G"}
+    time_limit: 2.5
+    kill_sequence: "INT:10s,TERM:5s"
+    checkpoint: {"signal": "USR1", "dir": "ckpt"}
+    input_files: ["{{.Input}}"]
+    output_files: ["{{.Stem}}.out"]
+    cache: true
+    webhook: http://example.com/hook
+  - name: after
+    cmd: after
+    after: [arr]
+    deps: [other]
+`))
+			So(err, ShouldBeNil)
+
+			jd := &JobDefaults{Cwd: "/tmp/wf", Retries: 3, DepGroups: []string{"all"}}
+			jobs, err := wf.Jobs(jd)
+			So(err, ShouldBeNil)
+			So(len(jobs), ShouldEqual, 2)
+
+			wjs, err := wf.JobsViaJSON(jd)
+			So(err, ShouldBeNil)
+			So(len(wjs), ShouldEqual, 2)
+
+			var converted []*Job
+			for _, wj := range wjs {
+				opts, errj := wj.OptionsJSON()
+				So(errj, ShouldBeNil)
+				So(string(opts), ShouldNotContainSubstring, `"cmd"`)
+
+				var jvj *JobViaJSON
+				errj = json.Unmarshal(opts, &jvj)
+				So(errj, ShouldBeNil)
+				jvj.Cmd = wj.Cmd
+
+				job, errc := jvj.Convert(&JobDefaults{Retries: 3})
+				So(errc, ShouldBeNil)
+				converted = append(converted, job)
+			}
+			So(converted, ShouldResemble, jobs)
+
+			So(jobs[0].Cwd, ShouldEqual, "/tmp/wf")
+			So(jobs[0].CwdMatters, ShouldBeTrue)
+			So(jobs[0].Array, ShouldNotBeNil)
+			So(jobs[0].Inputs, ShouldResemble, []string{"/x/a.txt"})
+			So(jobs[0].Outputs, ShouldResemble, []string{"a.out"})
+			So(jobs[0].Requirements.Other["cloud_script"], ShouldEqual, "echo setup\n")
+			So(jobs[0].DepGroups, ShouldResemble, []string{"all", "opts.arr"})
+			So(jobs[1].Dependencies.DepGroups(), ShouldResemble, []string{"other", "opts.arr"})
+		})
+	})
+
+	Convey("Invalid workflows are rejected", t, func() {
+		_, err := ParseWorkflowYAML([]byte("steps:\n  - name: a\n    cmd: a\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "no name")
+
+		_, err = ParseWorkflowYAML([]byte("name: w\nsteps:\n  - name: a\n    cmd: a\n  - name: a\n    cmd: b\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "more than one step named 'a'")
+
+		_, err = ParseWorkflowYAML([]byte("name: w\nsteps:\n  - name: a\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "no cmd")
+
+		_, err = ParseWorkflowYAML([]byte("name: w\nsteps:\n  - name: a\n    cmd: a\n    after: [b]\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "unknown step 'b'")
+
+		_, err = ParseWorkflowYAML([]byte("name: w\nsteps:\n  - name: a\n    cmd: a\n    after: [b]\n  - name: b\n    cmd: b\n    after: [a]\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "circular")
+
+		_, err = ParseWorkflowYAML([]byte("name: w\nsteps:\n  - name: a\n    cmd: a {{.Input\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "bad cmd template")
+
+		_, err = ParseWorkflowYAML([]byte("name: w\nsteps:\n  - name: a\n    cmd: a\n    priority: high\n"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "bad option values")
+
+		wf, err := ParseWorkflowYAML([]byte("name: w\ndefaults:\n  cmd: b\nsteps:\n  - name: a\n    cmd: a\n"))
+		So(err, ShouldBeNil)
+		_, err = wf.Jobs(nil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "may not specify a cmd")
+
+		wf, err = ParseWorkflowYAML([]byte("name: w\ndefaults:\n  memory: lots\nsteps:\n  - name: a\n    cmd: a\n"))
+		So(err, ShouldBeNil)
+		_, err = wf.Jobs(nil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "memory value (lots)")
+
+		wf, err = ParseWorkflowYAML([]byte("name: w\nsteps:\n  - name: a\n    cmd: a {{.Input}}\n    glob: /nonexistent/wr/*.foo\n"))
+		So(err, ShouldBeNil)
+		_, err = wf.Jobs(nil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "matched no files")
+	})
+}
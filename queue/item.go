@@ -58,6 +58,10 @@ type Item struct {
 	readyAt       time.Time
 	releaseAt     time.Time
 	creation      time.Time
+	readySince    time.Time
+	shareGroup    string
+	agedPriority  int
+	shareTag      float64
 	dependencies  []string
 	remainingDeps map[string]bool
 	mutex         sync.RWMutex
@@ -37,6 +37,12 @@ the ready queue (bypassing the delay queue) once all its dependencies have been
 Remove()d from the queue. Items can also belong to a reservation group, in which
 case you can Reserve() an item in a desired group.
 
+Optionally, items in the ready queue can be shared fairly between share groups
+(eg. the users that added them), so that many items added by one group don't
+block the later items of other groups with the same priority; see
+SetFairShare(). Items can also have their priority increase the longer they
+wait in the ready queue; see SetPriorityAging().
+
 In the run queue the item starts a time-to-release (ttr) countdown; when that
 runs out the item is placed back on the ready queue. This is to handle a
 process Reserving an item but then crashing before it deals with the item;
@@ -134,6 +140,19 @@ type ReadyAddedCallback func(queuename string, allitemdata []interface{})
 // leaving the queue, `to` will be SubQueueRemoved.
 type ChangedCallback func(from, to SubQueue, data []interface{})
 
+// ShareCallback is used as a callback to find out which share group an item
+// belongs to (based on its data) and the weight of that group, when fair share
+// ordering is on. Groups with twice the weight get twice as many of their items
+// Reserve()d. Weights of 0 or less are treated as 1.
+type ShareCallback func(data interface{}) (group string, weight float64)
+
+// ReserveFilter is used as a callback by Reserve() to find out if an item (based
+// on its data) may be reserved right now. Items it returns false for are left
+// where they are in the ready sub-queue, and the next item is considered
+// instead. It is called while the queue is locked, so must not call any of the
+// queue's methods.
+type ReserveFilter func(data interface{}) bool
+
 // TTRCallback is used as a callback to decide which sub-queue an item should
 // move to when a an item in the run sub-queue hits its TTR, based on that
 // item's data. Valid return values are SubQueueDelay, SubQueueReady and
@@ -172,6 +191,8 @@ type Queue struct {
 	readyAddedCb           ReadyAddedCallback
 	changedCb              ChangedCallback
 	ttrCb                  TTRCallback
+	reserveFilter          ReserveFilter
+	agingClose             chan bool
 }
 
 // Stats holds information about the Queue's state.
@@ -226,7 +247,8 @@ func New(name string) *Queue {
 // SetReadyAddedCallback sets a callback that will be called when new items have
 // been added to the ready sub-queue. The callback will receive the name of the
 // queue, and a slice of the Data properties of every item currently in the
-// ready sub-queue. The callback will be initiated in a go routine.
+// ready sub-queue, in the order they would be Reserve()d were they all in the
+// same reserve group. The callback will be initiated in a go routine.
 func (queue *Queue) SetReadyAddedCallback(callback ReadyAddedCallback) {
 	queue.readyAddedCb = callback
 }
@@ -244,10 +266,8 @@ func (queue *Queue) readyAdded() {
 	if queue.readyAddedCb != nil {
 		queue.mutex.RLock()
 		var data []interface{}
-		for _, il := range queue.readyQueue.groupedItems {
-			for _, item := range il {
-				data = append(data, item.Data)
-			}
+		for _, item := range queue.readyQueue.reserveOrder() {
+			data = append(data, item.Data)
 		}
 		queue.mutex.RUnlock()
 		go queue.readyAddedCb(queue.Name, data)
@@ -286,6 +306,56 @@ func (queue *Queue) SetTTRCallback(callback TTRCallback) {
 	queue.ttrCb = callback
 }
 
+// SetReserveFilter sets a callback that Reserve() will consult before returning
+// an item, letting you skip over items that shouldn't be reserved right now
+// (eg. because they would use more than some allowance of resources) without
+// changing their place in the queue. Once the filter has rejected every item
+// in a reserve group, Reserve() won't consider that group again until an item
+// is added to it or you call ReserveFilterChanged().
+func (queue *Queue) SetReserveFilter(filter ReserveFilter) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.reserveFilter = filter
+	queue.readyQueue.unblockFiltered()
+}
+
+// ReserveFilterChanged tells the queue that your ReserveFilter may now accept
+// items that it previously rejected.
+func (queue *Queue) ReserveFilterChanged() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.readyQueue.unblockFiltered()
+}
+
+// SetFairShare turns on fair share ordering of the ready sub-queue: amongst
+// items with the same priority, instead of strict fifo order, Reserve() will
+// interleave the items of different share groups in proportion to their
+// weights, as determined by the supplied callback when items become ready.
+// Within a share group, items remain in fifo order. Only affects items that
+// become ready after this call.
+func (queue *Queue) SetFairShare(callback ShareCallback) {
+	queue.readyQueue.setShareCallback(callback)
+}
+
+// SetPriorityAging causes items in the ready sub-queue to have their priority
+// (for the purposes of deciding which item Reserve() returns next) increased by
+// 1 for every interval they have spent waiting there, so that long-waiting low
+// priority items eventually get their turn. Items' priorities are re-assessed
+// every quarter interval.
+func (queue *Queue) SetPriorityAging(interval time.Duration) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	if queue.closed || interval <= 0 {
+		return
+	}
+	queue.readyQueue.setAging(interval)
+	if queue.agingClose != nil {
+		close(queue.agingClose)
+	}
+	queue.agingClose = make(chan bool)
+	go queue.startAgingProcessing(interval, queue.agingClose)
+}
+
 // Destroy shuts down a queue, destroying any contents. You can't do anything
 // useful with it after that.
 func (queue *Queue) Destroy() (err error) {
@@ -299,6 +369,9 @@ func (queue *Queue) Destroy() (err error) {
 
 	queue.ttrClose <- true
 	queue.delayClose <- true
+	if queue.agingClose != nil {
+		close(queue.agingClose)
+	}
 	queue.items = nil
 	queue.delayQueue.empty()
 	queue.readyQueue.empty()
@@ -734,7 +807,11 @@ func (queue *Queue) Reserve(reserveGroup ...string) (item *Item, err error) {
 	}
 
 	// pop an item from the ready queue and add it to the run queue
-	item = queue.readyQueue.pop(group)
+	if queue.reserveFilter != nil {
+		item = queue.readyQueue.popFiltered(queue.reserveFilter, group)
+	} else {
+		item = queue.readyQueue.pop(group)
+	}
 	if item == nil {
 		queue.mutex.Unlock()
 		err = Error{queue.Name, "Reserve", "", ErrNothingReady}
@@ -1065,6 +1142,21 @@ func (queue *Queue) startDelayProcessing() {
 	}
 }
 
+func (queue *Queue) startAgingProcessing(interval time.Duration, stop chan bool) {
+	ticker := time.NewTicker(interval / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			queue.mutex.Lock()
+			queue.readyQueue.age()
+			queue.mutex.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
 func (queue *Queue) delayNotificationTrigger(item *Item) {
 	queue.mutex.RLock()
 	if queue.delayTime.After(time.Now().Add(item.delay)) {
@@ -1125,6 +1125,92 @@ func TestQueue(t *testing.T) {
 		})
 	})
 
+	Convey("A reserve filter lets you skip over items without reordering them", t, func() {
+		q := New("myqueue")
+		defer q.Destroy()
+
+		for i, data := range []string{"a", "b", "a", "b"} {
+			_, err := q.Add(fmt.Sprintf("key_%d", i), "", data, 0, 0*time.Second, 1*time.Minute)
+			So(err, ShouldBeNil)
+		}
+
+		allowA := true
+		calls := 0
+		q.SetReserveFilter(func(data interface{}) bool {
+			calls++
+			return allowA || data.(string) != "a"
+		})
+
+		item, err := q.Reserve()
+		So(err, ShouldBeNil)
+		So(item.Key, ShouldEqual, "key_0")
+
+		allowA = false
+		item, err = q.Reserve()
+		So(err, ShouldBeNil)
+		So(item.Key, ShouldEqual, "key_1")
+		item, err = q.Reserve()
+		So(err, ShouldBeNil)
+		So(item.Key, ShouldEqual, "key_3")
+		_, err = q.Reserve()
+		So(err, ShouldNotBeNil)
+		qerr, ok := err.(Error)
+		So(ok, ShouldBeTrue)
+		So(qerr.Err, ShouldEqual, ErrNothingReady)
+		So(q.Stats().Ready, ShouldEqual, 1)
+
+		// having rejected everything, it doesn't bother asking again until
+		// told things have changed
+		calls = 0
+		allowA = true
+		_, err = q.Reserve()
+		So(err, ShouldNotBeNil)
+		So(calls, ShouldEqual, 0)
+
+		q.ReserveFilterChanged()
+		item, err = q.Reserve()
+		So(err, ShouldBeNil)
+		So(item.Key, ShouldEqual, "key_2")
+		So(calls, ShouldEqual, 1)
+
+		Convey("Adding an item also makes it reconsider", func() {
+			allowA = false
+			_, err = q.Add("key_4", "", "a", 0, 0*time.Second, 1*time.Minute)
+			So(err, ShouldBeNil)
+			_, err = q.Reserve()
+			So(err, ShouldNotBeNil)
+			allowA = true
+			_, err = q.Add("key_5", "", "b", 0, 0*time.Second, 1*time.Minute)
+			So(err, ShouldBeNil)
+			item, err = q.Reserve()
+			So(err, ShouldBeNil)
+			So(item.Key, ShouldEqual, "key_4")
+		})
+	})
+
+	Convey("The ready added callback gets items in the order they'd be reserved", t, func() {
+		q := New("myqueue")
+		defer q.Destroy()
+
+		order := make(chan []string, 1)
+		q.SetReadyAddedCallback(func(queuename string, allitemdata []interface{}) {
+			var datas []string
+			for _, data := range allitemdata {
+				datas = append(datas, data.(string))
+			}
+			order <- datas
+		})
+		_, err := q.Add("key_0", "", "low", 0, 0*time.Second, 1*time.Minute)
+		So(err, ShouldBeNil)
+		<-order
+		_, err = q.Add("key_1", "group", "high", 2, 0*time.Second, 1*time.Minute)
+		So(err, ShouldBeNil)
+		<-order
+		_, err = q.Add("key_2", "", "mid", 1, 0*time.Second, 1*time.Minute)
+		So(err, ShouldBeNil)
+		So(<-order, ShouldResemble, []string{"high", "mid", "low"})
+	})
+
 	Convey("Once some items with dependencies have been added to the queue", t, func() {
 		// https://i-msdn.sec.s-msft.com/dynimg/IC332764.gif
 		queue := New("dep queue")
@@ -190,6 +190,92 @@ func TestReadyQueue(t *testing.T) {
 			So(queue.len(), ShouldEqual, 0)
 		})
 	})
+
+	Convey("With fair share on, items of different share groups are interleaved by weight", t, func() {
+		queue := newSubQueue(1)
+		queue.setShareCallback(func(data interface{}) (string, float64) {
+			group := data.(string)
+			if group == "b" {
+				return group, 2
+			}
+			return group, 1
+		})
+
+		for i := 0; i < 6; i++ {
+			queue.push(newItem(fmt.Sprintf("a_%d", i), "", "a", 0, 0*time.Second, 0*time.Second))
+		}
+		So(queue.pop().Key, ShouldEqual, "a_0")
+
+		// b's items arrive later, but don't have to wait for all of a's; with
+		// twice the weight, b gets 2 items for every 1 of a's
+		for i := 0; i < 4; i++ {
+			queue.push(newItem(fmt.Sprintf("b_%d", i), "", "b", 0, 0*time.Second, 0*time.Second))
+		}
+		var order []string
+		for {
+			item := queue.pop()
+			if item == nil {
+				break
+			}
+			order = append(order, item.Key)
+		}
+		So(order, ShouldResemble, []string{"b_0", "a_1", "b_1", "b_2", "a_2", "b_3", "a_3", "a_4", "a_5"})
+		So(len(queue.shareFinish), ShouldEqual, 0)
+
+		Convey("Priority still comes first", func() {
+			queue.push(newItem("a_low", "", "a", 0, 0*time.Second, 0*time.Second))
+			queue.push(newItem("b_high", "", "b", 1, 0*time.Second, 0*time.Second))
+			queue.push(newItem("a_high", "", "a", 1, 0*time.Second, 0*time.Second))
+			So(queue.pop().Key, ShouldEqual, "b_high")
+			So(queue.pop().Key, ShouldEqual, "a_high")
+			So(queue.pop().Key, ShouldEqual, "a_low")
+		})
+
+		Convey("Removed items don't penalise their group", func() {
+			var removed []*Item
+			for i := 0; i < 5; i++ {
+				item := newItem(fmt.Sprintf("a_%d", i), "", "a", 0, 0*time.Second, 0*time.Second)
+				queue.push(item)
+				removed = append(removed, item)
+			}
+			for _, item := range removed {
+				queue.remove(item)
+			}
+			queue.push(newItem("b_0", "", "b", 0, 0*time.Second, 0*time.Second))
+			queue.push(newItem("a_new", "", "a", 0, 0*time.Second, 0*time.Second))
+			So(queue.pop().Key, ShouldEqual, "b_0")
+			So(queue.pop().Key, ShouldEqual, "a_new")
+		})
+	})
+
+	Convey("With priority aging on, long waiting items rise in priority", t, func() {
+		queue := newSubQueue(1)
+		queue.setAging(50 * time.Millisecond)
+		old := newItem("old", "", "data", 0, 0*time.Second, 0*time.Second)
+		queue.push(old)
+		<-time.After(110 * time.Millisecond)
+		queue.push(newItem("new", "", "data", 1, 0*time.Second, 0*time.Second))
+
+		So(queue.pop().Key, ShouldEqual, "new")
+		queue.push(newItem("new2", "", "data", 1, 0*time.Second, 0*time.Second))
+		queue.age()
+		So(old.agedPriority, ShouldEqual, 2)
+		So(queue.pop().Key, ShouldEqual, "old")
+		So(queue.pop().Key, ShouldEqual, "new2")
+
+		Convey("Items whose aged priority changes are moved individually", func() {
+			old = newItem("old", "", "data", 0, 0*time.Second, 0*time.Second)
+			queue.push(old)
+			<-time.After(110 * time.Millisecond)
+			for i := 0; i < 8; i++ {
+				queue.push(newItem(fmt.Sprintf("new_%d", i), "", "data", 1, 0*time.Second, 0*time.Second))
+			}
+			queue.age()
+			So(old.agedPriority, ShouldEqual, 2)
+			So(queue.pop().Key, ShouldEqual, "old")
+			So(queue.pop().Key, ShouldEqual, "new_0")
+		})
+	})
 }
 
 // func BenchmarkReadyQueue(b *testing.B) {
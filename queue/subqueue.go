@@ -23,7 +23,9 @@ package queue
 
 import (
 	"container/heap"
+	"sort"
 	"sync"
+	"time"
 )
 
 type subQueue struct {
@@ -32,6 +34,17 @@ type subQueue struct {
 	groupedItems map[string][]*Item
 	sqIndex      int
 	reserveGroup string
+
+	// the following are only used by the ready sub-queue, for fair share
+	// ordering and priority aging
+	shareCb     ShareCallback
+	shareFinish map[string]float64
+	shareCount  map[string]int
+	shareClock  float64
+	aging       time.Duration
+
+	// reserve groups whose items were all rejected by popFiltered()
+	filterBlocked map[string]bool
 }
 
 // create a new subQueue that can hold *Items in "priority" order. sqIndex is
@@ -41,6 +54,9 @@ func newSubQueue(sqIndex int) *subQueue {
 	queue := &subQueue{sqIndex: sqIndex}
 	if sqIndex == 1 {
 		queue.groupedItems = make(map[string][]*Item)
+		queue.shareFinish = make(map[string]float64)
+		queue.shareCount = make(map[string]int)
+		queue.filterBlocked = make(map[string]bool)
 	}
 	heap.Init(queue)
 	return queue
@@ -52,10 +68,114 @@ func (q *subQueue) push(item *Item) {
 	defer q.mutex.Unlock()
 	if q.sqIndex == 1 {
 		q.reserveGroup = item.ReserveGroup
+		item.readySince = time.Now()
+		item.agedPriority = q.agedPriority(item)
+		q.shareTag(item)
+		delete(q.filterBlocked, item.ReserveGroup)
 	}
 	heap.Push(q, item)
 }
 
+// agedPriority returns the item's priority, boosted by 1 for every aging
+// interval it has been in the ready sub-queue.
+func (q *subQueue) agedPriority(item *Item) int {
+	item.mutex.RLock()
+	defer item.mutex.RUnlock()
+	p := int(item.priority)
+	if q.aging > 0 {
+		p += int(time.Since(item.readySince) / q.aging)
+	}
+	return p
+}
+
+// shareTag gives an item entering the ready sub-queue its place amongst the
+// items of other share groups. This is weighted fair queueing: each item gets a
+// virtual finish time that is 1/weight after that of the previous item in its
+// group, or after the virtual time of the most recently reserved item if its
+// group has no other ready items. Ordering by these tags interleaves the items
+// of different share groups in proportion to their weights, regardless of when
+// they were added.
+func (q *subQueue) shareTag(item *Item) {
+	if q.shareCb == nil {
+		item.shareTag = 0
+		return
+	}
+	var weight float64
+	item.shareGroup, weight = q.shareCb(item.Data)
+	if weight <= 0 {
+		weight = 1
+	}
+	start := q.shareClock
+	if finish, exists := q.shareFinish[item.shareGroup]; exists && finish > start {
+		start = finish
+	}
+	item.shareTag = start + 1/weight
+	q.shareFinish[item.shareGroup] = item.shareTag
+	q.shareCount[item.shareGroup]++
+}
+
+// shareDone is called when an item leaves the ready sub-queue, so that groups
+// that no longer have any ready items don't keep a finish time that would
+// penalise their future items. If the item was reserved, the virtual time
+// moves on to its tag.
+func (q *subQueue) shareDone(item *Item, reserved bool) {
+	if q.shareCb == nil || item.shareTag == 0 {
+		return
+	}
+	if reserved && item.shareTag > q.shareClock {
+		q.shareClock = item.shareTag
+	}
+	q.shareCount[item.shareGroup]--
+	if q.shareCount[item.shareGroup] <= 0 {
+		delete(q.shareCount, item.shareGroup)
+		delete(q.shareFinish, item.shareGroup)
+	}
+}
+
+// setShareCallback turns on fair share ordering. It only affects items pushed
+// after this call.
+func (q *subQueue) setShareCallback(callback ShareCallback) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.shareCb = callback
+}
+
+// setAging turns on priority aging. It takes effect for existing items the
+// next time age() is called.
+func (q *subQueue) setAging(interval time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.aging = interval
+}
+
+// age recalculates the aged priorities of all items in the queue, and reorders
+// the items of reserve groups where any changed. If only a few items changed,
+// they are moved individually instead of the whole group being reordered.
+func (q *subQueue) age() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for group, itemList := range q.groupedItems {
+		var changed []*Item
+		for _, item := range itemList {
+			if p := q.agedPriority(item); p != item.agedPriority {
+				item.agedPriority = p
+				changed = append(changed, item)
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		q.reserveGroup = group
+		if len(changed) > len(itemList)/4 {
+			heap.Init(q)
+			continue
+		}
+		for _, item := range changed {
+			heap.Fix(q, item.queueIndexes[q.sqIndex])
+		}
+	}
+}
+
 // pop removes the next item from the queue according to its "priority"
 func (q *subQueue) pop(reserveGroup ...string) *Item {
 	q.mutex.Lock()
@@ -77,7 +197,80 @@ func (q *subQueue) pop(reserveGroup ...string) *Item {
 	if len(itemList) == 0 {
 		return nil
 	}
-	return heap.Pop(q).(*Item)
+	item := heap.Pop(q).(*Item)
+	if q.sqIndex == 1 {
+		q.shareDone(item, true)
+	}
+	return item
+}
+
+// popFiltered is like pop(), but for the ready sub-queue returns the first
+// item in "priority" order whose data the filter accepts. Rejected items keep
+// their place in the queue. If the filter rejects every item in the reserve
+// group, the group is skipped by subsequent calls until an item is added to it
+// or unblockFiltered() is called, so that we don't keep going through all its
+// items for nothing.
+func (q *subQueue) popFiltered(filter ReserveFilter, reserveGroup ...string) *Item {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var group string
+	if len(reserveGroup) == 1 {
+		group = reserveGroup[0]
+	}
+	if q.filterBlocked[group] {
+		return nil
+	}
+	q.reserveGroup = group
+
+	var item *Item
+	var rejected []*Item
+	for len(q.groupedItems[group]) > 0 {
+		candidate := heap.Pop(q).(*Item)
+		if filter(candidate.Data) {
+			item = candidate
+			break
+		}
+		rejected = append(rejected, candidate)
+	}
+
+	// (we push the rejected items back directly, since they haven't really
+	// left the sub-queue and so should keep their fair share tags and aged
+	// priorities)
+	for _, r := range rejected {
+		heap.Push(q, r)
+	}
+
+	if item != nil {
+		q.shareDone(item, true)
+	} else if len(rejected) > 0 {
+		q.filterBlocked[group] = true
+	}
+	return item
+}
+
+// unblockFiltered lets popFiltered() consider reserve groups again after it
+// found the filter rejected all their items.
+func (q *subQueue) unblockFiltered() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.filterBlocked) > 0 {
+		q.filterBlocked = make(map[string]bool)
+	}
+}
+
+// reserveOrder returns all the items in the ready sub-queue, in the order they
+// would be reserved were they all in the same reserve group.
+func (q *subQueue) reserveOrder() []*Item {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	var items []*Item
+	for _, il := range q.groupedItems {
+		items = append(items, il...)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return readyBefore(items[i], items[j])
+	})
+	return items
 }
 
 // remove removes a given item from the queue
@@ -86,6 +279,7 @@ func (q *subQueue) remove(item *Item) {
 	defer q.mutex.Unlock()
 	if q.sqIndex == 1 {
 		q.reserveGroup = item.ReserveGroup
+		q.shareDone(item, false)
 	}
 	heap.Remove(q, item.queueIndexes[q.sqIndex])
 }
@@ -134,8 +328,13 @@ func (q *subQueue) update(item *Item, oldGroup ...string) {
 		heap.Remove(q, item.queueIndexes[q.sqIndex])
 		q.reserveGroup = item.ReserveGroup
 		heap.Push(q, item)
+		delete(q.filterBlocked, item.ReserveGroup)
 		return
 	}
+	if q.sqIndex == 1 {
+		q.reserveGroup = item.ReserveGroup
+		item.agedPriority = q.agedPriority(item)
+	}
 	heap.Fix(q, item.queueIndexes[q.sqIndex])
 }
 
@@ -145,6 +344,10 @@ func (q *subQueue) empty() {
 	defer q.mutex.Unlock()
 	if q.sqIndex == 1 {
 		q.groupedItems = make(map[string][]*Item)
+		q.shareFinish = make(map[string]float64)
+		q.shareCount = make(map[string]int)
+		q.shareClock = 0
+		q.filterBlocked = make(map[string]bool)
 	} else {
 		q.items = nil
 	}
@@ -167,16 +370,25 @@ func (q *subQueue) Len() int {
 	return len(itemList)
 }
 
+// readyBefore tells you if item a would be reserved before item b, were they in
+// the same reserve group of the ready sub-queue.
+func readyBefore(a, b *Item) bool {
+	if a.agedPriority != b.agedPriority {
+		return a.agedPriority > b.agedPriority
+	}
+	if a.shareTag != b.shareTag {
+		return a.shareTag < b.shareTag
+	}
+	return a.creation.Before(b.creation)
+}
+
 func (q *subQueue) Less(i, j int) bool {
 	switch q.sqIndex {
 	case 0:
 		return q.items[i].readyAt.Before(q.items[j].readyAt)
 	case 1:
 		if itemList, existed := q.groupedItems[q.reserveGroup]; existed {
-			if itemList[i].priority == itemList[j].priority {
-				return itemList[i].creation.Before(itemList[j].creation)
-			}
-			return itemList[i].priority > itemList[j].priority
+			return readyBefore(itemList[i], itemList[j])
 		}
 		return false
 	}